@@ -4,8 +4,12 @@ go 1.13
 
 require (
 	cloud.google.com/go/storage v1.5.0
+	github.com/Azure/azure-storage-blob-go v0.13.0
 	github.com/aws/aws-sdk-go v1.28.10
 	github.com/fsouza/fake-gcs-server v1.17.0
 	github.com/johannesboyne/gofakes3 v0.0.0-20191228161223-9aee1c78a252
+	github.com/pkg/sftp v1.13.5
+	github.com/prometheus/client_golang v1.4.0
+	golang.org/x/crypto v0.0.0-20211215153901-e495a2d5b3d3
 	google.golang.org/api v0.16.0
 )
@@ -0,0 +1,372 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package archiveprovider
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"github.com/contentsquare/gospal/gospal"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// size of the blocks fetched from the archive by ranged reads
+const blockSize = 1024 * 1024
+
+// member is a file of the archive
+type member struct {
+	info *gospal.ObjectInfo
+	// offset of the data of the uncompressed tar members within the archive, -1 when the member has to be reached by
+	// reading the archive from the start
+	offset int64
+	// the zip members are read through the central directory
+	zip *zipMember
+	// number of the previous tar members of the same name
+	occurrence int
+}
+
+// index holds the members of the archive by name, along with their sorted names
+type index struct {
+	members map[string]*member
+	names   []string
+}
+
+func newIndex() *index {
+	return &index{members: map[string]*member{}}
+}
+
+// add indexes the member under its cleaned name. Directories and the names escaping the archive are ignored, a name
+// added again replaces the previous member as tar does on extraction
+func (idx *index) add(name string, m *member) {
+	name = memberName(name)
+	if name == "" {
+		return
+	}
+	if previous, ok := idx.members[name]; ok {
+		m.occurrence = previous.occurrence + 1
+	} else {
+		idx.names = append(idx.names, name)
+	}
+	m.info.Key = name
+	idx.members[name] = m
+}
+
+func (idx *index) sort() {
+	sort.Strings(idx.names)
+}
+
+// memberName returns the key of the named file of the archive, or an empty string when the file can not be a key
+func memberName(name string) string {
+	if strings.HasSuffix(name, "/") {
+		return ""
+	}
+	name = path.Clean("/" + name)[1:]
+	if name == "" || name == "." {
+		return ""
+	}
+	return name
+}
+
+// zipMember locates a member in the central directory of the zip archive
+type zipMember struct {
+	// position of the member in the central directory
+	position int
+	method   uint16
+
+	mu sync.Mutex
+	// offset of the data of the member within the archive, 0 until read from its local header
+	dataOffset int64
+}
+
+// zipArchive reads the members of a zip archive. The central directory read by the index is kept in memory, each read
+// parsing it again over a reader of the archive bound to the context of the read
+type zipArchive struct {
+	source gospal.Gospal
+	key    string
+	size   int64
+	// directory holds the end of the archive from the offset on, the central directory included
+	directory []byte
+	offset    int64
+}
+
+// file returns the member from the central directory, read over a reader bound to the context
+func (a *zipArchive) file(ctx context.Context, m *zipMember) (*zip.File, error) {
+	archive := &directoryReaderAt{
+		ReaderAt:  &blockReaderAt{ctx: ctx, provider: a.source, key: a.key, size: a.size},
+		directory: a.directory,
+		offset:    a.offset,
+	}
+	reader, err := zip.NewReader(archive, a.size)
+	if err != nil {
+		return nil, err
+	}
+	if m.position >= len(reader.File) {
+		// the archive has changed since it has been indexed
+		return nil, fmt.Errorf("unexpected central directory of %v", a.key)
+	}
+	return reader.File[m.position], nil
+}
+
+// directoryReaderAt serves the reads of the end of the archive from the central directory kept in memory
+type directoryReaderAt struct {
+	io.ReaderAt
+	directory []byte
+	offset    int64
+}
+
+func (r *directoryReaderAt) ReadAt(b []byte, offset int64) (int, error) {
+	n := 0
+	if offset < r.offset {
+		head := b
+		if offset+int64(len(head)) > r.offset {
+			head = head[:r.offset-offset]
+		}
+		var err error
+		if n, err = r.ReaderAt.ReadAt(head, offset); n < len(head) {
+			return n, err
+		}
+		offset += int64(n)
+	}
+	if n == len(b) {
+		return n, nil
+	}
+	if offset-r.offset >= int64(len(r.directory)) {
+		return n, io.EOF
+	}
+	copied := copy(b[n:], r.directory[offset-r.offset:])
+	if n += copied; n < len(b) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// lowestReaderAt records the lowest offset read
+type lowestReaderAt struct {
+	io.ReaderAt
+	lowest int64
+}
+
+func (r *lowestReaderAt) ReadAt(b []byte, offset int64) (int, error) {
+	if offset < r.lowest {
+		r.lowest = offset
+	}
+	return r.ReaderAt.ReadAt(b, offset)
+}
+
+// blockReaderAt reads the archive by ranged reads of whole blocks, keeping the last block read. The small sequential
+// reads of the zip and tar readers are then served from the same block. It is bound to the context of a single read,
+// or of the indexing
+type blockReaderAt struct {
+	ctx      context.Context
+	provider gospal.Gospal
+	key      string
+	size     int64
+
+	mu     sync.Mutex
+	offset int64
+	block  []byte
+}
+
+func (r *blockReaderAt) ReadAt(b []byte, offset int64) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := 0
+	for n < len(b) {
+		if offset >= r.size {
+			return n, io.EOF
+		}
+		if offset < r.offset || offset >= r.offset+int64(len(r.block)) {
+			if err := r.fetch(offset, int64(len(b)-n)); err != nil {
+				return n, err
+			}
+		}
+		copied := copy(b[n:], r.block[offset-r.offset:])
+		n += copied
+		offset += int64(copied)
+	}
+	return n, nil
+}
+
+// fetch reads the block starting at offset, at least length bytes long unless past the end of the archive
+func (r *blockReaderAt) fetch(offset int64, length int64) error {
+	if length < blockSize {
+		length = blockSize
+	}
+	if offset+length > r.size {
+		length = r.size - offset
+	}
+	stream, cancel, err := r.provider.GetRangeContext(r.ctx, r.key, offset, length)
+	if err != nil {
+		return err
+	}
+	defer cancel()
+	block := make([]byte, length)
+	if _, err := io.ReadFull(stream, block); err != nil {
+		return err
+	}
+	r.offset, r.block = offset, block
+	return nil
+}
+
+// indexZip indexes the members of the central directory of the zip archive, which is kept in memory for the reads
+func indexZip(archive *blockReaderAt) (*index, *zipArchive, error) {
+	recorder := &lowestReaderAt{ReaderAt: archive, lowest: archive.size}
+	reader, err := zip.NewReader(recorder, archive.size)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the reader only reads the end of the archive, from the central directory on
+	directory := make([]byte, archive.size-recorder.lowest)
+	if _, err := archive.ReadAt(directory, recorder.lowest); err != nil {
+		return nil, nil, err
+	}
+	idx := newIndex()
+	for position, file := range reader.File {
+		idx.add(file.Name, &member{
+			info: &gospal.ObjectInfo{
+				Size:         int64(file.UncompressedSize64),
+				LastModified: file.Modified,
+			},
+			offset: -1,
+			zip:    &zipMember{position: position, method: file.Method},
+		})
+	}
+	idx.sort()
+	return idx, &zipArchive{
+		source:    archive.provider,
+		key:       archive.key,
+		size:      archive.size,
+		directory: directory,
+		offset:    recorder.lowest,
+	}, nil
+}
+
+// indexTar indexes the members of the tar archive by walking its headers. The data of the members is skipped over,
+// the archive being read by blocks only the headers are fetched from large archives
+func indexTar(archive *blockReaderAt) (*index, error) {
+	section := io.NewSectionReader(archive, 0, archive.size)
+	return walkTar(section, func() int64 {
+		offset, _ := section.Seek(0, io.SeekCurrent)
+		return offset
+	})
+}
+
+// indexTarGzip indexes the members of the compressed tar archive. The archive has to be read and uncompressed as a
+// whole, and so will be the reads of its members
+func indexTarGzip(ctx context.Context, provider gospal.Gospal, key string) (*index, error) {
+	reader, err := provider.NewReader(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	gzipReader, err := gzip.NewReader(reader)
+	if err != nil {
+		return nil, err
+	}
+	return walkTar(gzipReader, func() int64 { return -1 })
+}
+
+// walkTar indexes the regular files of the tar stream, offset returning the position of the data of the current
+// member in the archive
+func walkTar(reader io.Reader, offset func() int64) (*index, error) {
+	tarReader := tar.NewReader(reader)
+	idx := newIndex()
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !isFile(header) {
+			continue
+		}
+		m := &member{
+			info: &gospal.ObjectInfo{
+				Size:         header.Size,
+				LastModified: header.ModTime,
+			},
+			offset: offset(),
+		}
+		if isSparse(header) {
+			// the data of sparse files is not stored as is
+			m.offset = -1
+		}
+		idx.add(header.Name, m)
+	}
+	idx.sort()
+	return idx, nil
+}
+
+// isFile tells whether the tar member is a regular file, the other members are not keys
+func isFile(header *tar.Header) bool {
+	return header.Typeflag == tar.TypeReg || header.Typeflag == tar.TypeRegA || header.Typeflag == tar.TypeGNUSparse
+}
+
+// isSparse tells whether the tar member is a sparse file, either of the GNU or of the PAX format
+func isSparse(header *tar.Header) bool {
+	if header.Typeflag == tar.TypeGNUSparse {
+		return true
+	}
+	for name := range header.PAXRecords {
+		if strings.HasPrefix(name, "GNU.sparse.") {
+			return true
+		}
+	}
+	return false
+}
+
+// scanTar returns the reader of the member, reading the archive from the start. The reader closes the archive
+func scanTar(ctx context.Context, provider gospal.Gospal, key string, gzipped bool, m *member) (io.ReadCloser, error) {
+	reader, err := provider.NewReader(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	var stream io.Reader = reader
+	if gzipped {
+		if stream, err = gzip.NewReader(reader); err != nil {
+			reader.Close()
+			return nil, err
+		}
+	}
+	tarReader := tar.NewReader(stream)
+	skipped := 0
+	for {
+		header, err := tarReader.Next()
+		if err != nil {
+			reader.Close()
+			if err == io.EOF {
+				// the archive has changed since it has been indexed
+				err = noSuchMember(m.info.Key, key)
+			}
+			return nil, err
+		}
+		if !isFile(header) || memberName(header.Name) != m.info.Key {
+			continue
+		}
+		// the member replaces the previous ones of the same name
+		if skipped == m.occurrence {
+			return gospal.NewReadCloser(tarReader, reader, nil), nil
+		}
+		skipped++
+	}
+}
@@ -0,0 +1,100 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package archiveprovider
+
+import (
+	"context"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"sort"
+	"strings"
+)
+
+// default number of objects per page when ProviderConfig.MaxKeys is not set
+const defaultMaxKeys = 1024
+
+// objectIterator lists the indexed members one page of sorted names at a time, the page token is the key of the last
+// object of the previous page
+type objectIterator struct {
+	ctx          context.Context
+	p            *provider
+	targetPrefix string
+	after        string
+	pageSize     int
+	page         []string
+	done         bool
+	pageToken    string
+	current      *gospal.ObjectInfo
+	err          error
+}
+
+func (it *objectIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.err = errors.ErrorListKeysError(it.targetPrefix, toError(err))
+		return false
+	}
+	if len(it.page) == 0 {
+		if it.done {
+			return false
+		}
+		if it.current != nil {
+			it.pageToken = it.current.Key
+		}
+		it.page = it.nextPage()
+		it.done = len(it.page) < it.pageSize
+		if len(it.page) == 0 {
+			return false
+		}
+	}
+	name := it.page[0]
+	it.page = it.page[1:]
+	it.after = name
+	info := *it.p.index.members[name].info
+	info.Key = it.p.toKey(name)
+	it.current = &info
+	return true
+}
+
+// nextPage returns the names of the next page, starting with the prefix and following the last listed name
+func (it *objectIterator) nextPage() []string {
+	names := it.p.index.names
+	start := sort.SearchStrings(names, it.targetPrefix)
+	if it.after >= it.targetPrefix {
+		start = sort.Search(len(names), func(i int) bool { return names[i] > it.after })
+	}
+	var page []string
+	for _, name := range names[start:] {
+		if !strings.HasPrefix(name, it.targetPrefix) || len(page) == it.pageSize {
+			break
+		}
+		page = append(page, name)
+	}
+	return page
+}
+
+func (it *objectIterator) Object() *gospal.ObjectInfo {
+	return it.current
+}
+
+func (it *objectIterator) Err() error {
+	return it.err
+}
+
+func (it *objectIterator) PageToken() string {
+	return it.pageToken
+}
@@ -0,0 +1,461 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package archiveprovider
+
+import (
+	"archive/zip"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/internal/fsutil"
+	"github.com/contentsquare/gospal/gospal/internal/registry"
+	"io"
+	"io/ioutil"
+	"mime"
+	"path"
+	"strings"
+)
+
+// Format of an archive
+type Format string
+
+const (
+	// FormatZip zip archives, their members being located by the central directory
+	FormatZip Format = "zip"
+	// FormatTar uncompressed tar archives, such as the ones of the backup example
+	FormatTar Format = "tar"
+	// FormatTarGzip gzip compressed tar archives, which have to be read from the start for every member
+	FormatTarGzip Format = "tar.gz"
+)
+
+const noSuchMemberErrorString = "no such member"
+
+// Config is the archive specific configuration, given as ProviderConfig.SpecConfig. The bucket is the key of the
+// archive on the provider
+type Config struct {
+	// Provider storing the archive
+	Provider gospal.Gospal
+
+	// Format of the archive, guessed from the extension of its key when not set: .zip, .tar, .tar.gz or .tgz
+	Format Format
+}
+
+type provider struct {
+	context              context.Context
+	kind                 string
+	source               gospal.Gospal
+	archive              string
+	format               Format
+	noSuchKeyErrorString string
+	index                *index
+	zip                  *zipArchive
+	config               *gospal.ProviderConfig
+}
+
+// toError classifies the errors raised by the archive readers, the errors of the provider storing the archive are
+// already classified
+func toError(err error) error {
+	if stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded) {
+		return errors.Wrap(errors.ErrCanceled, err)
+	}
+	return err
+}
+
+// noSuchMember returns the error of a key which is not a member of the archive
+func noSuchMember(name string, archive string) error {
+	return errors.Wrap(errors.ErrNotExist, fmt.Errorf("%v %v in archive %v", noSuchMemberErrorString, name, archive))
+}
+
+// guessFormat returns the format of the archive from the extension of its key
+func guessFormat(key string) (Format, error) {
+	switch {
+	case strings.HasSuffix(key, ".zip"):
+		return FormatZip, nil
+	case strings.HasSuffix(key, ".tar"):
+		return FormatTar, nil
+	case strings.HasSuffix(key, ".tar.gz") || strings.HasSuffix(key, ".tgz"):
+		return FormatTarGzip, nil
+	}
+	return "", fmt.Errorf("unable to guess the format of %v", key)
+}
+
+// getTargetKey returns the name of the member of the key, relative to the global prefix
+func (p *provider) getTargetKey(key string) string {
+	return gospal.TargetKey(p.config.GlobalPrefix, key)
+}
+
+// getTargetPrefix returns the listing prefix of the member names, a prefix relative to the global prefix staying under it
+func (p *provider) getTargetPrefix(prefix string) string {
+	targetKey := p.getTargetKey(prefix)
+	if p.config.GlobalPrefix != "" && (prefix == "" || strings.HasSuffix(prefix, "/")) && !strings.HasSuffix(targetKey, "/") {
+		targetKey += "/"
+	}
+	return targetKey
+}
+
+// toKey returns the key relative to the global prefix of the member name
+func (p *provider) toKey(name string) string {
+	return gospal.RelativeKey(p.config.GlobalPrefix, name)
+}
+
+// member returns the member of the key
+func (p *provider) member(key string) (*member, error) {
+	name := p.getTargetKey(key)
+	m, ok := p.index.members[name]
+	if !ok {
+		return nil, noSuchMember(name, p.archive)
+	}
+	return m, nil
+}
+
+// openMember returns the reader of the member, the zip members being read through the central directory and the
+// other ones from the archive itself
+func (p *provider) openMember(ctx context.Context, m *member) (io.ReadCloser, error) {
+	switch {
+	case m.zip != nil:
+		file, err := p.zip.file(ctx, m.zip)
+		if err != nil {
+			return nil, err
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		return gospal.NewReadCloser(&fsutil.ContextReader{Ctx: ctx, Reader: reader}, reader, nil), nil
+	case m.offset >= 0:
+		stream, cancel, err := p.source.GetRangeContext(ctx, p.archive, m.offset, m.info.Size)
+		if err != nil {
+			return nil, err
+		}
+		return gospal.NewReadCloser(stream, nil, cancel), nil
+	}
+	return scanTar(ctx, p.source, p.archive, p.format == FormatTarGzip, m)
+}
+
+// dataOffset returns the offset of the data of the uncompressed member within the archive, or -1 when the member is
+// compressed. The offset of the zip members is read from their local header on first use
+func (p *provider) dataOffset(ctx context.Context, m *member) (int64, error) {
+	if m.zip == nil {
+		return m.offset, nil
+	}
+	if m.zip.method != zip.Store {
+		return -1, nil
+	}
+	m.zip.mu.Lock()
+	defer m.zip.mu.Unlock()
+	if m.zip.dataOffset == 0 {
+		file, err := p.zip.file(ctx, m.zip)
+		if err != nil {
+			return -1, err
+		}
+		if m.zip.dataOffset, err = file.DataOffset(); err != nil {
+			return -1, err
+		}
+	}
+	return m.zip.dataOffset, nil
+}
+
+func (p *provider) ListKeys(pathName ...string) ([]string, error) {
+	return p.ListKeysContext(p.context, pathName...)
+}
+
+func (p *provider) ListKeysContext(ctx context.Context, pathName ...string) ([]string, error) {
+	if len(pathName) > 1 {
+		return nil, errors.ErrorTooMuchListKeysArgs()
+	}
+	var extraPath string
+	if len(pathName) != 0 {
+		extraPath = pathName[0]
+	}
+	var keys []string
+	it := p.Objects(ctx, extraPath)
+	for it.Next() {
+		keys = append(keys, it.Object().Key)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (p *provider) ListDir(prefix string) ([]string, []string, error) {
+	return p.ListDirContext(p.context, prefix)
+}
+
+func (p *provider) ListDirContext(ctx context.Context, prefix string) (keys []string, prefixes []string, err error) {
+	delimiter := p.config.Delimiter
+	if delimiter == "" {
+		delimiter = gospal.DefaultDelimiter
+	}
+	// the prefix is a directory, it should end with the delimiter
+	targetKey := p.getTargetKey(prefix)
+	if targetKey != "" && !strings.HasSuffix(targetKey, delimiter) {
+		targetKey += delimiter
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, errors.ErrorListDir(targetKey, toError(err))
+	}
+	for _, name := range p.index.names {
+		if !strings.HasPrefix(name, targetKey) {
+			continue
+		}
+		rest := strings.TrimPrefix(name, targetKey)
+		if i := strings.Index(rest, delimiter); i >= 0 {
+			// the names being sorted, the names of a sub prefix follow each other
+			subPrefix := p.toKey(targetKey + rest[:i+len(delimiter)])
+			if len(prefixes) == 0 || prefixes[len(prefixes)-1] != subPrefix {
+				prefixes = append(prefixes, subPrefix)
+			}
+			continue
+		}
+		keys = append(keys, p.toKey(name))
+	}
+	return keys, prefixes, nil
+}
+
+func (p *provider) Objects(ctx context.Context, prefix string) gospal.ObjectIterator {
+	return p.ObjectsFrom(ctx, prefix, "")
+}
+
+func (p *provider) ObjectsFrom(ctx context.Context, prefix string, pageToken string) gospal.ObjectIterator {
+	it := &objectIterator{
+		ctx:          ctx,
+		p:            p,
+		targetPrefix: p.getTargetPrefix(prefix),
+		pageSize:     defaultMaxKeys,
+		pageToken:    pageToken,
+	}
+	if pageToken != "" {
+		it.after = p.getTargetKey(pageToken)
+	}
+	if p.config.MaxKeys > 0 {
+		it.pageSize = int(p.config.MaxKeys)
+	}
+	return it
+}
+
+func (p *provider) GetStream(filePath string) (io.Reader, context.CancelFunc, error) {
+	return p.GetStreamContext(p.context, filePath)
+}
+
+func (p *provider) GetStreamContext(ctx context.Context, filePath string) (io.Reader, context.CancelFunc, error) {
+	return gospal.ToStream(p.NewReader(ctx, filePath))
+}
+
+func (p *provider) NewReader(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.ErrorGetStreamReader(filePath, toError(err))
+	}
+	m, err := p.member(filePath)
+	if err != nil {
+		return nil, errors.ErrorGetStreamReader(filePath, err)
+	}
+	reader, err := p.openMember(ctx, m)
+	if err != nil {
+		return nil, errors.ErrorGetStreamReader(filePath, toError(err))
+	}
+	return reader, nil
+}
+
+func (p *provider) GetRange(filePath string, offset int64, length int64) (io.Reader, context.CancelFunc, error) {
+	return p.GetRangeContext(p.context, filePath, offset, length)
+}
+
+func (p *provider) GetRangeContext(ctx context.Context, filePath string, offset int64, length int64) (io.Reader, context.CancelFunc, error) {
+	if err := ctx.Err(); err != nil {
+		return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, filePath, toError(err)))
+	}
+	m, err := p.member(filePath)
+	if err != nil {
+		return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, filePath, err))
+	}
+	if offset > m.info.Size {
+		offset = m.info.Size
+	}
+	if length < 0 || offset+length > m.info.Size {
+		length = m.info.Size - offset
+	}
+	// the uncompressed members are read straight from the archive
+	dataOffset, err := p.dataOffset(ctx, m)
+	if err != nil {
+		return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, filePath, toError(err)))
+	}
+	if dataOffset >= 0 {
+		return p.source.GetRangeContext(ctx, p.archive, dataOffset+offset, length)
+	}
+	// the compressed ones are read up to the range
+	reader, err := p.openMember(ctx, m)
+	if err != nil {
+		return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, filePath, toError(err)))
+	}
+	if _, err := io.CopyN(ioutil.Discard, reader, offset); err != nil {
+		reader.Close()
+		return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, filePath, toError(err)))
+	}
+	return gospal.ToStream(gospal.NewReadCloser(io.LimitReader(reader, length), reader, nil), nil)
+}
+
+func (p *provider) Open(filePath string) (gospal.ObjectReader, error) {
+	return p.OpenContext(p.context, filePath)
+}
+
+func (p *provider) OpenContext(ctx context.Context, filePath string) (gospal.ObjectReader, error) {
+	info, err := p.StatContext(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	return gospal.NewRangeReader(ctx, p, filePath, info.Size), nil
+}
+
+func (p *provider) Stat(fileName string) (*gospal.ObjectInfo, error) {
+	return p.StatContext(p.context, fileName)
+}
+
+func (p *provider) StatContext(ctx context.Context, fileName string) (*gospal.ObjectInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.ErrorStat(fileName, toError(err))
+	}
+	m, err := p.member(fileName)
+	if err != nil {
+		return nil, errors.ErrorStat(fileName, err)
+	}
+	// archives store neither etag nor attributes, the content type is guessed from the file extension
+	return &gospal.ObjectInfo{
+		Key:          fileName,
+		Size:         m.info.Size,
+		LastModified: m.info.LastModified,
+		ContentType:  mime.TypeByExtension(path.Ext(fileName)),
+	}, nil
+}
+
+func (p *provider) GetKind() string {
+	return p.kind
+}
+
+func (p *provider) GetNoSuchKeyErrorString() string {
+	return p.noSuchKeyErrorString
+}
+
+// The archives are read-only, every write fails with an *errors.NotSupportedError
+
+func (p *provider) PutStream(fileName string, reader io.Reader, opts ...gospal.PutOption) (int64, error) {
+	return p.PutStreamContext(p.context, fileName, reader, opts...)
+}
+
+func (p *provider) PutStreamContext(ctx context.Context, fileName string, reader io.Reader, opts ...gospal.PutOption) (int64, error) {
+	return -1, errors.ErrorNotSupported("PutStream", p.kind)
+}
+
+func (p *provider) NewWriter(ctx context.Context, fileName string, opts ...gospal.PutOption) (io.WriteCloser, error) {
+	return nil, errors.ErrorNotSupported("NewWriter", p.kind)
+}
+
+func (p *provider) Copy(src string, dst string) error {
+	return p.CopyContext(p.context, src, dst)
+}
+
+func (p *provider) CopyContext(ctx context.Context, src string, dst string) error {
+	return errors.ErrorNotSupported("Copy", p.kind)
+}
+
+func (p *provider) Move(src string, dst string) error {
+	return p.MoveContext(p.context, src, dst)
+}
+
+func (p *provider) MoveContext(ctx context.Context, src string, dst string) error {
+	return errors.ErrorNotSupported("Move", p.kind)
+}
+
+func (p *provider) DeleteKey(fileName string) error {
+	return p.DeleteKeyContext(p.context, fileName)
+}
+
+func (p *provider) DeleteKeyContext(ctx context.Context, fileName string) error {
+	return errors.ErrorNotSupported("DeleteKey", p.kind)
+}
+
+func (p *provider) DeleteKeys(fileNames []string) error {
+	return p.DeleteKeysContext(p.context, fileNames)
+}
+
+func (p *provider) DeleteKeysContext(ctx context.Context, fileNames []string) error {
+	return errors.ErrorNotSupported("DeleteKeys", p.kind)
+}
+
+func (p *provider) DeletePrefix(prefix string) error {
+	return p.DeletePrefixContext(p.context, prefix)
+}
+
+func (p *provider) DeletePrefixContext(ctx context.Context, prefix string) error {
+	return errors.ErrorNotSupported("DeletePrefix", p.kind)
+}
+
+// the provider is available from the factory as soon as its package is imported
+func init() {
+	registry.MustRegister(gospal.ProviderArchive, New)
+}
+
+//New archive provider constructor. The bucket is the key of the archive on the provider of the configuration, eg.:
+//  provider, err := archiveprovider.New(ctx, "backups/toto.tar", &gospal.ProviderConfig{
+//      SpecConfig: &archiveprovider.Config{Provider: s3Provider},
+//  })
+//The members of the archive are indexed by the constructor, the zip central directory and the tar headers being
+//fetched by ranged reads. The compressed tar archives are read as a whole
+func New(ctx context.Context, bucket string, config *gospal.ProviderConfig) (gospal.Gospal, error) {
+	provider := provider{archive: bucket}
+	provider.kind = string(gospal.ProviderArchive)
+	provider.noSuchKeyErrorString = noSuchMemberErrorString
+	provider.config = config
+	provider.context = ctx
+
+	cfg, ok := config.SpecConfig.(*Config)
+	if !ok || cfg == nil || cfg.Provider == nil {
+		return nil, errors.ErrorInitProvider("archive", stderrors.New("SpecConfig is not a *archiveprovider.Config with a Provider"))
+	}
+	provider.source = cfg.Provider
+	provider.format = cfg.Format
+	if provider.format == "" {
+		var err error
+		if provider.format, err = guessFormat(bucket); err != nil {
+			return nil, errors.ErrorInitProvider("archive", err)
+		}
+	}
+
+	var err error
+	switch provider.format {
+	case FormatZip, FormatTar:
+		var info *gospal.ObjectInfo
+		if info, err = provider.source.StatContext(ctx, bucket); err != nil {
+			break
+		}
+		// the reader of the indexing is bound to the context of the constructor, it is not kept for the reads
+		archive := &blockReaderAt{ctx: ctx, provider: provider.source, key: bucket, size: info.Size}
+		if provider.format == FormatZip {
+			provider.index, provider.zip, err = indexZip(archive)
+		} else {
+			provider.index, err = indexTar(archive)
+		}
+	case FormatTarGzip:
+		provider.index, err = indexTarGzip(ctx, provider.source, bucket)
+	default:
+		err = fmt.Errorf("unknown archive format %v", provider.format)
+	}
+	if err != nil {
+		return nil, errors.ErrorInitProvider("archive", toError(err))
+	}
+	return &provider, nil
+}
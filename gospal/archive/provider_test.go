@@ -0,0 +1,474 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package archiveprovider
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	stderrors "errors"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	memprovider "github.com/contentsquare/gospal/gospal/memory"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testModTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// testFile is a file of the test archives
+type testFile struct {
+	name    string
+	content string
+}
+
+// the files of the backup example, along with a directory entry
+var testFiles = []testFile{
+	{name: "toto/", content: ""},
+	{name: "toto/a.txt", content: "aaaaaaaaaa"},
+	{name: "toto/b/c.txt", content: "0123456789"},
+	{name: "toto/b/d.json", content: "{}"},
+	{name: "toto/empty.txt", content: ""},
+}
+
+func buildTar(t *testing.T, files []testFile, gzipped bool) []byte {
+	var bb bytes.Buffer
+	var writer io.Writer = &bb
+	var gzipWriter *gzip.Writer
+	if gzipped {
+		gzipWriter = gzip.NewWriter(&bb)
+		writer = gzipWriter
+	}
+	tarWriter := tar.NewWriter(writer)
+	for _, file := range files {
+		header := &tar.Header{Name: file.name, Size: int64(len(file.content)), Mode: 0600, ModTime: testModTime}
+		if strings.HasSuffix(file.name, "/") {
+			header.Typeflag = tar.TypeDir
+		}
+		if err := tarWriter.WriteHeader(header); err != nil {
+			t.Fatalf("unable to write tar header for tests. err=%v", err.Error())
+		}
+		io.WriteString(tarWriter, file.content)
+	}
+	tarWriter.Close()
+	if gzipped {
+		gzipWriter.Close()
+	}
+	return bb.Bytes()
+}
+
+func buildZip(t *testing.T, files []testFile, method uint16) []byte {
+	var bb bytes.Buffer
+	zipWriter := zip.NewWriter(&bb)
+	for _, file := range files {
+		writer, err := zipWriter.CreateHeader(&zip.FileHeader{Name: file.name, Method: method, Modified: testModTime})
+		if err != nil {
+			t.Fatalf("unable to write zip header for tests. err=%v", err.Error())
+		}
+		io.WriteString(writer, file.content)
+	}
+	zipWriter.Close()
+	return bb.Bytes()
+}
+
+// newTestProvider returns a provider of the archive, stored on a memory provider along with its store
+func newTestProvider(t *testing.T, key string, archive []byte, config *gospal.ProviderConfig) (gospal.Gospal, *memprovider.Store) {
+	store := memprovider.Bucket("archive-" + t.Name())
+	store.Reset()
+	store.Put(key, archive)
+	source, _ := memprovider.New(context.Background(), "archive-"+t.Name(), gospal.NewProviderConfig())
+	config.SpecConfig = &Config{Provider: source}
+	p, err := New(context.Background(), key, config)
+	if err != nil {
+		t.Fatalf("error when instantiating archive provider. err=%v", err.Error())
+	}
+	return p, store
+}
+
+func TestNew(t *testing.T) {
+	store := memprovider.Bucket("archive-TestNew")
+	store.Reset()
+	store.Put("backup.tar", buildTar(t, testFiles, false))
+	store.Put("backup.tar.gz", buildTar(t, testFiles, true))
+	store.Put("backup.zip", buildZip(t, testFiles, zip.Deflate))
+	store.Put("backup.bin", buildTar(t, testFiles, true))
+	store.Put("corrupted.zip", []byte("not a zip"))
+	source, _ := memprovider.New(context.Background(), "archive-TestNew", gospal.NewProviderConfig())
+
+	tests := []struct {
+		name    string
+		bucket  string
+		config  *Config
+		wantErr error
+	}{
+		{
+			name:   "Should instantiate a provider of a tar archive",
+			bucket: "backup.tar",
+			config: &Config{Provider: source},
+		},
+		{
+			name:   "Should instantiate a provider of a compressed tar archive",
+			bucket: "backup.tar.gz",
+			config: &Config{Provider: source},
+		},
+		{
+			name:   "Should instantiate a provider of a zip archive",
+			bucket: "backup.zip",
+			config: &Config{Provider: source},
+		},
+		{
+			name:   "Should instantiate a provider of an archive of the specified format",
+			bucket: "backup.bin",
+			config: &Config{Provider: source, Format: FormatTarGzip},
+		},
+		{
+			name:    "Should raise on missing provider",
+			bucket:  "backup.tar",
+			config:  &Config{},
+			wantErr: stderrors.New("any"),
+		},
+		{
+			name:    "Should raise on unknown extension",
+			bucket:  "backup.bin",
+			config:  &Config{Provider: source},
+			wantErr: stderrors.New("any"),
+		},
+		{
+			name:    "Should raise on missing archive",
+			bucket:  "missing.zip",
+			config:  &Config{Provider: source},
+			wantErr: errors.ErrNotExist,
+		},
+		{
+			name:    "Should raise on corrupted archive",
+			bucket:  "corrupted.zip",
+			config:  &Config{Provider: source},
+			wantErr: stderrors.New("any"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(context.Background(), tt.bucket, &gospal.ProviderConfig{SpecConfig: tt.config})
+			if (err != nil) != (tt.wantErr != nil) {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr == errors.ErrNotExist && !stderrors.Is(err, errors.ErrNotExist) {
+				t.Errorf("New() error = %v, should be %v", err, errors.ErrNotExist)
+			}
+			if tt.wantErr == nil && got.GetKind() != "archive" {
+				t.Errorf("GetKind() got = %v, want %v", got.GetKind(), "archive")
+			}
+		})
+	}
+}
+
+func Test_provider_Formats(t *testing.T) {
+	archives := map[string][]byte{
+		"backup.tar":     buildTar(t, testFiles, false),
+		"backup.tar.gz":  buildTar(t, testFiles, true),
+		"backup.tgz":     buildTar(t, testFiles, true),
+		"deflated.zip":   buildZip(t, testFiles, zip.Deflate),
+		"uncompress.zip": buildZip(t, testFiles, zip.Store),
+	}
+	for key, archive := range archives {
+		t.Run(key, func(t *testing.T) {
+			p, _ := newTestProvider(t, key, archive, &gospal.ProviderConfig{MaxKeys: 2})
+
+			keys, err := p.ListKeys()
+			if want := []string{"toto/a.txt", "toto/b/c.txt", "toto/b/d.json", "toto/empty.txt"}; err != nil || !reflect.DeepEqual(keys, want) {
+				t.Errorf("ListKeys() got = %v, %v, want %v", keys, err, want)
+			}
+			keys, err = p.ListKeys("toto/b/")
+			if want := []string{"toto/b/c.txt", "toto/b/d.json"}; err != nil || !reflect.DeepEqual(keys, want) {
+				t.Errorf("ListKeys() got = %v, %v, want %v", keys, err, want)
+			}
+			gotKeys, gotPrefixes, err := p.ListDir("toto")
+			if err != nil || !reflect.DeepEqual(gotKeys, []string{"toto/a.txt", "toto/empty.txt"}) || !reflect.DeepEqual(gotPrefixes, []string{"toto/b/"}) {
+				t.Errorf("ListDir() got = %v, %v, %v", gotKeys, gotPrefixes, err)
+			}
+
+			for _, file := range testFiles[1:] {
+				reader, err := p.NewReader(context.Background(), file.name)
+				if err != nil {
+					t.Errorf("NewReader() error = %v", err)
+					continue
+				}
+				if data, _ := ioutil.ReadAll(reader); string(data) != file.content {
+					t.Errorf("NewReader() got = %v, want %v", string(data), file.content)
+				}
+				reader.Close()
+				info, err := p.Stat(file.name)
+				if err != nil || info.Size != int64(len(file.content)) || !info.LastModified.Equal(testModTime) {
+					t.Errorf("Stat() got = %+v, %v", info, err)
+				}
+			}
+
+			ranges := []struct {
+				offset int64
+				length int64
+				want   string
+			}{
+				{offset: 0, length: 3, want: "012"},
+				{offset: 4, length: 2, want: "45"},
+				{offset: 7, length: -1, want: "789"},
+				{offset: 8, length: 10, want: "89"},
+				{offset: 5, length: 0, want: ""},
+				{offset: 10, length: -1, want: ""},
+			}
+			for _, tt := range ranges {
+				reader, cancel, err := p.GetRange("toto/b/c.txt", tt.offset, tt.length)
+				if err != nil {
+					t.Errorf("GetRange(%v, %v) error = %v", tt.offset, tt.length, err)
+					continue
+				}
+				if data, _ := ioutil.ReadAll(reader); string(data) != tt.want {
+					t.Errorf("GetRange(%v, %v) got = %v, want %v", tt.offset, tt.length, string(data), tt.want)
+				}
+				cancel()
+			}
+
+			reader, err := p.Open("toto/b/c.txt")
+			if err != nil {
+				t.Errorf("Open() error = %v", err)
+				return
+			}
+			b := make([]byte, 4)
+			if n, err := reader.ReadAt(b, 3); err != nil || string(b[:n]) != "3456" {
+				t.Errorf("ReadAt() got = %v, %v, want %v", string(b[:n]), err, "3456")
+			}
+			reader.Close()
+
+			// directories are not keys
+			for _, key := range []string{"toto", "toto/", "missing.txt"} {
+				if _, err := p.NewReader(context.Background(), key); !stderrors.Is(err, errors.ErrNotExist) {
+					t.Errorf("NewReader() error = %v, should be %v", err, errors.ErrNotExist)
+				}
+				if _, err := p.Stat(key); !stderrors.Is(err, errors.ErrNotExist) {
+					t.Errorf("Stat() error = %v, should be %v", err, errors.ErrNotExist)
+				}
+			}
+		})
+	}
+}
+
+func Test_provider_RangedReads(t *testing.T) {
+	large := strings.Repeat("0123456789", 300*1024)
+	files := []testFile{{name: "large.bin", content: large}, {name: "small.txt", content: "small"}}
+
+	for key, archive := range map[string][]byte{"backup.tar": buildTar(t, files, false), "backup.zip": buildZip(t, files, zip.Deflate)} {
+		t.Run(key, func(t *testing.T) {
+			p, store := newTestProvider(t, key, archive, &gospal.ProviderConfig{})
+
+			// the archive is indexed without reading it all
+			if calls := store.Calls("GetRange"); calls == 0 || calls > 2 {
+				t.Errorf("New() made %v ranged reads, want 1 or 2", calls)
+			}
+			store.ResetCalls()
+			reader, err := p.NewReader(context.Background(), "small.txt")
+			if err != nil {
+				t.Errorf("NewReader() error = %v", err)
+				return
+			}
+			if data, _ := ioutil.ReadAll(reader); string(data) != "small" {
+				t.Errorf("NewReader() got = %v, want %v", string(data), "small")
+			}
+			reader.Close()
+			if calls := store.Calls("NewReader") + store.Calls("GetStream"); calls != 0 {
+				t.Errorf("NewReader() read the whole archive %v times", calls)
+			}
+		})
+	}
+}
+
+func Test_provider_Contexts(t *testing.T) {
+	large := strings.Repeat("0123456789", 300*1024)
+	files := []testFile{{name: "large.bin", content: large}, {name: "small.txt", content: "small"}}
+	archives := map[string][]byte{
+		"backup.tar":   buildTar(t, files, false),
+		"deflated.zip": buildZip(t, files, zip.Deflate),
+		"stored.zip":   buildZip(t, files, zip.Store),
+	}
+	for key, archive := range archives {
+		t.Run(key, func(t *testing.T) {
+			store := memprovider.Bucket("archive-" + t.Name())
+			store.Reset()
+			store.Put(key, archive)
+			source, _ := memprovider.New(context.Background(), "archive-"+t.Name(), gospal.NewProviderConfig())
+
+			// the context of the constructor only bounds the indexing
+			ctx, cancel := context.WithCancel(context.Background())
+			p, err := New(ctx, key, &gospal.ProviderConfig{SpecConfig: &Config{Provider: source}})
+			cancel()
+			if err != nil {
+				t.Errorf("New() error = %v", err)
+				return
+			}
+			reader, err := p.NewReader(context.Background(), "large.bin")
+			if err != nil {
+				t.Errorf("NewReader() error = %v", err)
+				return
+			}
+			if data, err := ioutil.ReadAll(reader); err != nil || string(data) != large {
+				t.Errorf("NewReader() got %v bytes, %v, want %v bytes", len(data), err, len(large))
+			}
+			reader.Close()
+			stream, closeStream, err := p.GetRangeContext(context.Background(), "large.bin", 10, 5)
+			if err != nil {
+				t.Errorf("GetRange() error = %v", err)
+				return
+			}
+			if data, _ := ioutil.ReadAll(stream); string(data) != "01234" {
+				t.Errorf("GetRange() got = %v, want %v", string(data), "01234")
+			}
+			closeStream()
+
+			// while the context of a read cancels it. The tar members are streamed by the source provider, which is
+			// in charge of the cancellation
+			if !strings.HasSuffix(key, ".zip") {
+				return
+			}
+			readCtx, cancelRead := context.WithCancel(context.Background())
+			defer cancelRead()
+			reader, err = p.NewReader(readCtx, "large.bin")
+			if err != nil {
+				t.Errorf("NewReader() error = %v", err)
+				return
+			}
+			defer reader.Close()
+			if _, err := io.ReadFull(reader, make([]byte, 10)); err != nil {
+				t.Errorf("NewReader() read error = %v", err)
+			}
+			cancelRead()
+			if _, err := ioutil.ReadAll(reader); err == nil {
+				t.Errorf("NewReader() should fail once its context is canceled")
+			}
+		})
+	}
+}
+
+func Test_provider_ConcurrentReads(t *testing.T) {
+	first := strings.Repeat("a", 3*blockSize)
+	second := strings.Repeat("b", 3*blockSize)
+	files := []testFile{{name: "first.bin", content: first}, {name: "second.bin", content: second}}
+	p, _ := newTestProvider(t, "backup.zip", buildZip(t, files, zip.Deflate), &gospal.ProviderConfig{})
+
+	// each read has its own reader of the archive, the reads of different members do not interfere
+	readers := map[string]io.ReadCloser{}
+	for _, name := range []string{"first.bin", "second.bin"} {
+		reader, err := p.NewReader(context.Background(), name)
+		if err != nil {
+			t.Errorf("NewReader() error = %v", err)
+			return
+		}
+		defer reader.Close()
+		readers[name] = reader
+	}
+	got := map[string]*bytes.Buffer{"first.bin": {}, "second.bin": {}}
+	for done := false; !done; {
+		done = true
+		for name, reader := range readers {
+			if n, _ := io.CopyN(got[name], reader, 4096); n > 0 {
+				done = false
+			}
+		}
+	}
+	if got["first.bin"].String() != first || got["second.bin"].String() != second {
+		t.Errorf("NewReader() got %v and %v bytes, want %v", got["first.bin"].Len(), got["second.bin"].Len(), len(first))
+	}
+}
+
+func Test_provider_Duplicates(t *testing.T) {
+	files := []testFile{{name: "a.txt", content: "first"}, {name: "./a.txt", content: "second"}, {name: "b.txt", content: "b"}}
+	for key, archive := range map[string][]byte{"backup.tar": buildTar(t, files, false), "backup.tar.gz": buildTar(t, files, true)} {
+		t.Run(key, func(t *testing.T) {
+			p, _ := newTestProvider(t, key, archive, &gospal.ProviderConfig{})
+
+			// the last member of a name replaces the previous ones, as on extraction
+			if keys, err := p.ListKeys(); err != nil || !reflect.DeepEqual(keys, []string{"a.txt", "b.txt"}) {
+				t.Errorf("ListKeys() got = %v, %v", keys, err)
+			}
+			reader, err := p.NewReader(context.Background(), "a.txt")
+			if err != nil {
+				t.Errorf("NewReader() error = %v", err)
+				return
+			}
+			if data, _ := ioutil.ReadAll(reader); string(data) != "second" {
+				t.Errorf("NewReader() got = %v, want %v", string(data), "second")
+			}
+			reader.Close()
+		})
+	}
+}
+
+func Test_provider_GlobalPrefix(t *testing.T) {
+	p, _ := newTestProvider(t, "backup.tar", buildTar(t, testFiles, false), &gospal.ProviderConfig{GlobalPrefix: "toto"})
+
+	// the keys are relative to the global prefix
+	keys, err := p.ListKeys()
+	if want := []string{"a.txt", "b/c.txt", "b/d.json", "empty.txt"}; err != nil || !reflect.DeepEqual(keys, want) {
+		t.Errorf("ListKeys() got = %v, %v, want %v", keys, err, want)
+	}
+	gotKeys, gotPrefixes, err := p.ListDir("")
+	if err != nil || !reflect.DeepEqual(gotKeys, []string{"a.txt", "empty.txt"}) || !reflect.DeepEqual(gotPrefixes, []string{"b/"}) {
+		t.Errorf("ListDir() got = %v, %v, %v", gotKeys, gotPrefixes, err)
+	}
+	// and can be fed back to the provider
+	reader, err := p.NewReader(context.Background(), keys[0])
+	if err != nil {
+		t.Errorf("NewReader() error = %v", err)
+		return
+	}
+	if data, _ := ioutil.ReadAll(reader); string(data) != "aaaaaaaaaa" {
+		t.Errorf("NewReader() got = %v, want %v", string(data), "aaaaaaaaaa")
+	}
+	reader.Close()
+}
+
+func Test_provider_NotSupported(t *testing.T) {
+	p, store := newTestProvider(t, "backup.zip", buildZip(t, testFiles, zip.Deflate), &gospal.ProviderConfig{})
+
+	if _, err := p.PutStream("toto/a.txt", strings.NewReader("overwritten")); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("PutStream() error = %v, should be %v", err, errors.ErrNotSupported)
+	}
+	if _, err := p.NewWriter(context.Background(), "toto/a.txt"); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("NewWriter() error = %v, should be %v", err, errors.ErrNotSupported)
+	}
+	if err := p.Copy("toto/a.txt", "b.txt"); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("Copy() error = %v, should be %v", err, errors.ErrNotSupported)
+	}
+	if err := p.Move("toto/a.txt", "b.txt"); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("Move() error = %v, should be %v", err, errors.ErrNotSupported)
+	}
+	if err := p.DeleteKey("toto/a.txt"); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("DeleteKey() error = %v, should be %v", err, errors.ErrNotSupported)
+	}
+	if err := p.DeleteKeys([]string{"toto/a.txt"}); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("DeleteKeys() error = %v, should be %v", err, errors.ErrNotSupported)
+	}
+	if err := p.DeletePrefix("toto/"); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("DeletePrefix() error = %v, should be %v", err, errors.ErrNotSupported)
+	}
+	// the archive is left untouched
+	if calls := store.Calls("PutStream") + store.Calls("DeleteKey") + store.Calls("Move"); calls != 0 {
+		t.Errorf("the archive has been written %v times", calls)
+	}
+}
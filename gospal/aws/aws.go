@@ -16,13 +16,18 @@ package awsprovider
 
 import (
 	"context"
+	"encoding/hex"
+	stderrors "errors"
+	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/contentsquare/gospal/gospal"
 	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/internal/registry"
 	"io"
 	"os"
 	"path"
@@ -47,14 +52,96 @@ type provider struct {
 	config *gospal.ProviderConfig
 }
 
+// toError classifies an aws sdk error as one of the gospal errors
+func toError(err error) error {
+	if stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded) {
+		return errors.Wrap(errors.ErrCanceled, err)
+	}
+	var aerr awserr.Error
+	if !stderrors.As(err, &aerr) {
+		return err
+	}
+	switch aerr.Code() {
+	case s3.ErrCodeNoSuchKey, s3.ErrCodeNoSuchBucket, s3.ErrCodeNoSuchUpload, "NotFound":
+		return errors.Wrap(errors.ErrNotExist, err)
+	case "AccessDenied", "Forbidden", "InvalidAccessKeyId", "SignatureDoesNotMatch":
+		return errors.Wrap(errors.ErrPermissionDenied, err)
+	case s3.ErrCodeBucketAlreadyExists, s3.ErrCodeBucketAlreadyOwnedByYou:
+		return errors.Wrap(errors.ErrAlreadyExists, err)
+	case "PreconditionFailed":
+		return errors.Wrap(errors.ErrPreconditionFailed, err)
+	case request.CanceledErrorCode:
+		return errors.Wrap(errors.ErrCanceled, err)
+	case "SlowDown", "Throttling", "ThrottlingException", "RequestLimitExceeded", "RequestTimeout", "InternalError",
+		"ServiceUnavailable", request.ErrCodeRequestError:
+		return errors.Wrap(errors.ErrTransient, err)
+	}
+	// HeadObject responses have no body, the error code is then derived from the status code
+	var rerr awserr.RequestFailure
+	if stderrors.As(err, &rerr) {
+		switch rerr.StatusCode() {
+		case 404:
+			return errors.Wrap(errors.ErrNotExist, err)
+		case 403:
+			return errors.Wrap(errors.ErrPermissionDenied, err)
+		case 412:
+			return errors.Wrap(errors.ErrPreconditionFailed, err)
+		case 429, 500, 502, 503, 504:
+			return errors.Wrap(errors.ErrTransient, err)
+		}
+	}
+	return err
+}
+
+// uploadInput returns the input to upload the body to the key with the specified options
+func (p *provider) uploadInput(filePath string, body io.Reader, opts ...gospal.PutOption) *s3manager.UploadInput {
+	options := gospal.NewPutOptions(opts...)
+	input := &s3manager.UploadInput{
+		Bucket:          &p.bucketName,
+		Key:             aws.String(p.getTargetKey(filePath)),
+		Body:            body,
+		ContentType:     stringOrNil(options.ContentType),
+		ContentEncoding: stringOrNil(options.ContentEncoding),
+		CacheControl:    stringOrNil(options.CacheControl),
+	}
+	if len(options.Metadata) > 0 {
+		input.Metadata = aws.StringMap(options.Metadata)
+	}
+	return input
+}
+
+// stringOrNil returns nil on empty strings, for the sdk to leave the matching field unset
+func stringOrNil(s string) *string {
+	if s == "" {
+		return nil
+	}
+	return &s
+}
+
 func (p *provider) getTargetKey(filePath string) string {
-	if p.config.GlobalPrefix != "" {
-		return path.Join(p.config.GlobalPrefix, filePath)
+	return gospal.TargetKey(p.config.GlobalPrefix, filePath)
+}
+
+// getTargetPrefix returns the listing prefix of the specified prefix. The global prefix being a directory, the keys of
+// its siblings should not be listed
+func (p *provider) getTargetPrefix(prefix string) string {
+	targetKey := p.getTargetKey(prefix)
+	if p.config.GlobalPrefix != "" && (prefix == "" || strings.HasSuffix(prefix, "/")) && !strings.HasSuffix(targetKey, "/") {
+		targetKey += "/"
 	}
-	return filePath
+	return targetKey
+}
+
+// toKey returns the key relative to the global prefix of the specified s3 key
+func (p *provider) toKey(targetKey string) string {
+	return gospal.RelativeKey(p.config.GlobalPrefix, targetKey)
 }
 
-func (p *provider) ListKeys(pathName ...string) (fileList []string, err error) {
+func (p *provider) ListKeys(pathName ...string) ([]string, error) {
+	return p.ListKeysContext(p.context, pathName...)
+}
+
+func (p *provider) ListKeysContext(ctx context.Context, pathName ...string) (fileList []string, err error) {
 	if len(pathName) > 1 {
 		return nil, errors.ErrorTooMuchListKeysArgs()
 	}
@@ -62,37 +149,99 @@ func (p *provider) ListKeys(pathName ...string) (fileList []string, err error) {
 	if len(pathName) != 0 {
 		extraPath = pathName[0]
 	}
-	targetKey := p.getTargetKey(extraPath)
-	params := s3.ListObjectsInput{
-		Bucket:  aws.String(p.bucketName),
-		Prefix:  aws.String(targetKey),
-		MaxKeys: aws.Int64(p.config.MaxKeys),
+	it := p.Objects(ctx, extraPath)
+	for it.Next() {
+		fileList = append(fileList, it.Object().Key)
 	}
-	if p.config.Delimiter != "" {
-		params.Delimiter = aws.String(p.config.Delimiter)
+	if err := it.Err(); err != nil {
+		return nil, err
 	}
+	return fileList, nil
+}
 
-	page := request.Pagination{
-		NewRequest: func() (*request.Request, error) {
-			req, _ := p.s3Service.ListObjectsRequest(&params)
-			req.SetContext(p.context)
-			return req, nil
-		},
-	}
+func (p *provider) ListDir(prefix string) ([]string, []string, error) {
+	return p.ListDirContext(p.context, prefix)
+}
 
-	for page.Next() {
-		page := page.Page().(*s3.ListObjectsOutput)
+func (p *provider) ListDirContext(ctx context.Context, prefix string) (keys []string, prefixes []string, err error) {
+	delimiter := p.config.Delimiter
+	if delimiter == "" {
+		delimiter = gospal.DefaultDelimiter
+	}
+	// the prefix is a directory, it should end with the delimiter
+	targetKey := p.getTargetKey(prefix)
+	if targetKey != "" && !strings.HasSuffix(targetKey, delimiter) {
+		targetKey += delimiter
+	}
+	params := &s3.ListObjectsInput{
+		Bucket:    aws.String(p.bucketName),
+		Prefix:    aws.String(targetKey),
+		Delimiter: aws.String(delimiter),
+	}
+	if p.config.MaxKeys > 0 {
+		params.MaxKeys = aws.Int64(p.config.MaxKeys)
+	}
+	err = p.s3Service.ListObjectsPagesWithContext(ctx, params, func(page *s3.ListObjectsOutput, lastPage bool) bool {
 		for _, obj := range page.Contents {
-			if !strings.HasSuffix(*obj.Key, "/") {
-				fileList = append(fileList, *obj.Key)
+			// keys ending with a slash are directory placeholders
+			if !strings.HasSuffix(aws.StringValue(obj.Key), "/") {
+				keys = append(keys, p.toKey(aws.StringValue(obj.Key)))
+			}
+		}
+		for _, commonPrefix := range page.CommonPrefixes {
+			// a prefix spanning several pages may be repeated, the listing being sorted it follows itself
+			key := p.toKey(aws.StringValue(commonPrefix.Prefix))
+			if len(prefixes) == 0 || prefixes[len(prefixes)-1] != key {
+				prefixes = append(prefixes, key)
 			}
 		}
+		return true
+	})
+	if err != nil {
+		return nil, nil, errors.ErrorListDir(targetKey, toError(err))
 	}
-	return
+	return keys, prefixes, nil
+}
+
+func (p *provider) Objects(ctx context.Context, prefix string) gospal.ObjectIterator {
+	return p.ObjectsFrom(ctx, prefix, "")
+}
+
+func (p *provider) ObjectsFrom(ctx context.Context, prefix string, pageToken string) gospal.ObjectIterator {
+	return p.objects(ctx, prefix, pageToken, p.config.Delimiter)
+}
+
+// objects returns the iterator of the objects under the prefix. With a delimiter, only the objects right under the
+// prefix are listed
+func (p *provider) objects(ctx context.Context, prefix string, pageToken string, delimiter string) *objectIterator {
+	it := &objectIterator{
+		ctx: ctx,
+		p:   p,
+		params: s3.ListObjectsInput{
+			Bucket: aws.String(p.bucketName),
+			Prefix: aws.String(p.getTargetPrefix(prefix)),
+		},
+		marker: pageToken,
+	}
+	if p.config.MaxKeys > 0 {
+		it.params.MaxKeys = aws.Int64(p.config.MaxKeys)
+	}
+	if delimiter != "" {
+		it.params.Delimiter = aws.String(delimiter)
+	}
+	return it
 }
 
 func (p *provider) GetStream(filePath string) (io.Reader, context.CancelFunc, error) {
-	ctx, cancel := context.WithTimeout(p.context, time.Second*time.Duration(p.config.TimeOut))
+	return p.GetStreamContext(p.context, filePath)
+}
+
+func (p *provider) GetStreamContext(ctx context.Context, filePath string) (io.Reader, context.CancelFunc, error) {
+	return gospal.ToStream(p.NewReader(ctx, filePath))
+}
+
+func (p *provider) NewReader(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(p.config.TimeOut))
 	targetKey := p.getTargetKey(filePath)
 	result, err := p.s3Service.GetObjectWithContext(ctx,
 		&s3.GetObjectInput{
@@ -101,24 +250,123 @@ func (p *provider) GetStream(filePath string) (io.Reader, context.CancelFunc, er
 		})
 	if err != nil {
 		defer cancel()
-		return nil, nil, errors.ErrorGetStreamReader(targetKey, err.Error())
+		return nil, errors.ErrorGetStreamReader(targetKey, toError(err))
 	}
-	return result.Body, cancel, nil
+	// closing the body releases the connection
+	return gospal.NewReadCloser(result.Body, result.Body, cancel), nil
 }
 
-func (p *provider) PutStream(filePath string, reader io.Reader) (int64, error) {
-	ctx, cancel := context.WithCancel(p.context)
+func (p *provider) GetRange(filePath string, offset int64, length int64) (io.Reader, context.CancelFunc, error) {
+	return p.GetRangeContext(p.context, filePath, offset, length)
+}
+
+func (p *provider) GetRangeContext(ctx context.Context, filePath string, offset int64, length int64) (io.Reader, context.CancelFunc, error) {
+	if length == 0 {
+		// an empty range is not a valid Range header
+		return strings.NewReader(""), func() {}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(p.config.TimeOut))
+	targetKey := p.getTargetKey(filePath)
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length > 0 {
+		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+	result, err := p.s3Service.GetObjectWithContext(ctx,
+		&s3.GetObjectInput{
+			Bucket: &p.bucketName,
+			Key:    &targetKey,
+			Range:  &byteRange,
+		})
+	if err != nil {
+		defer cancel()
+		return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, targetKey, toError(err)))
+	}
+	return gospal.ToStream(gospal.NewReadCloser(result.Body, result.Body, cancel), nil)
+}
+
+func (p *provider) Open(filePath string) (gospal.ObjectReader, error) {
+	return p.OpenContext(p.context, filePath)
+}
+
+func (p *provider) OpenContext(ctx context.Context, filePath string) (gospal.ObjectReader, error) {
+	info, err := p.StatContext(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	return gospal.NewRangeReader(ctx, p, filePath, info.Size), nil
+}
+
+func (p *provider) PutStream(filePath string, reader io.Reader, opts ...gospal.PutOption) (int64, error) {
+	return p.PutStreamContext(p.context, filePath, reader, opts...)
+}
+
+func (p *provider) PutStreamContext(ctx context.Context, filePath string, reader io.Reader, opts ...gospal.PutOption) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
+	// the uploader does not report the size of the object. Seekable bodies are given as is, for the uploader to read
+	// their parts in place and rewind them on retry, the others are buffered by the uploader anyway
+	body, size := reader, int64(-1)
+	if seeker, ok := reader.(io.Seeker); ok {
+		if n, err := aws.SeekerLen(seeker); err == nil {
+			size = n
+		}
+	}
+	var counter *countingReader
+	if size < 0 {
+		counter = &countingReader{reader: reader}
+		body = counter
+	}
+	_, err := p.uploader.UploadWithContext(ctx, p.uploadInput(filePath, body, opts...))
+	if err != nil {
+		return 0, errors.ErrorPutStreamReader(filepath.Join(p.config.GlobalPrefix, filePath), toError(err))
+	}
+	if counter != nil {
+		return counter.count, nil
+	}
+	return size, nil
+}
+
+// countingReader counts the bytes read from the stream
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.count += int64(n)
+	return n, err
+}
+
+func (p *provider) Stat(filePath string) (*gospal.ObjectInfo, error) {
+	return p.StatContext(p.context, filePath)
+}
+
+func (p *provider) StatContext(ctx context.Context, filePath string) (*gospal.ObjectInfo, error) {
 	targetKey := p.getTargetKey(filePath)
-	_, err := p.uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+	result, err := p.s3Service.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
 		Bucket: &p.bucketName,
 		Key:    &targetKey,
-		Body:   reader,
 	})
 	if err != nil {
-		return 0, errors.ErrorPutStreamReader(filepath.Join(p.config.GlobalPrefix, filePath), err.Error())
+		return nil, errors.ErrorStat(targetKey, toError(err))
+	}
+	// the sdk returns the metadata keys capitalized
+	info := &gospal.ObjectInfo{
+		Key:             filePath,
+		Size:            aws.Int64Value(result.ContentLength),
+		LastModified:    aws.TimeValue(result.LastModified),
+		ETag:            strings.Trim(aws.StringValue(result.ETag), `"`),
+		ContentType:     aws.StringValue(result.ContentType),
+		ContentEncoding: aws.StringValue(result.ContentEncoding),
+		CacheControl:    aws.StringValue(result.CacheControl),
+		Metadata:        aws.StringValueMap(result.Metadata),
+	}
+	// the etag is the md5 of the contents unless the object was uploaded using multipart (etag is then suffixed by -<parts>)
+	if md5, err := hex.DecodeString(info.ETag); err == nil && len(md5) == 16 {
+		info.MD5 = md5
 	}
-	return -1, nil
+	return info, nil
 }
 
 func (p *provider) GetKind() string {
@@ -126,18 +374,22 @@ func (p *provider) GetKind() string {
 }
 
 func (p *provider) DeleteKey(filePath string) error {
+	return p.DeleteKeyContext(p.context, filePath)
+}
+
+func (p *provider) DeleteKeyContext(ctx context.Context, filePath string) error {
 	targetKey := p.getTargetKey(filePath)
-	if _, err := p.s3Service.DeleteObject(&s3.DeleteObjectInput{
+	if _, err := p.s3Service.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
 		Bucket: &p.bucketName,
 		Key:    &targetKey,
 	}); err != nil {
-		return errors.ErrorDeleteKey(path.Join(p.config.GlobalPrefix, filePath), err.Error())
+		return errors.ErrorDeleteKey(path.Join(p.config.GlobalPrefix, filePath), toError(err))
 	}
-	if err := p.s3Service.WaitUntilObjectNotExists(&s3.HeadObjectInput{
+	if err := p.s3Service.WaitUntilObjectNotExistsWithContext(ctx, &s3.HeadObjectInput{
 		Bucket: &p.bucketName,
 		Key:    &targetKey,
 	}); err != nil {
-		return errors.ErrorDeleteKey(path.Join(p.config.GlobalPrefix, filePath), err.Error())
+		return errors.ErrorDeleteKey(path.Join(p.config.GlobalPrefix, filePath), toError(err))
 	}
 	return nil
 }
@@ -146,14 +398,13 @@ func (p *provider) GetNoSuchKeyErrorString() string {
 	return p.noSuchKeyErrorString
 }
 
+// the provider is available from the factory as soon as its package is imported
+func init() {
+	registry.MustRegister(gospal.ProviderAWS, New)
+}
+
 //New aws provider constructor
 func New(ctx context.Context, bucket string, config *gospal.ProviderConfig) (gospal.Gospal, error) {
-	// fetch aws region from env
-	var region string
-
-	if region = os.Getenv("AWS_REGION"); region == "" {
-		return nil, errors.ErrorInitProvider("aws", "AWS_REGION is not set")
-	}
 	provider := provider{bucketName: bucket}
 	provider.noSuchKeyErrorString = s3.ErrCodeNoSuchKey
 	provider.config = config
@@ -166,7 +417,12 @@ func New(ctx context.Context, bucket string, config *gospal.ProviderConfig) (gos
 		cfg = config.SpecConfig.(*aws.Config)
 	}
 
-	if endpoint := os.Getenv("AWS_ENDPOINT"); endpoint != "" {
+	// the region is fetched from env unless set by the aws configuration
+	if aws.StringValue(cfg.Region) == "" && os.Getenv("AWS_REGION") == "" {
+		return nil, errors.ErrorInitProvider("aws", stderrors.New("AWS_REGION is not set"))
+	}
+
+	if endpoint := os.Getenv("AWS_ENDPOINT"); endpoint != "" && cfg.Endpoint == nil {
 		cfg.Endpoint = aws.String(endpoint)
 	}
 
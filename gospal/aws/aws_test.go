@@ -3,16 +3,24 @@ package awsprovider
 import (
 	"bytes"
 	"context"
+	stderrors "errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/gospaltest"
 	"github.com/johannesboyne/gofakes3"
 	"github.com/johannesboyne/gofakes3/backend/s3mem"
 	"io"
+	"io/ioutil"
+	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"reflect"
 	"sort"
@@ -25,9 +33,59 @@ const testBucket = "test-bucket"
 var (
 	fakeS3Backend = s3mem.New()
 	fakerS3       = gofakes3.New(fakeS3Backend)
-	tsS3          = httptest.NewServer(fakerS3.Server())
+	tsS3          = httptest.NewServer(emptyObjectHandler(copyObjectHandler(fakerS3.Server())))
 )
 
+// emptyObjectHandler implements the upload of empty objects on top of the fake s3 server, which rejects them
+func emptyObjectHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.ContentLength != 0 || r.Header.Get("X-Amz-Copy-Source") != "" || r.URL.Query().Get("uploadId") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		targetParts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+		metadata := map[string]string{}
+		for name := range r.Header {
+			if strings.HasPrefix(name, "X-Amz-Meta-") {
+				metadata[name] = r.Header.Get(name)
+			}
+		}
+		if _, err := fakeS3Backend.PutObject(targetParts[0], targetParts[1], metadata, bytes.NewReader(nil), 0); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "<Error><Code>InternalError</Code><Message>%v</Message></Error>", err.Error())
+			return
+		}
+		w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+	})
+}
+
+// copyObjectHandler implements CopyObject on top of the fake s3 server, which does not support it
+func copyObjectHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		copySource := r.Header.Get("X-Amz-Copy-Source")
+		if r.Method != http.MethodPut || copySource == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		source, _ := url.PathUnescape(copySource)
+		sourceParts := strings.SplitN(strings.TrimPrefix(source, "/"), "/", 2)
+		targetParts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+		obj, err := fakeS3Backend.GetObject(sourceParts[0], sourceParts[1], nil)
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, "<Error><Code>NoSuchKey</Code><Message>%v</Message></Error>", err.Error())
+			return
+		}
+		defer obj.Contents.Close()
+		if _, err := fakeS3Backend.PutObject(targetParts[0], targetParts[1], obj.Metadata, obj.Contents, obj.Size); err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "<Error><Code>InternalError</Code><Message>%v</Message></Error>", err.Error())
+			return
+		}
+		fmt.Fprintf(w, "<CopyObjectResult><ETag>&quot;%x&quot;</ETag></CopyObjectResult>", obj.Hash)
+	})
+}
+
 func StorageReset() {
 	fakeS3Backend.CreateBucket(testBucket)
 	_ = os.Setenv("AWS_REGION", "eu-west-1")
@@ -266,8 +324,19 @@ func Test_provider_PutStream(t *testing.T) {
 				reader:   strings.NewReader(`{"configuration": {"main_color": "#333"}, "screens": []}`),
 				fileName: "/bladibla_input.in",
 			},
-			// AWS Provider returns -1 as the number of bytes written
-			want:    -1,
+			want:    56,
+			wantErr: false,
+		},
+		{
+			name: "Should upload a stream which can not be seeked",
+			fields: fields{
+				client: awsClient,
+			},
+			args: args{
+				reader:   io.MultiReader(strings.NewReader(`{"configuration": {"main_color": "#333"}, "screens": []}`)),
+				fileName: "/bladibla_input_stream.in",
+			},
+			want:    56,
 			wantErr: false,
 		},
 		{
@@ -600,3 +669,895 @@ func Test_provider_getTargetKey(t *testing.T) {
 		})
 	}
 }
+
+func Test_provider_Stat(t *testing.T) {
+
+	StorageReset()
+	CreateStorageFiles()
+
+	awsClient, err := New(context.Background(), testBucket, &gospal.ProviderConfig{
+		TimeOut: 300,
+		SpecConfig: &aws.Config{
+			S3ForcePathStyle: aws.Bool(true),
+		},
+	})
+
+	if err != nil {
+		t.Errorf("error when instantiating aws client. err=%v", err.Error())
+	}
+
+	type fields struct {
+		client gospal.Gospal
+	}
+	type args struct {
+		fileName string
+	}
+	tests := []struct {
+		name     string
+		fields   fields
+		args     args
+		wantSize int64
+		wantMD5  bool
+		wantErr  bool
+	}{
+		{
+			name: "Should return the object attributes",
+			fields: fields{
+				client: awsClient,
+			},
+			args: args{
+				fileName: "bladibla/bladibla_3.out",
+			},
+			wantSize: int64(len(`{"configuration": {"main_color": "#567"}, "screens": [89]}`)),
+			wantMD5:  true,
+			wantErr:  false,
+		},
+		{
+			name: "Should raise with unknown key",
+			fields: fields{
+				client: awsClient,
+			},
+			args: args{
+				fileName: "bladibla_1_no_such_file.txt",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.fields.client.Stat(tt.args.fileName)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Stat() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil && !stderrors.Is(err, errors.ErrNotExist) {
+				t.Errorf("Stat() error = %v, should be %v", err, errors.ErrNotExist)
+			}
+			if err == nil {
+				if got.Key != tt.args.fileName {
+					t.Errorf("Stat() got key = %v, want %v", got.Key, tt.args.fileName)
+				}
+				if got.Size != tt.wantSize {
+					t.Errorf("Stat() got size = %v, want %v", got.Size, tt.wantSize)
+				}
+				if (got.MD5 != nil) != tt.wantMD5 {
+					t.Errorf("Stat() got md5 = %v, wantMD5 %v", got.MD5, tt.wantMD5)
+				}
+			}
+		})
+	}
+}
+
+func Test_provider_ListKeysContext(t *testing.T) {
+
+	StorageReset()
+	CreateStorageFiles()
+
+	awsClient, err := New(context.Background(), testBucket, &gospal.ProviderConfig{
+		SpecConfig: &aws.Config{
+			S3ForcePathStyle: aws.Bool(true),
+		},
+	})
+
+	if err != nil {
+		t.Errorf("error then setup fake s3 client. err=%v", err.Error())
+	}
+
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	type args struct {
+		ctx      context.Context
+		pathName []string
+	}
+	tests := []struct {
+		name         string
+		args         args
+		wantFileList []string
+		wantErr      bool
+	}{
+		{
+			name: "Should return the proper file list",
+			args: args{
+				ctx:      context.Background(),
+				pathName: []string{"bladibla/"},
+			},
+			wantFileList: []string{"bladibla/bladibla_3.out"},
+			wantErr:      false,
+		},
+		{
+			name: "Should raise with a canceled context",
+			args: args{
+				ctx:      canceledCtx,
+				pathName: []string{},
+			},
+			wantFileList: nil,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotFileList, err := awsClient.ListKeysContext(tt.args.ctx, tt.args.pathName...)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ListKeysContext() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotFileList, tt.wantFileList) {
+				t.Errorf("ListKeysContext() gotFileList = %v, want %v", gotFileList, tt.wantFileList)
+			}
+		})
+	}
+}
+
+func Test_toError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantKind error
+	}{
+		{
+			name:     "Should classify NoSuchKey as not exist",
+			err:      awserr.New(s3.ErrCodeNoSuchKey, "The specified key does not exist.", nil),
+			wantKind: errors.ErrNotExist,
+		},
+		{
+			name:     "Should classify a 404 head response as not exist",
+			err:      awserr.NewRequestFailure(awserr.New("NotFound", "Not Found", nil), 404, "bladibla"),
+			wantKind: errors.ErrNotExist,
+		},
+		{
+			name:     "Should classify a 403 response as permission denied",
+			err:      awserr.NewRequestFailure(awserr.New("Forbidden", "Forbidden", nil), 403, "bladibla"),
+			wantKind: errors.ErrPermissionDenied,
+		},
+		{
+			name:     "Should classify a 412 response as precondition failed",
+			err:      awserr.NewRequestFailure(awserr.New("PreconditionFailed", "At least one of the pre-conditions you specified did not hold", nil), 412, "bladibla"),
+			wantKind: errors.ErrPreconditionFailed,
+		},
+		{
+			name:     "Should classify canceled requests",
+			err:      awserr.New(request.CanceledErrorCode, "request context canceled", context.Canceled),
+			wantKind: errors.ErrCanceled,
+		},
+		{
+			name:     "Should classify internal errors as transient",
+			err:      awserr.New("InternalError", "We encountered an internal error. Please try again.", nil),
+			wantKind: errors.ErrTransient,
+		},
+		{
+			name:     "Should classify SlowDown as transient",
+			err:      awserr.NewRequestFailure(awserr.New("SlowDown", "Please reduce your request rate.", nil), 503, "bladibla"),
+			wantKind: errors.ErrTransient,
+		},
+		{
+			name:     "Should classify a 503 head response as transient",
+			err:      awserr.NewRequestFailure(awserr.New("ServiceUnavailable", "Service Unavailable", nil), 503, "bladibla"),
+			wantKind: errors.ErrTransient,
+		},
+		{
+			name:     "Should classify failed requests as transient",
+			err:      awserr.New(request.ErrCodeRequestError, "send request failed", stderrors.New("connection reset by peer")),
+			wantKind: errors.ErrTransient,
+		},
+		{
+			name:     "Should not classify unknown errors",
+			err:      awserr.New("InvalidArgument", "Invalid Argument", nil),
+			wantKind: nil,
+		},
+	}
+	kinds := []error{errors.ErrNotExist, errors.ErrPermissionDenied, errors.ErrAlreadyExists, errors.ErrPreconditionFailed, errors.ErrCanceled, errors.ErrTransient}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := toError(tt.err)
+			for _, kind := range kinds {
+				if stderrors.Is(got, kind) != (kind == tt.wantKind) {
+					t.Errorf("toError() = %v, is %v: %v, want %v", got, kind, stderrors.Is(got, kind), tt.wantKind)
+				}
+			}
+			var aerr awserr.Error
+			if !stderrors.As(got, &aerr) {
+				t.Errorf("toError() = %v should unwrap to the aws error", got)
+			}
+		})
+	}
+}
+
+func Test_provider_ObjectsFrom(t *testing.T) {
+
+	StorageReset()
+	keys := []string{"iterator/a.txt", "iterator/b.txt", "iterator/c/d.txt", "iterator/e.txt", "iterator/f.txt"}
+	for _, key := range keys {
+		if _, err := fakeS3Backend.PutObject(testBucket, key, make(map[string]string, 0), strings.NewReader(key), int64(len(key))); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", key, err.Error())
+		}
+	}
+
+	awsClient, err := New(context.Background(), testBucket, &gospal.ProviderConfig{
+		MaxKeys: 2,
+		SpecConfig: &aws.Config{
+			S3ForcePathStyle: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		t.Errorf("error then setup fake s3 client. err=%v", err.Error())
+	}
+
+	tests := []struct {
+		name       string
+		stopAfter  int
+		wantResume []string
+	}{
+		{
+			name:       "Should resume from the first page",
+			stopAfter:  1,
+			wantResume: keys,
+		},
+		{
+			name:       "Should resume from the beginning of the current page",
+			stopAfter:  4,
+			wantResume: keys[2:],
+		},
+		{
+			name:       "Should resume from the last page",
+			stopAfter:  5,
+			wantResume: keys[4:],
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it := awsClient.Objects(context.Background(), "iterator/")
+			var got []string
+			for len(got) < tt.stopAfter && it.Next() {
+				got = append(got, it.Object().Key)
+				if it.Object().Size != int64(len(it.Object().Key)) {
+					t.Errorf("Objects() got size = %v, want %v", it.Object().Size, len(it.Object().Key))
+				}
+			}
+			if err := it.Err(); err != nil {
+				t.Errorf("Objects() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, keys[:tt.stopAfter]) {
+				t.Errorf("Objects() got = %v, want %v", got, keys[:tt.stopAfter])
+			}
+			resumed := awsClient.ObjectsFrom(context.Background(), "iterator/", it.PageToken())
+			var gotResume []string
+			for resumed.Next() {
+				gotResume = append(gotResume, resumed.Object().Key)
+			}
+			if err := resumed.Err(); err != nil {
+				t.Errorf("ObjectsFrom() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(gotResume, tt.wantResume) {
+				t.Errorf("ObjectsFrom() got = %v, want %v", gotResume, tt.wantResume)
+			}
+		})
+	}
+}
+
+func Test_provider_ListDir(t *testing.T) {
+
+	StorageReset()
+	for _, key := range []string{"listdir/a.txt", "listdir/b/c.txt", "listdir/b/d/e.txt", "listdir/f/g.txt", "listdir/h.txt"} {
+		if _, err := fakeS3Backend.PutObject(testBucket, key, make(map[string]string, 0), strings.NewReader(key), int64(len(key))); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", key, err.Error())
+		}
+	}
+
+	awsClient, err := New(context.Background(), testBucket, &gospal.ProviderConfig{
+		SpecConfig: &aws.Config{
+			S3ForcePathStyle: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		t.Errorf("error then setup fake s3 client. err=%v", err.Error())
+	}
+
+	tests := []struct {
+		name         string
+		prefix       string
+		wantKeys     []string
+		wantPrefixes []string
+		wantErr      bool
+	}{
+		{
+			name:         "Should list keys and sub prefixes",
+			prefix:       "listdir",
+			wantKeys:     []string{"listdir/a.txt", "listdir/h.txt"},
+			wantPrefixes: []string{"listdir/b/", "listdir/f/"},
+			wantErr:      false,
+		},
+		{
+			name:         "Should list a sub directory",
+			prefix:       "listdir/b/",
+			wantKeys:     []string{"listdir/b/c.txt"},
+			wantPrefixes: []string{"listdir/b/d/"},
+			wantErr:      false,
+		},
+		{
+			name:         "Should return nothing for an unknown directory",
+			prefix:       "listdir/bladibla",
+			wantKeys:     nil,
+			wantPrefixes: nil,
+			wantErr:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotKeys, gotPrefixes, err := awsClient.ListDir(tt.prefix)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ListDir() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotKeys, tt.wantKeys) {
+				t.Errorf("ListDir() gotKeys = %v, want %v", gotKeys, tt.wantKeys)
+			}
+			if !reflect.DeepEqual(gotPrefixes, tt.wantPrefixes) {
+				t.Errorf("ListDir() gotPrefixes = %v, want %v", gotPrefixes, tt.wantPrefixes)
+			}
+		})
+	}
+
+	// a prefix spanning several pages is listed once
+	pagedClient, err := New(context.Background(), testBucket, &gospal.ProviderConfig{
+		MaxKeys: 1,
+		SpecConfig: &aws.Config{
+			S3ForcePathStyle: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		t.Errorf("error then setup fake s3 client. err=%v", err.Error())
+		return
+	}
+	if _, gotPrefixes, err := pagedClient.ListDir("listdir/b/"); err != nil || !reflect.DeepEqual(gotPrefixes, []string{"listdir/b/d/"}) {
+		t.Errorf("ListDir() got = %v, %v, want %v", gotPrefixes, err, []string{"listdir/b/d/"})
+	}
+	if _, gotPrefixes, err := pagedClient.ListDir("listdir"); err != nil || !reflect.DeepEqual(gotPrefixes, []string{"listdir/b/", "listdir/f/"}) {
+		t.Errorf("ListDir() got = %v, %v, want %v", gotPrefixes, err, []string{"listdir/b/", "listdir/f/"})
+	}
+}
+
+func Test_provider_Copy(t *testing.T) {
+
+	StorageReset()
+	CreateStorageFiles()
+
+	awsClient, err := New(context.Background(), testBucket, &gospal.ProviderConfig{
+		TimeOut: 300,
+		SpecConfig: &aws.Config{
+			S3ForcePathStyle: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		t.Errorf("error when instantiating aws client. err=%v", err.Error())
+	}
+
+	type args struct {
+		src string
+		dst string
+	}
+	tests := []struct {
+		name    string
+		move    bool
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "Should copy the key",
+			args: args{
+				src: "bladibla_2.txt",
+				dst: "copy/bladibla_2 copy.txt",
+			},
+			want:    `{"configuration": {"main_color": "#345"}, "screens": [1,2]}`,
+			wantErr: false,
+		},
+		{
+			name: "Should move the key",
+			move: true,
+			args: args{
+				src: "bladibla/bladibla_3.out",
+				dst: "move/bladibla_3.out",
+			},
+			want:    `{"configuration": {"main_color": "#567"}, "screens": [89]}`,
+			wantErr: false,
+		},
+		{
+			name: "Should raise with unknown key",
+			args: args{
+				src: "bladibla_no_such_file.txt",
+				dst: "copy/bladibla_no_such_file.txt",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.move {
+				err = awsClient.Move(tt.args.src, tt.args.dst)
+			} else {
+				err = awsClient.Copy(tt.args.src, tt.args.dst)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Copy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				if !stderrors.Is(err, errors.ErrNotExist) {
+					t.Errorf("Copy() error = %v, should be %v", err, errors.ErrNotExist)
+				}
+				return
+			}
+			obj, err := fakeS3Backend.GetObject(testBucket, tt.args.dst, nil)
+			if err != nil {
+				t.Errorf("Copy() destination not found. err=%v", err.Error())
+				return
+			}
+			defer obj.Contents.Close()
+			if data, _ := ioutil.ReadAll(obj.Contents); string(data) != tt.want {
+				t.Errorf("Copy() got = %v, want %v", string(data), tt.want)
+			}
+			if _, err := fakeS3Backend.HeadObject(testBucket, tt.args.src); (err != nil) != tt.move {
+				t.Errorf("Copy() source exists = %v, want %v", err == nil, !tt.move)
+			}
+		})
+	}
+}
+
+func Test_provider_DeleteKeys(t *testing.T) {
+
+	StorageReset()
+	// more keys than a single DeleteObjects request accepts
+	var batchKeys []string
+	for i := 0; i < maxDeleteObjectsKeys+10; i++ {
+		batchKeys = append(batchKeys, fmt.Sprintf("delete/batch/%04d.txt", i))
+	}
+	for _, key := range append(batchKeys, "delete/a.txt", "delete/b.txt", "delete/dir/c.txt", "delete/dir/d/e.txt", "delete/directory.txt") {
+		if _, err := fakeS3Backend.PutObject(testBucket, key, make(map[string]string, 0), strings.NewReader(key), int64(len(key))); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", key, err.Error())
+		}
+	}
+
+	awsClient, err := New(context.Background(), testBucket, &gospal.ProviderConfig{
+		SpecConfig: &aws.Config{
+			S3ForcePathStyle: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		t.Errorf("error then setup fake s3 client. err=%v", err.Error())
+	}
+
+	tests := []struct {
+		name     string
+		keys     []string
+		prefix   string
+		wantKeys []string
+		wantErr  bool
+	}{
+		{
+			name:     "Should delete the keys",
+			keys:     []string{"delete/a.txt", "delete/b.txt"},
+			wantKeys: append([]string{"delete/dir/c.txt", "delete/dir/d/e.txt", "delete/directory.txt"}, batchKeys...),
+			wantErr:  false,
+		},
+		{
+			name:     "Should delete the keys in several batches",
+			keys:     batchKeys,
+			wantKeys: []string{"delete/dir/c.txt", "delete/dir/d/e.txt", "delete/directory.txt"},
+			wantErr:  false,
+		},
+		{
+			name:     "Should delete the keys under the prefix",
+			prefix:   "delete/dir/",
+			wantKeys: []string{"delete/directory.txt"},
+			wantErr:  false,
+		},
+		{
+			name:     "Should do nothing on an empty prefix",
+			prefix:   "delete/nothing/",
+			wantKeys: []string{"delete/directory.txt"},
+			wantErr:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.keys != nil {
+				err = awsClient.DeleteKeys(tt.keys)
+			} else {
+				err = awsClient.DeletePrefix(tt.prefix)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("DeleteKeys() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			got, err := awsClient.ListKeys("delete")
+			if err != nil {
+				t.Errorf("ListKeys() error = %v", err)
+				return
+			}
+			sort.Strings(got)
+			sort.Strings(tt.wantKeys)
+			if !reflect.DeepEqual(got, tt.wantKeys) {
+				t.Errorf("DeleteKeys() remaining keys = %v, want %v", got, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func Test_provider_GetRange(t *testing.T) {
+
+	StorageReset()
+	CreateStorageFiles()
+	content := `{"configuration": {"main_color": "#123"}, "screens": []}`
+
+	awsClient, err := New(context.Background(), testBucket, &gospal.ProviderConfig{
+		TimeOut: 300,
+		SpecConfig: &aws.Config{
+			S3ForcePathStyle: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		t.Errorf("error when instantiating aws client. err=%v", err.Error())
+	}
+
+	type args struct {
+		key    string
+		offset int64
+		length int64
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "Should fetch the range",
+			args:    args{key: "bladibla_1.txt", offset: 2, length: 13},
+			want:    content[2:15],
+			wantErr: false,
+		},
+		{
+			name:    "Should fetch up to the end",
+			args:    args{key: "bladibla_1.txt", offset: 42, length: -1},
+			want:    content[42:],
+			wantErr: false,
+		},
+		{
+			name:    "Should fetch nothing",
+			args:    args{key: "bladibla_1.txt", offset: 2, length: 0},
+			want:    "",
+			wantErr: false,
+		},
+		{
+			name:    "Should raise with unknown key",
+			args:    args{key: "bladibla_no_such_file.txt", offset: 2, length: 13},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, cancel, err := awsClient.GetRange(tt.args.key, tt.args.offset, tt.args.length)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetRange() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				if !stderrors.Is(err, errors.ErrNotExist) {
+					t.Errorf("GetRange() error = %v, should be %v", err, errors.ErrNotExist)
+				}
+				return
+			}
+			defer cancel()
+			if data, _ := ioutil.ReadAll(got); string(data) != tt.want {
+				t.Errorf("GetRange() got = %v, want %v", string(data), tt.want)
+			}
+		})
+	}
+}
+
+func Test_provider_Open(t *testing.T) {
+
+	StorageReset()
+	CreateStorageFiles()
+	content := `{"configuration": {"main_color": "#123"}, "screens": []}`
+
+	awsClient, err := New(context.Background(), testBucket, &gospal.ProviderConfig{
+		TimeOut: 300,
+		SpecConfig: &aws.Config{
+			S3ForcePathStyle: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		t.Errorf("error when instantiating aws client. err=%v", err.Error())
+	}
+
+	if _, err := awsClient.Open("bladibla_no_such_file.txt"); !stderrors.Is(err, errors.ErrNotExist) {
+		t.Errorf("Open() error = %v, should be %v", err, errors.ErrNotExist)
+	}
+
+	reader, err := awsClient.Open("bladibla_1.txt")
+	if err != nil {
+		t.Errorf("Open() error = %v", err)
+		return
+	}
+	defer reader.Close()
+	if reader.Size() != int64(len(content)) {
+		t.Errorf("Open() size = %v, want %v", reader.Size(), len(content))
+	}
+	// the reader should satisfy the standard library random access helpers
+	section := io.NewSectionReader(reader, 19, 12)
+	if data, _ := ioutil.ReadAll(section); string(data) != content[19:31] {
+		t.Errorf("ReadAt() got = %v, want %v", string(data), content[19:31])
+	}
+	buf := make([]byte, 10)
+	if n, err := reader.ReadAt(buf, int64(len(content)-4)); n != 4 || err != io.EOF || string(buf[:n]) != content[len(content)-4:] {
+		t.Errorf("ReadAt() got = %v, %v, want %v, %v", string(buf[:n]), err, content[len(content)-4:], io.EOF)
+	}
+	if _, err := reader.Seek(-4, io.SeekEnd); err != nil {
+		t.Errorf("Seek() error = %v", err)
+	}
+	if data, _ := ioutil.ReadAll(reader); string(data) != content[len(content)-4:] {
+		t.Errorf("Read() got = %v, want %v", string(data), content[len(content)-4:])
+	}
+	if _, err := reader.Seek(2, io.SeekStart); err != nil {
+		t.Errorf("Seek() error = %v", err)
+	}
+	if _, err := io.ReadFull(reader, buf); err != nil || string(buf) != content[2:12] {
+		t.Errorf("Read() got = %v, %v, want %v", string(buf), err, content[2:12])
+	}
+}
+
+func Test_provider_PutStreamOptions(t *testing.T) {
+
+	StorageReset()
+
+	awsClient, err := New(context.Background(), testBucket, &gospal.ProviderConfig{
+		TimeOut: 300,
+		SpecConfig: &aws.Config{
+			S3ForcePathStyle: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		t.Errorf("error when instantiating aws client. err=%v", err.Error())
+	}
+
+	// the fake server only keeps the user metadata, not the standard headers such as Content-Type
+	if _, err := awsClient.PutStream("options.json", strings.NewReader("{}"),
+		gospal.WithContentType("application/json"),
+		gospal.WithMetadata(map[string]string{"owner": "bladibla"}),
+	); err != nil {
+		t.Errorf("PutStream() error = %v", err)
+		return
+	}
+	got, err := awsClient.Stat("options.json")
+	if err != nil {
+		t.Errorf("Stat() error = %v", err)
+		return
+	}
+	if want := map[string]string{"Owner": "bladibla"}; !reflect.DeepEqual(got.Metadata, want) {
+		t.Errorf("Stat() metadata = %v, want %v", got.Metadata, want)
+	}
+}
+
+func Test_provider_NewReader(t *testing.T) {
+
+	StorageReset()
+	CreateStorageFiles()
+
+	awsClient, err := New(context.Background(), testBucket, &gospal.ProviderConfig{
+		TimeOut: 300,
+		SpecConfig: &aws.Config{
+			S3ForcePathStyle: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		t.Errorf("error when instantiating aws client. err=%v", err.Error())
+	}
+
+	if _, err := awsClient.NewReader(context.Background(), "bladibla_no_such_file.txt"); !stderrors.Is(err, errors.ErrNotExist) {
+		t.Errorf("NewReader() error = %v, should be %v", err, errors.ErrNotExist)
+	}
+
+	reader, err := awsClient.NewReader(context.Background(), "bladibla_2.txt")
+	if err != nil {
+		t.Errorf("NewReader() error = %v", err)
+		return
+	}
+	if data, _ := ioutil.ReadAll(reader); string(data) != `{"configuration": {"main_color": "#345"}, "screens": [1,2]}` {
+		t.Errorf("NewReader() got = %v", string(data))
+	}
+	if err := reader.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
+
+func Test_provider_NewWriter(t *testing.T) {
+
+	StorageReset()
+
+	awsClient, err := New(context.Background(), testBucket, &gospal.ProviderConfig{
+		TimeOut: 300,
+		SpecConfig: &aws.Config{
+			S3ForcePathStyle: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		t.Errorf("error when instantiating aws client. err=%v", err.Error())
+	}
+
+	tests := []struct {
+		name    string
+		key     string
+		cancel  bool
+		wantErr bool
+	}{
+		{
+			name:    "Should upload the object on close",
+			key:     "writer/committed.txt",
+			cancel:  false,
+			wantErr: false,
+		},
+		{
+			name:    "Should abort on canceled context",
+			key:     "writer/aborted.txt",
+			cancel:  true,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			writer, err := awsClient.NewWriter(ctx, tt.key)
+			if err != nil {
+				t.Errorf("NewWriter() error = %v", err)
+				return
+			}
+			if tt.cancel {
+				cancel()
+			}
+			// the write may fail as soon as the upload is aborted
+			io.WriteString(writer, "written by a writer")
+			if err := writer.Close(); (err != nil) != tt.wantErr {
+				t.Errorf("Close() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			obj, err := fakeS3Backend.GetObject(testBucket, tt.key, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewWriter() object error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			defer obj.Contents.Close()
+			if data, _ := ioutil.ReadAll(obj.Contents); string(data) != "written by a writer" {
+				t.Errorf("NewWriter() got = %v, want %v", string(data), "written by a writer")
+			}
+		})
+	}
+}
+
+func Test_provider_GlobalPrefix(t *testing.T) {
+
+	StorageReset()
+	for _, key := range []string{"tenant/a.txt", "tenant/b/c.txt", "tenant2/d.txt"} {
+		if _, err := fakeS3Backend.PutObject(testBucket, key, map[string]string{}, strings.NewReader(key), int64(len(key))); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", key, err.Error())
+			return
+		}
+	}
+
+	awsClient, err := New(context.Background(), testBucket, &gospal.ProviderConfig{
+		TimeOut:      300,
+		GlobalPrefix: "tenant",
+		SpecConfig: &aws.Config{
+			S3ForcePathStyle: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		t.Errorf("error when instantiating aws client. err=%v", err.Error())
+		return
+	}
+
+	// the keys are relative to the global prefix, the sibling tenant2 is not listed
+	keys, err := awsClient.ListKeys()
+	if err != nil {
+		t.Errorf("ListKeys() error = %v", err)
+		return
+	}
+	if want := []string{"a.txt", "b/c.txt"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("ListKeys() got = %v, want %v", keys, want)
+	}
+	gotKeys, gotPrefixes, err := awsClient.ListDir("")
+	if err != nil || !reflect.DeepEqual(gotKeys, []string{"a.txt"}) || !reflect.DeepEqual(gotPrefixes, []string{"b/"}) {
+		t.Errorf("ListDir() got = %v, %v, %v", gotKeys, gotPrefixes, err)
+	}
+	// and can be fed back to the provider
+	for _, key := range keys {
+		reader, err := awsClient.NewReader(context.Background(), key)
+		if err != nil {
+			t.Errorf("NewReader() error = %v", err)
+			continue
+		}
+		if data, _ := ioutil.ReadAll(reader); string(data) != "tenant/"+key {
+			t.Errorf("NewReader() got = %v, want %v", string(data), "tenant/"+key)
+		}
+		reader.Close()
+		if err := awsClient.DeleteKey(key); err != nil {
+			t.Errorf("DeleteKey() error = %v", err)
+		}
+	}
+	if _, err := fakeS3Backend.HeadObject(testBucket, "tenant2/d.txt"); err != nil {
+		t.Errorf("DeleteKey() should have kept tenant2/d.txt. err=%v", err)
+	}
+	if keys, err := awsClient.ListKeys(); err != nil || len(keys) != 0 {
+		t.Errorf("ListKeys() got = %v, %v, want no keys", keys, err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	var buckets int
+	gospaltest.RunConformance(t, func(t *testing.T) (gospal.Gospal, func()) {
+		// each test is given its own empty bucket
+		buckets++
+		bucket := fmt.Sprintf("conformance-%d", buckets)
+		StorageReset()
+		if err := fakeS3Backend.CreateBucket(bucket); err != nil {
+			t.Fatalf("unable to create bucket %v for tests. err=%v", bucket, err.Error())
+		}
+		awsClient, err := New(context.Background(), bucket, &gospal.ProviderConfig{
+			TimeOut: 300,
+			MaxKeys: 2,
+			SpecConfig: &aws.Config{
+				S3ForcePathStyle: aws.Bool(true),
+			},
+		})
+		if err != nil {
+			t.Fatalf("error when instantiating aws client. err=%v", err.Error())
+		}
+		return awsClient, func() {}
+	})
+}
+
+func TestConfigConformance(t *testing.T) {
+	var buckets int
+	gospaltest.RunConfigConformance(t, func(t *testing.T, config *gospal.ProviderConfig) (gospal.Gospal, func()) {
+		buckets++
+		bucket := fmt.Sprintf("config-conformance-%d", buckets)
+		StorageReset()
+		if err := fakeS3Backend.CreateBucket(bucket); err != nil {
+			t.Fatalf("unable to create bucket %v for tests. err=%v", bucket, err.Error())
+		}
+		config.TimeOut = 300
+		config.SpecConfig = &aws.Config{S3ForcePathStyle: aws.Bool(true)}
+		awsClient, err := New(context.Background(), bucket, config)
+		if err != nil {
+			t.Fatalf("error when instantiating aws client. err=%v", err.Error())
+		}
+		return awsClient, func() {}
+	})
+}
@@ -0,0 +1,127 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package awsprovider
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"net/url"
+)
+
+const (
+	// objects bigger than this can not be copied using a single CopyObject request
+	maxCopyObjectSize = 5 * 1024 * 1024 * 1024
+	// size of each part of a multipart copy. S3 allows at most 10000 parts, so up to 5TB objects
+	copyPartSize = 512 * 1024 * 1024
+)
+
+func (p *provider) Copy(src string, dst string) error {
+	return p.CopyContext(p.context, src, dst)
+}
+
+func (p *provider) CopyContext(ctx context.Context, src string, dst string) error {
+	srcKey, dstKey := p.getTargetKey(src), p.getTargetKey(dst)
+	head, err := p.s3Service.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: &p.bucketName,
+		Key:    &srcKey,
+	})
+	if err != nil {
+		return errors.ErrorCopyKey(srcKey, dstKey, toError(err))
+	}
+	// the copy source is the url encoded bucket/key
+	copySource := (&url.URL{Path: p.bucketName + "/" + srcKey}).EscapedPath()
+	if aws.Int64Value(head.ContentLength) <= maxCopyObjectSize {
+		_, err = p.s3Service.CopyObjectWithContext(ctx, &s3.CopyObjectInput{
+			Bucket:     &p.bucketName,
+			Key:        &dstKey,
+			CopySource: &copySource,
+		})
+	} else {
+		err = p.multipartCopy(ctx, head, copySource, dstKey)
+	}
+	if err != nil {
+		return errors.ErrorCopyKey(srcKey, dstKey, toError(err))
+	}
+	return nil
+}
+
+// multipartCopy copies objects bigger than 5GB one part at a time, using UploadPartCopy
+func (p *provider) multipartCopy(ctx context.Context, head *s3.HeadObjectOutput, copySource string, dstKey string) error {
+	// unlike CopyObject, the metadata of the source object are not copied along
+	upload, err := p.s3Service.CreateMultipartUploadWithContext(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:             &p.bucketName,
+		Key:                &dstKey,
+		CacheControl:       head.CacheControl,
+		ContentDisposition: head.ContentDisposition,
+		ContentEncoding:    head.ContentEncoding,
+		ContentLanguage:    head.ContentLanguage,
+		ContentType:        head.ContentType,
+		Metadata:           head.Metadata,
+	})
+	if err != nil {
+		return err
+	}
+	var parts []*s3.CompletedPart
+	size := aws.Int64Value(head.ContentLength)
+	for start, partNumber := int64(0), int64(1); start < size; start, partNumber = start+copyPartSize, partNumber+1 {
+		end := start + copyPartSize - 1
+		if end >= size {
+			end = size - 1
+		}
+		part, err := p.s3Service.UploadPartCopyWithContext(ctx, &s3.UploadPartCopyInput{
+			Bucket:          &p.bucketName,
+			Key:             &dstKey,
+			CopySource:      &copySource,
+			CopySourceRange: aws.String(fmt.Sprintf("bytes=%d-%d", start, end)),
+			PartNumber:      aws.Int64(partNumber),
+			UploadId:        upload.UploadId,
+		})
+		if err != nil {
+			// do not leave the parts already copied behind. the context may be done, do not use it
+			_, _ = p.s3Service.AbortMultipartUpload(&s3.AbortMultipartUploadInput{
+				Bucket:   &p.bucketName,
+				Key:      &dstKey,
+				UploadId: upload.UploadId,
+			})
+			return err
+		}
+		parts = append(parts, &s3.CompletedPart{ETag: part.CopyPartResult.ETag, PartNumber: aws.Int64(partNumber)})
+	}
+	_, err = p.s3Service.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          &p.bucketName,
+		Key:             &dstKey,
+		UploadId:        upload.UploadId,
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: parts},
+	})
+	return err
+}
+
+func (p *provider) Move(src string, dst string) error {
+	return p.MoveContext(p.context, src, dst)
+}
+
+func (p *provider) MoveContext(ctx context.Context, src string, dst string) error {
+	// s3 has no rename, the object is copied then removed
+	if err := p.CopyContext(ctx, src, dst); err != nil {
+		return errors.ErrorMoveKey(p.getTargetKey(src), p.getTargetKey(dst), err)
+	}
+	if err := p.DeleteKeyContext(ctx, src); err != nil {
+		return errors.ErrorMoveKey(p.getTargetKey(src), p.getTargetKey(dst), err)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package awsprovider
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/contentsquare/gospal/gospal/errors"
+)
+
+// max number of keys a single DeleteObjects request accepts
+const maxDeleteObjectsKeys = 1000
+
+func (p *provider) DeleteKeys(filePaths []string) error {
+	return p.DeleteKeysContext(p.context, filePaths)
+}
+
+func (p *provider) DeleteKeysContext(ctx context.Context, filePaths []string) error {
+	failures := map[string]error{}
+	for start := 0; start < len(filePaths); start += maxDeleteObjectsKeys {
+		end := start + maxDeleteObjectsKeys
+		if end > len(filePaths) {
+			end = len(filePaths)
+		}
+		batch := map[string]string{}
+		for _, filePath := range filePaths[start:end] {
+			batch[p.getTargetKey(filePath)] = filePath
+		}
+		p.deleteObjects(ctx, batch, failures)
+	}
+	return errors.ErrorDeleteKeys(failures)
+}
+
+func (p *provider) DeletePrefix(prefix string) error {
+	return p.DeletePrefixContext(p.context, prefix)
+}
+
+func (p *provider) DeletePrefixContext(ctx context.Context, prefix string) error {
+	failures := map[string]error{}
+	batch := map[string]string{}
+	// the listing is flat, the keys under the nested prefixes being removed whatever the delimiter
+	it := p.objects(ctx, prefix, "", "")
+	for it.Next() {
+		batch[p.getTargetKey(it.Object().Key)] = it.Object().Key
+		if len(batch) == maxDeleteObjectsKeys {
+			p.deleteObjects(ctx, batch, failures)
+			batch = map[string]string{}
+		}
+	}
+	if len(batch) > 0 {
+		p.deleteObjects(ctx, batch, failures)
+	}
+	return errors.ErrorDeletePrefix(it.Err(), failures)
+}
+
+// deleteObjects removes the batch of target keys using a single DeleteObjects request, the failures are reported
+// under the key given by the caller
+func (p *provider) deleteObjects(ctx context.Context, batch map[string]string, failures map[string]error) {
+	objects := make([]*s3.ObjectIdentifier, 0, len(batch))
+	for targetKey := range batch {
+		objects = append(objects, &s3.ObjectIdentifier{Key: aws.String(targetKey)})
+	}
+	out, err := p.s3Service.DeleteObjectsWithContext(ctx, &s3.DeleteObjectsInput{
+		Bucket: &p.bucketName,
+		Delete: &s3.Delete{
+			Objects: objects,
+			// only the failures are returned
+			Quiet: aws.Bool(true),
+		},
+	})
+	if err != nil {
+		// the whole batch failed
+		for targetKey, filePath := range batch {
+			failures[filePath] = errors.ErrorDeleteKey(targetKey, toError(err))
+		}
+		return
+	}
+	for _, deleteErr := range out.Errors {
+		targetKey := aws.StringValue(deleteErr.Key)
+		err := awserr.New(aws.StringValue(deleteErr.Code), aws.StringValue(deleteErr.Message), nil)
+		failures[batch[targetKey]] = errors.ErrorDeleteKey(targetKey, toError(err))
+	}
+}
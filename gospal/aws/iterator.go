@@ -0,0 +1,98 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package awsprovider
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"strings"
+)
+
+// objectIterator iterates over a s3 listing. The page token is the marker used to fetch the current page
+type objectIterator struct {
+	ctx       context.Context
+	p         *provider
+	params    s3.ListObjectsInput
+	page      []*s3.Object
+	pageToken string
+	marker    string
+	done      bool
+	current   *gospal.ObjectInfo
+	err       error
+}
+
+func (it *objectIterator) fetch() error {
+	if it.marker != "" {
+		it.params.Marker = aws.String(it.marker)
+	}
+	out, err := it.p.s3Service.ListObjectsWithContext(it.ctx, &it.params)
+	if err != nil {
+		return errors.ErrorListKeysError(aws.StringValue(it.params.Prefix), toError(err))
+	}
+	it.pageToken = it.marker
+	it.page = out.Contents
+	if !aws.BoolValue(out.IsTruncated) {
+		it.done = true
+		return nil
+	}
+	// NextMarker is only returned when a delimiter is set, the last key of the page is used otherwise
+	if it.marker = aws.StringValue(out.NextMarker); it.marker == "" && len(out.Contents) > 0 {
+		it.marker = aws.StringValue(out.Contents[len(out.Contents)-1].Key)
+	}
+	return nil
+}
+
+func (it *objectIterator) Next() bool {
+	for {
+		if it.err != nil {
+			return false
+		}
+		if len(it.page) == 0 {
+			if it.done {
+				return false
+			}
+			it.err = it.fetch()
+			continue
+		}
+		obj := it.page[0]
+		it.page = it.page[1:]
+		// keys ending with a slash are directory placeholders
+		if strings.HasSuffix(aws.StringValue(obj.Key), "/") {
+			continue
+		}
+		it.current = &gospal.ObjectInfo{
+			Key:          it.p.toKey(aws.StringValue(obj.Key)),
+			Size:         aws.Int64Value(obj.Size),
+			LastModified: aws.TimeValue(obj.LastModified),
+			ETag:         strings.Trim(aws.StringValue(obj.ETag), `"`),
+		}
+		return true
+	}
+}
+
+func (it *objectIterator) Object() *gospal.ObjectInfo {
+	return it.current
+}
+
+func (it *objectIterator) Err() error {
+	return it.err
+}
+
+func (it *objectIterator) PageToken() string {
+	return it.pageToken
+}
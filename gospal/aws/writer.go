@@ -0,0 +1,36 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package awsprovider
+
+import (
+	"context"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"io"
+	"path/filepath"
+)
+
+// NewWriter returns a writer which Close completes the upload
+func (p *provider) NewWriter(ctx context.Context, filePath string, opts ...gospal.PutOption) (io.WriteCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.ErrorPutStreamReader(filepath.Join(p.config.GlobalPrefix, filePath), toError(err))
+	}
+	return gospal.NewPipeWriter(ctx, func(ctx context.Context, reader io.Reader) error {
+		if _, err := p.uploader.UploadWithContext(ctx, p.uploadInput(filePath, reader, opts...)); err != nil {
+			return errors.ErrorPutStreamReader(filepath.Join(p.config.GlobalPrefix, filePath), toError(err))
+		}
+		return nil
+	}), nil
+}
@@ -0,0 +1,418 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package azureprovider
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/internal/registry"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	// size of the blocks of the uploads, blobs are made of at most 50000 blocks
+	uploadBufferSize = 4 * 1024 * 1024
+	// number of blocks uploaded concurrently, each holding a buffer
+	uploadMaxBuffers = 4
+)
+
+// Config is the azure specific configuration, given as ProviderConfig.SpecConfig. The bucket is the name of the
+// container
+type Config struct {
+	// AccountName of the storage account, read from AZURE_STORAGE_ACCOUNT when not set
+	AccountName string
+
+	// AccountKey of the storage account, read from AZURE_STORAGE_KEY when not set. The requests are anonymous when
+	// neither the account key nor the credential are set
+	AccountKey string
+
+	// Credential overrides the shared key credential of the account key, eg.: azblob.NewTokenCredential
+	Credential azblob.Credential
+
+	// Endpoint of the blob service, https://<account name>.blob.core.windows.net by default. Local stand-ins such as
+	// Azurite hold the account in the path, eg.: http://127.0.0.1:10000/devstoreaccount1
+	Endpoint string
+
+	// PipelineOptions of the requests, eg.: the retry policy
+	PipelineOptions azblob.PipelineOptions
+}
+
+type provider struct {
+	context              context.Context
+	container            azblob.ContainerURL
+	bucketName           string
+	kind                 string
+	noSuchKeyErrorString string
+
+	config *gospal.ProviderConfig
+}
+
+// toError classifies an azure sdk error as one of the gospal errors
+func toError(err error) error {
+	if stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded) {
+		return errors.Wrap(errors.ErrCanceled, err)
+	}
+	var serr azblob.StorageError
+	if !stderrors.As(err, &serr) {
+		return err
+	}
+	switch serr.ServiceCode() {
+	case azblob.ServiceCodeBlobNotFound, azblob.ServiceCodeContainerNotFound, azblob.ServiceCodeCannotVerifyCopySource:
+		return errors.Wrap(errors.ErrNotExist, err)
+	case azblob.ServiceCodeAuthenticationFailed, azblob.ServiceCodeInsufficientAccountPermissions:
+		return errors.Wrap(errors.ErrPermissionDenied, err)
+	case azblob.ServiceCodeBlobAlreadyExists, azblob.ServiceCodeContainerAlreadyExists:
+		return errors.Wrap(errors.ErrAlreadyExists, err)
+	case azblob.ServiceCodeConditionNotMet:
+		return errors.Wrap(errors.ErrPreconditionFailed, err)
+	case azblob.ServiceCodeServerBusy, azblob.ServiceCodeInternalError, azblob.ServiceCodeOperationTimedOut:
+		return errors.Wrap(errors.ErrTransient, err)
+	}
+	// HEAD responses have no body, the error code is then derived from the status code
+	if response := serr.Response(); response != nil {
+		switch response.StatusCode {
+		case 404:
+			return errors.Wrap(errors.ErrNotExist, err)
+		case 401, 403:
+			return errors.Wrap(errors.ErrPermissionDenied, err)
+		case 409:
+			return errors.Wrap(errors.ErrAlreadyExists, err)
+		case 412:
+			return errors.Wrap(errors.ErrPreconditionFailed, err)
+		case 429, 500, 502, 503, 504:
+			return errors.Wrap(errors.ErrTransient, err)
+		}
+	}
+	return err
+}
+
+func (p *provider) getTargetKey(filePath string) string {
+	return gospal.TargetKey(p.config.GlobalPrefix, filePath)
+}
+
+// getTargetPrefix returns the listing prefix of the specified prefix. The global prefix being a directory, the keys of
+// its siblings should not be listed
+func (p *provider) getTargetPrefix(prefix string) string {
+	targetKey := p.getTargetKey(prefix)
+	if p.config.GlobalPrefix != "" && (prefix == "" || strings.HasSuffix(prefix, "/")) && !strings.HasSuffix(targetKey, "/") {
+		targetKey += "/"
+	}
+	return targetKey
+}
+
+// toKey returns the key relative to the global prefix of the specified blob name
+func (p *provider) toKey(targetKey string) string {
+	return gospal.RelativeKey(p.config.GlobalPrefix, targetKey)
+}
+
+func (p *provider) blob(targetKey string) azblob.BlockBlobURL {
+	return p.container.NewBlockBlobURL(targetKey)
+}
+
+func (p *provider) ListKeys(pathName ...string) ([]string, error) {
+	return p.ListKeysContext(p.context, pathName...)
+}
+
+func (p *provider) ListKeysContext(ctx context.Context, pathName ...string) (fileList []string, err error) {
+	if len(pathName) > 1 {
+		return nil, errors.ErrorTooMuchListKeysArgs()
+	}
+	var extraPath string
+	if len(pathName) != 0 {
+		extraPath = pathName[0]
+	}
+	it := p.Objects(ctx, extraPath)
+	for it.Next() {
+		fileList = append(fileList, it.Object().Key)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return fileList, nil
+}
+
+func (p *provider) ListDir(prefix string) ([]string, []string, error) {
+	return p.ListDirContext(p.context, prefix)
+}
+
+func (p *provider) ListDirContext(ctx context.Context, prefix string) (keys []string, prefixes []string, err error) {
+	delimiter := p.config.Delimiter
+	if delimiter == "" {
+		delimiter = gospal.DefaultDelimiter
+	}
+	// the prefix is a directory, it should end with the delimiter
+	targetKey := p.getTargetKey(prefix)
+	if targetKey != "" && !strings.HasSuffix(targetKey, delimiter) {
+		targetKey += delimiter
+	}
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		segment, err := p.container.ListBlobsHierarchySegment(ctx, marker, delimiter, azblob.ListBlobsSegmentOptions{
+			Prefix:     targetKey,
+			MaxResults: p.maxResults(),
+		})
+		if err != nil {
+			return nil, nil, errors.ErrorListDir(targetKey, toError(err))
+		}
+		for _, blob := range segment.Segment.BlobItems {
+			keys = append(keys, p.toKey(blob.Name))
+		}
+		for _, blobPrefix := range segment.Segment.BlobPrefixes {
+			prefixes = append(prefixes, p.toKey(blobPrefix.Name))
+		}
+		marker = segment.NextMarker
+	}
+	return keys, prefixes, nil
+}
+
+// maxResults returns the page size of the listings, the service default being used when MaxKeys is not set
+func (p *provider) maxResults() int32 {
+	if p.config.MaxKeys > 0 && p.config.MaxKeys <= 5000 {
+		return int32(p.config.MaxKeys)
+	}
+	return 0
+}
+
+func (p *provider) Objects(ctx context.Context, prefix string) gospal.ObjectIterator {
+	return p.ObjectsFrom(ctx, prefix, "")
+}
+
+func (p *provider) ObjectsFrom(ctx context.Context, prefix string, pageToken string) gospal.ObjectIterator {
+	return p.objects(ctx, prefix, pageToken, p.config.Delimiter)
+}
+
+// objects returns the iterator of the blobs under the prefix. With a delimiter, only the blobs right under the prefix
+// are listed
+func (p *provider) objects(ctx context.Context, prefix string, pageToken string, delimiter string) *objectIterator {
+	it := &objectIterator{ctx: ctx, p: p, prefix: p.getTargetPrefix(prefix), delimiter: delimiter, pageToken: pageToken}
+	if pageToken != "" {
+		it.marker.Val = &pageToken
+	}
+	return it
+}
+
+func (p *provider) GetStream(filePath string) (io.Reader, context.CancelFunc, error) {
+	return p.GetStreamContext(p.context, filePath)
+}
+
+func (p *provider) GetStreamContext(ctx context.Context, filePath string) (io.Reader, context.CancelFunc, error) {
+	return gospal.ToStream(p.NewReader(ctx, filePath))
+}
+
+func (p *provider) NewReader(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	targetKey := p.getTargetKey(filePath)
+	reader, err := p.download(ctx, targetKey, 0, azblob.CountToEnd)
+	if err != nil {
+		return nil, errors.ErrorGetStreamReader(targetKey, toError(err))
+	}
+	return reader, nil
+}
+
+// download returns the reader of count bytes of the blob starting at offset, the timeout of the provider applying to
+// the whole download
+func (p *provider) download(ctx context.Context, targetKey string, offset int64, count int64) (io.ReadCloser, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(p.config.TimeOut))
+	response, err := p.blob(targetKey).Download(ctx, offset, count, azblob.BlobAccessConditions{}, false, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		defer cancel()
+		return nil, err
+	}
+	body := response.Body(azblob.RetryReaderOptions{})
+	return gospal.NewReadCloser(body, body, cancel), nil
+}
+
+func (p *provider) GetRange(filePath string, offset int64, length int64) (io.Reader, context.CancelFunc, error) {
+	return p.GetRangeContext(p.context, filePath, offset, length)
+}
+
+func (p *provider) GetRangeContext(ctx context.Context, filePath string, offset int64, length int64) (io.Reader, context.CancelFunc, error) {
+	targetKey := p.getTargetKey(filePath)
+	if length == 0 {
+		// a zero count reads up to the end of the blob, only the existence of the blob is then checked
+		if _, err := p.blob(targetKey).GetProperties(ctx, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{}); err != nil {
+			return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, targetKey, toError(err)))
+		}
+		return gospal.ToStream(ioutil.NopCloser(bytes.NewReader(nil)), nil)
+	}
+	if length < 0 {
+		length = azblob.CountToEnd
+	}
+	reader, err := p.download(ctx, targetKey, offset, length)
+	if err != nil {
+		return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, targetKey, toError(err)))
+	}
+	return gospal.ToStream(reader, nil)
+}
+
+func (p *provider) Open(filePath string) (gospal.ObjectReader, error) {
+	return p.OpenContext(p.context, filePath)
+}
+
+func (p *provider) OpenContext(ctx context.Context, filePath string) (gospal.ObjectReader, error) {
+	info, err := p.StatContext(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	return gospal.NewRangeReader(ctx, p, filePath, info.Size), nil
+}
+
+func (p *provider) PutStream(filePath string, stream io.Reader, opts ...gospal.PutOption) (int64, error) {
+	return p.PutStreamContext(p.context, filePath, stream, opts...)
+}
+
+func (p *provider) PutStreamContext(ctx context.Context, filePath string, stream io.Reader, opts ...gospal.PutOption) (int64, error) {
+	targetKey := p.getTargetKey(filePath)
+	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(p.config.TimeOut))
+	defer cancel()
+	counter := &countingReader{reader: stream}
+	if err := p.upload(ctx, targetKey, counter, opts...); err != nil {
+		return 0, errors.ErrorPutStreamReader(targetKey, toError(err))
+	}
+	return counter.count, nil
+}
+
+// upload stages the stream as blocks of the blob, which is only committed once the stream is read to the end
+func (p *provider) upload(ctx context.Context, targetKey string, stream io.Reader, opts ...gospal.PutOption) error {
+	options := gospal.NewPutOptions(opts...)
+	_, err := azblob.UploadStreamToBlockBlob(ctx, stream, p.blob(targetKey), azblob.UploadStreamToBlockBlobOptions{
+		BufferSize: uploadBufferSize,
+		MaxBuffers: uploadMaxBuffers,
+		BlobHTTPHeaders: azblob.BlobHTTPHeaders{
+			ContentType:     options.ContentType,
+			ContentEncoding: options.ContentEncoding,
+			CacheControl:    options.CacheControl,
+		},
+		Metadata: options.Metadata,
+	})
+	return err
+}
+
+// countingReader counts the bytes read from the stream, the upload does not report the size of the blob
+type countingReader struct {
+	reader io.Reader
+	count  int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	r.count += int64(n)
+	return n, err
+}
+
+func (p *provider) Stat(filePath string) (*gospal.ObjectInfo, error) {
+	return p.StatContext(p.context, filePath)
+}
+
+func (p *provider) StatContext(ctx context.Context, filePath string) (*gospal.ObjectInfo, error) {
+	targetKey := p.getTargetKey(filePath)
+	properties, err := p.blob(targetKey).GetProperties(ctx, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
+	if err != nil {
+		return nil, errors.ErrorStat(targetKey, toError(err))
+	}
+	info := &gospal.ObjectInfo{
+		Key:             filePath,
+		Size:            properties.ContentLength(),
+		LastModified:    properties.LastModified(),
+		ETag:            strings.Trim(string(properties.ETag()), `"`),
+		MD5:             properties.ContentMD5(),
+		ContentType:     properties.ContentType(),
+		ContentEncoding: properties.ContentEncoding(),
+		CacheControl:    properties.CacheControl(),
+	}
+	if metadata := properties.NewMetadata(); len(metadata) > 0 {
+		info.Metadata = metadata
+	}
+	return info, nil
+}
+
+func (p *provider) GetKind() string {
+	return p.kind
+}
+
+func (p *provider) DeleteKey(filePath string) error {
+	return p.DeleteKeyContext(p.context, filePath)
+}
+
+func (p *provider) DeleteKeyContext(ctx context.Context, filePath string) error {
+	targetKey := p.getTargetKey(filePath)
+	// the snapshots of a blob have to be removed along with it
+	if _, err := p.blob(targetKey).Delete(ctx, azblob.DeleteSnapshotsOptionInclude, azblob.BlobAccessConditions{}); err != nil {
+		return errors.ErrorDeleteKey(targetKey, toError(err))
+	}
+	return nil
+}
+
+func (p *provider) GetNoSuchKeyErrorString() string {
+	return p.noSuchKeyErrorString
+}
+
+// the provider is available from the factory as soon as its package is imported
+func init() {
+	registry.MustRegister(gospal.ProviderAzure, New)
+}
+
+//New azure provider constructor
+func New(ctx context.Context, bucket string, config *gospal.ProviderConfig) (gospal.Gospal, error) {
+	provider := provider{bucketName: bucket}
+	provider.kind = string(gospal.ProviderAzure)
+	provider.noSuchKeyErrorString = string(azblob.ServiceCodeBlobNotFound)
+	provider.config = config
+	provider.context = ctx
+
+	cfg := Config{}
+	if specConfig, ok := config.SpecConfig.(*Config); ok && specConfig != nil {
+		cfg = *specConfig
+	}
+	// the account is fetched from env unless set by the azure configuration
+	if cfg.AccountName == "" {
+		cfg.AccountName = os.Getenv("AZURE_STORAGE_ACCOUNT")
+	}
+	if cfg.AccountKey == "" {
+		cfg.AccountKey = os.Getenv("AZURE_STORAGE_KEY")
+	}
+	if cfg.Endpoint == "" {
+		if cfg.AccountName == "" {
+			return nil, errors.ErrorInitProvider("azure", stderrors.New("AZURE_STORAGE_ACCOUNT is not set"))
+		}
+		cfg.Endpoint = fmt.Sprintf("https://%s.blob.core.windows.net", cfg.AccountName)
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, errors.ErrorInitProvider("azure", err)
+	}
+
+	credential := cfg.Credential
+	if credential == nil && cfg.AccountKey != "" {
+		if credential, err = azblob.NewSharedKeyCredential(cfg.AccountName, cfg.AccountKey); err != nil {
+			return nil, errors.ErrorInitProvider("azure", err)
+		}
+	}
+	if credential == nil {
+		credential = azblob.NewAnonymousCredential()
+	}
+
+	pipeline := azblob.NewPipeline(credential, cfg.PipelineOptions)
+	provider.container = azblob.NewServiceURL(*endpoint, pipeline).NewContainerURL(bucket)
+	return &provider, nil
+}
@@ -0,0 +1,347 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package azureprovider
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/gospaltest"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testAccount   = "devstoreaccount1"
+	testContainer = "test-container"
+	// the well known key of the storage emulators, the fake blob service does not check the signatures
+	testAccountKey = "Eby8vdM02xNOcqFlqUwJPLlmEtlCDXJ1OUzFT50uSRZ6IFsuFq2UVErCz4I6tq/K1SZFPTOtr/KBHBeksoGMGw=="
+)
+
+// newTestProvider returns a provider of the test container served by the handler, along with the function stopping
+// the server
+func newTestProvider(t *testing.T, handler http.Handler, config *gospal.ProviderConfig) (gospal.Gospal, func()) {
+	server := httptest.NewServer(handler)
+	config.SpecConfig = &Config{
+		AccountName: testAccount,
+		AccountKey:  testAccountKey,
+		Endpoint:    server.URL + "/" + testAccount,
+		// the fake responses are final, retrying them only slows the tests down
+		PipelineOptions: azblob.PipelineOptions{Retry: azblob.RetryOptions{MaxTries: 1}},
+	}
+	p, err := New(context.Background(), testContainer, config)
+	if err != nil {
+		server.Close()
+		t.Fatalf("error when instantiating azure provider. err=%v", err.Error())
+	}
+	return p, server.Close
+}
+
+func TestNew(t *testing.T) {
+	type args struct {
+		ctx    context.Context
+		bucket string
+		config *gospal.ProviderConfig
+	}
+	tests := []struct {
+		name    string
+		env     map[string]string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "Should instantiate an Azure provider",
+			args: args{
+				ctx:    context.Background(),
+				bucket: testContainer,
+				config: &gospal.ProviderConfig{
+					TimeOut:    300,
+					SpecConfig: &Config{AccountName: testAccount, AccountKey: testAccountKey},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Should instantiate an Azure provider with the account of the environment",
+			env:  map[string]string{"AZURE_STORAGE_ACCOUNT": testAccount, "AZURE_STORAGE_KEY": testAccountKey},
+			args: args{
+				ctx:    context.Background(),
+				bucket: testContainer,
+				config: &gospal.ProviderConfig{TimeOut: 300},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Should instantiate an anonymous Azure provider of an endpoint",
+			args: args{
+				ctx:    context.Background(),
+				bucket: testContainer,
+				config: &gospal.ProviderConfig{
+					TimeOut:    300,
+					SpecConfig: &Config{Endpoint: "http://127.0.0.1:10000/" + testAccount},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "Should raise on missing account",
+			args: args{
+				ctx:    context.Background(),
+				bucket: testContainer,
+				config: &gospal.ProviderConfig{TimeOut: 300},
+			},
+			wantErr: true,
+		},
+		{
+			name: "Should raise on invalid account key",
+			args: args{
+				ctx:    context.Background(),
+				bucket: testContainer,
+				config: &gospal.ProviderConfig{
+					TimeOut:    300,
+					SpecConfig: &Config{AccountName: testAccount, AccountKey: "not base64"},
+				},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"AZURE_STORAGE_ACCOUNT", "AZURE_STORAGE_KEY"} {
+				value, ok := os.LookupEnv(name)
+				os.Setenv(name, tt.env[name])
+				if ok {
+					defer os.Setenv(name, value)
+				} else {
+					defer os.Unsetenv(name)
+				}
+			}
+			got, err := New(tt.args.ctx, tt.args.bucket, tt.args.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && reflect.TypeOf(got) != reflect.TypeOf(&provider{}) {
+				t.Errorf("New() got = %v, want %v", reflect.TypeOf(got), reflect.TypeOf(provider{}))
+			}
+		})
+	}
+}
+
+func Test_toError(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		code     string
+		wantKind error
+	}{
+		{
+			name:     "Should classify BlobNotFound as not exist",
+			status:   404,
+			code:     "BlobNotFound",
+			wantKind: errors.ErrNotExist,
+		},
+		{
+			name:     "Should classify a 403 response as permission denied",
+			status:   403,
+			code:     "AuthorizationFailure",
+			wantKind: errors.ErrPermissionDenied,
+		},
+		{
+			name:     "Should classify BlobAlreadyExists as already exists",
+			status:   409,
+			code:     "BlobAlreadyExists",
+			wantKind: errors.ErrAlreadyExists,
+		},
+		{
+			name:     "Should classify ConditionNotMet as precondition failed",
+			status:   412,
+			code:     "ConditionNotMet",
+			wantKind: errors.ErrPreconditionFailed,
+		},
+		{
+			name:     "Should classify InternalError as transient",
+			status:   500,
+			code:     "InternalError",
+			wantKind: errors.ErrTransient,
+		},
+		{
+			name:     "Should classify ServerBusy as transient",
+			status:   503,
+			code:     "ServerBusy",
+			wantKind: errors.ErrTransient,
+		},
+		{
+			name:     "Should not classify unknown errors",
+			status:   400,
+			code:     "InvalidQueryParameterValue",
+			wantKind: nil,
+		},
+	}
+	kinds := []error{errors.ErrNotExist, errors.ErrPermissionDenied, errors.ErrAlreadyExists, errors.ErrPreconditionFailed, errors.ErrCanceled, errors.ErrTransient}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, cleanup := newTestProvider(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				writeError(w, tt.status, tt.code, tt.name)
+			}), gospal.NewProviderConfig())
+			defer cleanup()
+			_, err := p.(*provider).container.ListBlobsFlatSegment(context.Background(), azblob.Marker{}, azblob.ListBlobsSegmentOptions{})
+			got := toError(err)
+			for _, kind := range kinds {
+				if stderrors.Is(got, kind) != (kind == tt.wantKind) {
+					t.Errorf("toError() = %v, is %v: %v, want %v", got, kind, stderrors.Is(got, kind), tt.wantKind)
+				}
+			}
+			var serr azblob.StorageError
+			if !stderrors.As(got, &serr) || string(serr.ServiceCode()) != tt.code {
+				t.Errorf("toError() = %v should unwrap to the azure error", got)
+			}
+		})
+	}
+	if got := toError(context.DeadlineExceeded); !stderrors.Is(got, errors.ErrCanceled) {
+		t.Errorf("toError() = %v should be %v", got, errors.ErrCanceled)
+	}
+}
+
+func Test_provider_PutStreamOptions(t *testing.T) {
+	p, cleanup := newTestProvider(t, newFakeBlobService(testContainer), gospal.NewProviderConfig())
+	defer cleanup()
+
+	if _, err := p.PutStream("path/to/options.json", strings.NewReader("{}"),
+		gospal.WithContentType("application/json"),
+		gospal.WithContentEncoding("gzip"),
+		gospal.WithCacheControl("no-cache"),
+		gospal.WithMetadata(map[string]string{"owner": "gospal"}),
+	); err != nil {
+		t.Errorf("PutStream() error = %v", err)
+		return
+	}
+	got, err := p.Stat("path/to/options.json")
+	if err != nil {
+		t.Errorf("Stat() error = %v", err)
+		return
+	}
+	if got.Size != 2 || got.ContentType != "application/json" || got.ContentEncoding != "gzip" || got.CacheControl != "no-cache" {
+		t.Errorf("Stat() got = %+v", got)
+	}
+	if !reflect.DeepEqual(got.Metadata, map[string]string{"owner": "gospal"}) {
+		t.Errorf("Stat() metadata got = %v, want %v", got.Metadata, map[string]string{"owner": "gospal"})
+	}
+}
+
+func Test_provider_GlobalPrefix(t *testing.T) {
+	service := newFakeBlobService(testContainer)
+	for _, name := range []string{"tenant/a.txt", "tenant/b/c.txt", "tenant2/d.txt"} {
+		service.put(testContainer, name, []byte(name), nil)
+	}
+	p, cleanup := newTestProvider(t, service, &gospal.ProviderConfig{TimeOut: 300, GlobalPrefix: "tenant"})
+	defer cleanup()
+
+	// the keys are relative to the global prefix, the sibling tenant2 is not listed
+	keys, err := p.ListKeys()
+	if err != nil {
+		t.Errorf("ListKeys() error = %v", err)
+		return
+	}
+	if want := []string{"a.txt", "b/c.txt"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("ListKeys() got = %v, want %v", keys, want)
+	}
+	gotKeys, gotPrefixes, err := p.ListDir("")
+	if err != nil || !reflect.DeepEqual(gotKeys, []string{"a.txt"}) || !reflect.DeepEqual(gotPrefixes, []string{"b/"}) {
+		t.Errorf("ListDir() got = %v, %v, %v", gotKeys, gotPrefixes, err)
+	}
+	// and can be fed back to the provider
+	for _, key := range keys {
+		reader, err := p.NewReader(context.Background(), key)
+		if err != nil {
+			t.Errorf("NewReader() error = %v", err)
+			continue
+		}
+		var bb bytes.Buffer
+		io.Copy(&bb, reader)
+		if bb.String() != "tenant/"+key {
+			t.Errorf("NewReader() got = %v, want %v", bb.String(), "tenant/"+key)
+		}
+		reader.Close()
+		if err := p.DeleteKey(key); err != nil {
+			t.Errorf("DeleteKey() error = %v", err)
+		}
+	}
+	if _, ok := service.get(testContainer, "tenant2/d.txt"); !ok {
+		t.Errorf("DeleteKey() should have kept tenant2/d.txt")
+	}
+	if keys, err := p.ListKeys(); err != nil || len(keys) != 0 {
+		t.Errorf("ListKeys() got = %v, %v, want no keys", keys, err)
+	}
+}
+
+func Test_provider_Delimiter(t *testing.T) {
+	service := newFakeBlobService(testContainer)
+	for _, name := range []string{"a|b.txt", "a|c|d.txt", "e.txt"} {
+		service.put(testContainer, name, []byte(name), nil)
+	}
+	p, cleanup := newTestProvider(t, service, &gospal.ProviderConfig{TimeOut: 300, Delimiter: "|"})
+	defer cleanup()
+
+	// the delimiter splits the keys into directories, the objects being listed one directory at a time
+	gotKeys, gotPrefixes, err := p.ListDir("a")
+	if err != nil || !reflect.DeepEqual(gotKeys, []string{"a|b.txt"}) || !reflect.DeepEqual(gotPrefixes, []string{"a|c|"}) {
+		t.Errorf("ListDir() got = %v, %v, %v", gotKeys, gotPrefixes, err)
+	}
+	if keys, err := p.ListKeys(); err != nil || !reflect.DeepEqual(keys, []string{"e.txt"}) {
+		t.Errorf("ListKeys() got = %v, %v, want %v", keys, err, []string{"e.txt"})
+	}
+}
+
+func Test_provider_ObjectsWithoutLength(t *testing.T) {
+	service := newFakeBlobService(testContainer)
+	service.omitLength = true
+	service.put(testContainer, "a.txt", []byte("a"), nil)
+	p, cleanup := newTestProvider(t, service, &gospal.ProviderConfig{TimeOut: 300})
+	defer cleanup()
+
+	// the listing does not fail on blobs without Content-Length, their size being left to zero
+	it := p.Objects(context.Background(), "")
+	if !it.Next() || it.Object().Key != "a.txt" || it.Object().Size != 0 {
+		t.Errorf("Objects() got = %v, %v", it.Object(), it.Err())
+	}
+	if it.Next() || it.Err() != nil {
+		t.Errorf("Objects() should have stopped, error = %v", it.Err())
+	}
+}
+
+func TestConformance(t *testing.T) {
+	gospaltest.RunConformance(t, func(t *testing.T) (gospal.Gospal, func()) {
+		return newTestProvider(t, newFakeBlobService(testContainer), &gospal.ProviderConfig{
+			TimeOut: 300,
+			MaxKeys: 2,
+		})
+	})
+}
+
+func TestConfigConformance(t *testing.T) {
+	gospaltest.RunConfigConformance(t, func(t *testing.T, config *gospal.ProviderConfig) (gospal.Gospal, func()) {
+		config.TimeOut = 300
+		return newTestProvider(t, newFakeBlobService(testContainer), config)
+	})
+}
@@ -0,0 +1,83 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package azureprovider
+
+import (
+	"context"
+	"fmt"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"time"
+)
+
+// delay between two checks of the status of a pending copy
+const copyPollInterval = time.Second
+
+func (p *provider) Copy(src string, dst string) error {
+	return p.CopyContext(p.context, src, dst)
+}
+
+func (p *provider) CopyContext(ctx context.Context, src string, dst string) error {
+	srcKey, dstKey := p.getTargetKey(src), p.getTargetKey(dst)
+	if err := p.copyBlob(ctx, srcKey, dstKey); err != nil {
+		return errors.ErrorCopyKey(srcKey, dstKey, toError(err))
+	}
+	return nil
+}
+
+// copyBlob copies the blob server side. Copies within an account are usually done once started, larger ones are run
+// asynchronously by the service, their status is then polled until done
+func (p *provider) copyBlob(ctx context.Context, srcKey string, dstKey string) error {
+	dst := p.blob(dstKey)
+	response, err := dst.StartCopyFromURL(ctx, p.blob(srcKey).URL(), nil, azblob.ModifiedAccessConditions{},
+		azblob.BlobAccessConditions{}, azblob.DefaultAccessTier, nil)
+	if err != nil {
+		return err
+	}
+	status := response.CopyStatus()
+	for status == azblob.CopyStatusPending {
+		select {
+		case <-ctx.Done():
+			// the copy would go on otherwise
+			_, _ = dst.AbortCopyFromURL(context.Background(), response.CopyID(), azblob.LeaseAccessConditions{})
+			return ctx.Err()
+		case <-time.After(copyPollInterval):
+		}
+		properties, err := dst.GetProperties(ctx, azblob.BlobAccessConditions{}, azblob.ClientProvidedKeyOptions{})
+		if err != nil {
+			return err
+		}
+		status = properties.CopyStatus()
+	}
+	if status != azblob.CopyStatusSuccess {
+		return fmt.Errorf("copy %v", status)
+	}
+	return nil
+}
+
+func (p *provider) Move(src string, dst string) error {
+	return p.MoveContext(p.context, src, dst)
+}
+
+func (p *provider) MoveContext(ctx context.Context, src string, dst string) error {
+	// azure has no rename, the blob is copied then removed
+	if err := p.CopyContext(ctx, src, dst); err != nil {
+		return errors.ErrorMoveKey(p.getTargetKey(src), p.getTargetKey(dst), err)
+	}
+	if err := p.DeleteKeyContext(ctx, src); err != nil {
+		return errors.ErrorMoveKey(p.getTargetKey(src), p.getTargetKey(dst), err)
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package azureprovider
+
+import (
+	"context"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+)
+
+// number of objects deleted concurrently, the blob api of the sdk has no batch delete
+const deleteConcurrency = 32
+
+func (p *provider) DeleteKeys(filePaths []string) error {
+	return p.DeleteKeysContext(p.context, filePaths)
+}
+
+func (p *provider) DeleteKeysContext(ctx context.Context, filePaths []string) error {
+	return errors.ErrorDeleteKeys(gospal.DeleteKeys(ctx, filePaths, deleteConcurrency, p.DeleteKeyContext))
+}
+
+func (p *provider) DeletePrefix(prefix string) error {
+	return p.DeletePrefixContext(p.context, prefix)
+}
+
+func (p *provider) DeletePrefixContext(ctx context.Context, prefix string) error {
+	// the listing is flat, the keys under the nested prefixes being removed whatever the delimiter
+	failures, err := gospal.DeleteObjects(ctx, p.objects(ctx, prefix, "", ""), deleteConcurrency, p.DeleteKeyContext)
+	return errors.ErrorDeletePrefix(err, failures)
+}
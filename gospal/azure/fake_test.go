@@ -0,0 +1,364 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package azureprovider
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fakeBlob is a committed block blob of the fake blob service
+type fakeBlob struct {
+	content      []byte
+	md5          []byte
+	etag         string
+	lastModified time.Time
+	header       http.Header
+}
+
+// fakeBlobService is an in-process stand-in of the blob service, implementing the block blob requests of the
+// provider with path style urls, eg.: http://127.0.0.1:port/account/container/blob. Requests are not authenticated
+type fakeBlobService struct {
+	mu         sync.Mutex
+	containers map[string]map[string]*fakeBlob
+	blocks     map[string]map[string][]byte
+	version    int
+	// omitLength lists the blobs without their Content-Length, the property being optional
+	omitLength bool
+}
+
+func newFakeBlobService(containers ...string) *fakeBlobService {
+	s := &fakeBlobService{containers: map[string]map[string]*fakeBlob{}, blocks: map[string]map[string][]byte{}}
+	for _, container := range containers {
+		s.containers[container] = map[string]*fakeBlob{}
+	}
+	return s
+}
+
+// put stores the content to the blob, the container being created if needed
+func (s *fakeBlobService) put(container string, name string, content []byte, header http.Header) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.containers[container] == nil {
+		s.containers[container] = map[string]*fakeBlob{}
+	}
+	s.containers[container][name] = s.newBlob(content, nil, header)
+}
+
+// get returns the blob, and whether it exists
+func (s *fakeBlobService) get(container string, name string) (*fakeBlob, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	blob, ok := s.containers[container][name]
+	return blob, ok
+}
+
+func (s *fakeBlobService) newBlob(content []byte, md5 []byte, header http.Header) *fakeBlob {
+	s.version++
+	blob := &fakeBlob{
+		content:      content,
+		md5:          md5,
+		etag:         fmt.Sprintf(`"0x8D%013X"`, s.version),
+		lastModified: time.Now().UTC().Truncate(time.Second),
+		header:       http.Header{},
+	}
+	for name, values := range header {
+		if strings.HasPrefix(strings.ToLower(name), "x-ms-meta-") {
+			blob.header[name] = values
+		}
+	}
+	for _, name := range []string{"Content-Type", "Content-Encoding", "Cache-Control"} {
+		if value := header.Get("x-ms-blob-" + name); value != "" {
+			blob.header.Set(name, value)
+		}
+	}
+	if blob.header.Get("Content-Type") == "" {
+		blob.header.Set("Content-Type", "application/octet-stream")
+	}
+	return blob
+}
+
+func (s *fakeBlobService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	w.Header().Set("x-ms-version", r.Header.Get("x-ms-version"))
+	// the first element of the path is the account
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 3)
+	if len(parts) < 2 {
+		writeError(w, http.StatusBadRequest, "InvalidUri", "The requested URI does not represent any resource on the server.")
+		return
+	}
+	query := r.URL.Query()
+	blobs, ok := s.containers[parts[1]]
+	if query.Get("restype") == "container" {
+		switch {
+		case r.Method == http.MethodPut && ok:
+			writeError(w, http.StatusConflict, "ContainerAlreadyExists", "The specified container already exists.")
+		case r.Method == http.MethodPut:
+			s.containers[parts[1]] = map[string]*fakeBlob{}
+			w.WriteHeader(http.StatusCreated)
+		case !ok:
+			writeError(w, http.StatusNotFound, "ContainerNotFound", "The specified container does not exist.")
+		case r.Method == http.MethodGet && query.Get("comp") == "list":
+			s.list(w, parts[1], blobs, query)
+		default:
+			writeError(w, http.StatusBadRequest, "UnsupportedHttpVerb", "The resource doesn't support the specified HTTP verb.")
+		}
+		return
+	}
+	if !ok {
+		writeError(w, http.StatusNotFound, "ContainerNotFound", "The specified container does not exist.")
+		return
+	}
+	if len(parts) < 3 || parts[2] == "" {
+		writeError(w, http.StatusBadRequest, "InvalidUri", "The requested URI does not represent any resource on the server.")
+		return
+	}
+	name := parts[2]
+	switch {
+	case r.Method == http.MethodPut && query.Get("comp") == "block":
+		s.stageBlock(w, r, parts[1]+"/"+name, query.Get("blockid"))
+	case r.Method == http.MethodPut && query.Get("comp") == "blocklist":
+		s.commitBlockList(w, r, blobs, parts[1]+"/"+name, name)
+	case r.Method == http.MethodPut && r.Header.Get("x-ms-copy-source") != "":
+		s.copyBlob(w, r, blobs, name)
+	case r.Method == http.MethodPut:
+		content, _ := ioutil.ReadAll(r.Body)
+		sum := md5.Sum(content)
+		blobs[name] = s.newBlob(content, sum[:], r.Header)
+		writeBlobHeaders(w, blobs[name], false)
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		s.getBlob(w, r, blobs, name)
+	case r.Method == http.MethodDelete:
+		if _, ok := blobs[name]; !ok {
+			writeError(w, http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+			return
+		}
+		delete(blobs, name)
+		w.WriteHeader(http.StatusAccepted)
+	default:
+		writeError(w, http.StatusBadRequest, "UnsupportedHttpVerb", "The resource doesn't support the specified HTTP verb.")
+	}
+}
+
+func (s *fakeBlobService) stageBlock(w http.ResponseWriter, r *http.Request, path string, blockID string) {
+	content, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidInput", err.Error())
+		return
+	}
+	if s.blocks[path] == nil {
+		s.blocks[path] = map[string][]byte{}
+	}
+	s.blocks[path][blockID] = content
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *fakeBlobService) commitBlockList(w http.ResponseWriter, r *http.Request, blobs map[string]*fakeBlob, path string, name string) {
+	var blockList struct {
+		Committed []string `xml:"Committed"`
+		Latest    []string `xml:"Latest"`
+	}
+	if err := xml.NewDecoder(r.Body).Decode(&blockList); err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidXmlDocument", err.Error())
+		return
+	}
+	var content []byte
+	for _, blockID := range append(blockList.Committed, blockList.Latest...) {
+		block, ok := s.blocks[path][blockID]
+		if !ok {
+			writeError(w, http.StatusBadRequest, "InvalidBlockList", "The specified block list is invalid.")
+			return
+		}
+		content = append(content, block...)
+	}
+	// the staged blocks which are not committed are discarded
+	delete(s.blocks, path)
+	blobs[name] = s.newBlob(content, nil, r.Header)
+	writeBlobHeaders(w, blobs[name], false)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *fakeBlobService) copyBlob(w http.ResponseWriter, r *http.Request, blobs map[string]*fakeBlob, name string) {
+	source, err := url.Parse(r.Header.Get("x-ms-copy-source"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "InvalidHeaderValue", err.Error())
+		return
+	}
+	parts := strings.SplitN(strings.TrimPrefix(source.Path, "/"), "/", 3)
+	if len(parts) < 3 || s.containers[parts[1]][parts[2]] == nil {
+		writeError(w, http.StatusNotFound, "CannotVerifyCopySource", "The specified blob does not exist.")
+		return
+	}
+	src := s.containers[parts[1]][parts[2]]
+	blobs[name] = s.newBlob(src.content, src.md5, nil)
+	blobs[name].header = src.header
+	writeBlobHeaders(w, blobs[name], false)
+	w.Header().Set("x-ms-copy-id", strconv.Itoa(s.version))
+	w.Header().Set("x-ms-copy-status", "success")
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func (s *fakeBlobService) getBlob(w http.ResponseWriter, r *http.Request, blobs map[string]*fakeBlob, name string) {
+	blob, ok := blobs[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+		return
+	}
+	content, status := blob.content, http.StatusOK
+	if byteRange := r.Header.Get("x-ms-range"); byteRange != "" && r.Method == http.MethodGet {
+		var start, end int64
+		size := int64(len(blob.content))
+		if n, _ := fmt.Sscanf(byteRange, "bytes=%d-%d", &start, &end); n < 2 {
+			end = size - 1
+		}
+		if start >= size {
+			writeError(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The range specified is invalid for the current size of the resource.")
+			return
+		}
+		if end >= size {
+			end = size - 1
+		}
+		content, status = blob.content[start:end+1], http.StatusPartialContent
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+	}
+	writeBlobHeaders(w, blob, true)
+	w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+	w.WriteHeader(status)
+	if r.Method == http.MethodGet {
+		w.Write(content)
+	}
+}
+
+// fakeListEntry is either a blob or a blob prefix of a listing
+type fakeListEntry struct {
+	name   string
+	blob   *fakeBlob
+	prefix bool
+}
+
+func (s *fakeBlobService) list(w http.ResponseWriter, container string, blobs map[string]*fakeBlob, query url.Values) {
+	prefix, delimiter, marker := query.Get("prefix"), query.Get("delimiter"), query.Get("marker")
+	maxResults := 5000
+	if value := query.Get("maxresults"); value != "" {
+		maxResults, _ = strconv.Atoi(value)
+	}
+	seen := map[string]bool{}
+	var entries []fakeListEntry
+	for name, blob := range blobs {
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if i := strings.Index(name[len(prefix):], delimiter); delimiter != "" && i >= 0 {
+			blobPrefix := name[:len(prefix)+i+len(delimiter)]
+			if !seen[blobPrefix] {
+				seen[blobPrefix] = true
+				entries = append(entries, fakeListEntry{name: blobPrefix, prefix: true})
+			}
+			continue
+		}
+		entries = append(entries, fakeListEntry{name: name, blob: blob})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].name < entries[j].name })
+	// the marker is the name of the first entry of the page
+	for len(entries) > 0 && entries[0].name < marker {
+		entries = entries[1:]
+	}
+	nextMarker := ""
+	if len(entries) > maxResults {
+		nextMarker = entries[maxResults].name
+		entries = entries[:maxResults]
+	}
+
+	type properties struct {
+		LastModified  string `xml:"Last-Modified"`
+		Etag          string `xml:"Etag"`
+		ContentLength *int   `xml:"Content-Length,omitempty"`
+		ContentType   string `xml:"Content-Type"`
+		ContentMD5    string `xml:"Content-MD5,omitempty"`
+		BlobType      string `xml:"BlobType"`
+	}
+	type item struct {
+		XMLName    xml.Name
+		Name       string      `xml:"Name"`
+		Properties *properties `xml:"Properties,omitempty"`
+	}
+	result := struct {
+		XMLName       xml.Name `xml:"EnumerationResults"`
+		ContainerName string   `xml:"ContainerName,attr"`
+		Prefix        string   `xml:"Prefix"`
+		Marker        string   `xml:"Marker"`
+		MaxResults    int      `xml:"MaxResults"`
+		Delimiter     string   `xml:"Delimiter,omitempty"`
+		Items         []item   `xml:"Blobs>Item"`
+		NextMarker    string   `xml:"NextMarker"`
+	}{ContainerName: container, Prefix: prefix, Marker: marker, MaxResults: maxResults, Delimiter: delimiter, NextMarker: nextMarker}
+	for _, entry := range entries {
+		if entry.prefix {
+			result.Items = append(result.Items, item{XMLName: xml.Name{Local: "BlobPrefix"}, Name: entry.name})
+			continue
+		}
+		var contentLength *int
+		if !s.omitLength {
+			length := len(entry.blob.content)
+			contentLength = &length
+		}
+		result.Items = append(result.Items, item{XMLName: xml.Name{Local: "Blob"}, Name: entry.name, Properties: &properties{
+			LastModified:  entry.blob.lastModified.Format(http.TimeFormat),
+			Etag:          entry.blob.etag,
+			ContentLength: contentLength,
+			ContentType:   entry.blob.header.Get("Content-Type"),
+			ContentMD5:    base64.StdEncoding.EncodeToString(entry.blob.md5),
+			BlobType:      "BlockBlob",
+		}})
+	}
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, xml.Header)
+	xml.NewEncoder(w).Encode(result)
+}
+
+func writeBlobHeaders(w http.ResponseWriter, blob *fakeBlob, properties bool) {
+	w.Header().Set("ETag", blob.etag)
+	w.Header().Set("Last-Modified", blob.lastModified.Format(http.TimeFormat))
+	if !properties {
+		return
+	}
+	for name, values := range blob.header {
+		w.Header()[name] = values
+	}
+	if blob.md5 != nil {
+		w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(blob.md5))
+	}
+	w.Header().Set("x-ms-blob-type", "BlockBlob")
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("x-ms-error-code", code)
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	fmt.Fprintf(w, "%s<Error><Code>%s</Code><Message>%s</Message></Error>", xml.Header, code, message)
+}
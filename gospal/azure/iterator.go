@@ -0,0 +1,102 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package azureprovider
+
+import (
+	"context"
+	"github.com/Azure/azure-storage-blob-go/azblob"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"strings"
+)
+
+// objectIterator lists the blobs one segment at a time. The page token is the marker of the current segment
+type objectIterator struct {
+	ctx       context.Context
+	p         *provider
+	prefix    string
+	delimiter string
+	marker    azblob.Marker
+	done      bool
+	blobs     []azblob.BlobItemInternal
+	pageToken string
+	current   *gospal.ObjectInfo
+	err       error
+}
+
+func (it *objectIterator) Next() bool {
+	for len(it.blobs) == 0 {
+		if it.err != nil || it.done {
+			return false
+		}
+		it.fetch()
+	}
+	blob := it.blobs[0]
+	it.blobs = it.blobs[1:]
+	it.current = &gospal.ObjectInfo{
+		Key:          it.p.toKey(blob.Name),
+		LastModified: blob.Properties.LastModified,
+		ETag:         strings.Trim(string(blob.Properties.Etag), `"`),
+		MD5:          blob.Properties.ContentMD5,
+	}
+	if blob.Properties.ContentLength != nil {
+		it.current.Size = *blob.Properties.ContentLength
+	}
+	if blob.Properties.ContentType != nil {
+		it.current.ContentType = *blob.Properties.ContentType
+	}
+	return true
+}
+
+// fetch lists the next segment. With a delimiter, only the blobs right under the prefix are listed
+func (it *objectIterator) fetch() {
+	if it.marker.Val != nil {
+		it.pageToken = *it.marker.Val
+	}
+	options := azblob.ListBlobsSegmentOptions{Prefix: it.prefix, MaxResults: it.p.maxResults()}
+	if it.delimiter != "" {
+		segment, err := it.p.container.ListBlobsHierarchySegment(it.ctx, it.marker, it.delimiter, options)
+		if err != nil {
+			it.err = errors.ErrorListKeysError(it.prefix, toError(err))
+			return
+		}
+		it.next(segment.Segment.BlobItems, segment.NextMarker)
+		return
+	}
+	segment, err := it.p.container.ListBlobsFlatSegment(it.ctx, it.marker, options)
+	if err != nil {
+		it.err = errors.ErrorListKeysError(it.prefix, toError(err))
+		return
+	}
+	it.next(segment.Segment.BlobItems, segment.NextMarker)
+}
+
+// next sets the blobs of the fetched segment, the listing being done once no marker is returned
+func (it *objectIterator) next(blobs []azblob.BlobItemInternal, marker azblob.Marker) {
+	it.blobs, it.marker = blobs, marker
+	it.done = marker.Val == nil || *marker.Val == ""
+}
+
+func (it *objectIterator) Object() *gospal.ObjectInfo {
+	return it.current
+}
+
+func (it *objectIterator) Err() error {
+	return it.err
+}
+
+func (it *objectIterator) PageToken() string {
+	return it.pageToken
+}
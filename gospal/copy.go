@@ -0,0 +1,36 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package gospal
+
+import (
+	"context"
+)
+
+// StreamCopy copies the src key to the dst key by streaming it through the current process.
+// This is the fallback used by the providers which are not able to copy objects natively. The attributes of the
+// object (content type, metadata...) are copied along
+func StreamCopy(ctx context.Context, provider Gospal, src string, dst string) error {
+	info, err := provider.StatContext(ctx, src)
+	if err != nil {
+		return err
+	}
+	reader, err := provider.NewReader(ctx, src)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	_, err = provider.PutStreamContext(ctx, dst, reader, info.PutOptions()...)
+	return err
+}
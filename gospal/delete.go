@@ -0,0 +1,72 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package gospal
+
+import (
+	"context"
+	"sync"
+)
+
+// DeleteKeys deletes the keys running concurrency calls of del at once. It is meant for the providers which have no
+// batch delete. The failures are reported under the key they occurred on
+func DeleteKeys(ctx context.Context, keys []string, concurrency int, del func(context.Context, string) error) map[string]error {
+	queue := make(chan string)
+	go func() {
+		defer close(queue)
+		for _, key := range keys {
+			queue <- key
+		}
+	}()
+	return deleteConcurrently(ctx, queue, concurrency, del)
+}
+
+// DeleteObjects is the same as DeleteKeys for the objects of the iterator, the iterator error being returned along
+// with the failures of the objects listed before it stopped, see errors.ErrorDeletePrefix
+func DeleteObjects(ctx context.Context, it ObjectIterator, concurrency int, del func(context.Context, string) error) (map[string]error, error) {
+	queue := make(chan string)
+	go func() {
+		defer close(queue)
+		for it.Next() {
+			queue <- it.Object().Key
+		}
+	}()
+	failures := deleteConcurrently(ctx, queue, concurrency, del)
+	// the iterator is done once the queue is drained
+	return failures, it.Err()
+}
+
+// deleteConcurrently calls del on the keys received until the channel is closed
+func deleteConcurrently(ctx context.Context, keys <-chan string, concurrency int, del func(context.Context, string) error) map[string]error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures = map[string]error{}
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keys {
+				if err := del(ctx, key); err != nil {
+					mu.Lock()
+					failures[key] = err
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return failures
+}
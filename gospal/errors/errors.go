@@ -15,19 +15,164 @@
 package errors
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 )
 
 const (
 	tooMuchListKeysArgsMessage        = "ListKeys takes at most one path. extra=%v"
-	listKeysErrorMessage              = "ListKeys error when listing remote storage %v. extra=%v"
-	getStreamReaderErrorMessage       = "GetStream: error while fetching reader for filePath %v. err=%v"
-	putStreamReaderErrorMessage       = "PutStream: error when putting stream to file %v. err=%v"
-	deleteKeyErrorMessage             = "DeleteKey: error when deleting key %v. err=%v"
-	providerFactoryInitErrorMessage   = "NewProviderFactory: error when instantiating provider %v. err=%v"
+	listKeysErrorMessage              = "ListKeys error when listing remote storage %v. extra=%w"
+	listDirErrorMessage               = "ListDir: error when listing remote storage %v. err=%w"
+	getStreamReaderErrorMessage       = "GetStream: error while fetching reader for filePath %v. err=%w"
+	getRangeErrorMessage              = "GetRange: error while fetching %v bytes at offset %v of filePath %v. err=%w"
+	putStreamReaderErrorMessage       = "PutStream: error when putting stream to file %v. err=%w"
+	deleteKeyErrorMessage             = "DeleteKey: error when deleting key %v. err=%w"
+	deleteKeysErrorMessage            = "DeleteKeys: error when deleting %v keys. first failure on key %v. err=%v"
+	copyKeyErrorMessage               = "Copy: error when copying key %v to %v. err=%w"
+	moveKeyErrorMessage               = "Move: error when moving key %v to %v. err=%w"
+	statErrorMessage                  = "Stat: error when fetching attributes of key %v. err=%w"
+	invalidKeyErrorMessage            = "invalid key %q. reason=%v"
+	notSupportedErrorMessage          = "%v: operation not supported by provider %v"
+	providerFactoryInitErrorMessage   = "NewProviderFactory: error when instantiating provider %v. err=%w"
 	providerFactoryUnknownKindMessage = "NewProviderFactory: unable to process ConfigFactory. Unknown provider %v"
+	providerRegisterErrorMessage      = "Register: unable to register provider %v. err=%w"
+	providerURLErrorMessage           = "OpenURL: unable to process url %v. err=%w"
 )
 
+// Provider independent errors. Errors returned by the providers are classified against those so they can be checked
+// using errors.Is whatever the provider, eg.:
+//   if errors.Is(err, errors.ErrNotExist) { ... }
+// the original provider error is kept in the chain and may still be reached using errors.As
+var (
+	// ErrNotExist the key (or the bucket) does not exist
+	ErrNotExist = errors.New("object does not exist")
+	// ErrPermissionDenied the credentials do not allow the operation
+	ErrPermissionDenied = errors.New("permission denied")
+	// ErrAlreadyExists the object already exists
+	ErrAlreadyExists = errors.New("object already exists")
+	// ErrPreconditionFailed a condition set on the operation was not met
+	ErrPreconditionFailed = errors.New("precondition failed")
+	// ErrCanceled the context of the operation was either canceled or its deadline exceeded
+	ErrCanceled = errors.New("operation canceled")
+	// ErrInvalidKey the key is rejected by the provider, eg. a local key resolving outside of its directory
+	ErrInvalidKey = errors.New("invalid key")
+	// ErrNotSupported the provider does not implement the operation, eg. a write to a read-only provider
+	ErrNotSupported = errors.New("operation not supported")
+	// ErrTransient the storage failed on a transient condition (server error, throttling...), the operation may
+	// succeed when retried, see gospal.WithRetry
+	ErrTransient = errors.New("transient failure")
+)
+
+// Error holds a provider error along with the provider independent error it has been classified as
+type Error struct {
+	// one of the provider independent errors above
+	Kind error
+	// the original error, as returned by the provider sdk
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the original provider error
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the error has been classified as target
+func (e *Error) Is(target error) bool {
+	return e.Kind == target
+}
+
+// Wrap classifies err as kind. err is returned untouched when kind is nil
+func Wrap(kind error, err error) error {
+	if err == nil || kind == nil {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// DeleteKeysError reports the keys a batch delete failed to remove, each key being mapped to the reason of its
+// failure. The other keys have been removed
+type DeleteKeysError struct {
+	Errors map[string]error
+
+	// Err is the error which stopped the listing of DeletePrefix, if any: the keys listed after it are left
+	Err error
+}
+
+func (e *DeleteKeysError) Error() string {
+	keys := e.Keys()
+	message := fmt.Sprintf(deleteKeysErrorMessage, 0, "", nil)
+	if len(keys) > 0 {
+		message = fmt.Sprintf(deleteKeysErrorMessage, len(keys), keys[0], e.Errors[keys[0]])
+	}
+	if e.Err != nil {
+		return fmt.Sprintf("%v. listing stopped, err=%v", message, e.Err)
+	}
+	return message
+}
+
+// Unwrap returns the error which stopped the listing, if any
+func (e *DeleteKeysError) Unwrap() error {
+	return e.Err
+}
+
+// Keys returns the sorted list of the keys which could not be removed
+func (e *DeleteKeysError) Keys() []string {
+	keys := make([]string, 0, len(e.Errors))
+	for key := range e.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// InvalidKeyError reports a key rejected by the provider before any operation on it. It is classified as ErrInvalidKey
+type InvalidKeyError struct {
+	Key    string
+	Reason string
+}
+
+func (e *InvalidKeyError) Error() string {
+	return fmt.Sprintf(invalidKeyErrorMessage, e.Key, e.Reason)
+}
+
+// Is reports whether target is ErrInvalidKey
+func (e *InvalidKeyError) Is(target error) bool {
+	return target == ErrInvalidKey
+}
+
+// NotSupportedError reports an operation the provider does not implement, such as the writes of the read-only
+// providers. It is classified as ErrNotSupported
+type NotSupportedError struct {
+	// the operation, eg.: PutStream
+	Op string
+	// the kind of the provider
+	Kind string
+}
+
+func (e *NotSupportedError) Error() string {
+	return fmt.Sprintf(notSupportedErrorMessage, e.Op, e.Kind)
+}
+
+// Is reports whether target is ErrNotSupported
+func (e *NotSupportedError) Is(target error) bool {
+	return target == ErrNotSupported
+}
+
+//ErrorNotSupported helper to return a common error when an operation is not implemented by the provider
+func ErrorNotSupported(op string, kind string) error {
+	return &NotSupportedError{Op: op, Kind: kind}
+}
+
+//ErrorInvalidKey helper to return a common error when a key is rejected by the provider
+func ErrorInvalidKey(key string, reason string) error {
+	return &InvalidKeyError{Key: key, Reason: reason}
+}
+
 //ErrorTooMuchListKeysArgs helper to return a common error message when a too much args are given for the list function
 func ErrorTooMuchListKeysArgs(extra ...interface{}) error {
 	return fmt.Errorf(tooMuchListKeysArgsMessage, extra...)
@@ -38,11 +183,21 @@ func ErrorListKeysError(extra ...interface{}) error {
 	return fmt.Errorf(listKeysErrorMessage, extra...)
 }
 
+//ErrorListDir helper to return a common error message when error occures in ListDir
+func ErrorListDir(extra ...interface{}) error {
+	return fmt.Errorf(listDirErrorMessage, extra...)
+}
+
 //ErrorGetStreamReader helper to return a common error message when an error is raised when fetching a stream from object storage
 func ErrorGetStreamReader(extra ...interface{}) error {
 	return fmt.Errorf(getStreamReaderErrorMessage, extra...)
 }
 
+//ErrorGetRange helper to return a common error message when an error is raised when fetching a range of an object from object storage
+func ErrorGetRange(extra ...interface{}) error {
+	return fmt.Errorf(getRangeErrorMessage, extra...)
+}
+
 //ErrorPutStreamReader helper to return a common error message when an error is raised when putting a stream to object storage
 func ErrorPutStreamReader(extra ...interface{}) error {
 	return fmt.Errorf(putStreamReaderErrorMessage, extra...)
@@ -53,11 +208,56 @@ func ErrorDeleteKey(extra ...interface{}) error {
 	return fmt.Errorf(deleteKeyErrorMessage, extra...)
 }
 
+//ErrorDeleteKeys helper to return the report of a batch delete. nil is returned when every key has been removed
+func ErrorDeleteKeys(failures map[string]error) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	return &DeleteKeysError{Errors: failures}
+}
+
+//ErrorDeletePrefix helper to return the failures of the keys listed by DeletePrefix along with the error which stopped
+//the listing. The listing error is returned as is when no key failed
+func ErrorDeletePrefix(listErr error, failures map[string]error) error {
+	if listErr == nil {
+		return ErrorDeleteKeys(failures)
+	}
+	if len(failures) == 0 {
+		return listErr
+	}
+	return &DeleteKeysError{Errors: failures, Err: listErr}
+}
+
+//ErrorCopyKey helper to return a common error message when an error is raised when copying a key within the object storage
+func ErrorCopyKey(extra ...interface{}) error {
+	return fmt.Errorf(copyKeyErrorMessage, extra...)
+}
+
+//ErrorMoveKey helper to return a common error message when an error is raised when moving a key within the object storage
+func ErrorMoveKey(extra ...interface{}) error {
+	return fmt.Errorf(moveKeyErrorMessage, extra...)
+}
+
+//ErrorStat helper to return a common error message when an error is raised when fetching the attributes of a key from the object storage
+func ErrorStat(extra ...interface{}) error {
+	return fmt.Errorf(statErrorMessage, extra...)
+}
+
 //ErrorInitProvider helper to return a common error message when an error is raised when instantiating a provider client
 func ErrorInitProvider(extra ...interface{}) error {
 	return fmt.Errorf(providerFactoryInitErrorMessage, extra...)
 }
 
+//ErrorRegisterProvider helper to return a common error message when a provider can not be registered
+func ErrorRegisterProvider(extra ...interface{}) error {
+	return fmt.Errorf(providerRegisterErrorMessage, extra...)
+}
+
+//ErrorProviderURL helper to return a common error message when a provider url can not be processed
+func ErrorProviderURL(extra ...interface{}) error {
+	return fmt.Errorf(providerURLErrorMessage, extra...)
+}
+
 //ErrorUnknownProvider helper to return a common error message when an error is raised when instantiating a provider client for an unknown provider type
 func ErrorUnknownProvider(extra ...interface{}) error {
 	return fmt.Errorf(providerFactoryUnknownKindMessage, extra...)
@@ -0,0 +1,164 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package errors
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestWrap(t *testing.T) {
+	cause := &os.PathError{Op: "open", Path: "/bladibla", Err: os.ErrNotExist}
+	type args struct {
+		kind error
+		err  error
+	}
+	tests := []struct {
+		name     string
+		args     args
+		wantKind error
+		wantNil  bool
+	}{
+		{
+			name: "Should classify the error",
+			args: args{
+				kind: ErrNotExist,
+				err:  cause,
+			},
+			wantKind: ErrNotExist,
+		},
+		{
+			name: "Should return nil on nil error",
+			args: args{
+				kind: ErrNotExist,
+				err:  nil,
+			},
+			wantNil: true,
+		},
+		{
+			name: "Should return the error untouched without kind",
+			args: args{
+				kind: nil,
+				err:  cause,
+			},
+			wantKind: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Wrap(tt.args.kind, tt.args.err)
+			if (got == nil) != tt.wantNil {
+				t.Errorf("Wrap() got = %v, wantNil %v", got, tt.wantNil)
+				return
+			}
+			if got == nil {
+				return
+			}
+			// the error should be wrapped by the helpers and still be checkable
+			wrapped := ErrorGetStreamReader("bladibla", got)
+			if tt.wantKind != nil && !errors.Is(wrapped, tt.wantKind) {
+				t.Errorf("Wrap() error %v is not %v", wrapped, tt.wantKind)
+			}
+			if errors.Is(wrapped, ErrPermissionDenied) {
+				t.Errorf("Wrap() error %v should not be %v", wrapped, ErrPermissionDenied)
+			}
+			var pathErr *os.PathError
+			if !errors.As(wrapped, &pathErr) {
+				t.Errorf("Wrap() error %v should unwrap to the original error", wrapped)
+			}
+			if wrapped.Error() != "GetStream: error while fetching reader for filePath bladibla. err="+cause.Error() {
+				t.Errorf("Wrap() error message = %v", wrapped.Error())
+			}
+		})
+	}
+}
+
+func TestErrorDeleteKeys(t *testing.T) {
+	if err := ErrorDeleteKeys(map[string]error{}); err != nil {
+		t.Errorf("ErrorDeleteKeys() got = %v, want nil", err)
+	}
+	err := ErrorDeleteKeys(map[string]error{
+		"b": Wrap(ErrPermissionDenied, errors.New("access denied")),
+		"a": Wrap(ErrNotExist, errors.New("no such key")),
+	})
+	var deleteErr *DeleteKeysError
+	if !errors.As(err, &deleteErr) {
+		t.Errorf("ErrorDeleteKeys() error = %v, should be a DeleteKeysError", err)
+		return
+	}
+	if keys := deleteErr.Keys(); len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Errorf("DeleteKeysError.Keys() got = %v, want [a b]", keys)
+	}
+	if want := "DeleteKeys: error when deleting 2 keys. first failure on key a. err=no such key"; err.Error() != want {
+		t.Errorf("DeleteKeysError.Error() got = %v, want %v", err.Error(), want)
+	}
+}
+
+func TestErrorDeletePrefix(t *testing.T) {
+	listErr := Wrap(ErrPermissionDenied, errors.New("access denied"))
+	if err := ErrorDeletePrefix(nil, map[string]error{}); err != nil {
+		t.Errorf("ErrorDeletePrefix() got = %v, want nil", err)
+	}
+	if err := ErrorDeletePrefix(listErr, map[string]error{}); err != listErr {
+		t.Errorf("ErrorDeletePrefix() got = %v, want %v", err, listErr)
+	}
+	err := ErrorDeletePrefix(listErr, map[string]error{
+		"a": Wrap(ErrNotExist, errors.New("no such key")),
+	})
+	var deleteErr *DeleteKeysError
+	if !errors.As(err, &deleteErr) {
+		t.Errorf("ErrorDeletePrefix() error = %v, should be a DeleteKeysError", err)
+		return
+	}
+	if keys := deleteErr.Keys(); len(keys) != 1 || keys[0] != "a" {
+		t.Errorf("DeleteKeysError.Keys() got = %v, want [a]", keys)
+	}
+	if !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("ErrorDeletePrefix() error = %v, should be %v", err, ErrPermissionDenied)
+	}
+}
+
+func TestErrorInvalidKey(t *testing.T) {
+	err := fmt.Errorf("GetStream: err=%w", ErrorInvalidKey("../etc/passwd", "resolves outside of the directory"))
+	if !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("ErrorInvalidKey() error = %v, should be %v", err, ErrInvalidKey)
+	}
+	var invalidErr *InvalidKeyError
+	if !errors.As(err, &invalidErr) || invalidErr.Key != "../etc/passwd" {
+		t.Errorf("ErrorInvalidKey() error = %v, should be an InvalidKeyError", err)
+	}
+	if errors.Is(err, ErrNotExist) {
+		t.Errorf("ErrorInvalidKey() error = %v, should not be %v", err, ErrNotExist)
+	}
+}
+
+func TestErrorNotSupported(t *testing.T) {
+	err := ErrorNotSupported("PutStream", "http")
+	if !errors.Is(err, ErrNotSupported) {
+		t.Errorf("ErrorNotSupported() error = %v, should be %v", err, ErrNotSupported)
+	}
+	var notSupportedErr *NotSupportedError
+	if !errors.As(err, &notSupportedErr) || notSupportedErr.Op != "PutStream" || notSupportedErr.Kind != "http" {
+		t.Errorf("ErrorNotSupported() error = %v, should be a NotSupportedError", err)
+	}
+	if want := "PutStream: operation not supported by provider http"; err.Error() != want {
+		t.Errorf("NotSupportedError.Error() got = %v, want %v", err.Error(), want)
+	}
+	if errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("ErrorNotSupported() error = %v, should not be %v", err, ErrPermissionDenied)
+	}
+}
@@ -63,22 +63,29 @@ func main() {
 		return
 	}
 
-	// io.Pipe is a really conveniant way to link a reader and a writer
-	reader, writer := io.Pipe()
+	// the archive is written straight to the remote storage, canceling the context aborts the upload
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	writer, err := provider.NewWriter(ctx, path.Base(directory)+".tar", WithContentType("application/x-tar"))
+	if err != nil {
+		fmt.Printf("error creating %v.tar on remote storage. err=%v", path.Base(directory), err.Error())
+		return
+	}
 
-	// let's launch a go routing that will tar the directory.
-	// this go routine will return (wg.Done()) one it is done for it to add all required files
-	go tarThis(directory, writer)
+	if err := tarThis(directory, writer); err != nil {
+		fmt.Printf("error creating the archive of %v. err=%v", directory, err.Error())
+		cancel()
+	}
 
-	//
-	written, err := provider.PutStream(path.Base(directory)+".tar", reader)
-	if err != nil {
+	// the remote file is only committed on close, which reports the upload errors
+	if err := writer.Close(); err != nil {
 		fmt.Printf("error writing %v.tar for remote storage. err=%v", path.Base(directory), err.Error())
+		return
 	}
-	fmt.Printf("wrote %v bytes to remote file %v.tar.", written, directory)
+	fmt.Printf("wrote remote file %v.tar.", path.Base(directory))
 }
 
-func tarThis(directory string, writer io.WriteCloser) {
+func tarThis(directory string, writer io.Writer) error {
 	var files = make(map[string]os.FileInfo)
 	err := filepath.Walk(directory, func(path string, info os.FileInfo, err error) error {
 		if err == nil && !info.IsDir() {
@@ -87,8 +94,7 @@ func tarThis(directory string, writer io.WriteCloser) {
 		return nil
 	})
 	if err != nil {
-		fmt.Printf(err.Error() + "\n")
-		return
+		return err
 	}
 
 	tarfileWriter := tar.NewWriter(writer)
@@ -96,8 +102,7 @@ func tarThis(directory string, writer io.WriteCloser) {
 		if fileInfo.Mode().IsRegular() {
 			file, err := os.Open(fpath)
 			if err != nil {
-				fmt.Printf("Error opening %v for reading. %v\n", fpath, err)
-				break
+				return fmt.Errorf("error opening %v for reading. %w", fpath, err)
 			}
 			// prepare the tar header
 
@@ -109,19 +114,15 @@ func tarThis(directory string, writer io.WriteCloser) {
 
 			err = tarfileWriter.WriteHeader(header)
 			if err != nil {
-				fmt.Printf("Error writing tar header for %v. %v\n", fpath, err)
 				file.Close()
-				break
+				return fmt.Errorf("error writing tar header for %v. %w", fpath, err)
 			}
 			_, err = io.Copy(tarfileWriter, file)
+			file.Close()
 			if err != nil {
-				fmt.Printf("Error copying tar stream to tar writer for %v. %v\n", fpath, err)
-				file.Close()
-				break
+				return fmt.Errorf("error copying tar stream to tar writer for %v. %w", fpath, err)
 			}
-			file.Close()
 		}
 	}
-	tarfileWriter.Close()
-	writer.Close()
+	return tarfileWriter.Close()
 }
@@ -72,11 +72,13 @@ func main() {
 		return
 	}
 
-	srcStream, _, err := srcProvider.GetStream(filename)
+	srcStream, err := srcProvider.NewReader(ctx, filename)
 	if err != nil {
 		fmt.Println(fmt.Sprintf("error fetching source stream %v. err=%v", filename, err.Error()))
 		syscall.Exit(1)
 	}
+	// closing the stream releases the underlying connection
+	defer srcStream.Close()
 
 	_, err = dstProvider.PutStream(filename, srcStream)
 	if err != nil {
@@ -17,30 +17,42 @@ package factory
 import (
 	"context"
 	"github.com/contentsquare/gospal/gospal"
-	"github.com/contentsquare/gospal/gospal/aws"
+	// the built-in providers register themselves when imported
+	_ "github.com/contentsquare/gospal/gospal/archive"
+	_ "github.com/contentsquare/gospal/gospal/aws"
+	_ "github.com/contentsquare/gospal/gospal/azure"
 	"github.com/contentsquare/gospal/gospal/errors"
-	"github.com/contentsquare/gospal/gospal/gcp"
-	localprovider "github.com/contentsquare/gospal/gospal/local"
+	_ "github.com/contentsquare/gospal/gospal/gcp"
+	_ "github.com/contentsquare/gospal/gospal/http"
+	"github.com/contentsquare/gospal/gospal/internal/registry"
+	_ "github.com/contentsquare/gospal/gospal/local"
+	_ "github.com/contentsquare/gospal/gospal/memory"
+	_ "github.com/contentsquare/gospal/gospal/sftp"
 )
 
-//NewProviderFactory constructor for a provider
+// Constructor instantiates a provider of a kind over the bucket, such as the New functions of the provider packages
+type Constructor = registry.Constructor
+
+// Register makes a kind of provider available to NewProviderFactory. It is meant to be called from the init function
+// of the provider package. A kind can only be registered once, registering it again is reported as
+// errors.ErrAlreadyExists
+func Register(kind string, constructor Constructor) error {
+	return registry.Register(kind, constructor)
+}
+
+// Kinds returns the sorted kinds of the registered providers, the built-in ones included
+func Kinds() []string {
+	return registry.Kinds()
+}
+
+//NewProviderFactory constructor for a provider of any registered kind
 func NewProviderFactory(ctx context.Context, kind string, bucket string, config *gospal.ProviderConfig) (provider gospal.Gospal, err error) {
-	switch kind {
-	case string(gospal.ProviderAWS):
-		if provider, err = awsprovider.New(ctx, bucket, config); err != nil {
-			return nil, errors.ErrorInitProvider(kind, err.Error())
-		}
-		return provider, err
-	case string(gospal.ProviderGCP):
-		if provider, err = gcpprovider.New(ctx, bucket, config); err != nil {
-			return nil, errors.ErrorInitProvider(kind, err.Error())
-		}
-		return provider, err
-	case string(gospal.ProviderLocal):
-		if provider, err = localprovider.New(ctx, bucket, config); err != nil {
-			return nil, errors.ErrorInitProvider(kind, err.Error())
-		}
-		return provider, err
+	constructor, ok := registry.Lookup(kind)
+	if !ok {
+		return nil, errors.ErrorUnknownProvider(kind)
+	}
+	if provider, err = constructor(ctx, bucket, config); err != nil {
+		return nil, errors.ErrorInitProvider(kind, err)
 	}
-	return nil, errors.ErrorUnknownProvider(kind)
+	return provider, nil
 }
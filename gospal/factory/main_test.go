@@ -16,11 +16,28 @@ package factory
 
 import (
 	"context"
+	stderrors "errors"
+	"fmt"
 	"github.com/contentsquare/gospal/gospal"
+	azureprovider "github.com/contentsquare/gospal/gospal/azure"
+	"github.com/contentsquare/gospal/gospal/errors"
+	memprovider "github.com/contentsquare/gospal/gospal/memory"
 	"os"
+	"reflect"
+	"strings"
 	"testing"
 )
 
+// the registry is global, the custom providers are registered once whatever the number of test runs
+var (
+	registerCustomErr = Register("custom", func(ctx context.Context, bucket string, config *gospal.ProviderConfig) (gospal.Gospal, error) {
+		return memprovider.New(ctx, "custom-"+bucket, config)
+	})
+	registerFailingErr = Register("failing", func(ctx context.Context, bucket string, config *gospal.ProviderConfig) (gospal.Gospal, error) {
+		return nil, fmt.Errorf("unable to reach %v", bucket)
+	})
+)
+
 func TestNewProviderFactory(t *testing.T) {
 
 	type args struct {
@@ -59,6 +76,41 @@ func TestNewProviderFactory(t *testing.T) {
 			wantProvider: "gcp",
 			wantErr:      false,
 		},
+		{
+			name: "Should return a memory provider",
+			args: args{
+				ctx:    context.Background(),
+				kind:   "memory",
+				bucket: "test-bucket",
+				config: &gospal.ProviderConfig{},
+			},
+			wantProvider: "memory",
+			wantErr:      false,
+		},
+		{
+			name: "Should return an azure provider",
+			args: args{
+				ctx:    context.Background(),
+				kind:   "azure",
+				bucket: "test-container",
+				config: &gospal.ProviderConfig{
+					SpecConfig: &azureprovider.Config{AccountName: "devstoreaccount1"},
+				},
+			},
+			wantProvider: "azure",
+			wantErr:      false,
+		},
+		{
+			name: "Should return an http provider",
+			args: args{
+				ctx:    context.Background(),
+				kind:   "http",
+				bucket: "https://cdn.example.com/data",
+				config: &gospal.ProviderConfig{},
+			},
+			wantProvider: "http",
+			wantErr:      false,
+		},
 		{
 			name: "Should raise on unknown provider",
 			args: args{
@@ -109,3 +161,75 @@ func TestNewProviderFactory(t *testing.T) {
 		})
 	}
 }
+
+func TestRegister(t *testing.T) {
+	if registerCustomErr != nil || registerFailingErr != nil {
+		t.Errorf("Register() error = %v, %v", registerCustomErr, registerFailingErr)
+		return
+	}
+	if want := []string{"archive", "aws", "azure", "custom", "failing", "gcp", "http", "local", "memory", "sftp"}; !reflect.DeepEqual(Kinds(), want) {
+		t.Errorf("Kinds() got = %v, want %v", Kinds(), want)
+	}
+
+	provider, err := NewProviderFactory(context.Background(), "custom", "test-bucket", &gospal.ProviderConfig{})
+	if err != nil {
+		t.Errorf("NewProviderFactory() error = %v", err)
+		return
+	}
+	if _, err := provider.PutStream("a.txt", strings.NewReader("a")); err != nil {
+		t.Errorf("PutStream() error = %v", err)
+	}
+	if _, ok := memprovider.Bucket("custom-test-bucket").Get("a.txt"); !ok {
+		t.Errorf("NewProviderFactory() should have used the registered constructor")
+	}
+	if _, err := NewProviderFactory(context.Background(), "failing", "test-bucket", &gospal.ProviderConfig{}); err == nil {
+		t.Errorf("NewProviderFactory() should report the constructor error")
+	}
+
+	tests := []struct {
+		name        string
+		kind        string
+		constructor Constructor
+		wantExists  bool
+	}{
+		{
+			name:        "Should raise on a registered kind",
+			kind:        "custom",
+			constructor: memprovider.New,
+			wantExists:  true,
+		},
+		{
+			name:        "Should raise on a built-in kind",
+			kind:        "aws",
+			constructor: memprovider.New,
+			wantExists:  true,
+		},
+		{
+			name:        "Should raise on a missing constructor",
+			kind:        "nil-constructor",
+			constructor: nil,
+			wantExists:  false,
+		},
+		{
+			name:        "Should raise on an empty kind",
+			kind:        "",
+			constructor: memprovider.New,
+			wantExists:  false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Register(tt.kind, tt.constructor)
+			if err == nil {
+				t.Errorf("Register() should fail")
+				return
+			}
+			if stderrors.Is(err, errors.ErrAlreadyExists) != tt.wantExists {
+				t.Errorf("Register() error = %v, should be %v: %v", err, errors.ErrAlreadyExists, tt.wantExists)
+			}
+		})
+	}
+	if want := []string{"archive", "aws", "azure", "custom", "failing", "gcp", "http", "local", "memory", "sftp"}; !reflect.DeepEqual(Kinds(), want) {
+		t.Errorf("Kinds() got = %v, want %v", Kinds(), want)
+	}
+}
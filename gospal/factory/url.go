@@ -0,0 +1,190 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package factory
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/contentsquare/gospal/gospal"
+	azureprovider "github.com/contentsquare/gospal/gospal/azure"
+	"github.com/contentsquare/gospal/gospal/errors"
+	httpprovider "github.com/contentsquare/gospal/gospal/http"
+	"google.golang.org/api/option"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// schemes maps the usual url schemes of the storages to the kinds of provider. Any other scheme is taken as the kind
+// itself, eg.: memory://bucket/prefix
+var schemes = map[string]gospal.ProviderLabel{
+	"s3":     gospal.ProviderAWS,
+	"gs":     gospal.ProviderGCP,
+	"azblob": gospal.ProviderAzure,
+	"file":   gospal.ProviderLocal,
+	"mem":    gospal.ProviderMemory,
+	"https":  gospal.ProviderHTTP,
+}
+
+// ParseURL returns the kind, the bucket and the configuration of the provider located by the url. The path of the url
+// is the global prefix, except for file urls whose path is the local directory. The bucket of http and https urls is
+// the origin, scheme included:
+//   * s3://bucket/prefix?region=eu-west-1&endpoint=http://localhost:9000&disableSSL=true&s3ForcePathStyle=true
+//   * gs://bucket/prefix?endpoint=http://localhost:4443/storage/v1/&credentialsFile=/path/to/key.json
+//   * azblob://container/prefix?accountName=account&endpoint=http://127.0.0.1:10000/account
+//   * file:///var/data
+//   * mem://bucket/prefix
+//   * https://cdn.example.com/prefix?manifest=manifest.json
+// The common settings of ProviderConfig are set by the timeout (in seconds), maxKeys and delimiter query parameters.
+// Unknown query parameters are rejected
+func ParseURL(rawURL string) (kind string, bucket string, config *gospal.ProviderConfig, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", nil, errors.ErrorProviderURL(rawURL, err)
+	}
+	if u.Scheme == "" {
+		return "", "", nil, errors.ErrorProviderURL(rawURL, fmt.Errorf("missing scheme"))
+	}
+	kind = u.Scheme
+	if label, ok := schemes[u.Scheme]; ok {
+		kind = string(label)
+	}
+	config = gospal.NewProviderConfig()
+	if kind == string(gospal.ProviderLocal) {
+		if u.Host != "" && u.Host != "localhost" {
+			return "", "", nil, errors.ErrorProviderURL(rawURL, fmt.Errorf("unexpected host %v, file urls are local", u.Host))
+		}
+		bucket = u.Path
+	} else {
+		bucket = u.Host
+		config.GlobalPrefix = strings.Trim(u.Path, "/")
+	}
+	if kind == string(gospal.ProviderHTTP) && u.Host != "" {
+		bucket = u.Scheme + "://" + u.Host
+	}
+	if bucket == "" {
+		return "", "", nil, errors.ErrorProviderURL(rawURL, fmt.Errorf("missing bucket"))
+	}
+
+	query := u.Query()
+	// pop returns the query parameter, removing it from the query parameters left to process
+	pop := func(name string) (string, bool) {
+		_, ok := query[name]
+		value := query.Get(name)
+		delete(query, name)
+		return value, ok
+	}
+	popInt := func(name string) (int64, bool, error) {
+		value, ok := pop(name)
+		if !ok {
+			return 0, false, nil
+		}
+		i, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return 0, false, fmt.Errorf("invalid %v: %w", name, err)
+		}
+		return i, true, nil
+	}
+	popBool := func(name string) (*bool, error) {
+		value, ok := pop(name)
+		if !ok {
+			return nil, nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %v: %w", name, err)
+		}
+		return &b, nil
+	}
+
+	if timeout, ok, err := popInt("timeout"); err != nil {
+		return "", "", nil, errors.ErrorProviderURL(rawURL, err)
+	} else if ok {
+		config.TimeOut = int(timeout)
+	}
+	if maxKeys, ok, err := popInt("maxKeys"); err != nil {
+		return "", "", nil, errors.ErrorProviderURL(rawURL, err)
+	} else if ok {
+		config.MaxKeys = maxKeys
+	}
+	if delimiter, ok := pop("delimiter"); ok {
+		config.Delimiter = delimiter
+	}
+
+	switch kind {
+	case string(gospal.ProviderAWS):
+		cfg := &aws.Config{}
+		if region, ok := pop("region"); ok {
+			cfg.Region = aws.String(region)
+		}
+		if endpoint, ok := pop("endpoint"); ok {
+			cfg.Endpoint = aws.String(endpoint)
+		}
+		if cfg.DisableSSL, err = popBool("disableSSL"); err != nil {
+			return "", "", nil, errors.ErrorProviderURL(rawURL, err)
+		}
+		if cfg.S3ForcePathStyle, err = popBool("s3ForcePathStyle"); err != nil {
+			return "", "", nil, errors.ErrorProviderURL(rawURL, err)
+		}
+		config.SpecConfig = cfg
+	case string(gospal.ProviderGCP):
+		var opts []option.ClientOption
+		if endpoint, ok := pop("endpoint"); ok {
+			opts = append(opts, option.WithEndpoint(endpoint))
+		}
+		if credentialsFile, ok := pop("credentialsFile"); ok {
+			opts = append(opts, option.WithCredentialsFile(credentialsFile))
+		}
+		if len(opts) > 0 {
+			config.SpecConfig = opts
+		}
+	case string(gospal.ProviderAzure):
+		// the account key is a secret, it is only read from the environment
+		cfg := &azureprovider.Config{}
+		cfg.AccountName, _ = pop("accountName")
+		cfg.Endpoint, _ = pop("endpoint")
+		config.SpecConfig = cfg
+	case string(gospal.ProviderHTTP):
+		cfg := &httpprovider.Config{}
+		cfg.Manifest, _ = pop("manifest")
+		htmlIndex, err := popBool("htmlIndex")
+		if err != nil {
+			return "", "", nil, errors.ErrorProviderURL(rawURL, err)
+		}
+		cfg.HTMLIndex = htmlIndex != nil && *htmlIndex
+		config.SpecConfig = cfg
+	}
+
+	if len(query) > 0 {
+		names := make([]string, 0, len(query))
+		for name := range query {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", "", nil, errors.ErrorProviderURL(rawURL, fmt.Errorf("unknown query parameters %v", names))
+	}
+	return kind, bucket, config, nil
+}
+
+// OpenURL returns the provider located by the url, see ParseURL
+func OpenURL(ctx context.Context, rawURL string) (gospal.Gospal, error) {
+	kind, bucket, config, err := ParseURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return NewProviderFactory(ctx, kind, bucket, config)
+}
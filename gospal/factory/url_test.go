@@ -0,0 +1,189 @@
+package factory
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/contentsquare/gospal/gospal"
+	azureprovider "github.com/contentsquare/gospal/gospal/azure"
+	httpprovider "github.com/contentsquare/gospal/gospal/http"
+	memprovider "github.com/contentsquare/gospal/gospal/memory"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		rawURL     string
+		wantKind   string
+		wantBucket string
+		wantConfig *gospal.ProviderConfig
+		wantErr    bool
+	}{
+		{
+			name:       "Should parse a s3 url",
+			rawURL:     "s3://bucket/some/prefix/?region=eu-west-1&endpoint=http://localhost:9000&disableSSL=true&s3ForcePathStyle=true",
+			wantKind:   "aws",
+			wantBucket: "bucket",
+			wantConfig: &gospal.ProviderConfig{
+				TimeOut:      300,
+				MaxKeys:      1024,
+				GlobalPrefix: "some/prefix",
+				SpecConfig: &aws.Config{
+					Region:           aws.String("eu-west-1"),
+					Endpoint:         aws.String("http://localhost:9000"),
+					DisableSSL:       aws.Bool(true),
+					S3ForcePathStyle: aws.Bool(true),
+				},
+			},
+		},
+		{
+			name:       "Should parse a gs url",
+			rawURL:     "gs://bucket/prefix?timeout=10&maxKeys=100&delimiter=|",
+			wantKind:   "gcp",
+			wantBucket: "bucket",
+			wantConfig: &gospal.ProviderConfig{TimeOut: 10, MaxKeys: 100, Delimiter: "|", GlobalPrefix: "prefix"},
+		},
+		{
+			name:       "Should parse an azblob url",
+			rawURL:     "azblob://container/prefix?accountName=devstoreaccount1&endpoint=http://127.0.0.1:10000/devstoreaccount1",
+			wantKind:   "azure",
+			wantBucket: "container",
+			wantConfig: &gospal.ProviderConfig{
+				TimeOut:      300,
+				MaxKeys:      1024,
+				GlobalPrefix: "prefix",
+				SpecConfig:   &azureprovider.Config{AccountName: "devstoreaccount1", Endpoint: "http://127.0.0.1:10000/devstoreaccount1"},
+			},
+		},
+		{
+			name:       "Should parse an https url",
+			rawURL:     "https://cdn.example.com/data?manifest=manifest.json",
+			wantKind:   "http",
+			wantBucket: "https://cdn.example.com",
+			wantConfig: &gospal.ProviderConfig{
+				TimeOut:      300,
+				MaxKeys:      1024,
+				GlobalPrefix: "data",
+				SpecConfig:   &httpprovider.Config{Manifest: "manifest.json"},
+			},
+		},
+		{
+			name:       "Should parse an http url",
+			rawURL:     "http://127.0.0.1:8080/data?htmlIndex=true",
+			wantKind:   "http",
+			wantBucket: "http://127.0.0.1:8080",
+			wantConfig: &gospal.ProviderConfig{
+				TimeOut:      300,
+				MaxKeys:      1024,
+				GlobalPrefix: "data",
+				SpecConfig:   &httpprovider.Config{HTMLIndex: true},
+			},
+		},
+		{
+			name:       "Should parse a file url",
+			rawURL:     "file:///var/data",
+			wantKind:   "local",
+			wantBucket: "/var/data",
+			wantConfig: &gospal.ProviderConfig{TimeOut: 300, MaxKeys: 1024},
+		},
+		{
+			name:       "Should parse a url of any registered kind",
+			rawURL:     "memory://bucket/caf%C3%A9",
+			wantKind:   "memory",
+			wantBucket: "bucket",
+			wantConfig: &gospal.ProviderConfig{TimeOut: 300, MaxKeys: 1024, GlobalPrefix: "café"},
+		},
+		{
+			name:    "Should raise on unknown query parameters",
+			rawURL:  "gs://bucket/prefix?region=eu-west-1",
+			wantErr: true,
+		},
+		{
+			name:    "Should raise on invalid query parameters",
+			rawURL:  "s3://bucket/prefix?maxKeys=many",
+			wantErr: true,
+		},
+		{
+			name:    "Should raise on missing bucket",
+			rawURL:  "s3:///prefix",
+			wantErr: true,
+		},
+		{
+			name:    "Should raise on remote file url",
+			rawURL:  "file://remote/var/data",
+			wantErr: true,
+		},
+		{
+			name:    "Should raise on missing scheme",
+			rawURL:  "bucket/prefix",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kind, bucket, config, err := ParseURL(tt.rawURL)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseURL() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if kind != tt.wantKind || bucket != tt.wantBucket || !reflect.DeepEqual(config, tt.wantConfig) {
+				t.Errorf("ParseURL() got = %v, %v, %+v, want %v, %v, %+v", kind, bucket, config, tt.wantKind, tt.wantBucket, tt.wantConfig)
+			}
+		})
+	}
+}
+
+func TestOpenURL(t *testing.T) {
+	tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+	if err != nil {
+		t.Errorf("unable to create temporary directory for tests. err=%v", err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDirectory)
+
+	provider, err := OpenURL(context.Background(), "file://"+tmpDirectory)
+	if err != nil {
+		t.Errorf("OpenURL() error = %v", err)
+		return
+	}
+	if _, err := provider.PutStream("a/b.txt", strings.NewReader("b")); err != nil {
+		t.Errorf("PutStream() error = %v", err)
+	}
+	if _, err := os.Stat(path.Join(tmpDirectory, "a/b.txt")); err != nil {
+		t.Errorf("OpenURL() should use the path as directory. err=%v", err)
+	}
+
+	store := memprovider.Bucket("url-bucket")
+	defer store.Reset()
+	provider, err = OpenURL(context.Background(), "mem://url-bucket/some/prefix")
+	if err != nil {
+		t.Errorf("OpenURL() error = %v", err)
+		return
+	}
+	if _, err := provider.PutStream("a.txt", strings.NewReader("a")); err != nil {
+		t.Errorf("PutStream() error = %v", err)
+	}
+	if keys := store.Keys(""); !reflect.DeepEqual(keys, []string{"some/prefix/a.txt"}) {
+		t.Errorf("OpenURL() should use the path as global prefix, got %v", keys)
+	}
+
+	// the region of the url is enough, whatever the environment
+	region, ok := os.LookupEnv("AWS_REGION")
+	os.Unsetenv("AWS_REGION")
+	defer func() {
+		if ok {
+			os.Setenv("AWS_REGION", region)
+		}
+	}()
+	if provider, err = OpenURL(context.Background(), "s3://bucket/prefix?region=eu-west-1"); err != nil || provider.GetKind() != "aws" {
+		t.Errorf("OpenURL() got = %v, %v", provider, err)
+	}
+	if _, err = OpenURL(context.Background(), "bladibla://bucket/prefix"); err == nil {
+		t.Errorf("OpenURL() should raise on unknown provider")
+	}
+}
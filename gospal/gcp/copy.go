@@ -0,0 +1,50 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package gcpprovider
+
+import (
+	"context"
+	"github.com/contentsquare/gospal/gospal/errors"
+)
+
+func (p *provider) Copy(src string, dst string) error {
+	return p.CopyContext(p.context, src, dst)
+}
+
+func (p *provider) CopyContext(ctx context.Context, src string, dst string) error {
+	srcKey, dstKey := p.getTargetKey(src), p.getTargetKey(dst)
+	bucket := p.client.Bucket(p.bucketName)
+	// the copier relies on the rewrite api, which copies objects of any size server side, calling it again as long
+	// as the copy is not done
+	if _, err := bucket.Object(dstKey).CopierFrom(bucket.Object(srcKey)).Run(ctx); err != nil {
+		return errors.ErrorCopyKey(srcKey, dstKey, toError(err))
+	}
+	return nil
+}
+
+func (p *provider) Move(src string, dst string) error {
+	return p.MoveContext(p.context, src, dst)
+}
+
+func (p *provider) MoveContext(ctx context.Context, src string, dst string) error {
+	// gcs has no rename, the object is copied then removed
+	if err := p.CopyContext(ctx, src, dst); err != nil {
+		return errors.ErrorMoveKey(p.getTargetKey(src), p.getTargetKey(dst), err)
+	}
+	if err := p.DeleteKeyContext(ctx, src); err != nil {
+		return errors.ErrorMoveKey(p.getTargetKey(src), p.getTargetKey(dst), err)
+	}
+	return nil
+}
@@ -17,11 +17,15 @@ package gcpprovider
 import (
 	"cloud.google.com/go/storage"
 	"context"
+	stderrors "errors"
 	"github.com/contentsquare/gospal/gospal"
 	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/internal/registry"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
 	"io"
-	"path"
+	"strings"
 	"time"
 )
 
@@ -35,14 +39,56 @@ type provider struct {
 	config *gospal.ProviderConfig
 }
 
+// toError classifies a gcp sdk error as one of the gospal errors
+func toError(err error) error {
+	if stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded) {
+		return errors.Wrap(errors.ErrCanceled, err)
+	}
+	if stderrors.Is(err, storage.ErrObjectNotExist) || stderrors.Is(err, storage.ErrBucketNotExist) {
+		return errors.Wrap(errors.ErrNotExist, err)
+	}
+	var gerr *googleapi.Error
+	if stderrors.As(err, &gerr) {
+		switch gerr.Code {
+		case 404:
+			return errors.Wrap(errors.ErrNotExist, err)
+		case 401, 403:
+			return errors.Wrap(errors.ErrPermissionDenied, err)
+		case 409:
+			return errors.Wrap(errors.ErrAlreadyExists, err)
+		case 412:
+			return errors.Wrap(errors.ErrPreconditionFailed, err)
+		case 429, 500, 502, 503, 504:
+			return errors.Wrap(errors.ErrTransient, err)
+		}
+	}
+	return err
+}
+
 func (p *provider) getTargetKey(filePath string) string {
-	if p.config.GlobalPrefix != "" {
-		return path.Join(p.config.GlobalPrefix, filePath)
+	return gospal.TargetKey(p.config.GlobalPrefix, filePath)
+}
+
+// getTargetPrefix returns the listing prefix of the specified prefix. The global prefix being a directory, the keys of
+// its siblings should not be listed
+func (p *provider) getTargetPrefix(prefix string) string {
+	targetKey := p.getTargetKey(prefix)
+	if p.config.GlobalPrefix != "" && (prefix == "" || strings.HasSuffix(prefix, "/")) && !strings.HasSuffix(targetKey, "/") {
+		targetKey += "/"
 	}
-	return filePath
+	return targetKey
+}
+
+// toKey returns the key relative to the global prefix of the specified gcs object name
+func (p *provider) toKey(targetKey string) string {
+	return gospal.RelativeKey(p.config.GlobalPrefix, targetKey)
 }
 
-func (p *provider) ListKeys(pathName ...string) (fileList []string, err error) {
+func (p *provider) ListKeys(pathName ...string) ([]string, error) {
+	return p.ListKeysContext(p.context, pathName...)
+}
+
+func (p *provider) ListKeysContext(ctx context.Context, pathName ...string) (fileList []string, err error) {
 	if len(pathName) > 1 {
 		return nil, errors.ErrorTooMuchListKeysArgs()
 	}
@@ -50,48 +96,203 @@ func (p *provider) ListKeys(pathName ...string) (fileList []string, err error) {
 	if len(pathName) != 0 {
 		extraPath = pathName[0]
 	}
-	targetKey := p.getTargetKey(extraPath)
-	it := p.client.Bucket(p.bucketName).Objects(p.context, &storage.Query{
+	it := p.Objects(ctx, extraPath)
+	for it.Next() {
+		fileList = append(fileList, it.Object().Key)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return fileList, nil
+}
+
+func (p *provider) ListDir(prefix string) ([]string, []string, error) {
+	return p.ListDirContext(p.context, prefix)
+}
+
+func (p *provider) ListDirContext(ctx context.Context, prefix string) (keys []string, prefixes []string, err error) {
+	delimiter := p.config.Delimiter
+	if delimiter == "" {
+		delimiter = gospal.DefaultDelimiter
+	}
+	// the prefix is a directory, it should end with the delimiter
+	targetKey := p.getTargetKey(prefix)
+	if targetKey != "" && !strings.HasSuffix(targetKey, delimiter) {
+		targetKey += delimiter
+	}
+	it := p.client.Bucket(p.bucketName).Objects(ctx, &storage.Query{
 		Prefix:    targetKey,
-		Delimiter: p.config.Delimiter,
+		Delimiter: delimiter,
 	})
-
 	for {
 		attrs, err := it.Next()
 		if err == iterator.Done {
 			break
 		}
 		if err != nil {
-			return nil, errors.ErrorListKeysError(targetKey, err.Error())
+			return nil, nil, errors.ErrorListDir(targetKey, toError(err))
+		}
+		// sub prefixes are returned as objects with only the prefix set
+		if attrs.Prefix != "" {
+			prefixes = append(prefixes, p.toKey(attrs.Prefix))
+		} else {
+			keys = append(keys, p.toKey(attrs.Name))
 		}
-		fileList = append(fileList, attrs.Name)
+	}
+	return keys, prefixes, nil
+}
 
+func (p *provider) Objects(ctx context.Context, prefix string) gospal.ObjectIterator {
+	return p.ObjectsFrom(ctx, prefix, "")
+}
+
+func (p *provider) ObjectsFrom(ctx context.Context, prefix string, pageToken string) gospal.ObjectIterator {
+	return p.objects(ctx, prefix, pageToken, p.config.Delimiter)
+}
+
+// objects returns the iterator of the objects under the prefix. With a delimiter, only the objects right under the
+// prefix are listed
+func (p *provider) objects(ctx context.Context, prefix string, pageToken string, delimiter string) *objectIterator {
+	targetKey := p.getTargetPrefix(prefix)
+	it := p.client.Bucket(p.bucketName).Objects(ctx, &storage.Query{
+		Prefix:    targetKey,
+		Delimiter: delimiter,
+	})
+	it.PageInfo().Token = pageToken
+	if p.config.MaxKeys > 0 {
+		it.PageInfo().MaxSize = int(p.config.MaxKeys)
 	}
-	return fileList, nil
+	return &objectIterator{p: p, it: it, prefix: targetKey}
 }
 
 func (p *provider) GetStream(filePath string) (io.Reader, context.CancelFunc, error) {
-	ctx, cancel := context.WithTimeout(p.context, time.Second*time.Duration(p.config.TimeOut))
-	var reader *storage.Reader
-	var err error
+	return p.GetStreamContext(p.context, filePath)
+}
+
+func (p *provider) GetStreamContext(ctx context.Context, filePath string) (io.Reader, context.CancelFunc, error) {
+	return gospal.ToStream(p.NewReader(ctx, filePath))
+}
 
-	if reader, err = p.client.Bucket(p.bucketName).Object(p.getTargetKey(filePath)).NewReader(ctx); err != nil {
+func (p *provider) NewReader(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(p.config.TimeOut))
+	reader, err := p.client.Bucket(p.bucketName).Object(p.getTargetKey(filePath)).NewReader(ctx)
+	if err != nil {
 		defer cancel()
-		return nil, nil, errors.ErrorGetStreamReader(p.getTargetKey(filePath), err.Error())
+		return nil, errors.ErrorGetStreamReader(p.getTargetKey(filePath), toError(err))
 	}
-	return reader, cancel, err
+	return gospal.NewReadCloser(reader, reader, cancel), nil
+}
+
+func (p *provider) GetRange(filePath string, offset int64, length int64) (io.Reader, context.CancelFunc, error) {
+	return p.GetRangeContext(p.context, filePath, offset, length)
 }
 
-func (p *provider) PutStream(filePath string, stream io.Reader) (written int64, err error) {
+func (p *provider) GetRangeContext(ctx context.Context, filePath string, offset int64, length int64) (io.Reader, context.CancelFunc, error) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(p.config.TimeOut))
 	targetKey := p.getTargetKey(filePath)
-	ctx, cancel := context.WithTimeout(p.context, time.Second*time.Duration(p.config.TimeOut))
+	if length < 0 {
+		// NewRangeReader reads up to the end of the object on -1 only
+		length = -1
+	}
+	reader, err := p.client.Bucket(p.bucketName).Object(targetKey).NewRangeReader(ctx, offset, length)
+	if err != nil {
+		defer cancel()
+		return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, targetKey, toError(err)))
+	}
+	return gospal.ToStream(gospal.NewReadCloser(reader, reader, cancel), nil)
+}
+
+func (p *provider) Open(filePath string) (gospal.ObjectReader, error) {
+	return p.OpenContext(p.context, filePath)
+}
+
+func (p *provider) OpenContext(ctx context.Context, filePath string) (gospal.ObjectReader, error) {
+	info, err := p.StatContext(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	return gospal.NewRangeReader(ctx, p, filePath, info.Size), nil
+}
+
+func (p *provider) PutStream(filePath string, stream io.Reader, opts ...gospal.PutOption) (int64, error) {
+	return p.PutStreamContext(p.context, filePath, stream, opts...)
+}
+
+func (p *provider) PutStreamContext(ctx context.Context, filePath string, stream io.Reader, opts ...gospal.PutOption) (written int64, err error) {
+	targetKey := p.getTargetKey(filePath)
+	ctx, cancel := context.WithTimeout(ctx, time.Second*time.Duration(p.config.TimeOut))
 	defer cancel()
-	wc := p.client.Bucket(p.bucketName).Object(targetKey).NewWriter(ctx)
-	defer wc.Close()
+	wc := p.newObjectWriter(ctx, targetKey, opts...)
 	if written, err = io.Copy(wc, stream); err != nil {
-		return 0, errors.ErrorPutStreamReader(targetKey, err.Error())
+		// canceling the context before closing the writer aborts the upload
+		cancel()
+		_ = wc.Close()
+		return 0, errors.ErrorPutStreamReader(targetKey, toError(err))
+	}
+	// the object is only committed on close, which reports the upload errors
+	if err = wc.Close(); err != nil {
+		return 0, errors.ErrorPutStreamReader(targetKey, toError(err))
 	}
-	return written, err
+	return written, nil
+}
+
+// newObjectWriter returns the writer of the target key with the attributes set by the options
+func (p *provider) newObjectWriter(ctx context.Context, targetKey string, opts ...gospal.PutOption) *storage.Writer {
+	options := gospal.NewPutOptions(opts...)
+	wc := p.client.Bucket(p.bucketName).Object(targetKey).NewWriter(ctx)
+	wc.ContentType = options.ContentType
+	wc.ContentEncoding = options.ContentEncoding
+	wc.CacheControl = options.CacheControl
+	wc.Metadata = options.Metadata
+	return wc
+}
+
+// objectWriter releases the context of the upload once the object is committed
+type objectWriter struct {
+	*storage.Writer
+	targetKey string
+	cancel    context.CancelFunc
+}
+
+func (w *objectWriter) Close() error {
+	defer w.cancel()
+	// the object is only committed on close, which reports the upload errors
+	if err := w.Writer.Close(); err != nil {
+		return errors.ErrorPutStreamReader(w.targetKey, toError(err))
+	}
+	return nil
+}
+
+func (p *provider) NewWriter(ctx context.Context, filePath string, opts ...gospal.PutOption) (io.WriteCloser, error) {
+	targetKey := p.getTargetKey(filePath)
+	if err := ctx.Err(); err != nil {
+		return nil, errors.ErrorPutStreamReader(targetKey, toError(err))
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return &objectWriter{Writer: p.newObjectWriter(ctx, targetKey, opts...), targetKey: targetKey, cancel: cancel}, nil
+}
+
+func (p *provider) Stat(filePath string) (*gospal.ObjectInfo, error) {
+	return p.StatContext(p.context, filePath)
+}
+
+func (p *provider) StatContext(ctx context.Context, filePath string) (*gospal.ObjectInfo, error) {
+	targetKey := p.getTargetKey(filePath)
+	attrs, err := p.client.Bucket(p.bucketName).Object(targetKey).Attrs(ctx)
+	if err != nil {
+		return nil, errors.ErrorStat(targetKey, toError(err))
+	}
+	return &gospal.ObjectInfo{
+		Key:             filePath,
+		Size:            attrs.Size,
+		LastModified:    attrs.Updated,
+		ETag:            attrs.Etag,
+		MD5:             attrs.MD5,
+		ContentType:     attrs.ContentType,
+		ContentEncoding: attrs.ContentEncoding,
+		CacheControl:    attrs.CacheControl,
+		Metadata:        attrs.Metadata,
+	}, nil
 }
 
 func (p *provider) GetKind() string {
@@ -99,8 +300,12 @@ func (p *provider) GetKind() string {
 }
 
 func (p *provider) DeleteKey(filePath string) error {
-	if err := p.client.Bucket(p.bucketName).Object(p.getTargetKey(filePath)).Delete(p.context); err != nil {
-		return errors.ErrorDeleteKey(p.getTargetKey(filePath), err.Error())
+	return p.DeleteKeyContext(p.context, filePath)
+}
+
+func (p *provider) DeleteKeyContext(ctx context.Context, filePath string) error {
+	if err := p.client.Bucket(p.bucketName).Object(p.getTargetKey(filePath)).Delete(ctx); err != nil {
+		return errors.ErrorDeleteKey(p.getTargetKey(filePath), toError(err))
 	}
 	return nil
 }
@@ -109,6 +314,11 @@ func (p *provider) GetNoSuchKeyErrorString() string {
 	return p.noSuchKeyErrorString
 }
 
+// the provider is available from the factory as soon as its package is imported
+func init() {
+	registry.MustRegister(gospal.ProviderGCP, New)
+}
+
 //New gcp provider constructor
 func New(ctx context.Context, bucket string, config *gospal.ProviderConfig) (gospal.Gospal, error) {
 	provider := provider{bucketName: bucket}
@@ -116,7 +326,9 @@ func New(ctx context.Context, bucket string, config *gospal.ProviderConfig) (gos
 	provider.noSuchKeyErrorString = storage.ErrObjectNotExist.Error()
 	provider.config = config
 	provider.context = ctx
-	client, err := storage.NewClient(provider.context)
+	// the client options, eg.: option.WithCredentialsFile, may be given as provider specific configuration
+	opts, _ := config.SpecConfig.([]option.ClientOption)
+	client, err := storage.NewClient(provider.context, opts...)
 	if err != nil {
 		return &provider, err
 	}
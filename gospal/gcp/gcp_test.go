@@ -18,11 +18,17 @@ import (
 	"bytes"
 	"cloud.google.com/go/storage"
 	"context"
+	stderrors "errors"
 	"fmt"
 	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/gospaltest"
 	"github.com/fsouza/fake-gcs-server/fakestorage"
+	"google.golang.org/api/googleapi"
 	"google.golang.org/api/iterator"
+	"google.golang.org/api/option"
 	"io"
+	"net/http"
 	"reflect"
 	"strings"
 	"testing"
@@ -257,6 +263,9 @@ func Test_provider_GetStream(t *testing.T) {
 				t.Errorf("GetStream() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
+			if err != nil && !stderrors.Is(err, errors.ErrNotExist) {
+				t.Errorf("GetStream() error = %v, should be %v", err, errors.ErrNotExist)
+			}
 			if err == nil {
 				var bb bytes.Buffer
 				io.Copy(&bb, got)
@@ -528,3 +537,796 @@ func Test_provider_ListKeys(t *testing.T) {
 		})
 	}
 }
+
+func Test_provider_Stat(t *testing.T) {
+	client := storageInit()
+
+	type fields struct {
+		context              context.Context
+		client               *storage.Client
+		bucketName           string
+		kind                 string
+		noSuchKeyErrorString string
+		config               *gospal.ProviderConfig
+	}
+	type args struct {
+		filePath string
+	}
+	tests := []struct {
+		name     string
+		fields   fields
+		args     args
+		wantSize int64
+		wantErr  bool
+	}{
+		{
+			name: "Should return the object attributes",
+			fields: fields{
+				context:              context.Background(),
+				client:               client,
+				bucketName:           testBucket,
+				kind:                 "gcp",
+				noSuchKeyErrorString: storage.ErrObjectNotExist.Error(),
+				config: &gospal.ProviderConfig{
+					TimeOut: 300,
+				},
+			},
+			args: args{
+				filePath: "path/to/bladibla_1.txt",
+			},
+			wantSize: int64(len("Some cool contents. with more useless chars %^&*()")),
+			wantErr:  false,
+		},
+		{
+			name: "Should raise with bad path",
+			fields: fields{
+				context:              context.Background(),
+				client:               client,
+				bucketName:           testBucket,
+				kind:                 "gcp",
+				noSuchKeyErrorString: storage.ErrObjectNotExist.Error(),
+				config: &gospal.ProviderConfig{
+					TimeOut: 300,
+				},
+			},
+			args: args{
+				filePath: "path/two/non_existing_file",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &provider{
+				context:              tt.fields.context,
+				client:               tt.fields.client,
+				bucketName:           tt.fields.bucketName,
+				kind:                 tt.fields.kind,
+				noSuchKeyErrorString: tt.fields.noSuchKeyErrorString,
+				config:               tt.fields.config,
+			}
+			got, err := p.Stat(tt.args.filePath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Stat() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil {
+				if got.Key != tt.args.filePath {
+					t.Errorf("Stat() got key = %v, want %v", got.Key, tt.args.filePath)
+				}
+				if got.Size != tt.wantSize {
+					t.Errorf("Stat() got size = %v, want %v", got.Size, tt.wantSize)
+				}
+			}
+		})
+	}
+}
+
+func Test_provider_StatContext(t *testing.T) {
+	p := &provider{
+		context:              context.Background(),
+		client:               storageInit(),
+		bucketName:           testBucket,
+		kind:                 "gcp",
+		noSuchKeyErrorString: storage.ErrObjectNotExist.Error(),
+		config: &gospal.ProviderConfig{
+			TimeOut: 300,
+		},
+	}
+
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	type args struct {
+		ctx      context.Context
+		filePath string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr bool
+	}{
+		{
+			name: "Should return the object attributes",
+			args: args{
+				ctx:      context.Background(),
+				filePath: "path/to/bladibla_1.txt",
+			},
+			wantErr: false,
+		},
+		{
+			name: "Should raise with a canceled context",
+			args: args{
+				ctx:      canceledCtx,
+				filePath: "path/to/bladibla_1.txt",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := p.StatContext(tt.args.ctx, tt.args.filePath); (err != nil) != tt.wantErr {
+				t.Errorf("StatContext() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_toError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantKind error
+	}{
+		{
+			name:     "Should classify ErrObjectNotExist as not exist",
+			err:      storage.ErrObjectNotExist,
+			wantKind: errors.ErrNotExist,
+		},
+		{
+			name:     "Should classify a wrapped ErrBucketNotExist as not exist",
+			err:      fmt.Errorf("reading bucket: %w", storage.ErrBucketNotExist),
+			wantKind: errors.ErrNotExist,
+		},
+		{
+			name:     "Should classify a 403 response as permission denied",
+			err:      &googleapi.Error{Code: 403, Message: "Forbidden"},
+			wantKind: errors.ErrPermissionDenied,
+		},
+		{
+			name:     "Should classify a 409 response as already exists",
+			err:      &googleapi.Error{Code: 409, Message: "Conflict"},
+			wantKind: errors.ErrAlreadyExists,
+		},
+		{
+			name:     "Should classify a 412 response as precondition failed",
+			err:      &googleapi.Error{Code: 412, Message: "Precondition Failed"},
+			wantKind: errors.ErrPreconditionFailed,
+		},
+		{
+			name:     "Should classify exceeded deadlines as canceled",
+			err:      context.DeadlineExceeded,
+			wantKind: errors.ErrCanceled,
+		},
+		{
+			name:     "Should classify a 500 response as transient",
+			err:      &googleapi.Error{Code: 500, Message: "Internal Server Error"},
+			wantKind: errors.ErrTransient,
+		},
+		{
+			name:     "Should classify a 429 response as transient",
+			err:      &googleapi.Error{Code: 429, Message: "Too Many Requests"},
+			wantKind: errors.ErrTransient,
+		},
+		{
+			name:     "Should not classify unknown errors",
+			err:      &googleapi.Error{Code: 400, Message: "Bad Request"},
+			wantKind: nil,
+		},
+	}
+	kinds := []error{errors.ErrNotExist, errors.ErrPermissionDenied, errors.ErrAlreadyExists, errors.ErrPreconditionFailed, errors.ErrCanceled, errors.ErrTransient}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := toError(tt.err)
+			for _, kind := range kinds {
+				if stderrors.Is(got, kind) != (kind == tt.wantKind) {
+					t.Errorf("toError() = %v, is %v: %v, want %v", got, kind, stderrors.Is(got, kind), tt.wantKind)
+				}
+			}
+			if !stderrors.Is(got, tt.err) {
+				t.Errorf("toError() = %v should unwrap to the gcp error", got)
+			}
+		})
+	}
+}
+
+func Test_provider_Objects(t *testing.T) {
+	p := &provider{
+		context:              context.Background(),
+		client:               storageInit(),
+		bucketName:           testBucket,
+		kind:                 "gcp",
+		noSuchKeyErrorString: storage.ErrObjectNotExist.Error(),
+		config: &gospal.ProviderConfig{
+			TimeOut: 300,
+			MaxKeys: 1,
+		},
+	}
+
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	type args struct {
+		ctx    context.Context
+		prefix string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "Should iterate over the objects",
+			args: args{
+				ctx:    context.Background(),
+				prefix: "path/",
+			},
+			want:    []string{"path/to/bladibla_1.txt", "path/two/bladibla_2.txt"},
+			wantErr: false,
+		},
+		{
+			name: "Should iterate over the objects with the specified prefix",
+			args: args{
+				ctx:    context.Background(),
+				prefix: "path/two",
+			},
+			want:    []string{"path/two/bladibla_2.txt"},
+			wantErr: false,
+		},
+		{
+			name: "Should raise with a canceled context",
+			args: args{
+				ctx:    canceledCtx,
+				prefix: "path/",
+			},
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it := p.Objects(tt.args.ctx, tt.args.prefix)
+			var got []string
+			for it.Next() {
+				got = append(got, it.Object().Key)
+			}
+			if (it.Err() != nil) != tt.wantErr {
+				t.Errorf("Objects() error = %v, wantErr %v", it.Err(), tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Objects() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_provider_ListDir(t *testing.T) {
+	p := &provider{
+		context:              context.Background(),
+		client:               storageInit(),
+		bucketName:           testBucket,
+		kind:                 "gcp",
+		noSuchKeyErrorString: storage.ErrObjectNotExist.Error(),
+		config: &gospal.ProviderConfig{
+			TimeOut: 300,
+		},
+	}
+
+	tests := []struct {
+		name         string
+		prefix       string
+		wantKeys     []string
+		wantPrefixes []string
+		wantErr      bool
+	}{
+		{
+			name:         "Should list sub prefixes",
+			prefix:       "path",
+			wantKeys:     nil,
+			wantPrefixes: []string{"path/to/", "path/two/"},
+			wantErr:      false,
+		},
+		{
+			name:         "Should list keys",
+			prefix:       "path/to/",
+			wantKeys:     []string{"path/to/bladibla_1.txt"},
+			wantPrefixes: nil,
+			wantErr:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotKeys, gotPrefixes, err := p.ListDir(tt.prefix)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ListDir() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotKeys, tt.wantKeys) {
+				t.Errorf("ListDir() gotKeys = %v, want %v", gotKeys, tt.wantKeys)
+			}
+			if !reflect.DeepEqual(gotPrefixes, tt.wantPrefixes) {
+				t.Errorf("ListDir() gotPrefixes = %v, want %v", gotPrefixes, tt.wantPrefixes)
+			}
+		})
+	}
+}
+
+func Test_provider_Copy(t *testing.T) {
+	client := storageInit()
+	p := &provider{
+		context:              context.Background(),
+		client:               client,
+		bucketName:           testBucket,
+		kind:                 "gcp",
+		noSuchKeyErrorString: storage.ErrObjectNotExist.Error(),
+		config: &gospal.ProviderConfig{
+			TimeOut: 300,
+		},
+	}
+
+	type args struct {
+		src string
+		dst string
+	}
+	tests := []struct {
+		name    string
+		move    bool
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "Should copy the key",
+			args: args{
+				src: "path/to/bladibla_1.txt",
+				dst: "path/copy/bladibla_1.txt",
+			},
+			want:    "Some cool contents. with more useless chars %^&*()",
+			wantErr: false,
+		},
+		{
+			name: "Should move the key",
+			move: true,
+			args: args{
+				src: "path/two/bladibla_2.txt",
+				dst: "path/move/bladibla_2.txt",
+			},
+			want:    "Some cool contents. with more useless chars %^&*(), but this is not the same file",
+			wantErr: false,
+		},
+		{
+			name: "Should raise with unknown key",
+			args: args{
+				src: "path/two/non_existing_file",
+				dst: "path/copy/non_existing_file",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.move {
+				err = p.Move(tt.args.src, tt.args.dst)
+			} else {
+				err = p.Copy(tt.args.src, tt.args.dst)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Copy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				return
+			}
+			reader, err := client.Bucket(testBucket).Object(tt.args.dst).NewReader(context.Background())
+			if err != nil {
+				t.Errorf("Copy() destination not found. err=%v", err.Error())
+				return
+			}
+			defer reader.Close()
+			var bb bytes.Buffer
+			io.Copy(&bb, reader)
+			if bb.String() != tt.want {
+				t.Errorf("Copy() got = %v, want %v", bb.String(), tt.want)
+			}
+			if _, err := client.Bucket(testBucket).Object(tt.args.src).Attrs(context.Background()); (err != nil) != tt.move {
+				t.Errorf("Copy() source exists = %v, want %v", err == nil, !tt.move)
+			}
+		})
+	}
+}
+
+func Test_provider_DeleteKeys(t *testing.T) {
+	p := &provider{
+		context:              context.Background(),
+		client:               storageInit(),
+		bucketName:           testBucket,
+		kind:                 "gcp",
+		noSuchKeyErrorString: storage.ErrObjectNotExist.Error(),
+		config: &gospal.ProviderConfig{
+			TimeOut: 300,
+		},
+	}
+
+	tests := []struct {
+		name       string
+		keys       []string
+		prefix     string
+		wantKeys   []string
+		wantFailed []string
+	}{
+		{
+			name:       "Should delete the keys and report the failures",
+			keys:       []string{"path/to/bladibla_1.txt", "path/to/non_existing_file"},
+			wantKeys:   []string{"path/two/bladibla_2.txt"},
+			wantFailed: []string{"path/to/non_existing_file"},
+		},
+		{
+			name:     "Should delete the keys under the prefix",
+			prefix:   "path/two",
+			wantKeys: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.keys != nil {
+				err = p.DeleteKeys(tt.keys)
+			} else {
+				err = p.DeletePrefix(tt.prefix)
+			}
+			if (err != nil) != (tt.wantFailed != nil) {
+				t.Errorf("DeleteKeys() error = %v, wantFailed %v", err, tt.wantFailed)
+				return
+			}
+			if err != nil {
+				var deleteErr *errors.DeleteKeysError
+				if !stderrors.As(err, &deleteErr) {
+					t.Errorf("DeleteKeys() error = %v, should be a DeleteKeysError", err)
+					return
+				}
+				if !reflect.DeepEqual(deleteErr.Keys(), tt.wantFailed) {
+					t.Errorf("DeleteKeys() failed keys = %v, want %v", deleteErr.Keys(), tt.wantFailed)
+				}
+				for _, key := range deleteErr.Keys() {
+					if !stderrors.Is(deleteErr.Errors[key], errors.ErrNotExist) {
+						t.Errorf("DeleteKeys() error = %v, should be %v", deleteErr.Errors[key], errors.ErrNotExist)
+					}
+				}
+			}
+			got, err := p.ListKeys()
+			if err != nil {
+				t.Errorf("ListKeys() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.wantKeys) {
+				t.Errorf("DeleteKeys() remaining keys = %v, want %v", got, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func Test_provider_GetRange(t *testing.T) {
+	p := &provider{
+		context:              context.Background(),
+		client:               storageInit(),
+		bucketName:           testBucket,
+		kind:                 "gcp",
+		noSuchKeyErrorString: storage.ErrObjectNotExist.Error(),
+		config: &gospal.ProviderConfig{
+			TimeOut: 300,
+		},
+	}
+	// the fake server handles the end of bounded ranges as exclusive, only ranges up to the end of objects are tested
+	content := "Some cool contents. with more useless chars %^&*()"
+
+	type args struct {
+		key    string
+		offset int64
+		length int64
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "Should fetch up to the end",
+			args:    args{key: "path/to/bladibla_1.txt", offset: 20, length: -1},
+			want:    content[20:],
+			wantErr: false,
+		},
+		{
+			name:    "Should raise with unknown key",
+			args:    args{key: "path/to/non_existing_file", offset: 5, length: 4},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, cancel, err := p.GetRange(tt.args.key, tt.args.offset, tt.args.length)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetRange() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				if !stderrors.Is(err, errors.ErrNotExist) {
+					t.Errorf("GetRange() error = %v, should be %v", err, errors.ErrNotExist)
+				}
+				return
+			}
+			defer cancel()
+			var bb bytes.Buffer
+			io.Copy(&bb, got)
+			if bb.String() != tt.want {
+				t.Errorf("GetRange() got = %v, want %v", bb.String(), tt.want)
+			}
+		})
+	}
+}
+
+func Test_provider_Open(t *testing.T) {
+	p := &provider{
+		context:              context.Background(),
+		client:               storageInit(),
+		bucketName:           testBucket,
+		kind:                 "gcp",
+		noSuchKeyErrorString: storage.ErrObjectNotExist.Error(),
+		config: &gospal.ProviderConfig{
+			TimeOut: 300,
+		},
+	}
+	content := "Some cool contents. with more useless chars %^&*()"
+
+	if _, err := p.Open("path/to/non_existing_file"); !stderrors.Is(err, errors.ErrNotExist) {
+		t.Errorf("Open() error = %v, should be %v", err, errors.ErrNotExist)
+	}
+
+	reader, err := p.Open("path/to/bladibla_1.txt")
+	if err != nil {
+		t.Errorf("Open() error = %v", err)
+		return
+	}
+	defer reader.Close()
+	if reader.Size() != int64(len(content)) {
+		t.Errorf("Open() size = %v, want %v", reader.Size(), len(content))
+	}
+	// bounded ranges, used by ReadAt, are not handled properly by the fake server
+	if _, err := reader.Seek(-6, io.SeekEnd); err != nil {
+		t.Errorf("Seek() error = %v", err)
+	}
+	var bb bytes.Buffer
+	io.Copy(&bb, reader)
+	if bb.String() != content[len(content)-6:] {
+		t.Errorf("Read() got = %v, want %v", bb.String(), content[len(content)-6:])
+	}
+}
+
+func Test_provider_PutStreamOptions(t *testing.T) {
+	p := &provider{
+		context:              context.Background(),
+		client:               storageInit(),
+		bucketName:           testBucket,
+		kind:                 "gcp",
+		noSuchKeyErrorString: storage.ErrObjectNotExist.Error(),
+		config: &gospal.ProviderConfig{
+			TimeOut: 300,
+		},
+	}
+
+	// the fake server keeps neither the cache control nor the user metadata
+	if _, err := p.PutStream("path/to/options.json", strings.NewReader("{}"),
+		gospal.WithContentType("application/json"),
+		gospal.WithContentEncoding("gzip"),
+	); err != nil {
+		t.Errorf("PutStream() error = %v", err)
+		return
+	}
+	got, err := p.Stat("path/to/options.json")
+	if err != nil {
+		t.Errorf("Stat() error = %v", err)
+		return
+	}
+	if got.ContentType != "application/json" || got.ContentEncoding != "gzip" {
+		t.Errorf("Stat() got = %v, %v, want %v, %v", got.ContentType, got.ContentEncoding, "application/json", "gzip")
+	}
+}
+
+func Test_provider_NewReader(t *testing.T) {
+	p := &provider{
+		context:              context.Background(),
+		client:               storageInit(),
+		bucketName:           testBucket,
+		kind:                 "gcp",
+		noSuchKeyErrorString: storage.ErrObjectNotExist.Error(),
+		config: &gospal.ProviderConfig{
+			TimeOut: 300,
+		},
+	}
+
+	if _, err := p.NewReader(context.Background(), "path/to/non_existing_file"); !stderrors.Is(err, errors.ErrNotExist) {
+		t.Errorf("NewReader() error = %v, should be %v", err, errors.ErrNotExist)
+	}
+
+	reader, err := p.NewReader(context.Background(), "path/to/bladibla_1.txt")
+	if err != nil {
+		t.Errorf("NewReader() error = %v", err)
+		return
+	}
+	var bb bytes.Buffer
+	io.Copy(&bb, reader)
+	if want := "Some cool contents. with more useless chars %^&*()"; bb.String() != want {
+		t.Errorf("NewReader() got = %v, want %v", bb.String(), want)
+	}
+	if err := reader.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+}
+
+func Test_provider_NewWriter(t *testing.T) {
+	client := storageInit()
+	p := &provider{
+		context:              context.Background(),
+		client:               client,
+		bucketName:           testBucket,
+		kind:                 "gcp",
+		noSuchKeyErrorString: storage.ErrObjectNotExist.Error(),
+		config: &gospal.ProviderConfig{
+			TimeOut: 300,
+		},
+	}
+
+	writer, err := p.NewWriter(context.Background(), "path/to/writer.txt", gospal.WithContentType("text/plain"))
+	if err != nil {
+		t.Errorf("NewWriter() error = %v", err)
+		return
+	}
+	if _, err := io.WriteString(writer, "written by a writer"); err != nil {
+		t.Errorf("Write() error = %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+		return
+	}
+	reader, err := client.Bucket(testBucket).Object("path/to/writer.txt").NewReader(context.Background())
+	if err != nil {
+		t.Errorf("NewWriter() object not found. err=%v", err.Error())
+		return
+	}
+	defer reader.Close()
+	var bb bytes.Buffer
+	io.Copy(&bb, reader)
+	if bb.String() != "written by a writer" || reader.Attrs.ContentType != "text/plain" {
+		t.Errorf("NewWriter() got = %v, %v, want %v, %v", bb.String(), reader.Attrs.ContentType, "written by a writer", "text/plain")
+	}
+}
+
+func Test_provider_GlobalPrefix(t *testing.T) {
+	server := fakestorage.NewServer([]fakestorage.Object{
+		{BucketName: testBucket, Name: "tenant/a.txt", Content: []byte("tenant/a.txt")},
+		{BucketName: testBucket, Name: "tenant/b/c.txt", Content: []byte("tenant/b/c.txt")},
+		{BucketName: testBucket, Name: "tenant2/d.txt", Content: []byte("tenant2/d.txt")},
+	})
+	defer server.Stop()
+	p := &provider{
+		context:              context.Background(),
+		client:               server.Client(),
+		bucketName:           testBucket,
+		kind:                 "gcp",
+		noSuchKeyErrorString: storage.ErrObjectNotExist.Error(),
+		config: &gospal.ProviderConfig{
+			TimeOut:      300,
+			GlobalPrefix: "tenant",
+		},
+	}
+
+	// the keys are relative to the global prefix, the sibling tenant2 is not listed
+	keys, err := p.ListKeys()
+	if err != nil {
+		t.Errorf("ListKeys() error = %v", err)
+		return
+	}
+	if want := []string{"a.txt", "b/c.txt"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("ListKeys() got = %v, want %v", keys, want)
+	}
+	gotKeys, gotPrefixes, err := p.ListDir("")
+	if err != nil || !reflect.DeepEqual(gotKeys, []string{"a.txt"}) || !reflect.DeepEqual(gotPrefixes, []string{"b/"}) {
+		t.Errorf("ListDir() got = %v, %v, %v", gotKeys, gotPrefixes, err)
+	}
+	// and can be fed back to the provider
+	for _, key := range keys {
+		reader, err := p.NewReader(context.Background(), key)
+		if err != nil {
+			t.Errorf("NewReader() error = %v", err)
+			continue
+		}
+		var bb bytes.Buffer
+		io.Copy(&bb, reader)
+		if bb.String() != "tenant/"+key {
+			t.Errorf("NewReader() got = %v, want %v", bb.String(), "tenant/"+key)
+		}
+		reader.Close()
+		if err := p.DeleteKey(key); err != nil {
+			t.Errorf("DeleteKey() error = %v", err)
+		}
+	}
+	if _, err := server.GetObject(testBucket, "tenant2/d.txt"); err != nil {
+		t.Errorf("DeleteKey() should have kept tenant2/d.txt. err=%v", err)
+	}
+	if keys, err := p.ListKeys(); err != nil || len(keys) != 0 {
+		t.Errorf("ListKeys() got = %v, %v, want no keys", keys, err)
+	}
+}
+
+// fakeRangeTransport works around the fake gcs server handling the end of a range as exclusive
+type fakeRangeTransport struct {
+	next http.RoundTripper
+}
+
+func (t *fakeRangeTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	var start, end int64
+	if n, _ := fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end); n == 2 {
+		r = r.Clone(r.Context())
+		r.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end+1))
+	}
+	return t.next.RoundTrip(r)
+}
+
+func TestConformance(t *testing.T) {
+	gospaltest.RunConformance(t, func(t *testing.T) (gospal.Gospal, func()) {
+		server := fakestorage.NewServer(nil)
+		server.CreateBucket(testBucket)
+		client, err := storage.NewClient(context.Background(), option.WithHTTPClient(&http.Client{
+			Transport: &fakeRangeTransport{next: server.HTTPClient().Transport},
+		}))
+		if err != nil {
+			t.Fatalf("error when instantiating gcp client. err=%v", err.Error())
+		}
+		return &provider{
+			context:              context.Background(),
+			client:               client,
+			bucketName:           testBucket,
+			kind:                 "gcp",
+			noSuchKeyErrorString: storage.ErrObjectNotExist.Error(),
+			config: &gospal.ProviderConfig{
+				TimeOut: 300,
+				MaxKeys: 2,
+			},
+		}, server.Stop
+	})
+}
+
+func TestConfigConformance(t *testing.T) {
+	gospaltest.RunConfigConformance(t, func(t *testing.T, config *gospal.ProviderConfig) (gospal.Gospal, func()) {
+		server := fakestorage.NewServer(nil)
+		server.CreateBucket(testBucket)
+		client, err := storage.NewClient(context.Background(), option.WithHTTPClient(&http.Client{
+			Transport: &fakeRangeTransport{next: server.HTTPClient().Transport},
+		}))
+		if err != nil {
+			t.Fatalf("error when instantiating gcp client. err=%v", err.Error())
+		}
+		config.TimeOut = 300
+		return &provider{
+			context:              context.Background(),
+			client:               client,
+			bucketName:           testBucket,
+			kind:                 "gcp",
+			noSuchKeyErrorString: storage.ErrObjectNotExist.Error(),
+			config:               config,
+		}, server.Stop
+	})
+}
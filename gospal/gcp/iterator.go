@@ -0,0 +1,77 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package gcpprovider
+
+import (
+	"cloud.google.com/go/storage"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"google.golang.org/api/iterator"
+)
+
+// objectIterator wraps a storage.ObjectIterator. The page token is the gcs page token of the current page
+type objectIterator struct {
+	p         *provider
+	it        *storage.ObjectIterator
+	prefix    string
+	pageToken string
+	current   *gospal.ObjectInfo
+	err       error
+}
+
+func (it *objectIterator) Next() bool {
+	for {
+		if it.err != nil {
+			return false
+		}
+		// the underlying iterator fetches the next page whenever the current one has been consumed
+		if it.it.PageInfo().Remaining() == 0 {
+			it.pageToken = it.it.PageInfo().Token
+		}
+		attrs, err := it.it.Next()
+		if err == iterator.Done {
+			return false
+		}
+		if err != nil {
+			it.err = errors.ErrorListKeysError(it.prefix, toError(err))
+			return false
+		}
+		// prefixes returned when a delimiter is set have no name
+		if attrs.Name == "" {
+			continue
+		}
+		it.current = &gospal.ObjectInfo{
+			Key:          it.p.toKey(attrs.Name),
+			Size:         attrs.Size,
+			LastModified: attrs.Updated,
+			ETag:         attrs.Etag,
+			MD5:          attrs.MD5,
+			ContentType:  attrs.ContentType,
+		}
+		return true
+	}
+}
+
+func (it *objectIterator) Object() *gospal.ObjectInfo {
+	return it.current
+}
+
+func (it *objectIterator) Err() error {
+	return it.err
+}
+
+func (it *objectIterator) PageToken() string {
+	return it.pageToken
+}
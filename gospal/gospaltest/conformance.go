@@ -0,0 +1,592 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package gospaltest provides a conformance suite checking that an implementation of gospal.Gospal behaves the same
+// way as the built-in providers, eg.:
+//   func TestConformance(t *testing.T) {
+//       gospaltest.RunConformance(t, func(t *testing.T) (gospal.Gospal, func()) {
+//           return newProviderOnAnEmptyBucket(t), func() {}
+//       })
+//   }
+// RunConfigConformance runs the cases depending on the ProviderConfig, the factory being given the config to use.
+package gospaltest
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// size of the large objects, above the 5MiB part size of multipart uploads
+const largeObjectSize = 6<<20 + 1
+
+// Factory returns a provider over an empty bucket, along with the function releasing it once the test is done
+type Factory func(t *testing.T) (gospal.Gospal, func())
+
+// RunConformance runs the conformance suite, each test being given a new provider by the factory
+func RunConformance(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, p gospal.Gospal)
+	}{
+		{name: "RoundTrip", run: testRoundTrip},
+		{name: "EmptyObject", run: testEmptyObject},
+		{name: "LargeObject", run: testLargeObject},
+		{name: "Overwrite", run: testOverwrite},
+		{name: "PutOptions", run: testPutOptions},
+		{name: "NewWriter", run: testNewWriter},
+		{name: "MissingKeys", run: testMissingKeys},
+		{name: "ListKeys", run: testListKeys},
+		{name: "ListDir", run: testListDir},
+		{name: "Objects", run: testObjects},
+		{name: "GetRange", run: testGetRange},
+		{name: "Open", run: testOpen},
+		{name: "Copy", run: testCopy},
+		{name: "Move", run: testMove},
+		{name: "DeleteKey", run: testDeleteKey},
+		{name: "DeleteKeys", run: testDeleteKeys},
+		{name: "DeletePrefix", run: testDeletePrefix},
+		{name: "Canceled", run: testCanceled},
+		{name: "Kind", run: testKind},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, cleanup := factory(t)
+			defer cleanup()
+			tt.run(t, p)
+		})
+	}
+}
+
+// ConfigFactory returns a provider over an empty bucket using the config, completed by the settings the provider
+// requires (TimeOut, SpecConfig...), along with the function releasing it once the test is done
+type ConfigFactory func(t *testing.T, config *gospal.ProviderConfig) (gospal.Gospal, func())
+
+// RunConfigConformance runs the cases of the suite depending on the ProviderConfig, such as the delimiter and the
+// global prefix, each test being given a new provider by the factory
+func RunConfigConformance(t *testing.T, factory ConfigFactory) {
+	tests := []struct {
+		name   string
+		config *gospal.ProviderConfig
+		run    func(t *testing.T, p gospal.Gospal)
+	}{
+		{name: "DeletePrefixDelimiter", config: &gospal.ProviderConfig{MaxKeys: 2, Delimiter: "/"}, run: testDeletePrefixNested},
+		{name: "DeletePrefixGlobalPrefix", config: &gospal.ProviderConfig{MaxKeys: 2, Delimiter: "/", GlobalPrefix: "tenant"}, run: testDeletePrefixNested},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, cleanup := factory(t, tt.config)
+			defer cleanup()
+			tt.run(t, p)
+		})
+	}
+}
+
+// put stores the content to the key, failing the test on error
+func put(t *testing.T, p gospal.Gospal, key string, content string) {
+	t.Helper()
+	written, err := p.PutStream(key, strings.NewReader(content))
+	if err != nil {
+		t.Fatalf("PutStream(%q) error = %v", key, err)
+	}
+	if written != int64(len(content)) {
+		t.Fatalf("PutStream(%q) written = %v, want %v", key, written, len(content))
+	}
+}
+
+// read returns the content of the key, failing the test on error
+func read(t *testing.T, p gospal.Gospal, key string) string {
+	t.Helper()
+	reader, err := p.NewReader(context.Background(), key)
+	if err != nil {
+		t.Fatalf("NewReader(%q) error = %v", key, err)
+	}
+	defer reader.Close()
+	data, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("NewReader(%q) read error = %v", key, err)
+	}
+	return string(data)
+}
+
+// listKeys returns the sorted keys under the prefix, the order of the listing is left to the provider
+func listKeys(t *testing.T, p gospal.Gospal, prefix string) []string {
+	t.Helper()
+	keys, err := p.ListKeys(prefix)
+	if err != nil {
+		t.Fatalf("ListKeys(%q) error = %v", prefix, err)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// assertNotExist checks that the key can not be found
+func assertNotExist(t *testing.T, p gospal.Gospal, key string) {
+	t.Helper()
+	if _, err := p.Stat(key); !stderrors.Is(err, errors.ErrNotExist) {
+		t.Errorf("Stat(%q) error = %v, should be %v", key, err, errors.ErrNotExist)
+	}
+}
+
+func testRoundTrip(t *testing.T, p gospal.Gospal) {
+	for _, key := range []string{"a.txt", "dir/sub/b.json", "unicode/été 日本語 ключ.txt"} {
+		content := "content of " + key
+		put(t, p, key, content)
+		if got := read(t, p, key); got != content {
+			t.Errorf("NewReader(%q) got = %v, want %v", key, got, content)
+		}
+		reader, cancel, err := p.GetStream(key)
+		if err != nil {
+			t.Errorf("GetStream(%q) error = %v", key, err)
+			continue
+		}
+		var bb bytes.Buffer
+		io.Copy(&bb, reader)
+		cancel()
+		if bb.String() != content {
+			t.Errorf("GetStream(%q) got = %v, want %v", key, bb.String(), content)
+		}
+		info, err := p.Stat(key)
+		if err != nil {
+			t.Errorf("Stat(%q) error = %v", key, err)
+			continue
+		}
+		if info.Key != key || info.Size != int64(len(content)) || info.LastModified.IsZero() {
+			t.Errorf("Stat(%q) got = %v, %v, %v", key, info.Key, info.Size, info.LastModified)
+		}
+	}
+	if got, want := listKeys(t, p, ""), []string{"a.txt", "dir/sub/b.json", "unicode/été 日本語 ключ.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListKeys() got = %q, want %q", got, want)
+	}
+}
+
+func testEmptyObject(t *testing.T, p gospal.Gospal) {
+	put(t, p, "empty.txt", "")
+	if got := read(t, p, "empty.txt"); got != "" {
+		t.Errorf("NewReader() got = %v, want an empty object", got)
+	}
+	info, err := p.Stat("empty.txt")
+	if err != nil || info.Size != 0 {
+		t.Errorf("Stat() got = %v, %v, want an empty object", info, err)
+	}
+	if got := listKeys(t, p, ""); !reflect.DeepEqual(got, []string{"empty.txt"}) {
+		t.Errorf("ListKeys() got = %v, want %v", got, []string{"empty.txt"})
+	}
+}
+
+func testLargeObject(t *testing.T, p gospal.Gospal) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), largeObjectSize/16+1)[:largeObjectSize]
+	written, err := p.PutStream("large.bin", bytes.NewReader(content))
+	if err != nil || written != largeObjectSize {
+		t.Fatalf("PutStream() got = %v, %v, want %v", written, err, largeObjectSize)
+	}
+	if got := read(t, p, "large.bin"); got != string(content) {
+		t.Errorf("NewReader() got %v bytes, want %v", len(got), largeObjectSize)
+	}
+	if info, err := p.Stat("large.bin"); err != nil || info.Size != largeObjectSize {
+		t.Errorf("Stat() got = %v, %v, want %v bytes", info, err, largeObjectSize)
+	}
+}
+
+func testOverwrite(t *testing.T, p gospal.Gospal) {
+	put(t, p, "a.txt", "a rather long first content")
+	put(t, p, "a.txt", "second")
+	if got := read(t, p, "a.txt"); got != "second" {
+		t.Errorf("NewReader() got = %v, want %v", got, "second")
+	}
+}
+
+func testPutOptions(t *testing.T, p gospal.Gospal) {
+	// the attributes actually kept depend on the storage, only their acceptance is checked
+	_, err := p.PutStream("report.json", strings.NewReader("{}"),
+		gospal.WithContentType("application/json"),
+		gospal.WithContentEncoding("identity"),
+		gospal.WithCacheControl("no-cache"),
+		gospal.WithMetadata(map[string]string{"owner": "gospaltest"}),
+	)
+	if err != nil {
+		t.Fatalf("PutStream() error = %v", err)
+	}
+	if got := read(t, p, "report.json"); got != "{}" {
+		t.Errorf("NewReader() got = %v, want %v", got, "{}")
+	}
+	if _, err := p.Stat("report.json"); err != nil {
+		t.Errorf("Stat() error = %v", err)
+	}
+}
+
+func testNewWriter(t *testing.T, p gospal.Gospal) {
+	writer, err := p.NewWriter(context.Background(), "writer.txt", gospal.WithContentType("text/plain"))
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	if _, err := io.WriteString(writer, "written by a writer"); err != nil {
+		t.Errorf("Write() error = %v", err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if got := read(t, p, "writer.txt"); got != "written by a writer" {
+		t.Errorf("NewReader() got = %v, want %v", got, "written by a writer")
+	}
+
+	// canceling the context before closing the writer aborts the upload
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	writer, err = p.NewWriter(ctx, "aborted.txt")
+	if err != nil {
+		t.Fatalf("NewWriter() error = %v", err)
+	}
+	// the write may already fail
+	io.WriteString(writer, "never committed")
+	cancel()
+	if err := writer.Close(); err == nil {
+		t.Errorf("Close() should fail once the context is canceled")
+	}
+	assertNotExist(t, p, "aborted.txt")
+}
+
+func testMissingKeys(t *testing.T, p gospal.Gospal) {
+	put(t, p, "dir/a.txt", "a")
+	for _, key := range []string{"missing.txt", "dir/missing.txt", "dir"} {
+		if _, err := p.Stat(key); !stderrors.Is(err, errors.ErrNotExist) {
+			t.Errorf("Stat(%q) error = %v, should be %v", key, err, errors.ErrNotExist)
+		}
+		if _, err := p.NewReader(context.Background(), key); !stderrors.Is(err, errors.ErrNotExist) {
+			t.Errorf("NewReader(%q) error = %v, should be %v", key, err, errors.ErrNotExist)
+		}
+		if _, cancel, err := p.GetStream(key); !stderrors.Is(err, errors.ErrNotExist) {
+			t.Errorf("GetStream(%q) error = %v, should be %v", key, err, errors.ErrNotExist)
+		} else {
+			cancel()
+		}
+		if _, cancel, err := p.GetRange(key, 0, 1); !stderrors.Is(err, errors.ErrNotExist) {
+			t.Errorf("GetRange(%q) error = %v, should be %v", key, err, errors.ErrNotExist)
+		} else {
+			cancel()
+		}
+		if _, err := p.Open(key); !stderrors.Is(err, errors.ErrNotExist) {
+			t.Errorf("Open(%q) error = %v, should be %v", key, err, errors.ErrNotExist)
+		}
+		if err := p.Copy(key, "copy.txt"); !stderrors.Is(err, errors.ErrNotExist) {
+			t.Errorf("Copy(%q) error = %v, should be %v", key, err, errors.ErrNotExist)
+		}
+		if err := p.Move(key, "move.txt"); !stderrors.Is(err, errors.ErrNotExist) {
+			t.Errorf("Move(%q) error = %v, should be %v", key, err, errors.ErrNotExist)
+		}
+		// deleting a missing object succeeds on s3
+		if err := p.DeleteKey(key); err != nil && !stderrors.Is(err, errors.ErrNotExist) {
+			t.Errorf("DeleteKey(%q) error = %v, should be nil or %v", key, err, errors.ErrNotExist)
+		}
+	}
+	if got := listKeys(t, p, ""); !reflect.DeepEqual(got, []string{"dir/a.txt"}) {
+		t.Errorf("ListKeys() got = %v, want %v", got, []string{"dir/a.txt"})
+	}
+	if got := listKeys(t, p, "missing/"); len(got) != 0 {
+		t.Errorf("ListKeys() got = %v, want no keys", got)
+	}
+	if keys, prefixes, err := p.ListDir("missing/"); err != nil || len(keys) != 0 || len(prefixes) != 0 {
+		t.Errorf("ListDir() got = %v, %v, %v, want nothing", keys, prefixes, err)
+	}
+	if err := p.DeletePrefix("missing/"); err != nil {
+		t.Errorf("DeletePrefix() error = %v", err)
+	}
+}
+
+// putTree stores the keys used by the listing tests
+func putTree(t *testing.T, p gospal.Gospal) []string {
+	keys := []string{"a.txt", "b/c.txt", "b/d/e.txt", "b/f.txt", "bc.txt", "g/h.txt"}
+	for _, key := range keys {
+		put(t, p, key, key)
+	}
+	return keys
+}
+
+func testListKeys(t *testing.T, p gospal.Gospal) {
+	keys := putTree(t, p)
+	tests := []struct {
+		prefix string
+		want   []string
+	}{
+		{prefix: "", want: keys},
+		{prefix: "b/", want: []string{"b/c.txt", "b/d/e.txt", "b/f.txt"}},
+		{prefix: "b", want: []string{"b/c.txt", "b/d/e.txt", "b/f.txt", "bc.txt"}},
+		{prefix: "b/d/", want: []string{"b/d/e.txt"}},
+		{prefix: "g/h.txt", want: []string{"g/h.txt"}},
+	}
+	for _, tt := range tests {
+		if got := listKeys(t, p, tt.prefix); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ListKeys(%q) got = %v, want %v", tt.prefix, got, tt.want)
+		}
+	}
+	// the listed keys are given back as is
+	for _, key := range listKeys(t, p, "") {
+		if got := read(t, p, key); got != key {
+			t.Errorf("NewReader(%q) got = %v, want %v", key, got, key)
+		}
+	}
+}
+
+func testListDir(t *testing.T, p gospal.Gospal) {
+	putTree(t, p)
+	tests := []struct {
+		prefix       string
+		wantKeys     []string
+		wantPrefixes []string
+	}{
+		{prefix: "", wantKeys: []string{"a.txt", "bc.txt"}, wantPrefixes: []string{"b/", "g/"}},
+		{prefix: "b/", wantKeys: []string{"b/c.txt", "b/f.txt"}, wantPrefixes: []string{"b/d/"}},
+		// the prefix is a directory, whether it ends with the delimiter or not
+		{prefix: "b", wantKeys: []string{"b/c.txt", "b/f.txt"}, wantPrefixes: []string{"b/d/"}},
+	}
+	for _, tt := range tests {
+		keys, prefixes, err := p.ListDir(tt.prefix)
+		if err != nil {
+			t.Errorf("ListDir(%q) error = %v", tt.prefix, err)
+			continue
+		}
+		sort.Strings(keys)
+		sort.Strings(prefixes)
+		if !reflect.DeepEqual(keys, tt.wantKeys) || !reflect.DeepEqual(prefixes, tt.wantPrefixes) {
+			t.Errorf("ListDir(%q) got = %v, %v, want %v, %v", tt.prefix, keys, prefixes, tt.wantKeys, tt.wantPrefixes)
+		}
+	}
+}
+
+func testObjects(t *testing.T, p gospal.Gospal) {
+	keys := putTree(t, p)
+	var got []string
+	it := p.Objects(context.Background(), "")
+	for it.Next() {
+		if it.Object().Size != int64(len(it.Object().Key)) {
+			t.Errorf("Objects() size of %v got = %v, want %v", it.Object().Key, it.Object().Size, len(it.Object().Key))
+		}
+		got = append(got, it.Object().Key)
+	}
+	if err := it.Err(); err != nil {
+		t.Fatalf("Objects() error = %v", err)
+	}
+	sorted := append([]string(nil), got...)
+	sort.Strings(sorted)
+	if !reflect.DeepEqual(sorted, keys) {
+		t.Errorf("Objects() got = %v, want %v", sorted, keys)
+	}
+
+	// resuming from the page token of any object lists at least the objects after it
+	for i := range got {
+		it := p.Objects(context.Background(), "")
+		for j := 0; j <= i && it.Next(); j++ {
+		}
+		resumed := p.ObjectsFrom(context.Background(), "", it.PageToken())
+		var gotResume []string
+		for resumed.Next() {
+			gotResume = append(gotResume, resumed.Object().Key)
+		}
+		if err := resumed.Err(); err != nil {
+			t.Errorf("ObjectsFrom() error = %v", err)
+			continue
+		}
+		if len(gotResume) < len(got)-i-1 || !reflect.DeepEqual(gotResume, got[len(got)-len(gotResume):]) {
+			t.Errorf("ObjectsFrom() after %v got = %v, want a suffix of %v", got[i], gotResume, got[i+1:])
+		}
+	}
+}
+
+func testGetRange(t *testing.T, p gospal.Gospal) {
+	put(t, p, "range.txt", "0123456789")
+	tests := []struct {
+		offset int64
+		length int64
+		want   string
+	}{
+		{offset: 0, length: 10, want: "0123456789"},
+		{offset: 2, length: 3, want: "234"},
+		{offset: 9, length: 1, want: "9"},
+		{offset: 5, length: -1, want: "56789"},
+		{offset: 4, length: 0, want: ""},
+	}
+	for _, tt := range tests {
+		reader, cancel, err := p.GetRange("range.txt", tt.offset, tt.length)
+		if err != nil {
+			t.Errorf("GetRange(%v, %v) error = %v", tt.offset, tt.length, err)
+			continue
+		}
+		var bb bytes.Buffer
+		_, err = io.Copy(&bb, reader)
+		cancel()
+		if err != nil || bb.String() != tt.want {
+			t.Errorf("GetRange(%v, %v) got = %v, %v, want %v", tt.offset, tt.length, bb.String(), err, tt.want)
+		}
+	}
+}
+
+func testOpen(t *testing.T, p gospal.Gospal) {
+	put(t, p, "open.txt", "0123456789")
+	object, err := p.Open("open.txt")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer object.Close()
+	if object.Size() != 10 {
+		t.Errorf("Size() got = %v, want %v", object.Size(), 10)
+	}
+	b := make([]byte, 4)
+	if n, err := object.ReadAt(b, 3); n != 4 || err != nil || string(b) != "3456" {
+		t.Errorf("ReadAt() got = %v, %v, %v, want %v", n, string(b[:n]), err, "3456")
+	}
+	if n, err := object.ReadAt(b, 8); n != 2 || err != io.EOF || string(b[:n]) != "89" {
+		t.Errorf("ReadAt() got = %v, %v, %v, want %v, %v", n, string(b[:n]), err, "89", io.EOF)
+	}
+	if _, err := object.Seek(7, io.SeekStart); err != nil {
+		t.Errorf("Seek() error = %v", err)
+	}
+	if data, err := ioutil.ReadAll(object); err != nil || string(data) != "789" {
+		t.Errorf("Read() after Seek() got = %v, %v, want %v", string(data), err, "789")
+	}
+	if pos, err := object.Seek(-4, io.SeekEnd); err != nil || pos != 6 {
+		t.Errorf("Seek() got = %v, %v, want %v", pos, err, 6)
+	}
+	if n, err := io.ReadFull(object, b[:2]); n != 2 || err != nil || string(b[:2]) != "67" {
+		t.Errorf("Read() after Seek() got = %v, %v, want %v", string(b[:n]), err, "67")
+	}
+}
+
+func testCopy(t *testing.T, p gospal.Gospal) {
+	put(t, p, "src.txt", "copied content")
+	put(t, p, "existing.txt", "overwritten")
+	for _, dst := range []string{"dst/copy.txt", "existing.txt"} {
+		if err := p.Copy("src.txt", dst); err != nil {
+			t.Errorf("Copy(%q) error = %v", dst, err)
+			continue
+		}
+		if got := read(t, p, dst); got != "copied content" {
+			t.Errorf("Copy(%q) got = %v, want %v", dst, got, "copied content")
+		}
+	}
+	if got := read(t, p, "src.txt"); got != "copied content" {
+		t.Errorf("Copy() source got = %v, want %v", got, "copied content")
+	}
+}
+
+func testMove(t *testing.T, p gospal.Gospal) {
+	put(t, p, "dir/src.txt", "moved content")
+	if err := p.Move("dir/src.txt", "other/dst.txt"); err != nil {
+		t.Fatalf("Move() error = %v", err)
+	}
+	if got := read(t, p, "other/dst.txt"); got != "moved content" {
+		t.Errorf("Move() got = %v, want %v", got, "moved content")
+	}
+	assertNotExist(t, p, "dir/src.txt")
+	if got := listKeys(t, p, ""); !reflect.DeepEqual(got, []string{"other/dst.txt"}) {
+		t.Errorf("ListKeys() got = %v, want %v", got, []string{"other/dst.txt"})
+	}
+}
+
+func testDeleteKey(t *testing.T, p gospal.Gospal) {
+	put(t, p, "dir/a.txt", "a")
+	put(t, p, "dir/b.txt", "b")
+	if err := p.DeleteKey("dir/a.txt"); err != nil {
+		t.Fatalf("DeleteKey() error = %v", err)
+	}
+	assertNotExist(t, p, "dir/a.txt")
+	if got := listKeys(t, p, ""); !reflect.DeepEqual(got, []string{"dir/b.txt"}) {
+		t.Errorf("ListKeys() got = %v, want %v", got, []string{"dir/b.txt"})
+	}
+}
+
+func testDeleteKeys(t *testing.T, p gospal.Gospal) {
+	keys := putTree(t, p)
+	if err := p.DeleteKeys(keys[:3]); err != nil {
+		t.Fatalf("DeleteKeys() error = %v", err)
+	}
+	if got := listKeys(t, p, ""); !reflect.DeepEqual(got, keys[3:]) {
+		t.Errorf("ListKeys() got = %v, want %v", got, keys[3:])
+	}
+	if err := p.DeleteKeys(nil); err != nil {
+		t.Errorf("DeleteKeys() error = %v", err)
+	}
+}
+
+func testDeletePrefix(t *testing.T, p gospal.Gospal) {
+	putTree(t, p)
+	if err := p.DeletePrefix("b/"); err != nil {
+		t.Fatalf("DeletePrefix() error = %v", err)
+	}
+	if got, want := listKeys(t, p, ""), []string{"a.txt", "bc.txt", "g/h.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListKeys() got = %v, want %v", got, want)
+	}
+	if err := p.DeletePrefix("b"); err != nil {
+		t.Fatalf("DeletePrefix() error = %v", err)
+	}
+	if got, want := listKeys(t, p, ""), []string{"a.txt", "g/h.txt"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListKeys() got = %v, want %v", got, want)
+	}
+}
+
+func testCanceled(t *testing.T, p gospal.Gospal) {
+	put(t, p, "a.txt", "a")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.StatContext(ctx, "a.txt"); !stderrors.Is(err, errors.ErrCanceled) {
+		t.Errorf("StatContext() error = %v, should be %v", err, errors.ErrCanceled)
+	}
+	if _, err := p.ListKeysContext(ctx); !stderrors.Is(err, errors.ErrCanceled) {
+		t.Errorf("ListKeysContext() error = %v, should be %v", err, errors.ErrCanceled)
+	}
+	if _, err := p.NewReader(ctx, "a.txt"); !stderrors.Is(err, errors.ErrCanceled) {
+		t.Errorf("NewReader() error = %v, should be %v", err, errors.ErrCanceled)
+	}
+	if _, err := p.PutStreamContext(ctx, "b.txt", strings.NewReader("b")); !stderrors.Is(err, errors.ErrCanceled) {
+		t.Errorf("PutStreamContext() error = %v, should be %v", err, errors.ErrCanceled)
+	}
+	if err := p.DeleteKeyContext(ctx, "a.txt"); !stderrors.Is(err, errors.ErrCanceled) {
+		t.Errorf("DeleteKeyContext() error = %v, should be %v", err, errors.ErrCanceled)
+	}
+	if got := read(t, p, "a.txt"); got != "a" {
+		t.Errorf("NewReader() got = %v, want %v", got, "a")
+	}
+	assertNotExist(t, p, "b.txt")
+}
+
+func testKind(t *testing.T, p gospal.Gospal) {
+	if p.GetKind() == "" {
+		t.Errorf("GetKind() should not be empty")
+	}
+	if p.GetNoSuchKeyErrorString() == "" {
+		t.Errorf("GetNoSuchKeyErrorString() should not be empty")
+	}
+}
+
+func testDeletePrefixNested(t *testing.T, p gospal.Gospal) {
+	keys := putTree(t, p)
+	// the keys of the nested directories are removed whatever the delimiter of the listings
+	if err := p.DeletePrefix("b/"); err != nil {
+		t.Fatalf("DeletePrefix() error = %v", err)
+	}
+	for _, key := range keys {
+		if strings.HasPrefix(key, "b/") {
+			assertNotExist(t, p, key)
+		} else if got := read(t, p, key); got != key {
+			t.Errorf("NewReader() got = %v, want %v", got, key)
+		}
+	}
+}
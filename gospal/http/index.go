@@ -0,0 +1,191 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package httpprovider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maximum size of the manifests and of the index pages
+const maxIndexSize = 64 * 1024 * 1024
+
+// hrefPattern matches the links of the html index pages
+var hrefPattern = regexp.MustCompile(`(?i)<a\s[^>]*href\s*=\s*["']([^"']*)["']`)
+
+// manifestEntry is an object of a JSON manifest
+type manifestEntry struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"lastModified"`
+	ETag         string    `json:"etag"`
+}
+
+// list returns the sorted objects under the prefix, either from the manifest or from the html index pages. Unless
+// recursive, the prefix is a directory, only its files are listed from the index pages and its sub directories are
+// returned as prefixes. Both the manifest and the index pages are fetched as a whole
+func (p *provider) list(ctx context.Context, prefix string, recursive bool) ([]*gospal.ObjectInfo, []string, error) {
+	ctx, cancel := p.timeout(ctx)
+	defer cancel()
+	switch {
+	case p.spec.Manifest != "":
+		infos, err := p.readManifest(ctx, prefix)
+		return infos, nil, err
+	case p.spec.HTMLIndex:
+		crawler := &crawler{p: p, prefix: prefix, recursive: recursive}
+		dir := prefix[:strings.LastIndex(prefix, "/")+1]
+		if err := crawler.crawl(ctx, dir); err != nil {
+			return nil, nil, err
+		}
+		sort.Slice(crawler.infos, func(i, j int) bool { return crawler.infos[i].Key < crawler.infos[j].Key })
+		sort.Strings(crawler.dirs)
+		return crawler.infos, crawler.dirs, nil
+	}
+	return nil, nil, errors.ErrorNotSupported("ListKeys", p.kind)
+}
+
+// fetch returns the content of the manifest or of the index page
+func (p *provider) fetch(ctx context.Context, rawURL string) ([]byte, error) {
+	resp, err := p.do(ctx, http.MethodGet, rawURL, nil, http.StatusOK)
+	if err != nil {
+		return nil, toError(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxIndexSize+1))
+	if err != nil {
+		return nil, toError(err)
+	}
+	if len(body) > maxIndexSize {
+		return nil, fmt.Errorf("%v is larger than %v bytes", rawURL, maxIndexSize)
+	}
+	return body, nil
+}
+
+// readManifest returns the sorted objects of the manifest starting with the prefix
+func (p *provider) readManifest(ctx context.Context, prefix string) ([]*gospal.ObjectInfo, error) {
+	manifestURL, err := p.keyURL(p.spec.Manifest)
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.fetch(ctx, manifestURL)
+	if err != nil {
+		return nil, err
+	}
+	var entries []json.RawMessage
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, err
+	}
+	var infos []*gospal.ObjectInfo
+	for _, raw := range entries {
+		var entry manifestEntry
+		// the entries are either keys or objects
+		if raw = bytes.TrimSpace(raw); len(raw) > 0 && raw[0] == '"' {
+			err = json.Unmarshal(raw, &entry.Key)
+		} else {
+			err = json.Unmarshal(raw, &entry)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if entry.Key == "" || !strings.HasPrefix(entry.Key, prefix) {
+			continue
+		}
+		infos = append(infos, &gospal.ObjectInfo{
+			Key:          entry.Key,
+			Size:         entry.Size,
+			LastModified: entry.LastModified,
+			ETag:         entry.ETag,
+		})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Key < infos[j].Key })
+	return infos, nil
+}
+
+// crawler walks the html index pages of the directories, following the links to the files and the sub directories
+// of each page. Only the links to the direct children of a page are followed, the links to the parent directory,
+// the sorting links or to other origins are ignored
+type crawler struct {
+	p         *provider
+	prefix    string
+	recursive bool
+	infos     []*gospal.ObjectInfo
+	dirs      []string
+}
+
+func (c *crawler) crawl(ctx context.Context, dir string) error {
+	pageURL, err := c.p.keyURL(dir)
+	if err != nil {
+		return err
+	}
+	page, err := url.Parse(pageURL)
+	if err != nil {
+		return err
+	}
+	body, err := c.p.fetch(ctx, pageURL)
+	if stderrors.Is(err, errors.ErrNotExist) {
+		// just as a prefix without any key in object storages
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	seen := map[string]bool{}
+	for _, match := range hrefPattern.FindAllSubmatch(body, -1) {
+		ref, err := url.Parse(string(match[1]))
+		if err != nil {
+			continue
+		}
+		link := page.ResolveReference(ref)
+		if link.Scheme != page.Scheme || link.Host != page.Host || !strings.HasPrefix(link.Path, page.Path) {
+			continue
+		}
+		name := strings.TrimPrefix(link.Path, page.Path)
+		if name == "" || seen[name] || strings.Contains(strings.TrimSuffix(name, "/"), "/") {
+			continue
+		}
+		seen[name] = true
+		key := dir + name
+		if !strings.HasSuffix(name, "/") {
+			if strings.HasPrefix(key, c.prefix) {
+				c.infos = append(c.infos, &gospal.ObjectInfo{Key: key})
+			}
+			continue
+		}
+		switch {
+		case !c.recursive:
+			if strings.HasPrefix(key, c.prefix) {
+				c.dirs = append(c.dirs, key)
+			}
+		case strings.HasPrefix(key, c.prefix) || strings.HasPrefix(c.prefix, key):
+			if err := c.crawl(ctx, key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package httpprovider
+
+import (
+	"context"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+)
+
+// default number of objects per page when ProviderConfig.MaxKeys is not set
+const defaultMaxKeys = 1024
+
+// objectIterator pages the sorted objects of the listing, fetched as a whole on the first call to Next. The page
+// token is the key of the last object of the previous page
+type objectIterator struct {
+	ctx       context.Context
+	p         *provider
+	prefix    string
+	after     string
+	pageSize  int
+	listed    bool
+	objects   []*gospal.ObjectInfo
+	page      int
+	pageToken string
+	current   *gospal.ObjectInfo
+	err       error
+}
+
+func (it *objectIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.err = errors.ErrorListKeysError(it.prefix, toError(err))
+		return false
+	}
+	if !it.listed {
+		infos, _, err := it.p.list(it.ctx, it.prefix, true)
+		if err != nil {
+			it.err = errors.ErrorListKeysError(it.prefix, err)
+			return false
+		}
+		for _, info := range infos {
+			if info.Key > it.after {
+				it.objects = append(it.objects, info)
+			}
+		}
+		it.listed = true
+	}
+	if len(it.objects) == 0 {
+		return false
+	}
+	if it.page == it.pageSize {
+		it.pageToken, it.page = it.current.Key, 0
+	}
+	it.current, it.objects = it.objects[0], it.objects[1:]
+	it.page++
+	return true
+}
+
+func (it *objectIterator) Object() *gospal.ObjectInfo {
+	return it.current
+}
+
+func (it *objectIterator) Err() error {
+	return it.err
+}
+
+func (it *objectIterator) PageToken() string {
+	return it.pageToken
+}
@@ -0,0 +1,473 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package httpprovider
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/internal/registry"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Config is the http specific configuration, given as ProviderConfig.SpecConfig. It is optional, without it the
+// objects can be fetched but not listed
+type Config struct {
+	// Client sending the requests, defaulting to http.DefaultClient
+	Client *http.Client
+
+	// Header added to every request, eg.: an Authorization header
+	Header http.Header
+
+	// Manifest is the key of a JSON document listing the objects of the origin, either an array of keys or an array of
+	// objects such as {"key": "a/b.txt", "size": 3, "lastModified": "2020-01-01T00:00:00Z", "etag": "..."}. The keys
+	// are relative to the global prefix, as the key of the manifest itself
+	Manifest string
+
+	// HTMLIndex lists the objects by crawling the html index pages of the directories, such as the autoindex pages of
+	// nginx or apache. It is ignored when a Manifest is set
+	HTMLIndex bool
+}
+
+// StatusError is the error of an unexpected http response
+type StatusError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%v %v: %v", e.Method, e.URL, e.Status)
+}
+
+type provider struct {
+	context              context.Context
+	kind                 string
+	base                 *url.URL
+	noSuchKeyErrorString string
+	client               *http.Client
+	header               http.Header
+	spec                 *Config
+	config               *gospal.ProviderConfig
+}
+
+// toError classifies an http error as one of the gospal errors
+func toError(err error) error {
+	if stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded) {
+		return errors.Wrap(errors.ErrCanceled, err)
+	}
+	var statusErr *StatusError
+	if !stderrors.As(err, &statusErr) {
+		return err
+	}
+	switch statusErr.StatusCode {
+	case http.StatusNotFound, http.StatusGone:
+		return errors.Wrap(errors.ErrNotExist, err)
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return errors.Wrap(errors.ErrPermissionDenied, err)
+	case http.StatusPreconditionFailed:
+		return errors.Wrap(errors.ErrPreconditionFailed, err)
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return errors.Wrap(errors.ErrTransient, err)
+	}
+	return err
+}
+
+// keyURL returns the url of the specified key. The url paths being resolved by the servers, a key resolving outside
+// of the base url and the global prefix by dot dot elements is rejected by an *errors.InvalidKeyError
+func (p *provider) keyURL(key string) (string, error) {
+	root := "/" + strings.Trim(p.config.GlobalPrefix, "/")
+	targetKey := path.Join(root, key)
+	if targetKey != root && !strings.HasPrefix(targetKey, strings.TrimSuffix(root, "/")+"/") {
+		return "", errors.ErrorInvalidKey(key, "resolves outside of the base url")
+	}
+	if (key == "" || strings.HasSuffix(key, "/")) && !strings.HasSuffix(targetKey, "/") {
+		// directories are fetched with the trailing slash, as their index pages
+		targetKey += "/"
+	}
+	u := *p.base
+	u.Path = strings.TrimSuffix(u.Path, "/") + targetKey
+	u.RawPath = ""
+	return u.String(), nil
+}
+
+// do sends the request of the key, an unexpected status being returned as a *StatusError. The body of the response
+// has to be closed on success
+func (p *provider) do(ctx context.Context, method string, rawURL string, header http.Header, expected ...int) (*http.Response, error) {
+	req, err := http.NewRequest(method, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	for name, values := range p.header {
+		req.Header[name] = values
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	for _, code := range expected {
+		if resp.StatusCode == code {
+			return resp, nil
+		}
+	}
+	// drain the body so the connection can be reused
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+	return nil, &StatusError{Method: method, URL: rawURL, StatusCode: resp.StatusCode, Status: resp.Status}
+}
+
+// timeout returns the context of the requests which do not stream an object, bounded by ProviderConfig.TimeOut
+func (p *provider) timeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if p.config.TimeOut <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, time.Second*time.Duration(p.config.TimeOut))
+}
+
+func (p *provider) ListKeys(pathName ...string) ([]string, error) {
+	return p.ListKeysContext(p.context, pathName...)
+}
+
+func (p *provider) ListKeysContext(ctx context.Context, pathName ...string) ([]string, error) {
+	if len(pathName) > 1 {
+		return nil, errors.ErrorTooMuchListKeysArgs()
+	}
+	var extraPath string
+	if len(pathName) != 0 {
+		extraPath = pathName[0]
+	}
+	var keys []string
+	it := p.Objects(ctx, extraPath)
+	for it.Next() {
+		keys = append(keys, it.Object().Key)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (p *provider) ListDir(prefix string) ([]string, []string, error) {
+	return p.ListDirContext(p.context, prefix)
+}
+
+func (p *provider) ListDirContext(ctx context.Context, prefix string) (keys []string, prefixes []string, err error) {
+	delimiter := p.config.Delimiter
+	if delimiter == "" || p.spec.Manifest == "" {
+		// the html index pages are the directories of the server
+		delimiter = gospal.DefaultDelimiter
+	}
+	// the prefix is a directory, it should end with the delimiter
+	if prefix != "" && !strings.HasSuffix(prefix, delimiter) {
+		prefix += delimiter
+	}
+	infos, dirs, err := p.list(ctx, prefix, false)
+	if err != nil {
+		return nil, nil, errors.ErrorListDir(prefix, err)
+	}
+	for _, info := range infos {
+		rest := strings.TrimPrefix(info.Key, prefix)
+		if i := strings.Index(rest, delimiter); i >= 0 {
+			// the keys being sorted, the keys of a sub prefix follow each other
+			subPrefix := prefix + rest[:i+len(delimiter)]
+			if len(prefixes) == 0 || prefixes[len(prefixes)-1] != subPrefix {
+				prefixes = append(prefixes, subPrefix)
+			}
+			continue
+		}
+		keys = append(keys, info.Key)
+	}
+	return keys, append(prefixes, dirs...), nil
+}
+
+func (p *provider) Objects(ctx context.Context, prefix string) gospal.ObjectIterator {
+	return p.ObjectsFrom(ctx, prefix, "")
+}
+
+func (p *provider) ObjectsFrom(ctx context.Context, prefix string, pageToken string) gospal.ObjectIterator {
+	it := &objectIterator{
+		ctx:       ctx,
+		p:         p,
+		prefix:    prefix,
+		after:     pageToken,
+		pageSize:  defaultMaxKeys,
+		pageToken: pageToken,
+	}
+	if p.config.MaxKeys > 0 {
+		it.pageSize = int(p.config.MaxKeys)
+	}
+	return it
+}
+
+func (p *provider) GetStream(filePath string) (io.Reader, context.CancelFunc, error) {
+	return p.GetStreamContext(p.context, filePath)
+}
+
+func (p *provider) GetStreamContext(ctx context.Context, filePath string) (io.Reader, context.CancelFunc, error) {
+	return gospal.ToStream(p.NewReader(ctx, filePath))
+}
+
+func (p *provider) NewReader(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	keyURL, err := p.keyURL(filePath)
+	if err != nil {
+		return nil, errors.ErrorGetStreamReader(filePath, err)
+	}
+	// the body of the response is read as long as the context is neither done nor canceled
+	ctx, cancel := context.WithCancel(ctx)
+	resp, err := p.do(ctx, http.MethodGet, keyURL, nil, http.StatusOK)
+	if err != nil {
+		cancel()
+		return nil, errors.ErrorGetStreamReader(keyURL, toError(err))
+	}
+	return gospal.NewReadCloser(resp.Body, resp.Body, cancel), nil
+}
+
+func (p *provider) GetRange(filePath string, offset int64, length int64) (io.Reader, context.CancelFunc, error) {
+	return p.GetRangeContext(p.context, filePath, offset, length)
+}
+
+func (p *provider) GetRangeContext(ctx context.Context, filePath string, offset int64, length int64) (io.Reader, context.CancelFunc, error) {
+	keyURL, err := p.keyURL(filePath)
+	if err != nil {
+		return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, filePath, err))
+	}
+	if length == 0 {
+		// an empty range can not be expressed by the Range header, only the existence of the key is checked
+		if _, err := p.StatContext(ctx, filePath); err != nil {
+			return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, keyURL, err))
+		}
+		return gospal.ToStream(ioutil.NopCloser(strings.NewReader("")), nil)
+	}
+	byteRange := "bytes=" + strconv.FormatInt(offset, 10) + "-"
+	if length > 0 {
+		byteRange += strconv.FormatInt(offset+length-1, 10)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	header := http.Header{"Range": []string{byteRange}}
+	resp, err := p.do(ctx, http.MethodGet, keyURL, header, http.StatusPartialContent, http.StatusOK, http.StatusRequestedRangeNotSatisfiable)
+	if err != nil {
+		cancel()
+		return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, keyURL, toError(err)))
+	}
+	var reader io.Reader = resp.Body
+	switch resp.StatusCode {
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the offset is past the end of the object, there is nothing to read
+		reader = strings.NewReader("")
+	case http.StatusOK:
+		// the server ignores ranges and sends the whole object, the range is cut from it
+		if _, err := io.CopyN(ioutil.Discard, resp.Body, offset); err != nil && err != io.EOF {
+			resp.Body.Close()
+			cancel()
+			return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, keyURL, toError(err)))
+		}
+		if length > 0 {
+			reader = io.LimitReader(resp.Body, length)
+		}
+	}
+	return gospal.ToStream(gospal.NewReadCloser(reader, resp.Body, cancel), nil)
+}
+
+func (p *provider) Open(filePath string) (gospal.ObjectReader, error) {
+	return p.OpenContext(p.context, filePath)
+}
+
+func (p *provider) OpenContext(ctx context.Context, filePath string) (gospal.ObjectReader, error) {
+	info, err := p.StatContext(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	return gospal.NewRangeReader(ctx, p, filePath, info.Size), nil
+}
+
+func (p *provider) Stat(fileName string) (*gospal.ObjectInfo, error) {
+	return p.StatContext(p.context, fileName)
+}
+
+func (p *provider) StatContext(ctx context.Context, fileName string) (*gospal.ObjectInfo, error) {
+	keyURL, err := p.keyURL(fileName)
+	if err != nil {
+		return nil, errors.ErrorStat(fileName, err)
+	}
+	ctx, cancel := p.timeout(ctx)
+	defer cancel()
+	resp, err := p.do(ctx, http.MethodHead, keyURL, nil, http.StatusOK)
+	if err != nil {
+		return nil, errors.ErrorStat(keyURL, toError(err))
+	}
+	resp.Body.Close()
+	size := resp.ContentLength
+	if size < 0 {
+		// the length of chunked or dynamic responses is not known upfront
+		if size, err = p.contentSize(ctx, keyURL); err != nil {
+			return nil, errors.ErrorStat(keyURL, toError(err))
+		}
+	}
+	info := &gospal.ObjectInfo{
+		Key:             fileName,
+		Size:            size,
+		ETag:            strings.Trim(strings.TrimPrefix(resp.Header.Get("ETag"), "W/"), `"`),
+		ContentType:     resp.Header.Get("Content-Type"),
+		ContentEncoding: resp.Header.Get("Content-Encoding"),
+		CacheControl:    resp.Header.Get("Cache-Control"),
+	}
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		info.LastModified = lastModified
+	}
+	return info, nil
+}
+
+// contentSize returns the size of the object whose HEAD response has no Content-Length, from the Content-Range of
+// the response to the request of its first byte
+func (p *provider) contentSize(ctx context.Context, keyURL string) (int64, error) {
+	header := http.Header{"Range": []string{"bytes=0-0"}}
+	resp, err := p.do(ctx, http.MethodGet, keyURL, header, http.StatusPartialContent, http.StatusOK, http.StatusRequestedRangeNotSatisfiable)
+	if err != nil {
+		return -1, err
+	}
+	// the first byte at most is read, or none of the object when the range is ignored
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		if resp.ContentLength < 0 {
+			return -1, fmt.Errorf("unknown size of %v, the origin sends neither Content-Length nor Content-Range", keyURL)
+		}
+		return resp.ContentLength, nil
+	}
+	// eg.: bytes 0-0/1234, or bytes */0 for an empty object
+	contentRange := resp.Header.Get("Content-Range")
+	i := strings.LastIndex(contentRange, "/")
+	if i < 0 {
+		return -1, fmt.Errorf("unknown size of %v, invalid Content-Range %q", keyURL, contentRange)
+	}
+	size, err := strconv.ParseInt(contentRange[i+1:], 10, 64)
+	if err != nil {
+		return -1, fmt.Errorf("unknown size of %v, invalid Content-Range %q", keyURL, contentRange)
+	}
+	return size, nil
+}
+
+func (p *provider) GetKind() string {
+	return p.kind
+}
+
+func (p *provider) GetNoSuchKeyErrorString() string {
+	return p.noSuchKeyErrorString
+}
+
+// The origins are read-only, every write fails with an *errors.NotSupportedError
+
+func (p *provider) PutStream(fileName string, reader io.Reader, opts ...gospal.PutOption) (int64, error) {
+	return p.PutStreamContext(p.context, fileName, reader, opts...)
+}
+
+func (p *provider) PutStreamContext(ctx context.Context, fileName string, reader io.Reader, opts ...gospal.PutOption) (int64, error) {
+	return -1, errors.ErrorNotSupported("PutStream", p.kind)
+}
+
+func (p *provider) NewWriter(ctx context.Context, fileName string, opts ...gospal.PutOption) (io.WriteCloser, error) {
+	return nil, errors.ErrorNotSupported("NewWriter", p.kind)
+}
+
+func (p *provider) Copy(src string, dst string) error {
+	return p.CopyContext(p.context, src, dst)
+}
+
+func (p *provider) CopyContext(ctx context.Context, src string, dst string) error {
+	return errors.ErrorNotSupported("Copy", p.kind)
+}
+
+func (p *provider) Move(src string, dst string) error {
+	return p.MoveContext(p.context, src, dst)
+}
+
+func (p *provider) MoveContext(ctx context.Context, src string, dst string) error {
+	return errors.ErrorNotSupported("Move", p.kind)
+}
+
+func (p *provider) DeleteKey(fileName string) error {
+	return p.DeleteKeyContext(p.context, fileName)
+}
+
+func (p *provider) DeleteKeyContext(ctx context.Context, fileName string) error {
+	return errors.ErrorNotSupported("DeleteKey", p.kind)
+}
+
+func (p *provider) DeleteKeys(fileNames []string) error {
+	return p.DeleteKeysContext(p.context, fileNames)
+}
+
+func (p *provider) DeleteKeysContext(ctx context.Context, fileNames []string) error {
+	return errors.ErrorNotSupported("DeleteKeys", p.kind)
+}
+
+func (p *provider) DeletePrefix(prefix string) error {
+	return p.DeletePrefixContext(p.context, prefix)
+}
+
+func (p *provider) DeletePrefixContext(ctx context.Context, prefix string) error {
+	return errors.ErrorNotSupported("DeletePrefix", p.kind)
+}
+
+// the provider is available from the factory as soon as its package is imported
+func init() {
+	registry.MustRegister(gospal.ProviderHTTP, New)
+}
+
+//New http provider constructor. The bucket is the base url of the origin, eg.: https://cdn.example.com/data
+func New(ctx context.Context, bucket string, config *gospal.ProviderConfig) (gospal.Gospal, error) {
+	provider := provider{}
+	provider.kind = string(gospal.ProviderHTTP)
+	provider.noSuchKeyErrorString = http.StatusText(http.StatusNotFound)
+	provider.config = config
+	provider.context = ctx
+
+	base, err := url.Parse(bucket)
+	if err != nil {
+		return nil, errors.ErrorInitProvider("http", err)
+	}
+	if (base.Scheme != "http" && base.Scheme != "https") || base.Host == "" {
+		return nil, errors.ErrorInitProvider("http", fmt.Errorf("%v is not an http or https url", bucket))
+	}
+	provider.base = base
+
+	provider.spec = &Config{}
+	if config.SpecConfig != nil {
+		cfg, ok := config.SpecConfig.(*Config)
+		if !ok {
+			return nil, errors.ErrorInitProvider("http", stderrors.New("SpecConfig is not a *httpprovider.Config"))
+		}
+		provider.spec = cfg
+	}
+	provider.client = provider.spec.Client
+	if provider.client == nil {
+		provider.client = http.DefaultClient
+	}
+	provider.header = provider.spec.Header
+	return &provider, nil
+}
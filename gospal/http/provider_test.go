@@ -0,0 +1,527 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package httpprovider
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testModTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// origin is a static origin serving its files under /data, along with the autoindex pages of the directories
+type origin struct {
+	files map[string]string
+	// ignoreRange serves the whole files, as the servers not supporting ranges
+	ignoreRange bool
+	// unknownLength answers the HEAD requests without Content-Length, as for chunked or dynamic responses
+	unknownLength bool
+}
+
+func (o *origin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, "/data/") {
+		http.NotFound(w, r)
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/data/")
+	if name == "private.txt" {
+		http.Error(w, "forbidden", http.StatusForbidden)
+		return
+	}
+	if name == "" || strings.HasSuffix(name, "/") {
+		o.serveIndex(w, r, name)
+		return
+	}
+	content, ok := o.files[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if o.ignoreRange {
+		r.Header.Del("Range")
+	}
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, len(content)))
+	w.Header().Set("Cache-Control", "max-age=60")
+	if o.unknownLength && r.Method == http.MethodHead {
+		return
+	}
+	http.ServeContent(w, r, name, testModTime, strings.NewReader(content))
+}
+
+// serveIndex serves the index page of the directory, linking to its files and sub directories as nginx does
+func (o *origin) serveIndex(w http.ResponseWriter, r *http.Request, dir string) {
+	entries := map[string]bool{}
+	for name := range o.files {
+		if !strings.HasPrefix(name, dir) {
+			continue
+		}
+		rest := strings.TrimPrefix(name, dir)
+		if i := strings.Index(rest, "/"); i >= 0 {
+			rest = rest[:i+1]
+		}
+		entries[rest] = true
+	}
+	if len(entries) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	var names []string
+	for name := range entries {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	w.Header().Set("Content-Type", "text/html")
+	fmt.Fprintf(w, "<html><body><h1>Index of /data/%v</h1><hr><pre><a href=\"../\">../</a>\n", dir)
+	fmt.Fprintf(w, "<a href=\"?C=N;O=D\">Name</a> <a href=\"http://elsewhere.example.com/\">elsewhere</a>\n")
+	for _, name := range names {
+		fmt.Fprintf(w, "<a href=\"%v\">%v</a>\n", strings.Replace(name, " ", "%20", -1), name)
+	}
+	fmt.Fprintf(w, "</pre><hr></body></html>")
+}
+
+func newTestOrigin() *origin {
+	return &origin{files: map[string]string{
+		"a.txt":         "aaaaaaaaaa",
+		"b/c.txt":       "ccc",
+		"b/d e.txt":     "ddd",
+		"b/f/g.txt":     "ggg",
+		"h.json":        "{}",
+		"manifest.json": `["a.txt", {"key": "b/c.txt", "size": 3, "lastModified": "2020-01-02T03:04:05Z", "etag": "3"}, "b/d e.txt", "b/f/g.txt", "h.json"]`,
+	}}
+}
+
+// newTestProvider returns a provider of the origin served by a test server, along with the function stopping it
+func newTestProvider(t *testing.T, o *origin, config *gospal.ProviderConfig) (gospal.Gospal, func()) {
+	server := httptest.NewServer(o)
+	p, err := New(context.Background(), server.URL+"/data", config)
+	if err != nil {
+		server.Close()
+		t.Fatalf("error when instantiating http provider. err=%v", err.Error())
+	}
+	return p, server.Close
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		bucket  string
+		config  *gospal.ProviderConfig
+		wantErr bool
+	}{
+		{
+			name:    "Should instantiate an http provider",
+			bucket:  "http://127.0.0.1:8080/data",
+			config:  &gospal.ProviderConfig{TimeOut: 300},
+			wantErr: false,
+		},
+		{
+			name:    "Should instantiate an https provider with its configuration",
+			bucket:  "https://cdn.example.com",
+			config:  &gospal.ProviderConfig{TimeOut: 300, SpecConfig: &Config{Manifest: "manifest.json"}},
+			wantErr: false,
+		},
+		{
+			name:    "Should raise on non http url",
+			bucket:  "ftp://cdn.example.com/data",
+			config:  &gospal.ProviderConfig{TimeOut: 300},
+			wantErr: true,
+		},
+		{
+			name:    "Should raise on missing host",
+			bucket:  "data",
+			config:  &gospal.ProviderConfig{TimeOut: 300},
+			wantErr: true,
+		},
+		{
+			name:    "Should raise on invalid configuration",
+			bucket:  "https://cdn.example.com",
+			config:  &gospal.ProviderConfig{TimeOut: 300, SpecConfig: Config{}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(context.Background(), tt.bucket, tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !tt.wantErr && got.GetKind() != "http" {
+				t.Errorf("GetKind() got = %v, want %v", got.GetKind(), "http")
+			}
+		})
+	}
+}
+
+func Test_toError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantKind error
+	}{
+		{
+			name:     "Should classify not found",
+			err:      &StatusError{StatusCode: http.StatusNotFound},
+			wantKind: errors.ErrNotExist,
+		},
+		{
+			name:     "Should classify gone",
+			err:      &StatusError{StatusCode: http.StatusGone},
+			wantKind: errors.ErrNotExist,
+		},
+		{
+			name:     "Should classify forbidden",
+			err:      &StatusError{StatusCode: http.StatusForbidden},
+			wantKind: errors.ErrPermissionDenied,
+		},
+		{
+			name:     "Should classify unauthorized",
+			err:      &StatusError{StatusCode: http.StatusUnauthorized},
+			wantKind: errors.ErrPermissionDenied,
+		},
+		{
+			name:     "Should classify canceled context",
+			err:      fmt.Errorf("Get: %w", context.Canceled),
+			wantKind: errors.ErrCanceled,
+		},
+		{
+			name:     "Should classify server errors as transient",
+			err:      &StatusError{StatusCode: http.StatusServiceUnavailable},
+			wantKind: errors.ErrTransient,
+		},
+		{
+			name:     "Should classify throttling as transient",
+			err:      &StatusError{StatusCode: http.StatusTooManyRequests},
+			wantKind: errors.ErrTransient,
+		},
+		{
+			name:     "Should leave other errors unclassified",
+			err:      &StatusError{StatusCode: http.StatusBadRequest},
+			wantKind: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := toError(tt.err)
+			if tt.wantKind == nil {
+				if err != tt.err {
+					t.Errorf("toError() got = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if !stderrors.Is(err, tt.wantKind) {
+				t.Errorf("toError() error = %v, should be %v", err, tt.wantKind)
+			}
+		})
+	}
+}
+
+func Test_provider_NewReader(t *testing.T) {
+	p, cleanup := newTestProvider(t, newTestOrigin(), &gospal.ProviderConfig{TimeOut: 300})
+	defer cleanup()
+
+	for key, want := range map[string]string{"a.txt": "aaaaaaaaaa", "b/d e.txt": "ddd"} {
+		reader, err := p.NewReader(context.Background(), key)
+		if err != nil {
+			t.Errorf("NewReader() error = %v", err)
+			continue
+		}
+		if data, _ := ioutil.ReadAll(reader); string(data) != want {
+			t.Errorf("NewReader() got = %v, want %v", string(data), want)
+		}
+		reader.Close()
+	}
+	if _, err := p.NewReader(context.Background(), "missing.txt"); !stderrors.Is(err, errors.ErrNotExist) {
+		t.Errorf("NewReader() error = %v, should be %v", err, errors.ErrNotExist)
+	}
+	if _, err := p.NewReader(context.Background(), "private.txt"); !stderrors.Is(err, errors.ErrPermissionDenied) {
+		t.Errorf("NewReader() error = %v, should be %v", err, errors.ErrPermissionDenied)
+	}
+	var statusErr *StatusError
+	if _, err := p.NewReader(context.Background(), "missing.txt"); !stderrors.As(err, &statusErr) || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("NewReader() error = %v, should be a StatusError", err)
+	}
+}
+
+func Test_provider_GetRange(t *testing.T) {
+	for _, ignoreRange := range []bool{false, true} {
+		t.Run(fmt.Sprintf("ignoreRange=%v", ignoreRange), func(t *testing.T) {
+			o := newTestOrigin()
+			o.files["a.txt"] = "0123456789"
+			o.ignoreRange = ignoreRange
+			p, cleanup := newTestProvider(t, o, &gospal.ProviderConfig{TimeOut: 300})
+			defer cleanup()
+
+			tests := []struct {
+				offset int64
+				length int64
+				want   string
+			}{
+				{offset: 0, length: 3, want: "012"},
+				{offset: 4, length: 2, want: "45"},
+				{offset: 7, length: -1, want: "789"},
+				{offset: 8, length: 10, want: "89"},
+				{offset: 5, length: 0, want: ""},
+				{offset: 10, length: -1, want: ""},
+			}
+			for _, tt := range tests {
+				reader, cancel, err := p.GetRange("a.txt", tt.offset, tt.length)
+				if err != nil {
+					t.Errorf("GetRange(%v, %v) error = %v", tt.offset, tt.length, err)
+					continue
+				}
+				if data, _ := ioutil.ReadAll(reader); string(data) != tt.want {
+					t.Errorf("GetRange(%v, %v) got = %v, want %v", tt.offset, tt.length, string(data), tt.want)
+				}
+				cancel()
+			}
+			if _, _, err := p.GetRange("missing.txt", 0, 0); !stderrors.Is(err, errors.ErrNotExist) {
+				t.Errorf("GetRange() error = %v, should be %v", err, errors.ErrNotExist)
+			}
+
+			// random access relies on the ranges as well
+			reader, err := p.Open("a.txt")
+			if err != nil {
+				t.Errorf("Open() error = %v", err)
+				return
+			}
+			defer reader.Close()
+			b := make([]byte, 4)
+			if n, err := reader.ReadAt(b, 3); err != nil || string(b[:n]) != "3456" {
+				t.Errorf("ReadAt() got = %v, %v, want %v", string(b[:n]), err, "3456")
+			}
+			reader.Seek(-2, io.SeekEnd)
+			if data, _ := ioutil.ReadAll(reader); string(data) != "89" {
+				t.Errorf("Read() got = %v, want %v", string(data), "89")
+			}
+		})
+	}
+}
+
+func Test_provider_Stat(t *testing.T) {
+	p, cleanup := newTestProvider(t, newTestOrigin(), &gospal.ProviderConfig{TimeOut: 300})
+	defer cleanup()
+
+	got, err := p.Stat("h.json")
+	if err != nil {
+		t.Errorf("Stat() error = %v", err)
+		return
+	}
+	want := &gospal.ObjectInfo{
+		Key:          "h.json",
+		Size:         2,
+		LastModified: testModTime,
+		ETag:         "2",
+		ContentType:  "application/json",
+		CacheControl: "max-age=60",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Stat() got = %+v, want %+v", got, want)
+	}
+	if _, err := p.Stat("missing.txt"); !stderrors.Is(err, errors.ErrNotExist) {
+		t.Errorf("Stat() error = %v, should be %v", err, errors.ErrNotExist)
+	}
+}
+
+func Test_provider_StatUnknownLength(t *testing.T) {
+	tests := []struct {
+		name        string
+		ignoreRange bool
+		key         string
+		want        string
+	}{
+		{name: "Should get the size from the Content-Range", key: "a.txt", want: "aaaaaaaaaa"},
+		{name: "Should get the size of an empty object", key: "empty.txt", want: ""},
+		{name: "Should get the size from the Content-Length of the whole object", ignoreRange: true, key: "a.txt", want: "aaaaaaaaaa"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newTestOrigin()
+			o.files["empty.txt"] = ""
+			o.unknownLength = true
+			o.ignoreRange = tt.ignoreRange
+			p, cleanup := newTestProvider(t, o, &gospal.ProviderConfig{TimeOut: 300})
+			defer cleanup()
+
+			info, err := p.Stat(tt.key)
+			if err != nil {
+				t.Errorf("Stat() error = %v", err)
+				return
+			}
+			if info.Size != int64(len(tt.want)) {
+				t.Errorf("Stat() size = %v, want %v", info.Size, len(tt.want))
+			}
+			object, err := p.Open(tt.key)
+			if err != nil {
+				t.Errorf("Open() error = %v", err)
+				return
+			}
+			defer object.Close()
+			if data, err := ioutil.ReadAll(object); err != nil || string(data) != tt.want {
+				t.Errorf("Open() got = %q, %v, want %q", data, err, tt.want)
+			}
+		})
+	}
+}
+
+func Test_provider_Manifest(t *testing.T) {
+	p, cleanup := newTestProvider(t, newTestOrigin(), &gospal.ProviderConfig{
+		TimeOut:    300,
+		MaxKeys:    2,
+		SpecConfig: &Config{Manifest: "manifest.json"},
+	})
+	defer cleanup()
+
+	keys, err := p.ListKeys()
+	if want := []string{"a.txt", "b/c.txt", "b/d e.txt", "b/f/g.txt", "h.json"}; err != nil || !reflect.DeepEqual(keys, want) {
+		t.Errorf("ListKeys() got = %v, %v, want %v", keys, err, want)
+	}
+	keys, err = p.ListKeys("b/")
+	if want := []string{"b/c.txt", "b/d e.txt", "b/f/g.txt"}; err != nil || !reflect.DeepEqual(keys, want) {
+		t.Errorf("ListKeys() got = %v, %v, want %v", keys, err, want)
+	}
+	gotKeys, gotPrefixes, err := p.ListDir("b")
+	if err != nil || !reflect.DeepEqual(gotKeys, []string{"b/c.txt", "b/d e.txt"}) || !reflect.DeepEqual(gotPrefixes, []string{"b/f/"}) {
+		t.Errorf("ListDir() got = %v, %v, %v", gotKeys, gotPrefixes, err)
+	}
+
+	// the attributes of the manifest are returned by the listing
+	it := p.Objects(context.Background(), "b/c")
+	if !it.Next() || it.Object().Size != 3 || it.Object().ETag != "3" || !it.Object().LastModified.Equal(testModTime) {
+		t.Errorf("Objects() got = %+v, %v", it.Object(), it.Err())
+	}
+
+	// the listing resumes from the page token
+	it = p.Objects(context.Background(), "")
+	var tokens []string
+	for it.Next() {
+		tokens = append(tokens, it.PageToken())
+	}
+	if want := []string{"", "", "b/c.txt", "b/c.txt", "b/f/g.txt"}; !reflect.DeepEqual(tokens, want) {
+		t.Errorf("PageToken() got = %v, want %v", tokens, want)
+	}
+	var resumed []string
+	for it := p.ObjectsFrom(context.Background(), "", "b/c.txt"); it.Next(); {
+		resumed = append(resumed, it.Object().Key)
+	}
+	if want := []string{"b/d e.txt", "b/f/g.txt", "h.json"}; !reflect.DeepEqual(resumed, want) {
+		t.Errorf("ObjectsFrom() got = %v, want %v", resumed, want)
+	}
+}
+
+func Test_provider_HTMLIndex(t *testing.T) {
+	p, cleanup := newTestProvider(t, newTestOrigin(), &gospal.ProviderConfig{
+		TimeOut:    300,
+		SpecConfig: &Config{HTMLIndex: true},
+	})
+	defer cleanup()
+
+	keys, err := p.ListKeys()
+	if want := []string{"a.txt", "b/c.txt", "b/d e.txt", "b/f/g.txt", "h.json", "manifest.json"}; err != nil || !reflect.DeepEqual(keys, want) {
+		t.Errorf("ListKeys() got = %v, %v, want %v", keys, err, want)
+	}
+	keys, err = p.ListKeys("b/f")
+	if want := []string{"b/f/g.txt"}; err != nil || !reflect.DeepEqual(keys, want) {
+		t.Errorf("ListKeys() got = %v, %v, want %v", keys, err, want)
+	}
+	gotKeys, gotPrefixes, err := p.ListDir("")
+	if err != nil || !reflect.DeepEqual(gotKeys, []string{"a.txt", "h.json", "manifest.json"}) || !reflect.DeepEqual(gotPrefixes, []string{"b/"}) {
+		t.Errorf("ListDir() got = %v, %v, %v", gotKeys, gotPrefixes, err)
+	}
+	// a directory without index lists nothing, just as a prefix without keys
+	if keys, err := p.ListKeys("missing/"); err != nil || len(keys) != 0 {
+		t.Errorf("ListKeys() got = %v, %v, want no keys", keys, err)
+	}
+}
+
+func Test_provider_GlobalPrefix(t *testing.T) {
+	p, cleanup := newTestProvider(t, newTestOrigin(), &gospal.ProviderConfig{
+		TimeOut:      300,
+		GlobalPrefix: "b",
+		SpecConfig:   &Config{HTMLIndex: true},
+	})
+	defer cleanup()
+
+	// the keys are relative to the global prefix
+	keys, err := p.ListKeys()
+	if want := []string{"c.txt", "d e.txt", "f/g.txt"}; err != nil || !reflect.DeepEqual(keys, want) {
+		t.Errorf("ListKeys() got = %v, %v, want %v", keys, err, want)
+	}
+	// and can be fed back to the provider
+	for _, key := range keys {
+		reader, err := p.NewReader(context.Background(), key)
+		if err != nil {
+			t.Errorf("NewReader() error = %v", err)
+			continue
+		}
+		if data, _ := ioutil.ReadAll(reader); len(data) != 3 || string(data[0]) != path.Base(key)[:1] {
+			t.Errorf("NewReader() got = %v", string(data))
+		}
+		reader.Close()
+	}
+	for _, key := range []string{"../a.txt", "f/../../a.txt"} {
+		if _, err := p.Stat(key); !stderrors.Is(err, errors.ErrInvalidKey) {
+			t.Errorf("Stat() error = %v, should be %v", err, errors.ErrInvalidKey)
+		}
+	}
+}
+
+func Test_provider_NotSupported(t *testing.T) {
+	p, cleanup := newTestProvider(t, newTestOrigin(), &gospal.ProviderConfig{TimeOut: 300})
+	defer cleanup()
+
+	// without index, the origin can not be listed
+	if _, err := p.ListKeys(); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("ListKeys() error = %v, should be %v", err, errors.ErrNotSupported)
+	}
+	if _, _, err := p.ListDir(""); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("ListDir() error = %v, should be %v", err, errors.ErrNotSupported)
+	}
+	if _, err := p.PutStream("a.txt", strings.NewReader("overwritten")); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("PutStream() error = %v, should be %v", err, errors.ErrNotSupported)
+	}
+	if _, err := p.NewWriter(context.Background(), "a.txt"); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("NewWriter() error = %v, should be %v", err, errors.ErrNotSupported)
+	}
+	if err := p.Copy("a.txt", "b.txt"); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("Copy() error = %v, should be %v", err, errors.ErrNotSupported)
+	}
+	if err := p.Move("a.txt", "b.txt"); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("Move() error = %v, should be %v", err, errors.ErrNotSupported)
+	}
+	if err := p.DeleteKey("a.txt"); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("DeleteKey() error = %v, should be %v", err, errors.ErrNotSupported)
+	}
+	if err := p.DeleteKeys([]string{"a.txt"}); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("DeleteKeys() error = %v, should be %v", err, errors.ErrNotSupported)
+	}
+	var notSupportedErr *errors.NotSupportedError
+	if err := p.DeletePrefix(""); !stderrors.As(err, &notSupportedErr) || notSupportedErr.Op != "DeletePrefix" {
+		t.Errorf("DeletePrefix() error = %v, should be a NotSupportedError", err)
+	}
+}
@@ -0,0 +1,200 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package fsutil
+
+import (
+	"context"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"os"
+	"path"
+	"strings"
+)
+
+// FileSystem is the tree of directories walked by an Iterator
+type FileSystem interface {
+	// Stat returns the attributes of the directory the walk starts from, following it if it is a symbolic link
+	Stat(dir string) (os.FileInfo, error)
+	// ReadDir returns the attributes of the entries of the directory sorted by name. The symbolic links are not
+	// followed, they are listed as files
+	ReadDir(dir string) ([]os.FileInfo, error)
+}
+
+// Walk configures the walk of an Iterator
+type Walk struct {
+	// Directory is the directory of the provider. A missing root lists nothing, unless the directory itself is missing
+	Directory string
+	// Root is the directory the walk starts from, only keeping its entries starting with Base
+	Root string
+	Base string
+	// Resume is the path of the last object of the previous page, the walk starting from the first one when empty
+	Resume string
+	// PageSize is the number of objects per page
+	PageSize int
+	// ToKey returns the key of the path of a file
+	ToKey func(filePath string) string
+	// ToError classifies the errors of the file system as gospal errors
+	ToError func(err error) error
+	// IsInternal reports whether the file name is the one of a file of the provider, which is not a key
+	IsInternal func(name string) bool
+}
+
+// entry is a pending entry of the walk, the listing of a directory giving the attributes of its entries
+type entry struct {
+	path string
+	info os.FileInfo
+}
+
+// Iterator is the gospal.ObjectIterator of the file systems. It walks the directories lazily, a directory is only read
+// once the walk reaches it. Files are returned in lexical order within each directory, the page token is the key of
+// the last object of the previous page. Just as object storages, the prefix may stop in the middle of a name: the walk
+// starts from its directory, only keeping the entries starting with its last element.
+type Iterator struct {
+	ctx       context.Context
+	fs        FileSystem
+	walk      Walk
+	pending   []entry
+	started   bool
+	count     int
+	lastKey   string
+	pageToken string
+	current   *gospal.ObjectInfo
+	err       error
+}
+
+// NewIterator returns the iterator of the walk of the file system. The page token is the one the listing resumes from,
+// the one matching walk.Resume
+func NewIterator(ctx context.Context, fs FileSystem, walk Walk, pageToken string) *Iterator {
+	return &Iterator{ctx: ctx, fs: fs, walk: walk, pageToken: pageToken}
+}
+
+// FailedIterator returns an iterator stopped on the error, eg.: when the prefix is rejected
+func FailedIterator(err error) *Iterator {
+	return &Iterator{err: err}
+}
+
+// skip tells whether the child of dir has already been listed before the resumed page
+func (it *Iterator) skip(dir string, name string) bool {
+	if it.walk.Resume == "" || !strings.HasPrefix(it.walk.Resume, dir+"/") {
+		return false
+	}
+	rest := strings.TrimPrefix(it.walk.Resume, dir+"/")
+	if i := strings.Index(rest, "/"); i >= 0 {
+		// the resumed object is deeper in the tree, its ancestors should still be walked
+		return name < rest[:i]
+	}
+	return name <= rest
+}
+
+// push adds the entries of the directory to the pending entries, in reverse order as the last one is walked first
+func (it *Iterator) push(dir string) error {
+	infos, err := it.fs.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for i := len(infos) - 1; i >= 0; i-- {
+		name := infos[i].Name()
+		if dir == it.walk.Root && !strings.HasPrefix(name, it.walk.Base) {
+			continue
+		}
+		if !it.skip(dir, name) && !it.walk.IsInternal(name) {
+			it.pending = append(it.pending, entry{path: path.Join(dir, name), info: infos[i]})
+		}
+	}
+	return nil
+}
+
+// fail stops the iteration on the error
+func (it *Iterator) fail(err error) bool {
+	it.err = errors.ErrorListKeysError(it.walk.Root, it.walk.ToError(err))
+	return false
+}
+
+// start pushes the entries of the root, reporting whether there is anything to walk
+func (it *Iterator) start() bool {
+	if err := it.ctx.Err(); err != nil {
+		return it.fail(err)
+	}
+	info, err := it.fs.Stat(it.walk.Root)
+	if err != nil {
+		// just as a prefix without any key in object storages, unless the directory itself is missing
+		if _, dirErr := it.fs.Stat(it.walk.Directory); os.IsNotExist(err) && dirErr == nil {
+			return false
+		}
+		return it.fail(err)
+	}
+	if !info.IsDir() {
+		// the prefix goes through a file, no key can start with it
+		return false
+	}
+	if err := it.push(it.walk.Root); err != nil {
+		return it.fail(err)
+	}
+	return true
+}
+
+func (it *Iterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if !it.started {
+		it.started = true
+		if !it.start() {
+			return false
+		}
+	}
+	for len(it.pending) > 0 {
+		if err := it.ctx.Err(); err != nil {
+			return it.fail(err)
+		}
+		e := it.pending[len(it.pending)-1]
+		it.pending = it.pending[:len(it.pending)-1]
+		if e.info.IsDir() {
+			err := it.push(e.path)
+			if os.IsNotExist(err) {
+				// removed since its parent directory has been read
+				continue
+			}
+			if err != nil {
+				return it.fail(err)
+			}
+			continue
+		}
+		if it.count > 0 && it.count%it.walk.PageSize == 0 {
+			it.pageToken = it.lastKey
+		}
+		it.count++
+		it.lastKey = it.walk.ToKey(e.path)
+		it.current = &gospal.ObjectInfo{
+			Key:          it.lastKey,
+			Size:         e.info.Size(),
+			LastModified: e.info.ModTime(),
+		}
+		return true
+	}
+	return false
+}
+
+func (it *Iterator) Object() *gospal.ObjectInfo {
+	return it.current
+}
+
+func (it *Iterator) Err() error {
+	return it.err
+}
+
+func (it *Iterator) PageToken() string {
+	return it.pageToken
+}
@@ -0,0 +1,76 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package fsutil
+
+import (
+	"encoding/json"
+	"github.com/contentsquare/gospal/gospal"
+	"os"
+	"path"
+	"strings"
+)
+
+// File systems do not store the attributes set by PutOptions, they are persisted in a hidden json sidecar file next
+// to the file of the object, eg.: path/to/.key.txt.gospal.json for path/to/key.txt. The sidecars are never listed as
+// keys
+const metadataSuffix = ".gospal.json"
+
+// MetadataPath returns the path of the sidecar of the file
+func MetadataPath(filePath string) string {
+	dir, name := path.Split(filePath)
+	return path.Join(dir, "."+name+metadataSuffix)
+}
+
+// isMetadataFile reports whether the file name is the one of a sidecar
+func isMetadataFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, metadataSuffix)
+}
+
+// WriteMetadata persists the options in the sidecar of the file, replaced the same way as the file. The sidecar is
+// removed when there is nothing to persist, for the attributes of a previous version of the file not to be kept
+func WriteMetadata(fs WriteFileSystem, filePath string, options *gospal.PutOptions) error {
+	if options.ContentType == "" && options.ContentEncoding == "" && options.CacheControl == "" && len(options.Metadata) == 0 {
+		return RemoveMetadata(fs, filePath)
+	}
+	data, err := json.Marshal(options)
+	if err != nil {
+		return err
+	}
+	return replaceFile(fs, MetadataPath(filePath), data)
+}
+
+// ReadMetadata returns the options persisted in the sidecar of the file, empty options when there is none
+func ReadMetadata(fs WriteFileSystem, filePath string) (*gospal.PutOptions, error) {
+	options := &gospal.PutOptions{}
+	data, err := fs.ReadFile(MetadataPath(filePath))
+	if os.IsNotExist(err) {
+		return options, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, options); err != nil {
+		return nil, err
+	}
+	return options, nil
+}
+
+// RemoveMetadata removes the sidecar of the file, if any
+func RemoveMetadata(fs WriteFileSystem, filePath string) error {
+	if err := fs.Remove(MetadataPath(filePath)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
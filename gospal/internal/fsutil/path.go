@@ -0,0 +1,35 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package fsutil
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// IsWithin tells whether the cleaned path is either the root directory or one of its descendants. The root may be
+// relative, "." being the working directory itself
+func IsWithin(root string, filePath string) bool {
+	rel, err := filepath.Rel(root, filePath)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, "../")
+}
+
+// RelativePath returns the path of the descendant of the root directory relative to it
+func RelativePath(root string, filePath string) string {
+	if root == "." {
+		return filePath
+	}
+	return strings.TrimPrefix(filePath, strings.TrimSuffix(root, "/")+"/")
+}
@@ -0,0 +1,34 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package fsutil holds the helpers shared by the providers of file systems, such as the local and sftp providers
+package fsutil
+
+import (
+	"context"
+	"io"
+)
+
+// ContextReader is an io.Reader that stops reading as soon as its context is done
+type ContextReader struct {
+	Ctx    context.Context
+	Reader io.Reader
+}
+
+func (r *ContextReader) Read(b []byte) (int, error) {
+	if err := r.Ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.Reader.Read(b)
+}
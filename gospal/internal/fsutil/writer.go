@@ -0,0 +1,163 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package fsutil
+
+import (
+	"context"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"io"
+	"math/rand"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// Writers write to a hidden temporary file next to their target, eg.: path/to/.key.txt.gospal-tmp-1a2b3c for
+// path/to/key.txt, renamed to the target on close. Just like the sidecars, the temporary files are never listed as keys
+const tempInfix = ".gospal-tmp-"
+
+// File is a file of a WriteFileSystem being written
+type File interface {
+	io.WriteCloser
+	// Name returns the path of the file
+	Name() string
+}
+
+// WriteFileSystem is the tree of directories written by a Writer
+type WriteFileSystem interface {
+	// CreateNew creates the file for writing, failing with an error satisfying os.IsExist if it already exists. The
+	// content written is expected to be durable once the file closed
+	CreateNew(filePath string) (File, error)
+	// MkdirAll creates the directory along with its missing parents
+	MkdirAll(dir string) error
+	// Rename moves the file to the target path, replacing it
+	Rename(oldPath string, newPath string) error
+	// Remove removes the file
+	Remove(filePath string) error
+	// ReadFile returns the content of the file
+	ReadFile(filePath string) ([]byte, error)
+}
+
+// isTempFile reports whether the file name is the one of a temporary file
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.Contains(name, tempInfix)
+}
+
+// IsInternalFile reports whether the file name is the one of a file of the provider, which is not a key
+func IsInternalFile(name string) bool {
+	return isMetadataFile(name) || isTempFile(name)
+}
+
+// createTempFile creates a new temporary file for the file
+func createTempFile(fs WriteFileSystem, filePath string) (File, error) {
+	dir, name := path.Split(filePath)
+	for i := 0; ; i++ {
+		fh, err := fs.CreateNew(path.Join(dir, "."+name+tempInfix+strconv.FormatUint(uint64(rand.Uint32()), 36)))
+		if os.IsExist(err) && i < 100 {
+			continue
+		}
+		return fh, err
+	}
+}
+
+// replaceFile writes the data to a temporary file renamed to the file, which is either left untouched or replaced
+func replaceFile(fs WriteFileSystem, filePath string, data []byte) error {
+	fh, err := createTempFile(fs, filePath)
+	if err != nil {
+		return err
+	}
+	_, err = fh.Write(data)
+	if closeErr := fh.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = fs.Rename(fh.Name(), filePath)
+	}
+	if err != nil {
+		fs.Remove(fh.Name())
+	}
+	return err
+}
+
+// Writer is the io.WriteCloser of the file systems. It writes to a temporary file which is renamed to the target file
+// on close, the attributes of the put options being persisted in its sidecar
+type Writer struct {
+	ctx      context.Context
+	fs       WriteFileSystem
+	file     File
+	filePath string
+	options  *gospal.PutOptions
+	toError  func(err error) error
+}
+
+// NewWriter returns the writer of the file, toError classifying the errors of the file system as gospal errors
+func NewWriter(ctx context.Context, fs WriteFileSystem, filePath string, options *gospal.PutOptions, toError func(err error) error) (*Writer, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.ErrorPutStreamReader(filePath, toError(err))
+	}
+	fh, err := createTempFile(fs, filePath)
+	for i := 0; os.IsNotExist(err) && i < 3; i++ {
+		// intermediate directories are created just as object storages accept any key. Retried as they may be pruned
+		// by a concurrent delete meanwhile
+		if err = fs.MkdirAll(path.Dir(filePath)); err == nil {
+			fh, err = createTempFile(fs, filePath)
+		}
+	}
+	if err != nil {
+		return nil, errors.ErrorPutStreamReader(filePath, toError(err))
+	}
+	return &Writer{ctx: ctx, fs: fs, file: fh, filePath: filePath, options: options, toError: toError}, nil
+}
+
+// FilePath returns the path of the target file
+func (w *Writer) FilePath() string {
+	return w.filePath
+}
+
+func (w *Writer) Write(b []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, errors.ErrorPutStreamReader(w.filePath, w.toError(err))
+	}
+	return w.file.Write(b)
+}
+
+// Close renames the temporary file to the target file, unless the context is done. The target file is thus either
+// left untouched or replaced by the complete new file. The temporary file is removed whenever the file can not be
+// committed
+func (w *Writer) Close() error {
+	err := w.file.Close()
+	if err == nil {
+		err = w.ctx.Err()
+	}
+	if err == nil {
+		err = w.fs.Rename(w.file.Name(), w.filePath)
+	}
+	if err == nil {
+		err = WriteMetadata(w.fs, w.filePath, w.options)
+	}
+	if err != nil {
+		w.fs.Remove(w.file.Name())
+		return errors.ErrorPutStreamReader(w.filePath, w.toError(err))
+	}
+	return nil
+}
+
+// Abort closes and removes the temporary file, leaving the target file untouched
+func (w *Writer) Abort() {
+	w.file.Close()
+	w.fs.Remove(w.file.Name())
+}
@@ -0,0 +1,75 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+// Package registry holds the provider constructors by kind. The built-in providers register themselves from their
+// package, which can not import the factory as the factory imports them
+package registry
+
+import (
+	"context"
+	"fmt"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"sort"
+	"sync"
+)
+
+// Constructor instantiates a provider over the bucket, such as the New functions of the provider packages
+type Constructor func(ctx context.Context, bucket string, config *gospal.ProviderConfig) (gospal.Gospal, error)
+
+var (
+	mu           sync.RWMutex
+	constructors = map[string]Constructor{}
+)
+
+// Register registers the constructor of the kind of provider. A kind can only be registered once
+func Register(kind string, constructor Constructor) error {
+	if kind == "" || constructor == nil {
+		return errors.ErrorRegisterProvider(kind, fmt.Errorf("both a kind and a constructor are required"))
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := constructors[kind]; ok {
+		return errors.ErrorRegisterProvider(kind, errors.Wrap(errors.ErrAlreadyExists, fmt.Errorf("%v is already registered", kind)))
+	}
+	constructors[kind] = constructor
+	return nil
+}
+
+// MustRegister registers the constructor of a built-in provider, panicking on error as from an init function
+func MustRegister(kind gospal.ProviderLabel, constructor Constructor) {
+	if err := Register(string(kind), constructor); err != nil {
+		panic(err)
+	}
+}
+
+// Lookup returns the constructor of the kind of provider, if registered
+func Lookup(kind string) (Constructor, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	constructor, ok := constructors[kind]
+	return constructor, ok
+}
+
+// Kinds returns the sorted kinds of the registered providers
+func Kinds() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	kinds := make([]string, 0, len(constructors))
+	for kind := range constructors {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
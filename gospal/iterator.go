@@ -0,0 +1,40 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package gospal
+
+// ObjectIterator streams the objects of a listing. Objects are fetched from the provider one page at a time
+// (ProviderConfig.MaxKeys objects per page), the whole listing is never held in memory.
+//
+//   it := provider.Objects(ctx, "some/prefix")
+//   for it.Next() {
+//       fmt.Println(it.Object().Key)
+//   }
+//   if err := it.Err(); err != nil {
+//       // the listing stopped on error. resume it later on using provider.ObjectsFrom(ctx, "some/prefix", it.PageToken())
+//   }
+type ObjectIterator interface {
+	// Next advances the iterator to the next object. It returns false at the end of the listing or on error
+	Next() bool
+
+	// Object returns the current object. Only Key, Size, LastModified and ETag are filled in
+	Object() *ObjectInfo
+
+	// Err returns the error that stopped the iteration, if any
+	Err() error
+
+	// PageToken returns an opaque token of the page holding the current object. Given to ObjectsFrom it resumes the
+	// listing at the beginning of this page: at most one page of objects is listed twice when resuming.
+	PageToken() string
+}
@@ -0,0 +1,44 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package gospal
+
+import (
+	"strings"
+)
+
+// Keys given to and returned by the providers are relative to ProviderConfig.GlobalPrefix, which is handled as a
+// directory: with a global prefix set to "backups", the key "2020/01.tar" is stored as "backups/2020/01.tar" and
+// returned by ListKeys as "2020/01.tar". Keys returned by the providers can thus be fed straight back to them.
+
+// TargetKey returns the key, as stored by the provider, of the specified key relative to the global prefix
+func TargetKey(globalPrefix string, key string) string {
+	if globalPrefix == "" {
+		return key
+	}
+	globalPrefix = strings.TrimSuffix(globalPrefix, "/")
+	if key == "" {
+		return globalPrefix
+	}
+	return globalPrefix + "/" + strings.TrimPrefix(key, "/")
+}
+
+// RelativeKey returns the key relative to the global prefix of the specified key as stored by the provider, the
+// inverse of TargetKey
+func RelativeKey(globalPrefix string, targetKey string) string {
+	if globalPrefix == "" {
+		return targetKey
+	}
+	return strings.TrimPrefix(targetKey, strings.TrimSuffix(globalPrefix, "/")+"/")
+}
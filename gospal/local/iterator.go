@@ -0,0 +1,66 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package localprovider
+
+import (
+	"os"
+	"sort"
+)
+
+// default number of objects per page when ProviderConfig.MaxKeys is not set
+const defaultMaxKeys = 1024
+
+// fileSystem is the local file system walked by the iterators and written by the writers
+type fileSystem struct{}
+
+// Stat follows the symbolic links, the directory the walk starts from having been validated by keyPath. The bucket
+// directory itself may be one
+func (fileSystem) Stat(dir string) (os.FileInfo, error) {
+	return os.Stat(dir)
+}
+
+func (fileSystem) ReadDir(dir string) ([]os.FileInfo, error) {
+	return readDir(dir)
+}
+
+// readDir returns the entries of the directory sorted by name, the symbolic links not being followed
+func readDir(dir string) ([]os.FileInfo, error) {
+	fh, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := fh.Readdir(-1)
+	fh.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+// readDirNames returns the sorted names of the entries of the directory
+func readDirNames(dir string) ([]string, error) {
+	fh, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	names, err := fh.Readdirnames(-1)
+	fh.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
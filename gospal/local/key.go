@@ -0,0 +1,86 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package localprovider
+
+import (
+	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/internal/fsutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// rootPath returns the directory holding the keys, the global prefix is a sub directory of the local directory
+func (p *provider) rootPath() string {
+	return path.Join(p.directory, p.config.GlobalPrefix)
+}
+
+// keyPath returns the path of the file of the specified key. Keys are relative to the global prefix, a key resolving
+// outside of it, either by dot dot elements or through a symbolic link, is rejected by an *errors.InvalidKeyError
+func (p *provider) keyPath(key string) (string, error) {
+	if strings.IndexByte(key, 0) >= 0 {
+		return "", errors.ErrorInvalidKey(key, "contains a NUL byte")
+	}
+	root := p.rootPath()
+	filePath := path.Join(root, key)
+	if !fsutil.IsWithin(root, filePath) {
+		return "", errors.ErrorInvalidKey(key, "resolves outside of the directory")
+	}
+	// the root itself may be a symbolic link, only links found below it matter
+	realRoot, err := realPath(root)
+	if err != nil {
+		return "", toError(err)
+	}
+	realFilePath, err := realPath(filePath)
+	if err != nil {
+		return "", toError(err)
+	}
+	if !fsutil.IsWithin(realRoot, realFilePath) {
+		return "", errors.ErrorInvalidKey(key, "symbolic link resolving outside of the directory")
+	}
+	return filePath, nil
+}
+
+// toKey returns the key of the specified file path of the local directory, the inverse of keyPath
+func (p *provider) toKey(filePath string) string {
+	return fsutil.RelativePath(p.rootPath(), filePath)
+}
+
+// realPath resolves the symbolic links of the path. Its missing elements are kept as is, a file created at the path
+// would be created at the returned one
+func realPath(filePath string) (string, error) {
+	rest := ""
+	for current := filePath; ; current = path.Dir(current) {
+		resolved, err := filepath.EvalSymlinks(current)
+		if err == nil {
+			return path.Join(resolved, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		if target, err := os.Readlink(current); err == nil {
+			// a dangling symbolic link, writes would follow it
+			if !path.IsAbs(target) {
+				target = path.Join(path.Dir(current), target)
+			}
+			return realPath(path.Join(target, rest))
+		}
+		if current == path.Dir(current) {
+			return "", err
+		}
+		rest = path.Join(path.Base(current), rest)
+	}
+}
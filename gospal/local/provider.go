@@ -16,10 +16,15 @@ package localprovider
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"github.com/contentsquare/gospal/gospal"
 	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/internal/fsutil"
+	"github.com/contentsquare/gospal/gospal/internal/registry"
 	"io"
+	"math"
+	"mime"
 	"os"
 	"path"
 	"path/filepath"
@@ -34,7 +39,58 @@ type provider struct {
 	config               *gospal.ProviderConfig
 }
 
+// toError classifies a filesystem error as one of the gospal errors
+func toError(err error) error {
+	switch {
+	case stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded):
+		return errors.Wrap(errors.ErrCanceled, err)
+	case os.IsNotExist(err):
+		return errors.Wrap(errors.ErrNotExist, err)
+	case os.IsPermission(err):
+		return errors.Wrap(errors.ErrPermissionDenied, err)
+	case os.IsExist(err):
+		return errors.Wrap(errors.ErrAlreadyExists, err)
+	}
+	return err
+}
+
 func (p *provider) ListKeys(pathName ...string) ([]string, error) {
+	return p.ListKeysContext(p.context, pathName...)
+}
+
+// openFile opens the file of the key for reading. Directories are not keys, they are reported as not existing
+func (p *provider) openFile(fileName string) (*os.File, error) {
+	filePath, err := p.keyPath(fileName)
+	if err != nil {
+		return nil, err
+	}
+	fh, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := fh.Stat(); err != nil || info.IsDir() {
+		fh.Close()
+		if err == nil {
+			err = errors.Wrap(errors.ErrNotExist, fmt.Errorf("%v is a directory", fileName))
+		}
+		return nil, err
+	}
+	return fh, nil
+}
+
+// pruneDirs removes the directory then its parents as long as they are empty, up to the root directory which is
+// always kept. Just as object storages, there is no such thing as an empty directory
+func (p *provider) pruneDirs(dir string) {
+	root := path.Clean(p.directory)
+	for ; strings.HasPrefix(dir, root+"/"); dir = path.Dir(dir) {
+		// only empty directories can be removed
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+	}
+}
+
+func (p *provider) ListKeysContext(ctx context.Context, pathName ...string) ([]string, error) {
 	if len(pathName) > 1 {
 		return nil, errors.ErrorTooMuchListKeysArgs()
 	}
@@ -43,34 +99,193 @@ func (p *provider) ListKeys(pathName ...string) ([]string, error) {
 		extraPath = pathName[0]
 	}
 	var files []string
-	err := filepath.Walk(path.Join(p.directory, extraPath), func(filePath string, info os.FileInfo, err error) error {
-		if err == nil {
-			if !info.IsDir() {
-				files = append(files, strings.Replace(filePath, p.directory, "", 1))
-			}
+	it := p.Objects(ctx, extraPath)
+	for it.Next() {
+		files = append(files, it.Object().Key)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (p *provider) ListDir(prefix string) ([]string, []string, error) {
+	return p.ListDirContext(p.context, prefix)
+}
+
+func (p *provider) ListDirContext(ctx context.Context, prefix string) (keys []string, prefixes []string, err error) {
+	directory, err := p.keyPath(prefix)
+	if err != nil {
+		return nil, nil, errors.ErrorListDir(prefix, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, errors.ErrorListDir(directory, toError(err))
+	}
+	infos, err := readDir(directory)
+	if os.IsNotExist(err) {
+		// just as a prefix without any key in object storages
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, errors.ErrorListDir(directory, toError(err))
+	}
+	for _, info := range infos {
+		if fsutil.IsInternalFile(info.Name()) {
+			continue
+		}
+		if info.IsDir() {
+			// directories are returned the same way as object storages common prefixes, with the delimiter
+			prefixes = append(prefixes, p.toKey(path.Join(directory, info.Name()))+"/")
 		} else {
-			return err
+			keys = append(keys, p.toKey(path.Join(directory, info.Name())))
 		}
-		return nil
-	})
+	}
+	return keys, prefixes, nil
+}
+
+func (p *provider) Objects(ctx context.Context, prefix string) gospal.ObjectIterator {
+	return p.ObjectsFrom(ctx, prefix, "")
+}
+
+func (p *provider) ObjectsFrom(ctx context.Context, prefix string, pageToken string) gospal.ObjectIterator {
+	dir, base := path.Split(prefix)
+	root, err := p.keyPath(dir)
 	if err != nil {
-		return nil, err
+		return fsutil.FailedIterator(errors.ErrorListKeysError(prefix, err))
 	}
-	return files, nil
+	var resume string
+	if pageToken != "" {
+		if resume, err = p.keyPath(pageToken); err != nil {
+			return fsutil.FailedIterator(errors.ErrorListKeysError(prefix, err))
+		}
+	}
+	walk := fsutil.Walk{
+		Directory:  p.directory,
+		Root:       root,
+		Base:       base,
+		Resume:     resume,
+		PageSize:   defaultMaxKeys,
+		ToKey:      p.toKey,
+		ToError:    toError,
+		IsInternal: fsutil.IsInternalFile,
+	}
+	if p.config.MaxKeys > 0 {
+		walk.PageSize = int(p.config.MaxKeys)
+	}
+	return fsutil.NewIterator(ctx, fileSystem{}, walk, pageToken)
+}
+
+func (p *provider) PutStream(fileName string, reader io.Reader, opts ...gospal.PutOption) (int64, error) {
+	return p.PutStreamContext(p.context, fileName, reader, opts...)
+}
+
+func (p *provider) PutStreamContext(ctx context.Context, fileName string, reader io.Reader, opts ...gospal.PutOption) (int64, error) {
+	// the stream is written to a temporary file renamed on success, a failed put leaves any previous file untouched
+	writer, err := p.newFileWriter(ctx, fileName, opts...)
+	if err != nil {
+		return -1, err
+	}
+	written, err := io.Copy(writer, &fsutil.ContextReader{Ctx: ctx, Reader: reader})
+	if err != nil {
+		writer.Abort()
+		return -1, errors.ErrorPutStreamReader(writer.FilePath(), toError(err))
+	}
+	if err := writer.Close(); err != nil {
+		return -1, err
+	}
+	return written, nil
+}
+
+func (p *provider) Stat(fileName string) (*gospal.ObjectInfo, error) {
+	return p.StatContext(p.context, fileName)
 }
 
-func (p *provider) PutStream(fileName string, reader io.Reader) (int64, error) {
-	// create a file with the proper mode. Whenever a file exists with the same name we will overwrite it
-	fh, err := os.OpenFile(path.Join(p.directory, fileName), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
-	defer fh.Close()
+func (p *provider) StatContext(ctx context.Context, fileName string) (*gospal.ObjectInfo, error) {
+	filePath, err := p.keyPath(fileName)
 	if err != nil {
-		return -1, fmt.Errorf("unable to open file %v for writing. err=%v", path.Join(p.directory, fileName), err.Error())
+		return nil, errors.ErrorStat(fileName, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, errors.ErrorStat(filePath, toError(err))
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return nil, errors.ErrorStat(filePath, toError(err))
+	}
+	if info.IsDir() {
+		return nil, errors.ErrorStat(filePath, errors.Wrap(errors.ErrNotExist, fmt.Errorf("%v is a directory", fileName)))
 	}
-	written, err := io.Copy(fh, reader)
+	options, err := fsutil.ReadMetadata(fileSystem{}, filePath)
 	if err != nil {
-		return -1, fmt.Errorf("unable to write file %v. err=%v", path.Join(p.directory, fileName), err.Error())
+		return nil, errors.ErrorStat(filePath, toError(err))
 	}
-	return written, err
+	// the local filesystem does not store any etag. Unless set when putting the file, the content type is guessed
+	// from the file extension
+	if options.ContentType == "" {
+		options.ContentType = mime.TypeByExtension(filepath.Ext(fileName))
+	}
+	return &gospal.ObjectInfo{
+		Key:             fileName,
+		Size:            info.Size(),
+		LastModified:    info.ModTime(),
+		ContentType:     options.ContentType,
+		ContentEncoding: options.ContentEncoding,
+		CacheControl:    options.CacheControl,
+		Metadata:        options.Metadata,
+	}, nil
+}
+
+func (p *provider) Copy(src string, dst string) error {
+	return p.CopyContext(p.context, src, dst)
+}
+
+func (p *provider) CopyContext(ctx context.Context, src string, dst string) error {
+	// there is no such thing as a server side copy on a filesystem, the file is copied through the process
+	if err := gospal.StreamCopy(ctx, p, src, dst); err != nil {
+		return errors.ErrorCopyKey(src, dst, err)
+	}
+	return nil
+}
+
+func (p *provider) Move(src string, dst string) error {
+	return p.MoveContext(p.context, src, dst)
+}
+
+func (p *provider) MoveContext(ctx context.Context, src string, dst string) error {
+	srcPath, err := p.keyPath(src)
+	if err != nil {
+		return errors.ErrorMoveKey(src, dst, err)
+	}
+	dstPath, err := p.keyPath(dst)
+	if err != nil {
+		return errors.ErrorMoveKey(src, dst, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return errors.ErrorMoveKey(srcPath, dstPath, toError(err))
+	}
+	// only files are keys, directories should not be moved around
+	if info, err := os.Stat(srcPath); err != nil || info.IsDir() {
+		if err == nil {
+			err = errors.Wrap(errors.ErrNotExist, fmt.Errorf("%v is a directory", src))
+		}
+		return errors.ErrorMoveKey(srcPath, dstPath, toError(err))
+	}
+	if err := os.MkdirAll(path.Dir(dstPath), 0700); err != nil {
+		return errors.ErrorMoveKey(srcPath, dstPath, toError(err))
+	}
+	if err := os.Rename(srcPath, dstPath); err != nil {
+		return errors.ErrorMoveKey(srcPath, dstPath, toError(err))
+	}
+	// the attributes of the object follow it
+	err = os.Rename(fsutil.MetadataPath(srcPath), fsutil.MetadataPath(dstPath))
+	if os.IsNotExist(err) {
+		err = fsutil.RemoveMetadata(fileSystem{}, dstPath)
+	}
+	if err != nil {
+		return errors.ErrorMoveKey(srcPath, dstPath, toError(err))
+	}
+	p.pruneDirs(path.Dir(srcPath))
+	return nil
 }
 
 func (p *provider) GetKind() string {
@@ -78,36 +293,171 @@ func (p *provider) GetKind() string {
 }
 
 func (p *provider) DeleteKey(fileName string) error {
-	// check if key exists
-	_, err := os.Stat(path.Join(p.directory, fileName))
+	return p.DeleteKeyContext(p.context, fileName)
+}
+
+func (p *provider) DeleteKeyContext(ctx context.Context, fileName string) error {
+	filePath, err := p.keyPath(fileName)
 	if err != nil {
-		return errors.ErrorDeleteKey(path.Join(p.directory, fileName), err.Error())
+		return errors.ErrorDeleteKey(fileName, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return errors.ErrorDeleteKey(filePath, toError(err))
+	}
+	// check if key exists, directories are not keys
+	info, err := os.Stat(filePath)
+	if err == nil && info.IsDir() {
+		err = errors.Wrap(errors.ErrNotExist, fmt.Errorf("%v is a directory", fileName))
 	}
-	err = os.Remove(path.Join(p.directory, fileName))
 	if err != nil {
-		return errors.ErrorDeleteKey(path.Join(p.directory, fileName), err.Error())
+		return errors.ErrorDeleteKey(filePath, toError(err))
+	}
+	err = os.Remove(filePath)
+	if err != nil {
+		return errors.ErrorDeleteKey(filePath, toError(err))
+	}
+	if err := fsutil.RemoveMetadata(fileSystem{}, filePath); err != nil {
+		return errors.ErrorDeleteKey(filePath, toError(err))
 	}
+	p.pruneDirs(path.Dir(filePath))
 	return nil
 }
 
+func (p *provider) DeleteKeys(fileNames []string) error {
+	return p.DeleteKeysContext(p.context, fileNames)
+}
+
+func (p *provider) DeleteKeysContext(ctx context.Context, fileNames []string) error {
+	failures := map[string]error{}
+	for _, fileName := range fileNames {
+		if err := p.DeleteKeyContext(ctx, fileName); err != nil {
+			failures[fileName] = err
+		}
+	}
+	return errors.ErrorDeleteKeys(failures)
+}
+
+func (p *provider) DeletePrefix(prefix string) error {
+	return p.DeletePrefixContext(p.context, prefix)
+}
+
+func (p *provider) DeletePrefixContext(ctx context.Context, prefix string) error {
+	// a prefix may stop in the middle of a file name, every entry of its directory starting like it is removed
+	dir, base := path.Split(prefix)
+	dirPath, err := p.keyPath(dir)
+	if err != nil {
+		return errors.ErrorDeleteKey(prefix, err)
+	}
+	names, err := readDirNames(dirPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.ErrorDeleteKey(path.Join(dirPath, base), toError(err))
+	}
+	failures := map[string]error{}
+	for _, name := range names {
+		// sidecars are removed along with their file, temporary files belong to pending writers
+		if !strings.HasPrefix(name, base) || fsutil.IsInternalFile(name) {
+			continue
+		}
+		// the entries are right under the validated directory, RemoveAll does not follow symbolic links
+		filePath := path.Join(dirPath, name)
+		if err := ctx.Err(); err != nil {
+			failures[path.Join(dir, name)] = errors.ErrorDeleteKey(filePath, toError(err))
+			continue
+		}
+		if err := os.RemoveAll(filePath); err != nil {
+			failures[path.Join(dir, name)] = errors.ErrorDeleteKey(filePath, toError(err))
+			continue
+		}
+		if err := fsutil.RemoveMetadata(fileSystem{}, filePath); err != nil {
+			failures[path.Join(dir, name)] = errors.ErrorDeleteKey(filePath, toError(err))
+		}
+	}
+	p.pruneDirs(dirPath)
+	return errors.ErrorDeleteKeys(failures)
+}
+
 func (p *provider) GetNoSuchKeyErrorString() string {
 	return p.noSuchKeyErrorString
 }
 
 func (p *provider) GetStream(filePath string) (io.Reader, context.CancelFunc, error) {
-	// the context will be useless here, let's just create a cancel func for match the method signature in the interface
-	_, cancel := context.WithCancel(p.context)
+	return p.GetStreamContext(p.context, filePath)
+}
+
+func (p *provider) GetStreamContext(ctx context.Context, filePath string) (io.Reader, context.CancelFunc, error) {
+	return gospal.ToStream(p.NewReader(ctx, filePath))
+}
+
+func (p *provider) NewReader(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.ErrorGetStreamReader(filePath, toError(err))
+	}
 	// fetch the specified file from the local filesystem
-	fh, err := os.Open(path.Join(p.directory, filePath))
+	fh, err := p.openFile(filePath)
 
 	// if the file does not exists, then and error should be raised
 	if err != nil {
-		defer cancel()
-		return nil, nil, fmt.Errorf("could not open file %v. err=%v", filePath, err.Error())
+		return nil, errors.ErrorGetStreamReader(filePath, toError(err))
+	}
+
+	// reads on the returned stream stop as soon as the context is either done or canceled
+	ctx, cancel := context.WithCancel(ctx)
+	// *File implements the interface io.Reader, wrap it for the reads to honour the context
+	return gospal.NewReadCloser(&fsutil.ContextReader{Ctx: ctx, Reader: fh}, fh, cancel), nil
+}
+
+func (p *provider) GetRange(filePath string, offset int64, length int64) (io.Reader, context.CancelFunc, error) {
+	return p.GetRangeContext(p.context, filePath, offset, length)
+}
+
+func (p *provider) GetRangeContext(ctx context.Context, filePath string, offset int64, length int64) (io.Reader, context.CancelFunc, error) {
+	if err := ctx.Err(); err != nil {
+		return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, filePath, toError(err)))
 	}
+	fh, err := p.openFile(filePath)
+	if err != nil {
+		return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, filePath, toError(err)))
+	}
+	var reader io.Reader = io.NewSectionReader(fh, offset, math.MaxInt64-offset)
+	if length >= 0 {
+		reader = io.NewSectionReader(fh, offset, length)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return gospal.ToStream(gospal.NewReadCloser(&fsutil.ContextReader{Ctx: ctx, Reader: reader}, fh, cancel), nil)
+}
+
+// fileReader is the ObjectReader of a local file, *os.File already implements both io.ReadSeeker and io.ReaderAt
+type fileReader struct {
+	*os.File
+	size int64
+}
+
+func (f *fileReader) Size() int64 {
+	return f.size
+}
+
+func (p *provider) Open(filePath string) (gospal.ObjectReader, error) {
+	return p.OpenContext(p.context, filePath)
+}
+
+func (p *provider) OpenContext(ctx context.Context, filePath string) (gospal.ObjectReader, error) {
+	info, err := p.StatContext(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	fh, err := p.openFile(filePath)
+	if err != nil {
+		return nil, errors.ErrorGetStreamReader(filePath, toError(err))
+	}
+	return &fileReader{File: fh, size: info.Size}, nil
+}
 
-	// we may safely return a io.Reader from the file handler. *File implements the interface io.Reader
-	return fh, cancel, nil
+// the provider is available from the factory as soon as its package is imported
+func init() {
+	registry.MustRegister(gospal.ProviderLocal, New)
 }
 
 //New aws provider constructor
@@ -116,7 +466,7 @@ func New(ctx context.Context, bucket string, config *gospal.ProviderConfig) (gos
 	// check to directory to exists
 	if _, err := os.Stat(bucket); os.IsNotExist(err) {
 		if err2 := os.MkdirAll(bucket, 0700); err2 != nil {
-			return nil, fmt.Errorf("unable to create local directory %v. err=%v", bucket, err.Error())
+			return nil, fmt.Errorf("unable to create local directory %v. err=%w", bucket, err2)
 		}
 	}
 	provider.noSuchKeyErrorString = os.ErrNotExist.Error()
@@ -17,7 +17,10 @@ package localprovider
 import (
 	"bytes"
 	"context"
+	stderrors "errors"
 	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/gospaltest"
 	"io"
 	"io/ioutil"
 	"os"
@@ -25,6 +28,7 @@ import (
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -360,7 +364,7 @@ func Test_provider_ListKeys(t *testing.T) {
 			args: args{
 				pathName: nil,
 			},
-			want:    []string{"/file1.txt", "/file2.txt", "/file3.txt", "/otherpath/file4.txt"},
+			want:    []string{"file1.txt", "file2.txt", "file3.txt", "otherpath/file4.txt"},
 			wantErr: false,
 		},
 		{
@@ -468,3 +472,1335 @@ func Test_provider_PutStream(t *testing.T) {
 		})
 	}
 }
+
+func Test_provider_Stat(t *testing.T) {
+
+	tmpFile, err := ioutil.TempFile(os.TempDir(), "gospalTests*.json")
+	if err != nil {
+		t.Errorf("unable to create temporary file for tests. err=%v", err.Error())
+		return
+	}
+	tmpFile.WriteString("bladibla some content")
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	type fields struct {
+		context              context.Context
+		kind                 string
+		directory            string
+		noSuchKeyErrorString string
+		config               *gospal.ProviderConfig
+	}
+	type args struct {
+		filePath string
+	}
+	tests := []struct {
+		name            string
+		fields          fields
+		args            args
+		wantSize        int64
+		wantContentType string
+		wantErr         bool
+	}{
+		{
+			name: "Should return the file attributes",
+			fields: fields{
+				context:              context.Background(),
+				kind:                 "local",
+				directory:            os.TempDir(),
+				noSuchKeyErrorString: os.ErrNotExist.Error(),
+				config:               &gospal.ProviderConfig{},
+			},
+			args: args{
+				filePath: path.Base(tmpFile.Name()),
+			},
+			wantSize:        int64(len("bladibla some content")),
+			wantContentType: "application/json",
+			wantErr:         false,
+		},
+		{
+			name: "Should raise for non exising file",
+			fields: fields{
+				context:              context.Background(),
+				kind:                 "local",
+				directory:            os.TempDir(),
+				noSuchKeyErrorString: os.ErrNotExist.Error(),
+				config:               &gospal.ProviderConfig{},
+			},
+			args: args{
+				filePath: "bladibla_no_such_file",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &provider{
+				context:              tt.fields.context,
+				kind:                 tt.fields.kind,
+				directory:            tt.fields.directory,
+				noSuchKeyErrorString: tt.fields.noSuchKeyErrorString,
+				config:               tt.fields.config,
+			}
+			got, err := p.Stat(tt.args.filePath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Stat() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil && !stderrors.Is(err, errors.ErrNotExist) {
+				t.Errorf("Stat() error = %v, should be %v", err, errors.ErrNotExist)
+			}
+			if err == nil {
+				if got.Size != tt.wantSize {
+					t.Errorf("Stat() got size = %v, want %v", got.Size, tt.wantSize)
+				}
+				if got.ContentType != tt.wantContentType {
+					t.Errorf("Stat() got content type = %v, want %v", got.ContentType, tt.wantContentType)
+				}
+			}
+		})
+	}
+}
+
+func Test_provider_GetStreamContext(t *testing.T) {
+
+	tmpFile, err := ioutil.TempFile(os.TempDir(), "gospalTests")
+	if err != nil {
+		t.Errorf("unable to create temporary file for tests. err=%v", err.Error())
+		return
+	}
+	tmpFile.WriteString("bladibla some content")
+	tmpFile.Close()
+	defer os.Remove(tmpFile.Name())
+
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	p := &provider{
+		context:              context.Background(),
+		kind:                 "local",
+		directory:            os.TempDir(),
+		noSuchKeyErrorString: os.ErrNotExist.Error(),
+		config:               &gospal.ProviderConfig{},
+	}
+
+	type args struct {
+		ctx      context.Context
+		filePath string
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "Should return the proper stream",
+			args: args{
+				ctx:      context.Background(),
+				filePath: path.Base(tmpFile.Name()),
+			},
+			want:    "bladibla some content",
+			wantErr: false,
+		},
+		{
+			name: "Should raise with a canceled context",
+			args: args{
+				ctx:      canceledCtx,
+				filePath: path.Base(tmpFile.Name()),
+			},
+			want:    "",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, cancel, err := p.GetStreamContext(tt.args.ctx, tt.args.filePath)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetStreamContext() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err == nil {
+				defer cancel()
+				var bb bytes.Buffer
+				io.Copy(&bb, got)
+				if bb.String() != tt.want {
+					t.Errorf("GetStreamContext() got = %v, want %v", bb.String(), tt.want)
+				}
+				// once canceled, the stream should not be readable anymore
+				cancel()
+				if _, err := got.Read(make([]byte, 1)); err != context.Canceled {
+					t.Errorf("GetStreamContext() read after cancel error = %v, want %v", err, context.Canceled)
+				}
+			}
+		})
+	}
+}
+
+func Test_toError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantKind error
+	}{
+		{
+			name:     "Should classify missing files as not exist",
+			err:      &os.PathError{Op: "open", Path: "/bladibla", Err: os.ErrNotExist},
+			wantKind: errors.ErrNotExist,
+		},
+		{
+			name:     "Should classify permission errors as permission denied",
+			err:      &os.PathError{Op: "open", Path: "/bladibla", Err: os.ErrPermission},
+			wantKind: errors.ErrPermissionDenied,
+		},
+		{
+			name:     "Should classify existing files as already exists",
+			err:      &os.PathError{Op: "open", Path: "/bladibla", Err: os.ErrExist},
+			wantKind: errors.ErrAlreadyExists,
+		},
+		{
+			name:     "Should classify canceled contexts as canceled",
+			err:      context.Canceled,
+			wantKind: errors.ErrCanceled,
+		},
+	}
+	kinds := []error{errors.ErrNotExist, errors.ErrPermissionDenied, errors.ErrAlreadyExists, errors.ErrPreconditionFailed, errors.ErrCanceled}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := toError(tt.err)
+			for _, kind := range kinds {
+				if stderrors.Is(got, kind) != (kind == tt.wantKind) {
+					t.Errorf("toError() = %v, is %v: %v, want %v", got, kind, stderrors.Is(got, kind), tt.wantKind)
+				}
+			}
+			if !stderrors.Is(got, tt.err) {
+				t.Errorf("toError() = %v should unwrap to the original error", got)
+			}
+		})
+	}
+}
+
+func Test_provider_ObjectsFrom(t *testing.T) {
+
+	tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+	if err != nil {
+		t.Errorf("unable to create temporary directory for tests. err=%v", err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDirectory)
+	files := []string{"a.txt", "b/c.txt", "b/d/e.txt", "b/f.txt", "g.txt"}
+	for _, file := range files {
+		if err := os.MkdirAll(path.Dir(path.Join(tmpDirectory, file)), 0700); err != nil {
+			t.Errorf("unable to create directory for %v. err=%v", file, err.Error())
+			return
+		}
+		if err := ioutil.WriteFile(path.Join(tmpDirectory, file), []byte(file), 0600); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", file, err.Error())
+			return
+		}
+	}
+	keys := []string{"a.txt", "b/c.txt", "b/d/e.txt", "b/f.txt", "g.txt"}
+
+	p := &provider{
+		context:              context.Background(),
+		kind:                 "local",
+		directory:            tmpDirectory,
+		noSuchKeyErrorString: os.ErrNotExist.Error(),
+		config:               &gospal.ProviderConfig{MaxKeys: 2},
+	}
+
+	tests := []struct {
+		name       string
+		stopAfter  int
+		wantResume []string
+	}{
+		{
+			name:       "Should resume from the first page",
+			stopAfter:  2,
+			wantResume: keys,
+		},
+		{
+			name:       "Should resume from the beginning of the current page",
+			stopAfter:  3,
+			wantResume: keys[2:],
+		},
+		{
+			name:       "Should resume within nested directories",
+			stopAfter:  4,
+			wantResume: keys[2:],
+		},
+		{
+			name:       "Should resume from the last page",
+			stopAfter:  5,
+			wantResume: keys[4:],
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it := p.Objects(context.Background(), "")
+			var got []string
+			for len(got) < tt.stopAfter && it.Next() {
+				got = append(got, it.Object().Key)
+			}
+			if err := it.Err(); err != nil {
+				t.Errorf("Objects() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, keys[:tt.stopAfter]) {
+				t.Errorf("Objects() got = %v, want %v", got, keys[:tt.stopAfter])
+			}
+			resumed := p.ObjectsFrom(context.Background(), "", it.PageToken())
+			var gotResume []string
+			for resumed.Next() {
+				gotResume = append(gotResume, resumed.Object().Key)
+			}
+			if err := resumed.Err(); err != nil {
+				t.Errorf("ObjectsFrom() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(gotResume, tt.wantResume) {
+				t.Errorf("ObjectsFrom() got = %v, want %v", gotResume, tt.wantResume)
+			}
+		})
+	}
+}
+
+func Test_provider_ObjectsPrefix(t *testing.T) {
+
+	tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+	if err != nil {
+		t.Errorf("unable to create temporary directory for tests. err=%v", err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDirectory)
+	for _, file := range []string{"a.txt", "b/c.txt", "b/d/e.txt", "bc.txt", "g.txt"} {
+		if err := os.MkdirAll(path.Dir(path.Join(tmpDirectory, file)), 0700); err != nil {
+			t.Errorf("unable to create directory for %v. err=%v", file, err.Error())
+			return
+		}
+		if err := ioutil.WriteFile(path.Join(tmpDirectory, file), []byte(file), 0600); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", file, err.Error())
+			return
+		}
+	}
+
+	p := &provider{
+		context:              context.Background(),
+		kind:                 "local",
+		directory:            tmpDirectory,
+		noSuchKeyErrorString: os.ErrNotExist.Error(),
+		config:               &gospal.ProviderConfig{},
+	}
+
+	// just as object storages, the prefixes are not limited to directories
+	tests := []struct {
+		name     string
+		prefix   string
+		wantKeys []string
+	}{
+		{
+			name:     "Should list a directory",
+			prefix:   "b/",
+			wantKeys: []string{"b/c.txt", "b/d/e.txt"},
+		},
+		{
+			name:     "Should list a prefix stopping in the middle of a name",
+			prefix:   "b",
+			wantKeys: []string{"b/c.txt", "b/d/e.txt", "bc.txt"},
+		},
+		{
+			name:     "Should list a prefix stopping in the middle of a nested name",
+			prefix:   "b/d",
+			wantKeys: []string{"b/d/e.txt"},
+		},
+		{
+			name:     "Should list a key as a prefix",
+			prefix:   "a.txt",
+			wantKeys: []string{"a.txt"},
+		},
+		{
+			name:     "Should return nothing for a prefix going through a file",
+			prefix:   "a.txt/b",
+			wantKeys: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			it := p.Objects(context.Background(), tt.prefix)
+			var got []string
+			for it.Next() {
+				got = append(got, it.Object().Key)
+			}
+			if err := it.Err(); err != nil {
+				t.Errorf("Objects() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.wantKeys) {
+				t.Errorf("Objects() got = %v, want %v", got, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func Test_provider_ListDir(t *testing.T) {
+
+	tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+	if err != nil {
+		t.Errorf("unable to create temporary directory for tests. err=%v", err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDirectory)
+	for _, file := range []string{"a.txt", "b/c.txt", "b/d/e.txt", "f/g.txt", "h.txt"} {
+		if err := os.MkdirAll(path.Dir(path.Join(tmpDirectory, file)), 0700); err != nil {
+			t.Errorf("unable to create directory for %v. err=%v", file, err.Error())
+			return
+		}
+		if err := ioutil.WriteFile(path.Join(tmpDirectory, file), []byte(file), 0600); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", file, err.Error())
+			return
+		}
+	}
+
+	p := &provider{
+		context:              context.Background(),
+		kind:                 "local",
+		directory:            tmpDirectory,
+		noSuchKeyErrorString: os.ErrNotExist.Error(),
+		config:               &gospal.ProviderConfig{},
+	}
+
+	tests := []struct {
+		name         string
+		prefix       string
+		wantKeys     []string
+		wantPrefixes []string
+		wantErr      bool
+	}{
+		{
+			name:         "Should list keys and sub directories",
+			prefix:       "",
+			wantKeys:     []string{"a.txt", "h.txt"},
+			wantPrefixes: []string{"b/", "f/"},
+			wantErr:      false,
+		},
+		{
+			name:         "Should list a sub directory",
+			prefix:       "b/",
+			wantKeys:     []string{"b/c.txt"},
+			wantPrefixes: []string{"b/d/"},
+			wantErr:      false,
+		},
+		{
+			name:         "Should return nothing for an unknown directory",
+			prefix:       "bladibla",
+			wantKeys:     nil,
+			wantPrefixes: nil,
+			wantErr:      false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotKeys, gotPrefixes, err := p.ListDir(tt.prefix)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ListDir() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if !reflect.DeepEqual(gotKeys, tt.wantKeys) {
+				t.Errorf("ListDir() gotKeys = %v, want %v", gotKeys, tt.wantKeys)
+			}
+			if !reflect.DeepEqual(gotPrefixes, tt.wantPrefixes) {
+				t.Errorf("ListDir() gotPrefixes = %v, want %v", gotPrefixes, tt.wantPrefixes)
+			}
+		})
+	}
+}
+
+func Test_provider_Copy(t *testing.T) {
+
+	tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+	if err != nil {
+		t.Errorf("unable to create temporary directory for tests. err=%v", err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDirectory)
+	for _, file := range []string{"a.txt", "b.txt"} {
+		if err := ioutil.WriteFile(path.Join(tmpDirectory, file), []byte("content of "+file), 0600); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", file, err.Error())
+			return
+		}
+	}
+	if err := os.Mkdir(path.Join(tmpDirectory, "directory"), 0700); err != nil {
+		t.Errorf("unable to create directory for tests. err=%v", err.Error())
+		return
+	}
+
+	p := &provider{
+		context:              context.Background(),
+		kind:                 "local",
+		directory:            tmpDirectory,
+		noSuchKeyErrorString: os.ErrNotExist.Error(),
+		config:               &gospal.ProviderConfig{},
+	}
+
+	type args struct {
+		src string
+		dst string
+	}
+	tests := []struct {
+		name    string
+		move    bool
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name: "Should copy the key",
+			args: args{
+				src: "a.txt",
+				dst: "a_copy.txt",
+			},
+			want:    "content of a.txt",
+			wantErr: false,
+		},
+		{
+			name: "Should move the key",
+			move: true,
+			args: args{
+				src: "b.txt",
+				dst: "b_moved.txt",
+			},
+			want:    "content of b.txt",
+			wantErr: false,
+		},
+		{
+			name: "Should raise with unknown key",
+			args: args{
+				src: "bladibla.txt",
+				dst: "bladibla_copy.txt",
+			},
+			wantErr: true,
+		},
+		{
+			name: "Should not move directories",
+			move: true,
+			args: args{
+				src: "directory",
+				dst: "directory_moved",
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			if tt.move {
+				err = p.Move(tt.args.src, tt.args.dst)
+			} else {
+				err = p.Copy(tt.args.src, tt.args.dst)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Copy() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				if !stderrors.Is(err, errors.ErrNotExist) {
+					t.Errorf("Copy() error = %v, should be %v", err, errors.ErrNotExist)
+				}
+				return
+			}
+			data, err := ioutil.ReadFile(path.Join(tmpDirectory, tt.args.dst))
+			if err != nil {
+				t.Errorf("Copy() destination not found. err=%v", err.Error())
+				return
+			}
+			if string(data) != tt.want {
+				t.Errorf("Copy() got = %v, want %v", string(data), tt.want)
+			}
+			if _, err := os.Stat(path.Join(tmpDirectory, tt.args.src)); (err != nil) != tt.move {
+				t.Errorf("Copy() source exists = %v, want %v", err == nil, !tt.move)
+			}
+		})
+	}
+}
+
+func Test_provider_DeleteKeys(t *testing.T) {
+
+	tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+	if err != nil {
+		t.Errorf("unable to create temporary directory for tests. err=%v", err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDirectory)
+	for _, file := range []string{"a.txt", "b.txt", "dir/c.txt", "dir/d/e.txt", "directory.txt", "other/f.txt"} {
+		if err := os.MkdirAll(path.Dir(path.Join(tmpDirectory, file)), 0700); err != nil {
+			t.Errorf("unable to create directory for %v. err=%v", file, err.Error())
+			return
+		}
+		if err := ioutil.WriteFile(path.Join(tmpDirectory, file), []byte(file), 0600); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", file, err.Error())
+			return
+		}
+	}
+
+	p := &provider{
+		context:              context.Background(),
+		kind:                 "local",
+		directory:            tmpDirectory,
+		noSuchKeyErrorString: os.ErrNotExist.Error(),
+		config:               &gospal.ProviderConfig{},
+	}
+
+	tests := []struct {
+		name       string
+		keys       []string
+		prefix     string
+		wantKeys   []string
+		wantFailed []string
+	}{
+		{
+			name:       "Should delete the keys and report the failures",
+			keys:       []string{"a.txt", "bladibla.txt", "b.txt"},
+			wantKeys:   []string{"dir/c.txt", "dir/d/e.txt", "directory.txt", "other/f.txt"},
+			wantFailed: []string{"bladibla.txt"},
+		},
+		{
+			name:     "Should delete the directory under the prefix",
+			prefix:   "dir/",
+			wantKeys: []string{"directory.txt", "other/f.txt"},
+		},
+		{
+			name:     "Should delete the keys starting with the prefix",
+			prefix:   "dir",
+			wantKeys: []string{"other/f.txt"},
+		},
+		{
+			name:     "Should do nothing on an unknown prefix",
+			prefix:   "bladibla/",
+			wantKeys: []string{"other/f.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.keys != nil {
+				err = p.DeleteKeys(tt.keys)
+			} else {
+				err = p.DeletePrefix(tt.prefix)
+			}
+			if (err != nil) != (tt.wantFailed != nil) {
+				t.Errorf("DeleteKeys() error = %v, wantFailed %v", err, tt.wantFailed)
+				return
+			}
+			if err != nil {
+				var deleteErr *errors.DeleteKeysError
+				if !stderrors.As(err, &deleteErr) {
+					t.Errorf("DeleteKeys() error = %v, should be a DeleteKeysError", err)
+					return
+				}
+				if !reflect.DeepEqual(deleteErr.Keys(), tt.wantFailed) {
+					t.Errorf("DeleteKeys() failed keys = %v, want %v", deleteErr.Keys(), tt.wantFailed)
+				}
+			}
+			got, err := p.ListKeys()
+			if err != nil {
+				t.Errorf("ListKeys() error = %v", err)
+				return
+			}
+			if !reflect.DeepEqual(got, tt.wantKeys) {
+				t.Errorf("DeleteKeys() remaining keys = %v, want %v", got, tt.wantKeys)
+			}
+		})
+	}
+}
+
+func Test_provider_GetRange(t *testing.T) {
+
+	tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+	if err != nil {
+		t.Errorf("unable to create temporary directory for tests. err=%v", err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDirectory)
+	content := "Some cool contents. with more useless chars %^&*()"
+	if err := ioutil.WriteFile(path.Join(tmpDirectory, "a.txt"), []byte(content), 0600); err != nil {
+		t.Errorf("unable to create a.txt for tests. err=%v", err.Error())
+		return
+	}
+
+	p := &provider{
+		context:              context.Background(),
+		kind:                 "local",
+		directory:            tmpDirectory,
+		noSuchKeyErrorString: os.ErrNotExist.Error(),
+		config:               &gospal.ProviderConfig{},
+	}
+
+	type args struct {
+		key    string
+		offset int64
+		length int64
+	}
+	tests := []struct {
+		name    string
+		args    args
+		want    string
+		wantErr bool
+	}{
+		{
+			name:    "Should fetch the range",
+			args:    args{key: "a.txt", offset: 5, length: 4},
+			want:    content[5:9],
+			wantErr: false,
+		},
+		{
+			name:    "Should fetch up to the end",
+			args:    args{key: "a.txt", offset: 20, length: -1},
+			want:    content[20:],
+			wantErr: false,
+		},
+		{
+			name:    "Should stop at the end",
+			args:    args{key: "a.txt", offset: 40, length: 100},
+			want:    content[40:],
+			wantErr: false,
+		},
+		{
+			name:    "Should raise with unknown key",
+			args:    args{key: "bladibla.txt", offset: 5, length: 4},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, cancel, err := p.GetRange(tt.args.key, tt.args.offset, tt.args.length)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetRange() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if err != nil {
+				if !stderrors.Is(err, errors.ErrNotExist) {
+					t.Errorf("GetRange() error = %v, should be %v", err, errors.ErrNotExist)
+				}
+				return
+			}
+			defer cancel()
+			if data, _ := ioutil.ReadAll(got); string(data) != tt.want {
+				t.Errorf("GetRange() got = %v, want %v", string(data), tt.want)
+			}
+		})
+	}
+}
+
+func Test_provider_Open(t *testing.T) {
+
+	tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+	if err != nil {
+		t.Errorf("unable to create temporary directory for tests. err=%v", err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDirectory)
+	content := "Some cool contents. with more useless chars %^&*()"
+	if err := ioutil.WriteFile(path.Join(tmpDirectory, "a.txt"), []byte(content), 0600); err != nil {
+		t.Errorf("unable to create a.txt for tests. err=%v", err.Error())
+		return
+	}
+
+	p := &provider{
+		context:              context.Background(),
+		kind:                 "local",
+		directory:            tmpDirectory,
+		noSuchKeyErrorString: os.ErrNotExist.Error(),
+		config:               &gospal.ProviderConfig{},
+	}
+
+	if _, err := p.Open("bladibla.txt"); !stderrors.Is(err, errors.ErrNotExist) {
+		t.Errorf("Open() error = %v, should be %v", err, errors.ErrNotExist)
+	}
+
+	reader, err := p.Open("a.txt")
+	if err != nil {
+		t.Errorf("Open() error = %v", err)
+		return
+	}
+	defer reader.Close()
+	if reader.Size() != int64(len(content)) {
+		t.Errorf("Open() size = %v, want %v", reader.Size(), len(content))
+	}
+	buf := make([]byte, 4)
+	if n, err := reader.ReadAt(buf, 10); n != 4 || err != nil || string(buf) != content[10:14] {
+		t.Errorf("ReadAt() got = %v, %v, want %v", string(buf[:n]), err, content[10:14])
+	}
+	if _, err := reader.Seek(-6, io.SeekEnd); err != nil {
+		t.Errorf("Seek() error = %v", err)
+	}
+	if data, _ := ioutil.ReadAll(reader); string(data) != content[len(content)-6:] {
+		t.Errorf("Read() got = %v, want %v", string(data), content[len(content)-6:])
+	}
+}
+
+func Test_provider_PutStreamOptions(t *testing.T) {
+
+	tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+	if err != nil {
+		t.Errorf("unable to create temporary directory for tests. err=%v", err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDirectory)
+
+	p := &provider{
+		context:              context.Background(),
+		kind:                 "local",
+		directory:            tmpDirectory,
+		noSuchKeyErrorString: os.ErrNotExist.Error(),
+		config:               &gospal.ProviderConfig{},
+	}
+
+	want := &gospal.ObjectInfo{
+		Key:             "moved.bin",
+		ContentType:     "application/json",
+		ContentEncoding: "gzip",
+		CacheControl:    "no-cache",
+		Metadata:        map[string]string{"owner": "bladibla"},
+	}
+	if _, err := p.PutStream("options.bin", strings.NewReader("{}"),
+		gospal.WithContentType(want.ContentType),
+		gospal.WithContentEncoding(want.ContentEncoding),
+		gospal.WithCacheControl(want.CacheControl),
+		gospal.WithMetadata(want.Metadata),
+	); err != nil {
+		t.Errorf("PutStream() error = %v", err)
+		return
+	}
+	// the attributes should follow the object
+	if err := p.Move("options.bin", "moved.bin"); err != nil {
+		t.Errorf("Move() error = %v", err)
+		return
+	}
+	got, err := p.Stat("moved.bin")
+	if err != nil {
+		t.Errorf("Stat() error = %v", err)
+		return
+	}
+	got.Size, got.LastModified = 0, time.Time{}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Stat() got = %+v, want %+v", got, want)
+	}
+	// the sidecar should not be listed
+	if keys, err := p.ListKeys(); err != nil || !reflect.DeepEqual(keys, []string{"moved.bin"}) {
+		t.Errorf("ListKeys() got = %v, %v, want %v", keys, err, []string{"moved.bin"})
+	}
+	// putting the object again without options should reset them
+	if _, err := p.PutStream("moved.bin", strings.NewReader("{}")); err != nil {
+		t.Errorf("PutStream() error = %v", err)
+		return
+	}
+	if got, err := p.Stat("moved.bin"); err != nil || got.ContentType == want.ContentType || got.Metadata != nil {
+		t.Errorf("Stat() got = %+v, %v, want no attributes", got, err)
+	}
+	if err := p.DeleteKey("moved.bin"); err != nil {
+		t.Errorf("DeleteKey() error = %v", err)
+	}
+	if names, _ := readDirNames(tmpDirectory); len(names) != 0 {
+		t.Errorf("DeleteKey() left %v", names)
+	}
+}
+
+func Test_provider_NewReader(t *testing.T) {
+
+	tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+	if err != nil {
+		t.Errorf("unable to create temporary directory for tests. err=%v", err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDirectory)
+	if err := ioutil.WriteFile(path.Join(tmpDirectory, "a.txt"), []byte("content of a.txt"), 0600); err != nil {
+		t.Errorf("unable to create a.txt for tests. err=%v", err.Error())
+		return
+	}
+
+	p := &provider{
+		context:              context.Background(),
+		kind:                 "local",
+		directory:            tmpDirectory,
+		noSuchKeyErrorString: os.ErrNotExist.Error(),
+		config:               &gospal.ProviderConfig{},
+	}
+
+	if _, err := p.NewReader(context.Background(), "bladibla.txt"); !stderrors.Is(err, errors.ErrNotExist) {
+		t.Errorf("NewReader() error = %v, should be %v", err, errors.ErrNotExist)
+	}
+	// the compatibility shim should never return a nil cancel function
+	if _, cancel, err := p.GetStream("bladibla.txt"); err == nil || cancel == nil {
+		t.Errorf("GetStream() error = %v, cancel should not be nil", err)
+	} else {
+		cancel()
+	}
+
+	reader, err := p.NewReader(context.Background(), "a.txt")
+	if err != nil {
+		t.Errorf("NewReader() error = %v", err)
+		return
+	}
+	if data, _ := ioutil.ReadAll(reader); string(data) != "content of a.txt" {
+		t.Errorf("NewReader() got = %v, want %v", string(data), "content of a.txt")
+	}
+	if err := reader.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	// the file should be closed along with the reader
+	if _, err := reader.Read(make([]byte, 1)); err == nil || err == io.EOF {
+		t.Errorf("Read() after Close() error = %v, should fail", err)
+	}
+}
+
+func Test_provider_NewWriter(t *testing.T) {
+
+	tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+	if err != nil {
+		t.Errorf("unable to create temporary directory for tests. err=%v", err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDirectory)
+
+	p := &provider{
+		context:              context.Background(),
+		kind:                 "local",
+		directory:            tmpDirectory,
+		noSuchKeyErrorString: os.ErrNotExist.Error(),
+		config:               &gospal.ProviderConfig{},
+	}
+
+	tests := []struct {
+		name    string
+		cancel  bool
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:    "Should commit the file on close",
+			cancel:  false,
+			want:    []string{"a.txt"},
+			wantErr: false,
+		},
+		{
+			name:    "Should abort on canceled context",
+			cancel:  true,
+			want:    nil,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			defer p.DeleteKey("a.txt")
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			writer, err := p.NewWriter(ctx, "a.txt", gospal.WithContentType("text/plain"))
+			if err != nil {
+				t.Errorf("NewWriter() error = %v", err)
+				return
+			}
+			if _, err := io.WriteString(writer, "content of a.txt"); err != nil {
+				t.Errorf("Write() error = %v", err)
+			}
+			// nothing should be visible before the file is committed
+			if keys, _ := p.ListKeys(); keys != nil {
+				t.Errorf("ListKeys() before Close() got = %v, want nothing", keys)
+			}
+			if tt.cancel {
+				cancel()
+			}
+			if err := writer.Close(); (err != nil) != tt.wantErr {
+				t.Errorf("Close() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if keys, _ := p.ListKeys(); !reflect.DeepEqual(keys, tt.want) {
+				t.Errorf("ListKeys() after Close() got = %v, want %v", keys, tt.want)
+			}
+			if tt.cancel {
+				// the temporary file should have been removed
+				if names, _ := readDirNames(tmpDirectory); len(names) != 0 {
+					t.Errorf("Close() left %v", names)
+				}
+				return
+			}
+			if data, _ := ioutil.ReadFile(path.Join(tmpDirectory, "a.txt")); string(data) != "content of a.txt" {
+				t.Errorf("NewWriter() got = %v, want %v", string(data), "content of a.txt")
+			}
+		})
+	}
+}
+
+// failingReader returns its content then fails, as an interrupted upload
+type failingReader struct {
+	reader io.Reader
+}
+
+func (r *failingReader) Read(b []byte) (int, error) {
+	n, err := r.reader.Read(b)
+	if err == io.EOF {
+		return n, stderrors.New("connection reset by peer")
+	}
+	return n, err
+}
+
+func Test_provider_PutStreamAtomic(t *testing.T) {
+
+	tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+	if err != nil {
+		t.Errorf("unable to create temporary directory for tests. err=%v", err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDirectory)
+	if err := ioutil.WriteFile(path.Join(tmpDirectory, "a.txt"), []byte("previous content"), 0600); err != nil {
+		t.Errorf("unable to create a.txt for tests. err=%v", err.Error())
+		return
+	}
+
+	p := &provider{
+		context:              context.Background(),
+		kind:                 "local",
+		directory:            tmpDirectory,
+		noSuchKeyErrorString: os.ErrNotExist.Error(),
+		config:               &gospal.ProviderConfig{},
+	}
+
+	tests := []struct {
+		name        string
+		reader      io.Reader
+		wantContent string
+		wantErr     bool
+	}{
+		{
+			name:        "Should leave the previous file untouched on failure",
+			reader:      &failingReader{reader: strings.NewReader("partial new content")},
+			wantContent: "previous content",
+			wantErr:     true,
+		},
+		{
+			name:        "Should replace the previous file on success",
+			reader:      strings.NewReader("new content"),
+			wantContent: "new content",
+			wantErr:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := p.PutStream("a.txt", tt.reader); (err != nil) != tt.wantErr {
+				t.Errorf("PutStream() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if data, _ := ioutil.ReadFile(path.Join(tmpDirectory, "a.txt")); string(data) != tt.wantContent {
+				t.Errorf("PutStream() content = %v, wantContent %v", string(data), tt.wantContent)
+			}
+			// no temporary file should be left behind
+			if names, _ := readDirNames(tmpDirectory); !reflect.DeepEqual(names, []string{"a.txt"}) {
+				t.Errorf("PutStream() left %v", names)
+			}
+		})
+	}
+}
+
+func Test_provider_NestedKeys(t *testing.T) {
+
+	tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+	if err != nil {
+		t.Errorf("unable to create temporary directory for tests. err=%v", err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDirectory)
+
+	p := &provider{
+		context:              context.Background(),
+		kind:                 "local",
+		directory:            tmpDirectory,
+		noSuchKeyErrorString: os.ErrNotExist.Error(),
+		config:               &gospal.ProviderConfig{},
+	}
+
+	// the intermediate directories should be created
+	for _, key := range []string{"a/b/c.txt", "a/d.txt"} {
+		if _, err := p.PutStream(key, strings.NewReader(key)); err != nil {
+			t.Errorf("PutStream() error = %v", err)
+			return
+		}
+	}
+	if err := p.Move("a/b/c.txt", "e/f/c.txt"); err != nil {
+		t.Errorf("Move() error = %v", err)
+		return
+	}
+	// the source directory has been left empty by the move
+	if _, err := os.Stat(path.Join(tmpDirectory, "a/b")); !os.IsNotExist(err) {
+		t.Errorf("Move() should have pruned a/b. err=%v", err)
+	}
+	if err := p.DeleteKey("e/f/c.txt"); err != nil {
+		t.Errorf("DeleteKey() error = %v", err)
+		return
+	}
+	if names, _ := readDirNames(tmpDirectory); !reflect.DeepEqual(names, []string{"a"}) {
+		t.Errorf("DeleteKey() should have pruned e/f and e, got %v", names)
+	}
+	if err := p.DeleteKey("a/d.txt"); err != nil {
+		t.Errorf("DeleteKey() error = %v", err)
+		return
+	}
+	// the root directory should always be kept
+	if names, err := readDirNames(tmpDirectory); err != nil || len(names) != 0 {
+		t.Errorf("DeleteKey() should have pruned everything but the root, got %v, %v", names, err)
+	}
+}
+
+func Test_provider_GlobalPrefix(t *testing.T) {
+
+	tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+	if err != nil {
+		t.Errorf("unable to create temporary directory for tests. err=%v", err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDirectory)
+
+	for _, file := range []string{"tenant/a.txt", "tenant/b/c.txt", "tenant2/d.txt", "e.txt"} {
+		if err := os.MkdirAll(path.Dir(path.Join(tmpDirectory, file)), 0700); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", file, err.Error())
+			return
+		}
+		if err := ioutil.WriteFile(path.Join(tmpDirectory, file), []byte(file), 0600); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", file, err.Error())
+			return
+		}
+	}
+
+	p := &provider{
+		context:              context.Background(),
+		kind:                 "local",
+		directory:            tmpDirectory,
+		noSuchKeyErrorString: os.ErrNotExist.Error(),
+		config:               &gospal.ProviderConfig{GlobalPrefix: "tenant"},
+	}
+
+	// the keys are relative to the global prefix, the sibling tenant2 is not listed
+	keys, err := p.ListKeys()
+	if err != nil {
+		t.Errorf("ListKeys() error = %v", err)
+		return
+	}
+	if want := []string{"a.txt", "b/c.txt"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("ListKeys() got = %v, want %v", keys, want)
+	}
+	gotKeys, gotPrefixes, err := p.ListDir("")
+	if err != nil || !reflect.DeepEqual(gotKeys, []string{"a.txt"}) || !reflect.DeepEqual(gotPrefixes, []string{"b/"}) {
+		t.Errorf("ListDir() got = %v, %v, %v", gotKeys, gotPrefixes, err)
+	}
+	// and can be fed back to the provider
+	for _, key := range keys {
+		reader, err := p.NewReader(context.Background(), key)
+		if err != nil {
+			t.Errorf("NewReader() error = %v", err)
+			continue
+		}
+		if data, _ := ioutil.ReadAll(reader); string(data) != "tenant/"+key {
+			t.Errorf("NewReader() got = %v, want %v", string(data), "tenant/"+key)
+		}
+		reader.Close()
+		if err := p.DeleteKey(key); err != nil {
+			t.Errorf("DeleteKey() error = %v", err)
+		}
+	}
+	if names, _ := readDirNames(tmpDirectory); !reflect.DeepEqual(names, []string{"e.txt", "tenant2"}) {
+		t.Errorf("DeleteKey() left %v", names)
+	}
+	// the global prefix directory has been pruned, it lists nothing instead of failing
+	if keys, err := p.ListKeys(); err != nil || len(keys) != 0 {
+		t.Errorf("ListKeys() got = %v, %v, want no keys", keys, err)
+	}
+}
+
+func Test_provider_InvalidKeys(t *testing.T) {
+
+	tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+	if err != nil {
+		t.Errorf("unable to create temporary directory for tests. err=%v", err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDirectory)
+	outside, err := ioutil.TempDir(os.TempDir(), "gospalOutside")
+	if err != nil {
+		t.Errorf("unable to create temporary directory for tests. err=%v", err.Error())
+		return
+	}
+	defer os.RemoveAll(outside)
+
+	for _, file := range []string{"bucket/tenant/a.txt", "bucket/tenant2/b.txt"} {
+		if err := os.MkdirAll(path.Dir(path.Join(tmpDirectory, file)), 0700); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", file, err.Error())
+			return
+		}
+		if err := ioutil.WriteFile(path.Join(tmpDirectory, file), []byte(file), 0600); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", file, err.Error())
+			return
+		}
+	}
+	if err := ioutil.WriteFile(path.Join(outside, "secret.txt"), []byte("secret"), 0600); err != nil {
+		t.Errorf("unable to create secret.txt for tests. err=%v", err.Error())
+		return
+	}
+	links := map[string]string{
+		"bucket/tenant/escape":       outside,
+		"bucket/tenant/escape.txt":   path.Join(outside, "secret.txt"),
+		"bucket/tenant/dangling.txt": path.Join(outside, "missing.txt"),
+		"bucket/tenant/inside.txt":   "a.txt",
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, path.Join(tmpDirectory, link)); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", link, err.Error())
+			return
+		}
+	}
+
+	p := &provider{
+		context:              context.Background(),
+		kind:                 "local",
+		directory:            path.Join(tmpDirectory, "bucket"),
+		noSuchKeyErrorString: os.ErrNotExist.Error(),
+		config:               &gospal.ProviderConfig{GlobalPrefix: "tenant"},
+	}
+
+	for _, key := range []string{"../tenant2/b.txt", "../../bucket/tenant2/b.txt", "a/../../tenant2/b.txt", "escape/secret.txt", "escape.txt", "dangling.txt", "escape/new/c.txt", "a\x00.txt"} {
+		t.Run(key, func(t *testing.T) {
+			if _, err := p.Stat(key); !stderrors.Is(err, errors.ErrInvalidKey) {
+				t.Errorf("Stat() error = %v, should be %v", err, errors.ErrInvalidKey)
+			}
+			if _, err := p.NewReader(context.Background(), key); !stderrors.Is(err, errors.ErrInvalidKey) {
+				t.Errorf("NewReader() error = %v, should be %v", err, errors.ErrInvalidKey)
+			}
+			if _, err := p.PutStream(key, strings.NewReader("overwritten")); !stderrors.Is(err, errors.ErrInvalidKey) {
+				t.Errorf("PutStream() error = %v, should be %v", err, errors.ErrInvalidKey)
+			}
+			if err := p.Move("a.txt", key); !stderrors.Is(err, errors.ErrInvalidKey) {
+				t.Errorf("Move() error = %v, should be %v", err, errors.ErrInvalidKey)
+			}
+			if err := p.DeleteKey(key); !stderrors.Is(err, errors.ErrInvalidKey) {
+				t.Errorf("DeleteKey() error = %v, should be %v", err, errors.ErrInvalidKey)
+			}
+			var invalidErr *errors.InvalidKeyError
+			if err := p.DeleteKey(key); !stderrors.As(err, &invalidErr) || invalidErr.Key != key {
+				t.Errorf("DeleteKey() error = %v, should be an InvalidKeyError of %v", err, key)
+			}
+		})
+	}
+	if _, err := p.ListKeys("../tenant2"); !stderrors.Is(err, errors.ErrInvalidKey) {
+		t.Errorf("ListKeys() error = %v, should be %v", err, errors.ErrInvalidKey)
+	}
+	if _, _, err := p.ListDir("escape/"); !stderrors.Is(err, errors.ErrInvalidKey) {
+		t.Errorf("ListDir() error = %v, should be %v", err, errors.ErrInvalidKey)
+	}
+	if err := p.DeletePrefix("../"); !stderrors.Is(err, errors.ErrInvalidKey) {
+		t.Errorf("DeletePrefix() error = %v, should be %v", err, errors.ErrInvalidKey)
+	}
+
+	// nothing has been touched outside of the global prefix
+	if data, err := ioutil.ReadFile(path.Join(outside, "secret.txt")); err != nil || string(data) != "secret" {
+		t.Errorf("secret.txt got = %v, %v", string(data), err)
+	}
+	if names, _ := readDirNames(outside); !reflect.DeepEqual(names, []string{"secret.txt"}) {
+		t.Errorf("outside directory got = %v", names)
+	}
+	if data, err := ioutil.ReadFile(path.Join(tmpDirectory, "bucket/tenant2/b.txt")); err != nil || string(data) != "bucket/tenant2/b.txt" {
+		t.Errorf("tenant2/b.txt got = %v, %v", string(data), err)
+	}
+
+	// keys staying within the global prefix are still valid, whatever their form
+	for _, key := range []string{"a.txt", "/a.txt", "b/../a.txt", "inside.txt"} {
+		reader, err := p.NewReader(context.Background(), key)
+		if err != nil {
+			t.Errorf("NewReader() error = %v", err)
+			continue
+		}
+		if data, _ := ioutil.ReadAll(reader); string(data) != "bucket/tenant/a.txt" {
+			t.Errorf("NewReader() got = %v, want %v", string(data), "bucket/tenant/a.txt")
+		}
+		reader.Close()
+	}
+}
+
+func Test_provider_SymlinkedDirectory(t *testing.T) {
+
+	tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+	if err != nil {
+		t.Errorf("unable to create temporary directory for tests. err=%v", err.Error())
+		return
+	}
+	defer os.RemoveAll(tmpDirectory)
+
+	for _, file := range []string{"real/a.txt", "real/b/c.txt", "outside/secret.txt"} {
+		if err := os.MkdirAll(path.Dir(path.Join(tmpDirectory, file)), 0700); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", file, err.Error())
+			return
+		}
+		if err := ioutil.WriteFile(path.Join(tmpDirectory, file), []byte(file), 0600); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", file, err.Error())
+			return
+		}
+	}
+	// the bucket directory is a symbolic link, the links found below it are still not followed
+	links := map[string]string{
+		"bucket":        path.Join(tmpDirectory, "real"),
+		"real/b/escape": path.Join(tmpDirectory, "outside"),
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, path.Join(tmpDirectory, link)); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", link, err.Error())
+			return
+		}
+	}
+
+	p := &provider{
+		context:              context.Background(),
+		kind:                 "local",
+		directory:            path.Join(tmpDirectory, "bucket"),
+		noSuchKeyErrorString: os.ErrNotExist.Error(),
+		config:               &gospal.ProviderConfig{},
+	}
+
+	want := []string{"a.txt", "b/c.txt", "b/escape"}
+	keys, err := p.ListKeys()
+	if err != nil || !reflect.DeepEqual(keys, want) {
+		t.Errorf("ListKeys() got = %v, %v, want %v", keys, err, want)
+	}
+	var objects []string
+	it := p.Objects(context.Background(), "")
+	for it.Next() {
+		objects = append(objects, it.Object().Key)
+	}
+	if err := it.Err(); err != nil || !reflect.DeepEqual(objects, want) {
+		t.Errorf("Objects() got = %v, %v, want %v", objects, err, want)
+	}
+	gotKeys, gotPrefixes, err := p.ListDir("")
+	if err != nil || !reflect.DeepEqual(gotKeys, []string{"a.txt"}) || !reflect.DeepEqual(gotPrefixes, []string{"b/"}) {
+		t.Errorf("ListDir() got = %v, %v, %v", gotKeys, gotPrefixes, err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	gospaltest.RunConformance(t, func(t *testing.T) (gospal.Gospal, func()) {
+		tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+		if err != nil {
+			t.Fatalf("unable to create temporary directory for tests. err=%v", err.Error())
+		}
+		p, err := New(context.Background(), tmpDirectory, gospal.NewProviderConfig())
+		if err != nil {
+			t.Fatalf("error when instantiating local provider. err=%v", err.Error())
+		}
+		return p, func() { os.RemoveAll(tmpDirectory) }
+	})
+}
+
+func TestConfigConformance(t *testing.T) {
+	gospaltest.RunConfigConformance(t, func(t *testing.T, config *gospal.ProviderConfig) (gospal.Gospal, func()) {
+		tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+		if err != nil {
+			t.Fatalf("unable to create temporary directory for tests. err=%v", err.Error())
+		}
+		p, err := New(context.Background(), tmpDirectory, config)
+		if err != nil {
+			t.Fatalf("error when instantiating local provider. err=%v", err.Error())
+		}
+		return p, func() { os.RemoveAll(tmpDirectory) }
+	})
+}
@@ -0,0 +1,89 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package localprovider
+
+import (
+	"context"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/internal/fsutil"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+// syncFile is a file flushed to the disk on close, for its content to survive a crash once renamed
+type syncFile struct {
+	*os.File
+}
+
+func (f syncFile) Close() error {
+	err := f.File.Sync()
+	if closeErr := f.File.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func (fileSystem) CreateNew(filePath string) (fsutil.File, error) {
+	fh, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return syncFile{fh}, nil
+}
+
+func (fileSystem) MkdirAll(dir string) error {
+	return os.MkdirAll(dir, 0700)
+}
+
+// Rename replaces the target atomically, the directory being flushed to the disk for the rename to survive a crash
+func (fileSystem) Rename(oldPath string, newPath string) error {
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return err
+	}
+	syncDir(path.Dir(newPath))
+	return nil
+}
+
+func (fileSystem) Remove(filePath string) error {
+	return os.Remove(filePath)
+}
+
+func (fileSystem) ReadFile(filePath string) ([]byte, error) {
+	return ioutil.ReadFile(filePath)
+}
+
+func (p *provider) NewWriter(ctx context.Context, fileName string, opts ...gospal.PutOption) (io.WriteCloser, error) {
+	return p.newFileWriter(ctx, fileName, opts...)
+}
+
+func (p *provider) newFileWriter(ctx context.Context, fileName string, opts ...gospal.PutOption) (*fsutil.Writer, error) {
+	filePath, err := p.keyPath(fileName)
+	if err != nil {
+		return nil, errors.ErrorPutStreamReader(fileName, err)
+	}
+	return fsutil.NewWriter(ctx, fileSystem{}, filePath, gospal.NewPutOptions(opts...), toError)
+}
+
+// syncDir flushes the directory to the disk for the renames within it to survive a crash. This is a best effort as
+// not every platform allows to sync directories
+func syncDir(dir string) {
+	if fh, err := os.Open(dir); err == nil {
+		fh.Sync()
+		fh.Close()
+	}
+}
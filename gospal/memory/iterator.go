@@ -0,0 +1,78 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package memprovider
+
+import (
+	"context"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+)
+
+// default number of objects per page when ProviderConfig.MaxKeys is not set
+const defaultMaxKeys = 1024
+
+// objectIterator lists the store one page of sorted keys at a time, the page token is the key of the last object of
+// the previous page
+type objectIterator struct {
+	ctx          context.Context
+	p            *provider
+	targetPrefix string
+	after        string
+	pageSize     int
+	page         []*gospal.ObjectInfo
+	done         bool
+	pageToken    string
+	current      *gospal.ObjectInfo
+	err          error
+}
+
+func (it *objectIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if err := it.ctx.Err(); err != nil {
+		it.err = errors.ErrorListKeysError(it.targetPrefix, toError(err))
+		return false
+	}
+	if len(it.page) == 0 {
+		if it.done {
+			return false
+		}
+		if it.current != nil {
+			it.pageToken = it.current.Key
+		}
+		it.page = it.p.store.page(it.targetPrefix, it.after, it.pageSize)
+		it.done = len(it.page) < it.pageSize
+		if len(it.page) == 0 {
+			return false
+		}
+	}
+	it.current, it.page = it.page[0], it.page[1:]
+	it.after = it.current.Key
+	it.current.Key = it.p.toKey(it.current.Key)
+	return true
+}
+
+func (it *objectIterator) Object() *gospal.ObjectInfo {
+	return it.current
+}
+
+func (it *objectIterator) Err() error {
+	return it.err
+}
+
+func (it *objectIterator) PageToken() string {
+	return it.pageToken
+}
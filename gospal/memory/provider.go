@@ -0,0 +1,440 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package memprovider
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/internal/registry"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+type provider struct {
+	context              context.Context
+	kind                 string
+	bucketName           string
+	store                *Store
+	noSuchKeyErrorString string
+	config               *gospal.ProviderConfig
+}
+
+// toError classifies a context error as one of the gospal errors
+func toError(err error) error {
+	if stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded) {
+		return errors.Wrap(errors.ErrCanceled, err)
+	}
+	return err
+}
+
+// errNotExist returns the error of a missing key
+func errNotExist(targetKey string) error {
+	return errors.Wrap(errors.ErrNotExist, fmt.Errorf("no such key %v", targetKey))
+}
+
+// getTargetKey returns the key as stored, the global prefix included
+func (p *provider) getTargetKey(key string) string {
+	return gospal.TargetKey(p.config.GlobalPrefix, key)
+}
+
+// getTargetPrefix returns the listing prefix as stored, a prefix relative to the global prefix staying under it
+func (p *provider) getTargetPrefix(prefix string) string {
+	targetKey := p.getTargetKey(prefix)
+	if p.config.GlobalPrefix != "" && (prefix == "" || strings.HasSuffix(prefix, "/")) && !strings.HasSuffix(targetKey, "/") {
+		targetKey += "/"
+	}
+	return targetKey
+}
+
+// toKey returns the key relative to the global prefix of the stored key
+func (p *provider) toKey(targetKey string) string {
+	return gospal.RelativeKey(p.config.GlobalPrefix, targetKey)
+}
+
+// checkKey rejects the keys which can not be stored
+func checkKey(key string, targetKey string) error {
+	if targetKey == "" || strings.HasSuffix(targetKey, "/") {
+		return errors.ErrorInvalidKey(key, "not an object key")
+	}
+	return nil
+}
+
+func (p *provider) ListKeys(pathName ...string) ([]string, error) {
+	return p.ListKeysContext(p.context, pathName...)
+}
+
+func (p *provider) ListKeysContext(ctx context.Context, pathName ...string) ([]string, error) {
+	p.store.count("ListKeys")
+	if len(pathName) > 1 {
+		return nil, errors.ErrorTooMuchListKeysArgs()
+	}
+	var extraPath string
+	if len(pathName) != 0 {
+		extraPath = pathName[0]
+	}
+	var keys []string
+	it := p.objects(ctx, extraPath, "")
+	for it.Next() {
+		keys = append(keys, it.Object().Key)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (p *provider) ListDir(prefix string) ([]string, []string, error) {
+	return p.ListDirContext(p.context, prefix)
+}
+
+func (p *provider) ListDirContext(ctx context.Context, prefix string) (keys []string, prefixes []string, err error) {
+	p.store.count("ListDir")
+	delimiter := p.config.Delimiter
+	if delimiter == "" {
+		delimiter = gospal.DefaultDelimiter
+	}
+	// the prefix is a directory, it should end with the delimiter
+	targetKey := p.getTargetKey(prefix)
+	if targetKey != "" && !strings.HasSuffix(targetKey, delimiter) {
+		targetKey += delimiter
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, errors.ErrorListDir(targetKey, toError(err))
+	}
+	for _, key := range p.store.Keys(targetKey) {
+		rest := strings.TrimPrefix(key, targetKey)
+		if i := strings.Index(rest, delimiter); i >= 0 {
+			// the keys being sorted, the keys of a sub prefix follow each other
+			subPrefix := p.toKey(targetKey + rest[:i+len(delimiter)])
+			if len(prefixes) == 0 || prefixes[len(prefixes)-1] != subPrefix {
+				prefixes = append(prefixes, subPrefix)
+			}
+			continue
+		}
+		keys = append(keys, p.toKey(key))
+	}
+	return keys, prefixes, nil
+}
+
+func (p *provider) Objects(ctx context.Context, prefix string) gospal.ObjectIterator {
+	p.store.count("Objects")
+	return p.objects(ctx, prefix, "")
+}
+
+func (p *provider) ObjectsFrom(ctx context.Context, prefix string, pageToken string) gospal.ObjectIterator {
+	p.store.count("ObjectsFrom")
+	return p.objects(ctx, prefix, pageToken)
+}
+
+func (p *provider) objects(ctx context.Context, prefix string, pageToken string) *objectIterator {
+	it := &objectIterator{
+		ctx:          ctx,
+		p:            p,
+		targetPrefix: p.getTargetPrefix(prefix),
+		pageSize:     defaultMaxKeys,
+		pageToken:    pageToken,
+	}
+	if pageToken != "" {
+		it.after = p.getTargetKey(pageToken)
+	}
+	if p.config.MaxKeys > 0 {
+		it.pageSize = int(p.config.MaxKeys)
+	}
+	return it
+}
+
+func (p *provider) GetStream(filePath string) (io.Reader, context.CancelFunc, error) {
+	return p.GetStreamContext(p.context, filePath)
+}
+
+func (p *provider) GetStreamContext(ctx context.Context, filePath string) (io.Reader, context.CancelFunc, error) {
+	p.store.count("GetStream")
+	return gospal.ToStream(p.newReader(ctx, filePath))
+}
+
+func (p *provider) NewReader(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	p.store.count("NewReader")
+	return p.newReader(ctx, filePath)
+}
+
+func (p *provider) newReader(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	targetKey := p.getTargetKey(filePath)
+	if err := ctx.Err(); err != nil {
+		return nil, errors.ErrorGetStreamReader(targetKey, toError(err))
+	}
+	obj, ok := p.store.get(targetKey)
+	if !ok {
+		return nil, errors.ErrorGetStreamReader(targetKey, errNotExist(targetKey))
+	}
+	// the content of an object is never modified, it is read without copy
+	return ioutil.NopCloser(bytes.NewReader(obj.content)), nil
+}
+
+func (p *provider) GetRange(filePath string, offset int64, length int64) (io.Reader, context.CancelFunc, error) {
+	return p.GetRangeContext(p.context, filePath, offset, length)
+}
+
+func (p *provider) GetRangeContext(ctx context.Context, filePath string, offset int64, length int64) (io.Reader, context.CancelFunc, error) {
+	p.store.count("GetRange")
+	targetKey := p.getTargetKey(filePath)
+	if err := ctx.Err(); err != nil {
+		return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, targetKey, toError(err)))
+	}
+	obj, ok := p.store.get(targetKey)
+	if !ok {
+		return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, targetKey, errNotExist(targetKey)))
+	}
+	if offset < 0 {
+		return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, targetKey, fmt.Errorf("negative offset %v", offset)))
+	}
+	size := int64(len(obj.content))
+	if offset > size {
+		offset = size
+	}
+	end := size
+	if length >= 0 && offset+length < size {
+		end = offset + length
+	}
+	return gospal.ToStream(ioutil.NopCloser(bytes.NewReader(obj.content[offset:end])), nil)
+}
+
+// objectReader is the ObjectReader of an object, *bytes.Reader already implements io.ReadSeeker, io.ReaderAt and Size
+type objectReader struct {
+	*bytes.Reader
+}
+
+func (r *objectReader) Close() error {
+	return nil
+}
+
+func (p *provider) Open(filePath string) (gospal.ObjectReader, error) {
+	return p.OpenContext(p.context, filePath)
+}
+
+func (p *provider) OpenContext(ctx context.Context, filePath string) (gospal.ObjectReader, error) {
+	p.store.count("Open")
+	targetKey := p.getTargetKey(filePath)
+	if err := ctx.Err(); err != nil {
+		return nil, errors.ErrorGetStreamReader(targetKey, toError(err))
+	}
+	obj, ok := p.store.get(targetKey)
+	if !ok {
+		return nil, errors.ErrorGetStreamReader(targetKey, errNotExist(targetKey))
+	}
+	return &objectReader{Reader: bytes.NewReader(obj.content)}, nil
+}
+
+func (p *provider) PutStream(filePath string, reader io.Reader, opts ...gospal.PutOption) (int64, error) {
+	return p.PutStreamContext(p.context, filePath, reader, opts...)
+}
+
+func (p *provider) PutStreamContext(ctx context.Context, filePath string, reader io.Reader, opts ...gospal.PutOption) (int64, error) {
+	p.store.count("PutStream")
+	writer, err := p.newWriter(ctx, filePath, opts...)
+	if err != nil {
+		return 0, err
+	}
+	written, err := io.Copy(writer, reader)
+	if err != nil {
+		return 0, errors.ErrorPutStreamReader(writer.targetKey, toError(err))
+	}
+	if err := writer.Close(); err != nil {
+		return 0, err
+	}
+	return written, nil
+}
+
+// objectWriter buffers the object, which is only stored on close
+type objectWriter struct {
+	ctx       context.Context
+	store     *Store
+	targetKey string
+	buffer    bytes.Buffer
+	opts      []gospal.PutOption
+}
+
+func (w *objectWriter) Write(b []byte) (int, error) {
+	if err := w.ctx.Err(); err != nil {
+		return 0, errors.ErrorPutStreamReader(w.targetKey, toError(err))
+	}
+	return w.buffer.Write(b)
+}
+
+// Close stores the object unless the context is done
+func (w *objectWriter) Close() error {
+	if err := w.ctx.Err(); err != nil {
+		return errors.ErrorPutStreamReader(w.targetKey, toError(err))
+	}
+	w.store.Put(w.targetKey, w.buffer.Bytes(), w.opts...)
+	return nil
+}
+
+func (p *provider) NewWriter(ctx context.Context, filePath string, opts ...gospal.PutOption) (io.WriteCloser, error) {
+	p.store.count("NewWriter")
+	return p.newWriter(ctx, filePath, opts...)
+}
+
+func (p *provider) newWriter(ctx context.Context, filePath string, opts ...gospal.PutOption) (*objectWriter, error) {
+	targetKey := p.getTargetKey(filePath)
+	if err := checkKey(filePath, targetKey); err != nil {
+		return nil, errors.ErrorPutStreamReader(targetKey, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, errors.ErrorPutStreamReader(targetKey, toError(err))
+	}
+	return &objectWriter{ctx: ctx, store: p.store, targetKey: targetKey, opts: opts}, nil
+}
+
+func (p *provider) Stat(filePath string) (*gospal.ObjectInfo, error) {
+	return p.StatContext(p.context, filePath)
+}
+
+func (p *provider) StatContext(ctx context.Context, filePath string) (*gospal.ObjectInfo, error) {
+	p.store.count("Stat")
+	targetKey := p.getTargetKey(filePath)
+	if err := ctx.Err(); err != nil {
+		return nil, errors.ErrorStat(targetKey, toError(err))
+	}
+	info, ok := p.store.Stat(targetKey)
+	if !ok {
+		return nil, errors.ErrorStat(targetKey, errNotExist(targetKey))
+	}
+	info.Key = filePath
+	return info, nil
+}
+
+func (p *provider) GetKind() string {
+	return p.kind
+}
+
+func (p *provider) Copy(src string, dst string) error {
+	return p.CopyContext(p.context, src, dst)
+}
+
+func (p *provider) CopyContext(ctx context.Context, src string, dst string) error {
+	p.store.count("Copy")
+	return p.copy(ctx, src, dst, errors.ErrorCopyKey)
+}
+
+// copy stores the object of the source key to the destination key, both sharing the same immutable content
+func (p *provider) copy(ctx context.Context, src string, dst string, toErr func(...interface{}) error) error {
+	srcKey, dstKey := p.getTargetKey(src), p.getTargetKey(dst)
+	if err := checkKey(dst, dstKey); err != nil {
+		return toErr(srcKey, dstKey, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return toErr(srcKey, dstKey, toError(err))
+	}
+	p.store.mu.Lock()
+	defer p.store.mu.Unlock()
+	obj, ok := p.store.objects[srcKey]
+	if !ok {
+		return toErr(srcKey, dstKey, errNotExist(srcKey))
+	}
+	p.store.objects[dstKey] = obj
+	return nil
+}
+
+func (p *provider) Move(src string, dst string) error {
+	return p.MoveContext(p.context, src, dst)
+}
+
+func (p *provider) MoveContext(ctx context.Context, src string, dst string) error {
+	p.store.count("Move")
+	if err := p.copy(ctx, src, dst, errors.ErrorMoveKey); err != nil {
+		return err
+	}
+	if p.getTargetKey(src) != p.getTargetKey(dst) {
+		p.store.Delete(p.getTargetKey(src))
+	}
+	return nil
+}
+
+func (p *provider) DeleteKey(filePath string) error {
+	return p.DeleteKeyContext(p.context, filePath)
+}
+
+func (p *provider) DeleteKeyContext(ctx context.Context, filePath string) error {
+	p.store.count("DeleteKey")
+	return p.deleteKey(ctx, filePath)
+}
+
+func (p *provider) deleteKey(ctx context.Context, filePath string) error {
+	targetKey := p.getTargetKey(filePath)
+	if err := ctx.Err(); err != nil {
+		return errors.ErrorDeleteKey(targetKey, toError(err))
+	}
+	if !p.store.Delete(targetKey) {
+		return errors.ErrorDeleteKey(targetKey, errNotExist(targetKey))
+	}
+	return nil
+}
+
+func (p *provider) DeleteKeys(filePaths []string) error {
+	return p.DeleteKeysContext(p.context, filePaths)
+}
+
+func (p *provider) DeleteKeysContext(ctx context.Context, filePaths []string) error {
+	p.store.count("DeleteKeys")
+	failures := map[string]error{}
+	for _, filePath := range filePaths {
+		if err := p.deleteKey(ctx, filePath); err != nil {
+			failures[filePath] = err
+		}
+	}
+	return errors.ErrorDeleteKeys(failures)
+}
+
+func (p *provider) DeletePrefix(prefix string) error {
+	return p.DeletePrefixContext(p.context, prefix)
+}
+
+func (p *provider) DeletePrefixContext(ctx context.Context, prefix string) error {
+	p.store.count("DeletePrefix")
+	failures := map[string]error{}
+	for _, targetKey := range p.store.Keys(p.getTargetPrefix(prefix)) {
+		if err := p.deleteKey(ctx, p.toKey(targetKey)); err != nil && !stderrors.Is(err, errors.ErrNotExist) {
+			// removed meanwhile otherwise
+			failures[p.toKey(targetKey)] = err
+		}
+	}
+	return errors.ErrorDeleteKeys(failures)
+}
+
+func (p *provider) GetNoSuchKeyErrorString() string {
+	return p.noSuchKeyErrorString
+}
+
+// the provider is available from the factory as soon as its package is imported
+func init() {
+	registry.MustRegister(gospal.ProviderMemory, New)
+}
+
+//New memory provider constructor. The providers of the same bucket share its objects, see Bucket
+func New(ctx context.Context, bucket string, config *gospal.ProviderConfig) (gospal.Gospal, error) {
+	return &provider{
+		context:              ctx,
+		kind:                 string(gospal.ProviderMemory),
+		bucketName:           bucket,
+		store:                Bucket(bucket),
+		noSuchKeyErrorString: errors.ErrNotExist.Error(),
+		config:               config,
+	}, nil
+}
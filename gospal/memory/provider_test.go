@@ -0,0 +1,175 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package memprovider
+
+import (
+	"context"
+	"fmt"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/gospaltest"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestConformance(t *testing.T) {
+	var buckets int
+	gospaltest.RunConformance(t, func(t *testing.T) (gospal.Gospal, func()) {
+		buckets++
+		bucket := fmt.Sprintf("conformance-%d", buckets)
+		p, err := New(context.Background(), bucket, &gospal.ProviderConfig{MaxKeys: 2})
+		if err != nil {
+			t.Fatalf("error when instantiating memory provider. err=%v", err.Error())
+		}
+		return p, Bucket(bucket).Reset
+	})
+}
+
+func TestConfigConformance(t *testing.T) {
+	var buckets int
+	gospaltest.RunConfigConformance(t, func(t *testing.T, config *gospal.ProviderConfig) (gospal.Gospal, func()) {
+		buckets++
+		bucket := fmt.Sprintf("config-conformance-%d", buckets)
+		p, err := New(context.Background(), bucket, config)
+		if err != nil {
+			t.Fatalf("error when instantiating memory provider. err=%v", err.Error())
+		}
+		return p, Bucket(bucket).Reset
+	})
+}
+
+func TestStore(t *testing.T) {
+	store := Bucket("test-store")
+	defer store.Reset()
+
+	// seeded objects are seen by the providers of the bucket, with their global prefix
+	store.Put("tenant/a.txt", []byte("a"), gospal.WithContentType("text/plain"))
+	p, err := New(context.Background(), "test-store", &gospal.ProviderConfig{GlobalPrefix: "tenant"})
+	if err != nil {
+		t.Errorf("error when instantiating memory provider. err=%v", err.Error())
+		return
+	}
+	info, err := p.Stat("a.txt")
+	if err != nil || info.Size != 1 || info.ContentType != "text/plain" {
+		t.Errorf("Stat() got = %v, %v", info, err)
+	}
+
+	// and the objects put by the providers can be inspected
+	if _, err := p.PutStream("b.txt", strings.NewReader("b"), gospal.WithMetadata(map[string]string{"owner": "test"})); err != nil {
+		t.Errorf("PutStream() error = %v", err)
+		return
+	}
+	if content, ok := store.Get("tenant/b.txt"); !ok || string(content) != "b" {
+		t.Errorf("Get() got = %v, %v, want %v", string(content), ok, "b")
+	}
+	if info, ok := store.Stat("tenant/b.txt"); !ok || info.Metadata["owner"] != "test" {
+		t.Errorf("Stat() got = %v, %v", info, ok)
+	}
+	if keys := store.Keys(""); !reflect.DeepEqual(keys, []string{"tenant/a.txt", "tenant/b.txt"}) {
+		t.Errorf("Keys() got = %v", keys)
+	}
+
+	// a method and its Context variant are counted together
+	p.Stat("a.txt")
+	p.StatContext(context.Background(), "missing.txt")
+	if calls := store.Calls("Stat"); calls != 3 {
+		t.Errorf("Calls() got = %v, want %v", calls, 3)
+	}
+	if calls := store.Calls("PutStream"); calls != 1 {
+		t.Errorf("Calls() got = %v, want %v", calls, 1)
+	}
+	store.ResetCalls()
+	if calls := store.Calls("Stat"); calls != 0 {
+		t.Errorf("Calls() after ResetCalls() got = %v, want %v", calls, 0)
+	}
+	if !store.Delete("tenant/a.txt") || store.Delete("tenant/a.txt") {
+		t.Errorf("Delete() should only remove existing keys")
+	}
+}
+
+func Test_provider_GetRange(t *testing.T) {
+	store := Bucket("test-get-range")
+	defer store.Reset()
+	store.Put("a.txt", []byte("0123456789"))
+	p, _ := New(context.Background(), "test-get-range", &gospal.ProviderConfig{})
+
+	tests := []struct {
+		name    string
+		offset  int64
+		length  int64
+		want    string
+		wantErr bool
+	}{
+		{name: "Should read the range", offset: 2, length: 3, want: "234"},
+		{name: "Should read up to the end", offset: 7, length: -1, want: "789"},
+		{name: "Should read nothing past the end", offset: 12, length: 3, want: ""},
+		{name: "Should reject a negative offset", offset: -1, length: 3, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader, cancel, err := p.GetRange("a.txt", tt.offset, tt.length)
+			defer cancel()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("GetRange() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if data, _ := ioutil.ReadAll(reader); string(data) != tt.want {
+				t.Errorf("GetRange() got = %v, want %v", string(data), tt.want)
+			}
+		})
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	store := Bucket("test-concurrency")
+	defer store.Reset()
+	p, _ := New(context.Background(), "test-concurrency", &gospal.ProviderConfig{})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := fmt.Sprintf("dir/%d.txt", i)
+			for j := 0; j < 50; j++ {
+				if _, err := p.PutStream(key, strings.NewReader(key)); err != nil {
+					t.Errorf("PutStream() error = %v", err)
+					return
+				}
+				reader, err := p.NewReader(context.Background(), key)
+				if err != nil {
+					t.Errorf("NewReader() error = %v", err)
+					return
+				}
+				if data, _ := ioutil.ReadAll(reader); string(data) != key {
+					t.Errorf("NewReader() got = %v, want %v", string(data), key)
+				}
+				p.ListKeys("dir/")
+			}
+		}(i)
+	}
+	wg.Wait()
+	if keys := store.Keys("dir/"); len(keys) != 16 {
+		t.Errorf("Keys() got %v keys, want %v", len(keys), 16)
+	}
+	if calls := store.Calls("PutStream"); calls != 16*50 {
+		t.Errorf("Calls() got = %v, want %v", calls, 16*50)
+	}
+}
@@ -0,0 +1,196 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package memprovider
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"github.com/contentsquare/gospal/gospal"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	bucketsMu sync.Mutex
+	buckets   = map[string]*Store{}
+)
+
+// object is an immutable object of a store, it is replaced as a whole when put again
+type object struct {
+	content      []byte
+	lastModified time.Time
+	md5          []byte
+	options      *gospal.PutOptions
+}
+
+func (o *object) info(key string) *gospal.ObjectInfo {
+	info := &gospal.ObjectInfo{
+		Key:             key,
+		Size:            int64(len(o.content)),
+		LastModified:    o.lastModified,
+		ETag:            hex.EncodeToString(o.md5),
+		MD5:             o.md5,
+		ContentType:     o.options.ContentType,
+		ContentEncoding: o.options.ContentEncoding,
+		CacheControl:    o.options.CacheControl,
+	}
+	if len(o.options.Metadata) > 0 {
+		info.Metadata = make(map[string]string, len(o.options.Metadata))
+		for name, value := range o.options.Metadata {
+			info.Metadata[name] = value
+		}
+	}
+	return info
+}
+
+// Store holds the objects of a bucket, shared by every provider of the bucket. Its keys are the keys as stored, the
+// global prefix of the providers included. It is safe for concurrent use, and comes with helpers to seed and inspect
+// the bucket from the tests:
+//   store := memprovider.Bucket("test-bucket")
+//   store.Put("path/to/key", []byte("contents"))
+//   ... run the code under test
+//   if store.Calls("PutStream") != 1 { ... }
+type Store struct {
+	mu      sync.RWMutex
+	objects map[string]*object
+	calls   map[string]int
+}
+
+// Bucket returns the store of the named bucket, created empty on first use
+func Bucket(name string) *Store {
+	bucketsMu.Lock()
+	defer bucketsMu.Unlock()
+	store, ok := buckets[name]
+	if !ok {
+		store = &Store{objects: map[string]*object{}, calls: map[string]int{}}
+		buckets[name] = store
+	}
+	return store
+}
+
+// Put stores the content to the key, replacing any previous object
+func (s *Store) Put(key string, content []byte, opts ...gospal.PutOption) {
+	sum := md5.Sum(content)
+	obj := &object{
+		content:      append([]byte(nil), content...),
+		lastModified: time.Now(),
+		md5:          sum[:],
+		options:      gospal.NewPutOptions(opts...),
+	}
+	s.mu.Lock()
+	s.objects[key] = obj
+	s.mu.Unlock()
+}
+
+// Get returns a copy of the content of the key, and whether it exists
+func (s *Store) Get(key string) ([]byte, bool) {
+	obj, ok := s.get(key)
+	if !ok {
+		return nil, false
+	}
+	return append([]byte(nil), obj.content...), true
+}
+
+// Stat returns the attributes of the key, and whether it exists
+func (s *Store) Stat(key string) (*gospal.ObjectInfo, bool) {
+	obj, ok := s.get(key)
+	if !ok {
+		return nil, false
+	}
+	return obj.info(key), true
+}
+
+// Delete removes the key, and tells whether it existed
+func (s *Store) Delete(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.objects[key]
+	delete(s.objects, key)
+	return ok
+}
+
+// Keys returns the sorted keys starting with the prefix
+func (s *Store) Keys(prefix string) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Calls returns the number of calls to the method of the providers of the bucket since the last reset. A method and
+// its Context variant are counted together under the name of the method, eg.: "Stat" counts the calls to both Stat
+// and StatContext
+func (s *Store) Calls(method string) int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.calls[method]
+}
+
+// ResetCalls resets the call counts
+func (s *Store) ResetCalls() {
+	s.mu.Lock()
+	s.calls = map[string]int{}
+	s.mu.Unlock()
+}
+
+// Reset removes every object and resets the call counts
+func (s *Store) Reset() {
+	s.mu.Lock()
+	s.objects = map[string]*object{}
+	s.calls = map[string]int{}
+	s.mu.Unlock()
+}
+
+func (s *Store) get(key string) (*object, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	obj, ok := s.objects[key]
+	return obj, ok
+}
+
+func (s *Store) count(method string) {
+	s.mu.Lock()
+	s.calls[method]++
+	s.mu.Unlock()
+}
+
+// page returns at most size sorted objects starting with the prefix and following the key
+func (s *Store) page(prefix string, after string, size int) []*gospal.ObjectInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	var keys []string
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) && key > after {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if len(keys) > size {
+		keys = keys[:size]
+	}
+	infos := make([]*gospal.ObjectInfo, 0, len(keys))
+	for _, key := range keys {
+		infos = append(infos, s.objects[key].info(key))
+	}
+	return infos
+}
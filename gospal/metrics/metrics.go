@@ -0,0 +1,177 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	stderrors "errors"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// the labels of the metrics
+const (
+	labelKind      = "kind"
+	labelBucket    = "bucket"
+	labelOperation = "operation"
+	labelClass     = "class"
+)
+
+// classes maps the sentinels to the error classes, the first matching sentinel giving the class
+var classes = []struct {
+	sentinel error
+	class    string
+}{
+	{errors.ErrNotExist, "not_exist"},
+	{errors.ErrPermissionDenied, "permission_denied"},
+	{errors.ErrAlreadyExists, "already_exists"},
+	{errors.ErrPreconditionFailed, "precondition_failed"},
+	{errors.ErrCanceled, "canceled"},
+	{context.Canceled, "canceled"},
+	{context.DeadlineExceeded, "canceled"},
+	{errors.ErrInvalidKey, "invalid_key"},
+	{errors.ErrNotSupported, "not_supported"},
+	{errors.ErrTransient, "transient"},
+}
+
+// ErrorClass returns the class of the error reported by the class label of the errors metric: the sentinel of
+// github.com/contentsquare/gospal/gospal/errors it is classified as, in snake case (eg.: not_exist, transient), or
+// "other" when not classified. The partial failures of DeleteKeys and DeletePrefix are of class "delete_keys"
+func ErrorClass(err error) string {
+	for _, c := range classes {
+		if stderrors.Is(err, c.sentinel) {
+			return c.class
+		}
+	}
+	var deleteErr *errors.DeleteKeysError
+	if stderrors.As(err, &deleteErr) {
+		return "delete_keys"
+	}
+	return "other"
+}
+
+// Opts sets the metrics of a Collector
+type Opts struct {
+	// Namespace prefixes the names of the metrics. Defaults to gospal
+	Namespace string
+
+	// ConstLabels are added to every metric
+	ConstLabels prometheus.Labels
+
+	// Buckets are the buckets of the latency histogram, in seconds. Defaults to prometheus.DefBuckets
+	Buckets []float64
+}
+
+// Collector is a prometheus.Collector of the metrics of the providers wrapped by its Wrap method, each metric being
+// labelled by the kind and the bucket of the provider:
+//   * gospal_operations_total{kind, bucket, operation} counts the operations
+//   * gospal_operation_errors_total{kind, bucket, operation, class} counts the failed operations by ErrorClass
+//   * gospal_operation_duration_seconds{kind, bucket, operation} is the latency histogram of the operations
+//   * gospal_read_bytes_total{kind, bucket} counts the bytes read from the readers
+//   * gospal_written_bytes_total{kind, bucket} counts the bytes put or written to the writers
+// The operations are named after the methods, a method and its Context variant being counted together under the name
+// of the method, eg.: "Stat" counts the calls to both Stat and StatContext
+type Collector struct {
+	operations   *prometheus.CounterVec
+	errors       *prometheus.CounterVec
+	durations    *prometheus.HistogramVec
+	readBytes    *prometheus.CounterVec
+	writtenBytes *prometheus.CounterVec
+}
+
+// NewCollector returns a Collector to register in a prometheus registry. A nil opts is the default options:
+//   collector := metrics.NewCollector(nil)
+//   prometheus.MustRegister(collector)
+//   provider = collector.Wrap(provider, "my-bucket")
+func NewCollector(opts *Opts) *Collector {
+	if opts == nil {
+		opts = &Opts{}
+	}
+	namespace := opts.Namespace
+	if namespace == "" {
+		namespace = "gospal"
+	}
+	buckets := opts.Buckets
+	if len(buckets) == 0 {
+		buckets = prometheus.DefBuckets
+	}
+	labels := []string{labelKind, labelBucket, labelOperation}
+	return &Collector{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "operations_total",
+			Help:        "Number of operations of the storage providers.",
+			ConstLabels: opts.ConstLabels,
+		}, labels),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "operation_errors_total",
+			Help:        "Number of failed operations of the storage providers, by error class.",
+			ConstLabels: opts.ConstLabels,
+		}, append(labels, labelClass)),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace:   namespace,
+			Name:        "operation_duration_seconds",
+			Help:        "Latency of the operations of the storage providers.",
+			ConstLabels: opts.ConstLabels,
+			Buckets:     buckets,
+		}, labels),
+		readBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "read_bytes_total",
+			Help:        "Number of bytes read from the storage providers.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{labelKind, labelBucket}),
+		writtenBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Name:        "written_bytes_total",
+			Help:        "Number of bytes written to the storage providers.",
+			ConstLabels: opts.ConstLabels,
+		}, []string{labelKind, labelBucket}),
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.operations.Describe(ch)
+	c.errors.Describe(ch)
+	c.durations.Describe(ch)
+	c.readBytes.Describe(ch)
+	c.writtenBytes.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.operations.Collect(ch)
+	c.errors.Collect(ch)
+	c.durations.Collect(ch)
+	c.readBytes.Collect(ch)
+	c.writtenBytes.Collect(ch)
+}
+
+// Wrap returns a provider recording the metrics of the operations of the provider, labelled by its kind and the
+// bucket. The bucket is only a label, several providers of a bucket may be wrapped by the same collector
+func (c *Collector) Wrap(provider gospal.Gospal, bucket string) gospal.Gospal {
+	kind := provider.GetKind()
+	return &metricsProvider{
+		provider:     provider,
+		collector:    c,
+		kind:         kind,
+		bucket:       bucket,
+		readBytes:    c.readBytes.WithLabelValues(kind, bucket),
+		writtenBytes: c.writtenBytes.WithLabelValues(kind, bucket),
+	}
+}
@@ -0,0 +1,168 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/gospaltest"
+	memprovider "github.com/contentsquare/gospal/gospal/memory"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// newTestProvider returns a wrapped memory provider over an empty bucket, along with its collector
+func newTestProvider(t *testing.T) (gospal.Gospal, *Collector, *memprovider.Store) {
+	bucket := "metrics-" + t.Name()
+	store := memprovider.Bucket(bucket)
+	store.Reset()
+	p, err := memprovider.New(context.Background(), bucket, &gospal.ProviderConfig{MaxKeys: 2})
+	if err != nil {
+		t.Fatalf("error when instantiating memory provider. err=%v", err.Error())
+	}
+	collector := NewCollector(nil)
+	return collector.Wrap(p, "test-bucket"), collector, store
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{name: "Should classify missing keys", err: errors.Wrap(errors.ErrNotExist, fmt.Errorf("404")), want: "not_exist"},
+		{name: "Should classify transient errors", err: errors.Wrap(errors.ErrTransient, fmt.Errorf("503")), want: "transient"},
+		{name: "Should classify context errors as canceled", err: fmt.Errorf("stat: %w", context.DeadlineExceeded), want: "canceled"},
+		{name: "Should classify unsupported operations", err: errors.ErrorNotSupported("PutStream", "http"), want: "not_supported"},
+		{name: "Should classify partial deletes", err: errors.ErrorDeleteKeys(map[string]error{"a": fmt.Errorf("a")}), want: "delete_keys"},
+		{name: "Should not classify unknown errors", err: fmt.Errorf("unknown"), want: "other"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorClass(tt.err); got != tt.want {
+				t.Errorf("ErrorClass(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollector(t *testing.T) {
+	p, collector, _ := newTestProvider(t)
+	if p.GetKind() != "memory" {
+		t.Errorf("GetKind() got = %v, want memory", p.GetKind())
+	}
+
+	if _, err := p.PutStream("a.txt", strings.NewReader("hello")); err != nil {
+		t.Errorf("PutStream() error = %v", err)
+	}
+	writer, err := p.NewWriter(context.Background(), "b.txt")
+	if err != nil {
+		t.Errorf("NewWriter() error = %v", err)
+		return
+	}
+	io.WriteString(writer, "world!")
+	if err := writer.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	reader, err := p.NewReader(context.Background(), "a.txt")
+	if err != nil {
+		t.Errorf("NewReader() error = %v", err)
+		return
+	}
+	io.Copy(ioutil.Discard, reader)
+	reader.Close()
+	object, err := p.Open("b.txt")
+	if err != nil {
+		t.Errorf("Open() error = %v", err)
+		return
+	}
+	object.ReadAt(make([]byte, 3), 1)
+	object.Close()
+	// a method and its Context variant are counted together
+	p.Stat("a.txt")
+	p.StatContext(context.Background(), "missing.txt")
+	p.DeleteKey("missing.txt")
+	it := p.Objects(context.Background(), "")
+	for it.Next() {
+	}
+	// the listing is recorded once, whatever the calls to Next
+	it.Next()
+
+	metric := func(c prometheus.Collector) float64 { return testutil.ToFloat64(c) }
+	tests := []struct {
+		name string
+		got  float64
+		want float64
+	}{
+		{name: "PutStream operations", got: metric(collector.operations.WithLabelValues("memory", "test-bucket", "PutStream")), want: 1},
+		{name: "NewWriter operations", got: metric(collector.operations.WithLabelValues("memory", "test-bucket", "NewWriter")), want: 1},
+		{name: "NewReader operations", got: metric(collector.operations.WithLabelValues("memory", "test-bucket", "NewReader")), want: 1},
+		{name: "Open operations", got: metric(collector.operations.WithLabelValues("memory", "test-bucket", "Open")), want: 1},
+		{name: "Stat operations", got: metric(collector.operations.WithLabelValues("memory", "test-bucket", "Stat")), want: 2},
+		{name: "Objects operations", got: metric(collector.operations.WithLabelValues("memory", "test-bucket", "Objects")), want: 1},
+		{name: "Stat errors", got: metric(collector.errors.WithLabelValues("memory", "test-bucket", "Stat", "not_exist")), want: 1},
+		{name: "DeleteKey errors", got: metric(collector.errors.WithLabelValues("memory", "test-bucket", "DeleteKey", "not_exist")), want: 1},
+		{name: "read bytes", got: metric(collector.readBytes.WithLabelValues("memory", "test-bucket")), want: 5 + 3},
+		{name: "written bytes", got: metric(collector.writtenBytes.WithLabelValues("memory", "test-bucket")), want: 5 + 6},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%v got = %v, want %v", tt.name, tt.got, tt.want)
+		}
+	}
+	if got := testutil.CollectAndCount(collector.durations); got != 7 {
+		t.Errorf("operation_duration_seconds got %v series, want 7", got)
+	}
+}
+
+func TestCollector_Register(t *testing.T) {
+	p, collector, _ := newTestProvider(t)
+	registry := prometheus.NewPedanticRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Errorf("Register() error = %v", err)
+		return
+	}
+	p.PutStream("a.txt", strings.NewReader("a"))
+	p.Stat("missing.txt")
+
+	expected := `
+# HELP gospal_operation_errors_total Number of failed operations of the storage providers, by error class.
+# TYPE gospal_operation_errors_total counter
+gospal_operation_errors_total{bucket="test-bucket",class="not_exist",kind="memory",operation="Stat"} 1
+# HELP gospal_operations_total Number of operations of the storage providers.
+# TYPE gospal_operations_total counter
+gospal_operations_total{bucket="test-bucket",kind="memory",operation="PutStream"} 1
+gospal_operations_total{bucket="test-bucket",kind="memory",operation="Stat"} 1
+# HELP gospal_written_bytes_total Number of bytes written to the storage providers.
+# TYPE gospal_written_bytes_total counter
+gospal_written_bytes_total{bucket="test-bucket",kind="memory"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "gospal_operations_total", "gospal_operation_errors_total", "gospal_written_bytes_total"); err != nil {
+		t.Errorf("GatherAndCompare() error = %v", err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	gospaltest.RunConformance(t, func(t *testing.T) (gospal.Gospal, func()) {
+		p, _, store := newTestProvider(t)
+		return p, store.Reset
+	})
+}
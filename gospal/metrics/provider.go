@@ -0,0 +1,313 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/prometheus/client_golang/prometheus"
+	"io"
+	"time"
+)
+
+// metricsProvider is the Gospal decorator returned by Collector.Wrap
+type metricsProvider struct {
+	provider     gospal.Gospal
+	collector    *Collector
+	kind         string
+	bucket       string
+	readBytes    prometheus.Counter
+	writtenBytes prometheus.Counter
+}
+
+// observe records the operation started at start, failed when *errp is set. It is meant to be deferred:
+//   defer p.observe("Stat", time.Now(), &err)
+func (p *metricsProvider) observe(operation string, start time.Time, errp *error) {
+	p.collector.operations.WithLabelValues(p.kind, p.bucket, operation).Inc()
+	p.collector.durations.WithLabelValues(p.kind, p.bucket, operation).Observe(time.Since(start).Seconds())
+	if *errp != nil {
+		p.collector.errors.WithLabelValues(p.kind, p.bucket, operation, ErrorClass(*errp)).Inc()
+	}
+}
+
+// countingReader counts the bytes read
+type countingReader struct {
+	io.Reader
+	counter prometheus.Counter
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.Reader.Read(b)
+	r.counter.Add(float64(n))
+	return n, err
+}
+
+// countingReadCloser counts the bytes read
+type countingReadCloser struct {
+	io.ReadCloser
+	counter prometheus.Counter
+}
+
+func (r *countingReadCloser) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.counter.Add(float64(n))
+	return n, err
+}
+
+// countingObjectReader counts the bytes read, sequentially or not
+type countingObjectReader struct {
+	gospal.ObjectReader
+	counter prometheus.Counter
+}
+
+func (r *countingObjectReader) Read(b []byte) (int, error) {
+	n, err := r.ObjectReader.Read(b)
+	r.counter.Add(float64(n))
+	return n, err
+}
+
+func (r *countingObjectReader) ReadAt(b []byte, off int64) (int, error) {
+	n, err := r.ObjectReader.ReadAt(b, off)
+	r.counter.Add(float64(n))
+	return n, err
+}
+
+// countingWriter counts the bytes written, the upload being recorded as a NewWriter operation when closed
+type countingWriter struct {
+	io.WriteCloser
+	p     *metricsProvider
+	start time.Time
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	n, err := w.WriteCloser.Write(b)
+	w.p.writtenBytes.Add(float64(n))
+	return n, err
+}
+
+func (w *countingWriter) Close() (err error) {
+	defer w.p.observe("NewWriter", w.start, &err)
+	return w.WriteCloser.Close()
+}
+
+// countingIterator records the listing as an Objects operation once over
+type countingIterator struct {
+	gospal.ObjectIterator
+	p     *metricsProvider
+	start time.Time
+	done  bool
+}
+
+func (it *countingIterator) Next() bool {
+	if it.ObjectIterator.Next() {
+		return true
+	}
+	if !it.done {
+		it.done = true
+		err := it.ObjectIterator.Err()
+		it.p.observe("Objects", it.start, &err)
+	}
+	return false
+}
+
+func (p *metricsProvider) ListKeys(pathName ...string) (keys []string, err error) {
+	defer p.observe("ListKeys", time.Now(), &err)
+	return p.provider.ListKeys(pathName...)
+}
+
+func (p *metricsProvider) ListKeysContext(ctx context.Context, pathName ...string) (keys []string, err error) {
+	defer p.observe("ListKeys", time.Now(), &err)
+	return p.provider.ListKeysContext(ctx, pathName...)
+}
+
+func (p *metricsProvider) ListDir(prefix string) (keys []string, prefixes []string, err error) {
+	defer p.observe("ListDir", time.Now(), &err)
+	return p.provider.ListDir(prefix)
+}
+
+func (p *metricsProvider) ListDirContext(ctx context.Context, prefix string) (keys []string, prefixes []string, err error) {
+	defer p.observe("ListDir", time.Now(), &err)
+	return p.provider.ListDirContext(ctx, prefix)
+}
+
+func (p *metricsProvider) GetStream(filePath string) (reader io.Reader, cancel context.CancelFunc, err error) {
+	defer p.observe("GetStream", time.Now(), &err)
+	if reader, cancel, err = p.provider.GetStream(filePath); err != nil {
+		return reader, cancel, err
+	}
+	return &countingReader{Reader: reader, counter: p.readBytes}, cancel, nil
+}
+
+func (p *metricsProvider) GetStreamContext(ctx context.Context, filePath string) (reader io.Reader, cancel context.CancelFunc, err error) {
+	defer p.observe("GetStream", time.Now(), &err)
+	if reader, cancel, err = p.provider.GetStreamContext(ctx, filePath); err != nil {
+		return reader, cancel, err
+	}
+	return &countingReader{Reader: reader, counter: p.readBytes}, cancel, nil
+}
+
+func (p *metricsProvider) NewReader(ctx context.Context, filePath string) (reader io.ReadCloser, err error) {
+	defer p.observe("NewReader", time.Now(), &err)
+	if reader, err = p.provider.NewReader(ctx, filePath); err != nil {
+		return reader, err
+	}
+	return &countingReadCloser{ReadCloser: reader, counter: p.readBytes}, nil
+}
+
+func (p *metricsProvider) GetRange(filePath string, offset int64, length int64) (reader io.Reader, cancel context.CancelFunc, err error) {
+	defer p.observe("GetRange", time.Now(), &err)
+	if reader, cancel, err = p.provider.GetRange(filePath, offset, length); err != nil {
+		return reader, cancel, err
+	}
+	return &countingReader{Reader: reader, counter: p.readBytes}, cancel, nil
+}
+
+func (p *metricsProvider) GetRangeContext(ctx context.Context, filePath string, offset int64, length int64) (reader io.Reader, cancel context.CancelFunc, err error) {
+	defer p.observe("GetRange", time.Now(), &err)
+	if reader, cancel, err = p.provider.GetRangeContext(ctx, filePath, offset, length); err != nil {
+		return reader, cancel, err
+	}
+	return &countingReader{Reader: reader, counter: p.readBytes}, cancel, nil
+}
+
+func (p *metricsProvider) Open(filePath string) (reader gospal.ObjectReader, err error) {
+	defer p.observe("Open", time.Now(), &err)
+	if reader, err = p.provider.Open(filePath); err != nil {
+		return reader, err
+	}
+	return &countingObjectReader{ObjectReader: reader, counter: p.readBytes}, nil
+}
+
+func (p *metricsProvider) OpenContext(ctx context.Context, filePath string) (reader gospal.ObjectReader, err error) {
+	defer p.observe("Open", time.Now(), &err)
+	if reader, err = p.provider.OpenContext(ctx, filePath); err != nil {
+		return reader, err
+	}
+	return &countingObjectReader{ObjectReader: reader, counter: p.readBytes}, nil
+}
+
+func (p *metricsProvider) PutStream(fileName string, reader io.Reader, opts ...gospal.PutOption) (written int64, err error) {
+	defer p.observe("PutStream", time.Now(), &err)
+	written, err = p.provider.PutStream(fileName, reader, opts...)
+	if written > 0 {
+		p.writtenBytes.Add(float64(written))
+	}
+	return written, err
+}
+
+func (p *metricsProvider) PutStreamContext(ctx context.Context, fileName string, reader io.Reader, opts ...gospal.PutOption) (written int64, err error) {
+	defer p.observe("PutStream", time.Now(), &err)
+	written, err = p.provider.PutStreamContext(ctx, fileName, reader, opts...)
+	if written > 0 {
+		p.writtenBytes.Add(float64(written))
+	}
+	return written, err
+}
+
+// NewWriter records the upload once the writer is closed, the object being committed on close
+func (p *metricsProvider) NewWriter(ctx context.Context, fileName string, opts ...gospal.PutOption) (io.WriteCloser, error) {
+	start := time.Now()
+	writer, err := p.provider.NewWriter(ctx, fileName, opts...)
+	if err != nil {
+		p.observe("NewWriter", start, &err)
+		return nil, err
+	}
+	return &countingWriter{WriteCloser: writer, p: p, start: start}, nil
+}
+
+func (p *metricsProvider) Stat(fileName string) (info *gospal.ObjectInfo, err error) {
+	defer p.observe("Stat", time.Now(), &err)
+	return p.provider.Stat(fileName)
+}
+
+func (p *metricsProvider) StatContext(ctx context.Context, fileName string) (info *gospal.ObjectInfo, err error) {
+	defer p.observe("Stat", time.Now(), &err)
+	return p.provider.StatContext(ctx, fileName)
+}
+
+func (p *metricsProvider) GetKind() string {
+	return p.kind
+}
+
+func (p *metricsProvider) Copy(src string, dst string) (err error) {
+	defer p.observe("Copy", time.Now(), &err)
+	return p.provider.Copy(src, dst)
+}
+
+func (p *metricsProvider) CopyContext(ctx context.Context, src string, dst string) (err error) {
+	defer p.observe("Copy", time.Now(), &err)
+	return p.provider.CopyContext(ctx, src, dst)
+}
+
+func (p *metricsProvider) Move(src string, dst string) (err error) {
+	defer p.observe("Move", time.Now(), &err)
+	return p.provider.Move(src, dst)
+}
+
+func (p *metricsProvider) MoveContext(ctx context.Context, src string, dst string) (err error) {
+	defer p.observe("Move", time.Now(), &err)
+	return p.provider.MoveContext(ctx, src, dst)
+}
+
+func (p *metricsProvider) DeleteKey(fileName string) (err error) {
+	defer p.observe("DeleteKey", time.Now(), &err)
+	return p.provider.DeleteKey(fileName)
+}
+
+func (p *metricsProvider) DeleteKeyContext(ctx context.Context, fileName string) (err error) {
+	defer p.observe("DeleteKey", time.Now(), &err)
+	return p.provider.DeleteKeyContext(ctx, fileName)
+}
+
+func (p *metricsProvider) DeleteKeys(fileNames []string) (err error) {
+	defer p.observe("DeleteKeys", time.Now(), &err)
+	return p.provider.DeleteKeys(fileNames)
+}
+
+func (p *metricsProvider) DeleteKeysContext(ctx context.Context, fileNames []string) (err error) {
+	defer p.observe("DeleteKeys", time.Now(), &err)
+	return p.provider.DeleteKeysContext(ctx, fileNames)
+}
+
+func (p *metricsProvider) DeletePrefix(prefix string) (err error) {
+	defer p.observe("DeletePrefix", time.Now(), &err)
+	return p.provider.DeletePrefix(prefix)
+}
+
+func (p *metricsProvider) DeletePrefixContext(ctx context.Context, prefix string) (err error) {
+	defer p.observe("DeletePrefix", time.Now(), &err)
+	return p.provider.DeletePrefixContext(ctx, prefix)
+}
+
+// Objects records the whole listing as an Objects operation, once the iterator is exhausted
+func (p *metricsProvider) Objects(ctx context.Context, prefix string) gospal.ObjectIterator {
+	return &countingIterator{ObjectIterator: p.provider.Objects(ctx, prefix), p: p, start: time.Now()}
+}
+
+func (p *metricsProvider) ObjectsFrom(ctx context.Context, prefix string, pageToken string) gospal.ObjectIterator {
+	return &countingIterator{ObjectIterator: p.provider.ObjectsFrom(ctx, prefix, pageToken), p: p, start: time.Now()}
+}
+
+func (p *metricsProvider) GetNoSuchKeyErrorString() string {
+	return p.provider.GetNoSuchKeyErrorString()
+}
+
+// Close closes the provider when it holds resources, such as the connection of the sftp provider
+func (p *metricsProvider) Close() error {
+	if closer, ok := p.provider.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
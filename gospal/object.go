@@ -0,0 +1,60 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package gospal
+
+import (
+	"time"
+)
+
+// ObjectInfo holds the metadata of an object as returned by Stat
+type ObjectInfo struct {
+	// The key of the object, as given to the provider
+	Key string
+
+	// Size of the object in bytes
+	Size int64
+
+	// Last modification time of the object
+	LastModified time.Time
+
+	// ETag of the object, without the surrounding quotes. Empty when the provider has no such notion
+	ETag string
+
+	// MD5 hash of the object contents. nil when not known by the provider
+	// eg.: for aws multipart uploads the ETag is not the MD5 of the contents
+	MD5 []byte
+
+	// Content type of the object. Empty when unknown
+	ContentType string
+
+	// Content encoding of the object. Empty when not set
+	ContentEncoding string
+
+	// Cache-Control header of the object. Empty when not set
+	CacheControl string
+
+	// User defined metadata of the object, see PutOptions.Metadata
+	Metadata map[string]string
+}
+
+// PutOptions returns the options to put an object with the same attributes
+func (o *ObjectInfo) PutOptions() []PutOption {
+	return []PutOption{
+		WithContentType(o.ContentType),
+		WithContentEncoding(o.ContentEncoding),
+		WithCacheControl(o.CacheControl),
+		WithMetadata(o.Metadata),
+	}
+}
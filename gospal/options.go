@@ -0,0 +1,76 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package gospal
+
+// PutOptions holds the attributes given to an object when putting it. Empty attributes are left to the provider
+// defaults
+type PutOptions struct {
+	// Content type of the object, eg.: application/json
+	ContentType string
+
+	// Content encoding of the object, eg.: gzip
+	ContentEncoding string
+
+	// Cache-Control header served along with the object, eg.: no-cache
+	CacheControl string
+
+	// User defined metadata. The providers may canonicalize the keys, eg.: aws returns them capitalized
+	Metadata map[string]string
+}
+
+// PutOption sets one of the PutOptions, see PutStream
+type PutOption func(*PutOptions)
+
+// NewPutOptions returns the PutOptions set by the specified options
+func NewPutOptions(opts ...PutOption) *PutOptions {
+	options := &PutOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+	return options
+}
+
+// WithContentType sets the content type of the object
+func WithContentType(contentType string) PutOption {
+	return func(o *PutOptions) {
+		o.ContentType = contentType
+	}
+}
+
+// WithContentEncoding sets the content encoding of the object
+func WithContentEncoding(contentEncoding string) PutOption {
+	return func(o *PutOptions) {
+		o.ContentEncoding = contentEncoding
+	}
+}
+
+// WithCacheControl sets the Cache-Control header of the object
+func WithCacheControl(cacheControl string) PutOption {
+	return func(o *PutOptions) {
+		o.CacheControl = cacheControl
+	}
+}
+
+// WithMetadata adds the user defined metadata to the object. It may be given several times
+func WithMetadata(metadata map[string]string) PutOption {
+	return func(o *PutOptions) {
+		if o.Metadata == nil {
+			o.Metadata = make(map[string]string, len(metadata))
+		}
+		for key, value := range metadata {
+			o.Metadata[key] = value
+		}
+	}
+}
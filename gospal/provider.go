@@ -22,6 +22,9 @@ import (
 const (
 	defaultTimeOut = 300
 	defaultMaxKeys = 1024
+
+	// DefaultDelimiter is the delimiter used by ListDir when ProviderConfig.Delimiter is not set
+	DefaultDelimiter = "/"
 )
 
 //ProviderLabel represents a provider string label such as gcp or aws
@@ -34,23 +37,87 @@ var (
 	ProviderGCP ProviderLabel = "gcp"
 	//ProviderLocal ProviderLabel for Local
 	ProviderLocal ProviderLabel = "local"
+	//ProviderMemory ProviderLabel for the in-memory provider, meant for tests
+	ProviderMemory ProviderLabel = "memory"
+	//ProviderAzure ProviderLabel for Azure Blob Storage
+	ProviderAzure ProviderLabel = "azure"
+	//ProviderSFTP ProviderLabel for SFTP servers
+	ProviderSFTP ProviderLabel = "sftp"
+	//ProviderHTTP ProviderLabel for read-only http origins
+	ProviderHTTP ProviderLabel = "http"
+	//ProviderArchive ProviderLabel for the read-only zip and tar archives stored on another provider
+	ProviderArchive ProviderLabel = "archive"
 )
 
 //Gospal interface that represents a Storage Gospal
 //  * ListKeys: List all keys in a specified optional path within the configured bucket
-//  * GetStream: Stream out a specified. Return a io.Reader of the specified key within the configured bucket
-//  * PutStream: Stream in a given io.Reader to the specified key within the configured bucket
+//  * GetStream: Stream out a specified. Return a io.Reader of the specified key within the configured bucket, the
+//    returned cancel function has to be called to release the stream.
+//    Deprecated: use NewReader, which io.ReadCloser is closed the usual way
+//  * NewReader: Return an io.ReadCloser of the specified key within the configured bucket. Closing it releases the
+//    underlying connection or file
+//  * PutStream: Stream in a given io.Reader to the specified key within the configured bucket. The content type,
+//    encoding, cache control and user metadata of the object may be set using PutOption, eg.: WithContentType
+//  * NewWriter: Return an io.WriteCloser to the specified key within the configured bucket, taking the same options as
+//    PutStream. The object is only committed by Close, which returns the upload error if any. Canceling the context
+//    before closing the writer aborts the upload
 //  * GetKind: Return the provider kind, the provider name
 //  * DeleteKey: remove the specified key within the configured bucket
-//  * GetNoSuchKeyErrorString: return the error message for this provider when a key is not found
+//  * GetNoSuchKeyErrorString: return the error message for this provider when a key is not found.
+//    Deprecated: errors are classified whatever the provider, use errors.Is(err, errors.ErrNotExist) instead
+//  * Stat: return the metadata (size, last modification, etag...) of the specified key without fetching it
+//  * Objects: stream the objects under the specified prefix one page at a time, see ObjectIterator
+//  * ObjectsFrom: same as Objects, resuming the listing from a page token returned by ObjectIterator.PageToken
+//  * Copy: copy the source key to the destination key within the configured bucket, server side whenever possible
+//  * Move: move the source key to the destination key within the configured bucket
+//  * ListDir: list the keys and the sub prefixes ("directories") right under the specified prefix, see ProviderConfig.Delimiter
+//  * GetRange: same as GetStream, streaming only length bytes starting at offset. A negative length streams up to the
+//    end of the object
+//  * Open: return an ObjectReader giving random access (io.ReadSeeker, io.ReaderAt) to the specified key without
+//    fetching it all
+//  * DeleteKeys: remove the specified keys in batches, a failure on one key does not stop the others. The keys which
+//    could not be removed are reported by a *errors.DeleteKeysError
+//  * DeletePrefix: remove every key under the specified prefix, nested ones included whatever the delimiter,
+//    reporting failures the same way as DeleteKeys. An error stopping the listing is returned as well, as
+//    the Err of the DeleteKeysError when some keys also failed
+//
+// Every operation has a *Context variant taking a context.Context as first argument, allowing the caller to cancel it
+// or set a deadline. The plain variants use the context given to the provider constructor. NewReader and
+// NewWriter take the context as first argument and have no such variant.
 type Gospal interface {
 	ListKeys(...string) ([]string, error)
+	ListKeysContext(context.Context, ...string) ([]string, error)
+	ListDir(string) ([]string, []string, error)
+	ListDirContext(context.Context, string) ([]string, []string, error)
 	GetStream(string) (io.Reader, context.CancelFunc, error)
-	PutStream(string, io.Reader) (int64, error)
+	GetStreamContext(context.Context, string) (io.Reader, context.CancelFunc, error)
+	NewReader(context.Context, string) (io.ReadCloser, error)
+	GetRange(string, int64, int64) (io.Reader, context.CancelFunc, error)
+	GetRangeContext(context.Context, string, int64, int64) (io.Reader, context.CancelFunc, error)
+	Open(string) (ObjectReader, error)
+	OpenContext(context.Context, string) (ObjectReader, error)
+	PutStream(string, io.Reader, ...PutOption) (int64, error)
+	PutStreamContext(context.Context, string, io.Reader, ...PutOption) (int64, error)
+	NewWriter(context.Context, string, ...PutOption) (io.WriteCloser, error)
+	Stat(string) (*ObjectInfo, error)
+	StatContext(context.Context, string) (*ObjectInfo, error)
 
 	GetKind() string
 
+	Copy(string, string) error
+	CopyContext(context.Context, string, string) error
+	Move(string, string) error
+	MoveContext(context.Context, string, string) error
+
 	DeleteKey(string) error
+	DeleteKeyContext(context.Context, string) error
+	DeleteKeys([]string) error
+	DeleteKeysContext(context.Context, []string) error
+	DeletePrefix(string) error
+	DeletePrefixContext(context.Context, string) error
+
+	Objects(context.Context, string) ObjectIterator
+	ObjectsFrom(context.Context, string, string) ObjectIterator
 
 	GetNoSuchKeyErrorString() string
 }
@@ -64,13 +131,17 @@ type ProviderConfig struct {
 	// for aws will call s3://bucketName/keyName
 	// when set to bladibla
 	// for aws will call s3://bucketName/bladibla/keyName
+	// for local will use directory/bladibla/keyName
+	// Keys returned by the providers are relative to it, see TargetKey
 	// A single character used to separate individual fields in a record. You can
 	GlobalPrefix string
 
 	// specify an arbitrary delimiter.
+	// ListDir uses it to split keys into directories, defaulting to "/" when not set. The local provider always uses
+	// the directories of the filesystem.
 	Delimiter string
 
-	// AWS Only: max number of key to fetch at once
+	// max number of key to fetch at once, the page size of object iterators
 	MaxKeys int64
 
 	// Provider Specific Configuration.
@@ -0,0 +1,155 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package gospal
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ObjectReader gives random access to the content of an object. It has to be closed to release the underlying
+// connection or file
+type ObjectReader interface {
+	io.Reader
+	io.Seeker
+	io.ReaderAt
+	io.Closer
+	// Size returns the size of the object, as when it has been opened
+	Size() int64
+}
+
+// rangeReader is an ObjectReader fetching the object using ranged reads. Sequential reads share a single stream,
+// opened on the first read following a seek
+type rangeReader struct {
+	ctx      context.Context
+	provider Gospal
+	key      string
+	size     int64
+	offset   int64
+	stream   io.Reader
+	cancel   context.CancelFunc
+}
+
+// NewRangeReader returns an ObjectReader over the key of the provider relying on GetRangeContext. It is meant for the
+// providers which can not seek their streams
+func NewRangeReader(ctx context.Context, provider Gospal, key string, size int64) ObjectReader {
+	return &rangeReader{ctx: ctx, provider: provider, key: key, size: size}
+}
+
+func (r *rangeReader) Size() int64 {
+	return r.size
+}
+
+func (r *rangeReader) Read(b []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.stream == nil {
+		stream, cancel, err := r.provider.GetRangeContext(r.ctx, r.key, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.stream, r.cancel = stream, cancel
+	}
+	n, err := r.stream.Read(b)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *rangeReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("Seek: negative position")
+	}
+	if offset != r.offset {
+		// the next read opens a new stream at the new offset
+		r.closeStream()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+func (r *rangeReader) ReadAt(b []byte, offset int64) (int, error) {
+	if offset >= r.size {
+		return 0, io.EOF
+	}
+	length := int64(len(b))
+	if offset+length > r.size {
+		length = r.size - offset
+	}
+	stream, cancel, err := r.provider.GetRangeContext(r.ctx, r.key, offset, length)
+	if err != nil {
+		return 0, err
+	}
+	defer cancel()
+	n, err := io.ReadFull(stream, b[:length])
+	if err == nil && n < len(b) {
+		// ReadAt has to explain why less bytes than asked have been read
+		err = io.EOF
+	}
+	return n, err
+}
+
+func (r *rangeReader) Close() error {
+	r.closeStream()
+	return nil
+}
+
+func (r *rangeReader) closeStream() {
+	if r.stream == nil {
+		return
+	}
+	r.cancel()
+	r.stream, r.cancel = nil, nil
+}
+
+// readCloser is an io.ReadCloser releasing the context of the read along with the underlying reader
+type readCloser struct {
+	io.Reader
+	closer io.Closer
+	cancel context.CancelFunc
+}
+
+// NewReadCloser returns an io.ReadCloser reading from reader, which Close closes closer then calls cancel. Both
+// closer and cancel may be nil
+func NewReadCloser(reader io.Reader, closer io.Closer, cancel context.CancelFunc) io.ReadCloser {
+	return &readCloser{Reader: reader, closer: closer, cancel: cancel}
+}
+
+func (r *readCloser) Close() error {
+	var err error
+	if r.closer != nil {
+		err = r.closer.Close()
+	}
+	if r.cancel != nil {
+		r.cancel()
+	}
+	return err
+}
+
+// ToStream adapts the result of NewReader to the deprecated GetStream signature: the returned cancel function closes
+// the reader. It is never nil, calling it on error is a no-op
+func ToStream(reader io.ReadCloser, err error) (io.Reader, context.CancelFunc, error) {
+	if err != nil {
+		return nil, func() {}, err
+	}
+	return reader, func() { reader.Close() }, nil
+}
@@ -0,0 +1,540 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package gospal
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	gospalerrors "github.com/contentsquare/gospal/gospal/errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultMaxAttempts    = 3
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 10 * time.Second
+)
+
+// RetryPolicy sets how WithRetry retries the failed operations. The zero values are replaced by the defaults
+type RetryPolicy struct {
+	// MaxAttempts is the maximum number of attempts of an operation, the first one included. Defaults to 3
+	MaxAttempts int
+
+	// InitialBackoff is the upper bound of the wait before the first retry, doubled at each retry. The actual wait is
+	// drawn at random up to it. Defaults to 100ms
+	InitialBackoff time.Duration
+
+	// MaxBackoff caps the upper bound of the waits. Defaults to 10s
+	MaxBackoff time.Duration
+
+	// Retryable tells whether an operation failing with the error may be retried. Defaults to IsRetryable
+	Retryable func(error) bool
+
+	// MaxPutBuffer is the size up to which the PutStream bodies which can not be seeked are buffered in memory, so
+	// they can be replayed. The larger bodies are put once. Defaults to 0, not buffering any body
+	MaxPutBuffer int64
+}
+
+// DefaultRetryPolicy returns the default policy: 3 attempts, waiting up to 100ms then 200ms between them
+func DefaultRetryPolicy() *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    defaultMaxAttempts,
+		InitialBackoff: defaultInitialBackoff,
+		MaxBackoff:     defaultMaxBackoff,
+		Retryable:      IsRetryable,
+	}
+}
+
+// IsRetryable tells whether the error is transient: either classified as errors.ErrTransient by the provider, such as
+// the server errors and the throttling of the storages, or a network failure (connection reset, timeout...).
+// Canceled operations are never retried
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, gospalerrors.ErrCanceled) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, gospalerrors.ErrTransient) {
+		return true
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNABORTED) || errors.Is(err, syscall.EPIPE) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retryProvider is the Gospal decorator returned by WithRetry
+type retryProvider struct {
+	provider Gospal
+	policy   RetryPolicy
+}
+
+// WithRetry returns a provider retrying the idempotent operations of the provider which fail on a transient error,
+// waiting a jittered exponential backoff between the attempts. The waits never exceed the deadline of the context of
+// the operation, the operation failing straight away with its last error instead:
+//   provider = gospal.WithRetry(provider, gospal.DefaultRetryPolicy())
+// Listings, reads (the opening of the streams, not the reads of the streams), Stat, Copy and deletes are retried,
+// a listing resuming from the page of the last listed object. PutStream is retried when its body can be replayed,
+// either an io.Seeker or buffered up to RetryPolicy.MaxPutBuffer. Neither Move nor NewWriter are retried.
+// A put may be committed although it failed on the way back: a retry of a conditional put failing with
+// errors.ErrAlreadyExists or errors.ErrPreconditionFailed is not retried further, the error of the previous attempt
+// being returned as the outcome is unknown.
+// A nil policy is the default policy
+func WithRetry(provider Gospal, policy *RetryPolicy) Gospal {
+	r := &retryProvider{provider: provider, policy: *DefaultRetryPolicy()}
+	if policy != nil {
+		r.policy = *policy
+		defaults := DefaultRetryPolicy()
+		if r.policy.MaxAttempts <= 0 {
+			r.policy.MaxAttempts = defaults.MaxAttempts
+		}
+		if r.policy.InitialBackoff <= 0 {
+			r.policy.InitialBackoff = defaults.InitialBackoff
+		}
+		if r.policy.MaxBackoff <= 0 {
+			r.policy.MaxBackoff = defaults.MaxBackoff
+		}
+		if r.policy.Retryable == nil {
+			r.policy.Retryable = defaults.Retryable
+		}
+	}
+	return r
+}
+
+// backoff returns the wait before the retry following the attempt, drawn at random up to the exponential backoff
+func (r *retryProvider) backoff(attempt int) time.Duration {
+	backoff := r.policy.MaxBackoff
+	if attempt <= 32 {
+		if b := r.policy.InitialBackoff << uint(attempt-1); b > 0 && b < backoff {
+			backoff = b
+		}
+	}
+	return time.Duration(rand.Int63n(int64(backoff) + 1))
+}
+
+// wait waits before the retry following the attempt. It returns false when the context is done before, or would be
+func (r *retryProvider) wait(ctx context.Context, attempt int) bool {
+	backoff := r.backoff(attempt)
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+		return false
+	}
+	timer := time.NewTimer(backoff)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// retry calls op until it succeeds, fails on an error which can not be retried, or runs out of attempts. The error
+// of the last attempt is returned
+func (r *retryProvider) retry(ctx context.Context, op func(attempt int) error) error {
+	for attempt := 1; ; attempt++ {
+		err := op(attempt)
+		if err == nil || attempt >= r.policy.MaxAttempts || !r.policy.Retryable(err) || !r.wait(ctx, attempt) {
+			return err
+		}
+	}
+}
+
+// replayableBody returns the body along with the function rewinding it to its start, nil when the body can not be
+// replayed
+func (r *retryProvider) replayableBody(reader io.Reader) (io.Reader, func() error, error) {
+	if seeker, ok := reader.(io.Seeker); ok {
+		// some files, such as pipes, can not be seeked
+		if start, err := seeker.Seek(0, io.SeekCurrent); err == nil {
+			return reader, func() error {
+				_, err := seeker.Seek(start, io.SeekStart)
+				return err
+			}, nil
+		}
+	}
+	if r.policy.MaxPutBuffer <= 0 {
+		return reader, nil, nil
+	}
+	buffer, err := ioutil.ReadAll(io.LimitReader(reader, r.policy.MaxPutBuffer+1))
+	if err != nil {
+		return nil, nil, err
+	}
+	if int64(len(buffer)) > r.policy.MaxPutBuffer {
+		return io.MultiReader(bytes.NewReader(buffer), reader), nil, nil
+	}
+	body := bytes.NewReader(buffer)
+	return body, func() error {
+		_, err := body.Seek(0, io.SeekStart)
+		return err
+	}, nil
+}
+
+// putStream puts the body, retrying when it can be replayed. A conflict on retry may be caused by the previous attempt,
+// committed although it failed on the way back, the error of the previous attempt is returned instead
+func (r *retryProvider) putStream(ctx context.Context, fileName string, reader io.Reader, put func(io.Reader) (int64, error)) (int64, error) {
+	body, rewind, err := r.replayableBody(reader)
+	if err != nil {
+		return -1, gospalerrors.ErrorPutStreamReader(fileName, err)
+	}
+	if rewind == nil {
+		return put(body)
+	}
+	var (
+		written  int64
+		previous error
+		unknown  bool
+	)
+	err = r.retry(ctx, func(attempt int) error {
+		if attempt > 1 {
+			if err := rewind(); err != nil {
+				return gospalerrors.ErrorPutStreamReader(fileName, err)
+			}
+		}
+		written, err = put(body)
+		if attempt > 1 && (errors.Is(err, gospalerrors.ErrAlreadyExists) || errors.Is(err, gospalerrors.ErrPreconditionFailed)) {
+			// stops the retries
+			unknown = true
+			return nil
+		}
+		previous = err
+		return err
+	})
+	if unknown {
+		return -1, previous
+	}
+	return written, err
+}
+
+// deleteKey deletes the key. A key missing on retry is taken as deleted by the previous attempt, which failed on
+// the way back
+func (r *retryProvider) deleteKey(ctx context.Context, del func() error) error {
+	return r.retry(ctx, func(attempt int) error {
+		err := del()
+		if attempt > 1 && errors.Is(err, gospalerrors.ErrNotExist) {
+			return nil
+		}
+		return err
+	})
+}
+
+// deleteKeys deletes the keys, retrying only the keys which failed on a transient error. The failures of the keys are
+// merged across the attempts, an error of the whole call being returned as is until some keys fail on their own
+func (r *retryProvider) deleteKeys(ctx context.Context, fileNames []string, del func([]string) error) error {
+	failures := map[string]error{}
+	partial := false
+	err := r.retry(ctx, func(attempt int) error {
+		err := del(fileNames)
+		var deleteErr *gospalerrors.DeleteKeysError
+		if !errors.As(err, &deleteErr) {
+			// the whole call either succeeded or failed
+			for _, key := range fileNames {
+				if err == nil {
+					delete(failures, key)
+				} else {
+					failures[key] = err
+				}
+			}
+			return err
+		}
+		partial = true
+		var retried []string
+		for _, key := range deleteErr.Keys() {
+			keyErr := deleteErr.Errors[key]
+			switch {
+			case attempt > 1 && errors.Is(keyErr, gospalerrors.ErrNotExist):
+				// deleted by the previous attempt
+				delete(failures, key)
+			case r.policy.Retryable(keyErr):
+				failures[key] = keyErr
+				retried = append(retried, key)
+			default:
+				failures[key] = keyErr
+			}
+		}
+		for _, key := range fileNames {
+			if _, ok := deleteErr.Errors[key]; !ok {
+				delete(failures, key)
+			}
+		}
+		if len(retried) == 0 {
+			return nil
+		}
+		fileNames = retried
+		return deleteErr.Errors[retried[0]]
+	})
+	if !partial {
+		return err
+	}
+	return gospalerrors.ErrorDeleteKeys(failures)
+}
+
+func (r *retryProvider) ListKeys(pathName ...string) (keys []string, err error) {
+	err = r.retry(context.Background(), func(int) error {
+		keys, err = r.provider.ListKeys(pathName...)
+		return err
+	})
+	return keys, err
+}
+
+func (r *retryProvider) ListKeysContext(ctx context.Context, pathName ...string) (keys []string, err error) {
+	err = r.retry(ctx, func(int) error {
+		keys, err = r.provider.ListKeysContext(ctx, pathName...)
+		return err
+	})
+	return keys, err
+}
+
+func (r *retryProvider) ListDir(prefix string) (keys []string, prefixes []string, err error) {
+	err = r.retry(context.Background(), func(int) error {
+		keys, prefixes, err = r.provider.ListDir(prefix)
+		return err
+	})
+	return keys, prefixes, err
+}
+
+func (r *retryProvider) ListDirContext(ctx context.Context, prefix string) (keys []string, prefixes []string, err error) {
+	err = r.retry(ctx, func(int) error {
+		keys, prefixes, err = r.provider.ListDirContext(ctx, prefix)
+		return err
+	})
+	return keys, prefixes, err
+}
+
+func (r *retryProvider) GetStream(filePath string) (reader io.Reader, cancel context.CancelFunc, err error) {
+	err = r.retry(context.Background(), func(int) error {
+		reader, cancel, err = r.provider.GetStream(filePath)
+		return err
+	})
+	return reader, cancel, err
+}
+
+func (r *retryProvider) GetStreamContext(ctx context.Context, filePath string) (reader io.Reader, cancel context.CancelFunc, err error) {
+	err = r.retry(ctx, func(int) error {
+		reader, cancel, err = r.provider.GetStreamContext(ctx, filePath)
+		return err
+	})
+	return reader, cancel, err
+}
+
+func (r *retryProvider) NewReader(ctx context.Context, filePath string) (reader io.ReadCloser, err error) {
+	err = r.retry(ctx, func(int) error {
+		reader, err = r.provider.NewReader(ctx, filePath)
+		return err
+	})
+	return reader, err
+}
+
+func (r *retryProvider) GetRange(filePath string, offset int64, length int64) (reader io.Reader, cancel context.CancelFunc, err error) {
+	err = r.retry(context.Background(), func(int) error {
+		reader, cancel, err = r.provider.GetRange(filePath, offset, length)
+		return err
+	})
+	return reader, cancel, err
+}
+
+func (r *retryProvider) GetRangeContext(ctx context.Context, filePath string, offset int64, length int64) (reader io.Reader, cancel context.CancelFunc, err error) {
+	err = r.retry(ctx, func(int) error {
+		reader, cancel, err = r.provider.GetRangeContext(ctx, filePath, offset, length)
+		return err
+	})
+	return reader, cancel, err
+}
+
+func (r *retryProvider) Open(filePath string) (reader ObjectReader, err error) {
+	err = r.retry(context.Background(), func(int) error {
+		reader, err = r.provider.Open(filePath)
+		return err
+	})
+	return reader, err
+}
+
+func (r *retryProvider) OpenContext(ctx context.Context, filePath string) (reader ObjectReader, err error) {
+	err = r.retry(ctx, func(int) error {
+		reader, err = r.provider.OpenContext(ctx, filePath)
+		return err
+	})
+	return reader, err
+}
+
+func (r *retryProvider) PutStream(fileName string, reader io.Reader, opts ...PutOption) (int64, error) {
+	return r.putStream(context.Background(), fileName, reader, func(body io.Reader) (int64, error) {
+		return r.provider.PutStream(fileName, body, opts...)
+	})
+}
+
+func (r *retryProvider) PutStreamContext(ctx context.Context, fileName string, reader io.Reader, opts ...PutOption) (int64, error) {
+	return r.putStream(ctx, fileName, reader, func(body io.Reader) (int64, error) {
+		return r.provider.PutStreamContext(ctx, fileName, body, opts...)
+	})
+}
+
+func (r *retryProvider) NewWriter(ctx context.Context, fileName string, opts ...PutOption) (io.WriteCloser, error) {
+	return r.provider.NewWriter(ctx, fileName, opts...)
+}
+
+func (r *retryProvider) Stat(fileName string) (info *ObjectInfo, err error) {
+	err = r.retry(context.Background(), func(int) error {
+		info, err = r.provider.Stat(fileName)
+		return err
+	})
+	return info, err
+}
+
+func (r *retryProvider) StatContext(ctx context.Context, fileName string) (info *ObjectInfo, err error) {
+	err = r.retry(ctx, func(int) error {
+		info, err = r.provider.StatContext(ctx, fileName)
+		return err
+	})
+	return info, err
+}
+
+func (r *retryProvider) GetKind() string {
+	return r.provider.GetKind()
+}
+
+func (r *retryProvider) Copy(src string, dst string) error {
+	return r.retry(context.Background(), func(int) error {
+		return r.provider.Copy(src, dst)
+	})
+}
+
+func (r *retryProvider) CopyContext(ctx context.Context, src string, dst string) error {
+	return r.retry(ctx, func(int) error {
+		return r.provider.CopyContext(ctx, src, dst)
+	})
+}
+
+func (r *retryProvider) Move(src string, dst string) error {
+	return r.provider.Move(src, dst)
+}
+
+func (r *retryProvider) MoveContext(ctx context.Context, src string, dst string) error {
+	return r.provider.MoveContext(ctx, src, dst)
+}
+
+func (r *retryProvider) DeleteKey(fileName string) error {
+	return r.deleteKey(context.Background(), func() error {
+		return r.provider.DeleteKey(fileName)
+	})
+}
+
+func (r *retryProvider) DeleteKeyContext(ctx context.Context, fileName string) error {
+	return r.deleteKey(ctx, func() error {
+		return r.provider.DeleteKeyContext(ctx, fileName)
+	})
+}
+
+func (r *retryProvider) DeleteKeys(fileNames []string) error {
+	return r.deleteKeys(context.Background(), fileNames, r.provider.DeleteKeys)
+}
+
+func (r *retryProvider) DeleteKeysContext(ctx context.Context, fileNames []string) error {
+	return r.deleteKeys(ctx, fileNames, func(fileNames []string) error {
+		return r.provider.DeleteKeysContext(ctx, fileNames)
+	})
+}
+
+func (r *retryProvider) DeletePrefix(prefix string) error {
+	return r.retry(context.Background(), func(int) error {
+		return r.provider.DeletePrefix(prefix)
+	})
+}
+
+func (r *retryProvider) DeletePrefixContext(ctx context.Context, prefix string) error {
+	return r.retry(ctx, func(int) error {
+		return r.provider.DeletePrefixContext(ctx, prefix)
+	})
+}
+
+func (r *retryProvider) Objects(ctx context.Context, prefix string) ObjectIterator {
+	return r.ObjectsFrom(ctx, prefix, "")
+}
+
+func (r *retryProvider) ObjectsFrom(ctx context.Context, prefix string, pageToken string) ObjectIterator {
+	return &retryIterator{
+		ctx:       ctx,
+		r:         r,
+		prefix:    prefix,
+		it:        r.provider.ObjectsFrom(ctx, prefix, pageToken),
+		pageToken: pageToken,
+	}
+}
+
+func (r *retryProvider) GetNoSuchKeyErrorString() string {
+	return r.provider.GetNoSuchKeyErrorString()
+}
+
+// Close closes the provider when it holds resources, such as the connection of the sftp provider
+func (r *retryProvider) Close() error {
+	if closer, ok := r.provider.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// retryIterator resumes the listing from the page of the current object when it fails on a transient error, skipping
+// the objects of the page already listed
+type retryIterator struct {
+	ctx       context.Context
+	r         *retryProvider
+	prefix    string
+	it        ObjectIterator
+	pageToken string
+	listed    int
+	attempt   int
+	err       error
+}
+
+func (it *retryIterator) Next() bool {
+	for it.err == nil {
+		if it.it.Next() {
+			if token := it.it.PageToken(); token != it.pageToken {
+				it.pageToken, it.listed = token, 0
+			}
+			it.listed++
+			it.attempt = 0
+			return true
+		}
+		err := it.it.Err()
+		if err == nil {
+			return false
+		}
+		it.attempt++
+		if it.attempt >= it.r.policy.MaxAttempts || !it.r.policy.Retryable(err) || !it.r.wait(it.ctx, it.attempt) {
+			it.err = err
+			return false
+		}
+		it.it = it.r.provider.ObjectsFrom(it.ctx, it.prefix, it.pageToken)
+		for skipped := 0; skipped < it.listed && it.it.Next(); skipped++ {
+		}
+	}
+	return false
+}
+
+func (it *retryIterator) Object() *ObjectInfo {
+	return it.it.Object()
+}
+
+func (it *retryIterator) Err() error {
+	return it.err
+}
+
+func (it *retryIterator) PageToken() string {
+	return it.it.PageToken()
+}
@@ -0,0 +1,398 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package gospal_test
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/gospaltest"
+	memprovider "github.com/contentsquare/gospal/gospal/memory"
+	"io"
+	"io/ioutil"
+	"net"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// errTransient is the failure injected by the flaky provider
+var errTransient = errors.Wrap(errors.ErrTransient, fmt.Errorf("503 Service Unavailable"))
+
+// flakyProvider fails the first calls of its methods on a transient error
+type flakyProvider struct {
+	gospal.Gospal
+	// failures is the number of calls of each method left to fail
+	failures map[string]int
+	calls    map[string]int
+}
+
+func newFlakyProvider(t *testing.T, failures map[string]int, config *gospal.ProviderConfig) (*flakyProvider, *memprovider.Store) {
+	store := memprovider.Bucket("retry-" + t.Name())
+	store.Reset()
+	p, _ := memprovider.New(context.Background(), "retry-"+t.Name(), config)
+	return &flakyProvider{Gospal: p, failures: failures, calls: map[string]int{}}, store
+}
+
+// fail counts the call of the method, and tells whether it has to fail
+func (p *flakyProvider) fail(method string) bool {
+	p.calls[method]++
+	if p.failures[method] > 0 {
+		p.failures[method]--
+		return true
+	}
+	return false
+}
+
+func (p *flakyProvider) Stat(fileName string) (*gospal.ObjectInfo, error) {
+	return p.StatContext(context.Background(), fileName)
+}
+
+func (p *flakyProvider) StatContext(ctx context.Context, fileName string) (*gospal.ObjectInfo, error) {
+	if p.fail("Stat") {
+		return nil, errTransient
+	}
+	return p.Gospal.StatContext(ctx, fileName)
+}
+
+func (p *flakyProvider) PutStream(fileName string, reader io.Reader, opts ...gospal.PutOption) (int64, error) {
+	// the failing puts read some of the body
+	if p.fail("PutStream") {
+		_, _ = io.CopyN(ioutil.Discard, reader, 2)
+		return -1, errTransient
+	}
+	return p.Gospal.PutStream(fileName, reader, opts...)
+}
+
+func (p *flakyProvider) DeleteKey(fileName string) error {
+	// the failing deletes fail on the way back, the key being deleted
+	err := p.Gospal.DeleteKey(fileName)
+	if p.fail("DeleteKey") {
+		return errTransient
+	}
+	return err
+}
+
+func (p *flakyProvider) DeleteKeys(fileNames []string) error {
+	var keys []string
+	failures := map[string]error{}
+	for _, key := range fileNames {
+		if strings.HasPrefix(key, "flaky") && p.fail("DeleteKeys:"+key) {
+			failures[key] = errTransient
+		} else {
+			keys = append(keys, key)
+		}
+	}
+	var deleteErr *errors.DeleteKeysError
+	if err := p.Gospal.DeleteKeys(keys); stderrors.As(err, &deleteErr) {
+		for key, err := range deleteErr.Errors {
+			failures[key] = err
+		}
+	}
+	p.calls["DeleteKeys"]++
+	return errors.ErrorDeleteKeys(failures)
+}
+
+func (p *flakyProvider) ObjectsFrom(ctx context.Context, prefix string, pageToken string) gospal.ObjectIterator {
+	p.calls["ObjectsFrom"]++
+	return &flakyIterator{ObjectIterator: p.Gospal.ObjectsFrom(ctx, prefix, pageToken), p: p}
+}
+
+// flakyIterator fails once it has listed 3 objects, as long as the provider fails the listings
+type flakyIterator struct {
+	gospal.ObjectIterator
+	p      *flakyProvider
+	listed int
+	err    error
+}
+
+func (it *flakyIterator) Next() bool {
+	if it.err != nil {
+		return false
+	}
+	if it.listed == 3 && it.p.fail("Objects") {
+		it.err = errTransient
+		return false
+	}
+	it.listed++
+	return it.ObjectIterator.Next()
+}
+
+func (it *flakyIterator) Err() error {
+	if it.err != nil {
+		return it.err
+	}
+	return it.ObjectIterator.Err()
+}
+
+// testPolicy retries without waiting long
+var testPolicy = &gospal.RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+var _ net.Error = timeoutError{}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "Should retry transient errors", err: errTransient, want: true},
+		{name: "Should retry reset connections", err: &net.OpError{Op: "read", Err: syscall.ECONNRESET}, want: true},
+		{name: "Should retry truncated responses", err: fmt.Errorf("reading body: %w", io.ErrUnexpectedEOF), want: true},
+		{name: "Should retry timeouts", err: &net.OpError{Op: "dial", Err: timeoutError{}}, want: true},
+		{name: "Should not retry missing keys", err: errors.Wrap(errors.ErrNotExist, fmt.Errorf("404")), want: false},
+		{name: "Should not retry canceled operations", err: errors.Wrap(errors.ErrCanceled, context.Canceled), want: false},
+		{name: "Should not retry exceeded deadlines", err: context.DeadlineExceeded, want: false},
+		{name: "Should not retry unknown errors", err: fmt.Errorf("unknown"), want: false},
+		{name: "Should not retry nil", err: nil, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := gospal.IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithRetry_Stat(t *testing.T) {
+	tests := []struct {
+		name      string
+		failures  int
+		key       string
+		wantErr   error
+		wantCalls int
+	}{
+		{name: "Should succeed at first attempt", failures: 0, key: "a.txt", wantErr: nil, wantCalls: 1},
+		{name: "Should retry transient errors", failures: 2, key: "a.txt", wantErr: nil, wantCalls: 3},
+		{name: "Should give up after the last attempt", failures: 3, key: "a.txt", wantErr: errors.ErrTransient, wantCalls: 3},
+		{name: "Should not retry other errors", failures: 0, key: "missing.txt", wantErr: errors.ErrNotExist, wantCalls: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flaky, store := newFlakyProvider(t, map[string]int{"Stat": tt.failures}, gospal.NewProviderConfig())
+			store.Put("a.txt", []byte("a"))
+			_, err := gospal.WithRetry(flaky, testPolicy).Stat(tt.key)
+			if (err == nil) != (tt.wantErr == nil) || (err != nil && !stderrors.Is(err, tt.wantErr)) {
+				t.Errorf("Stat() error = %v, want %v", err, tt.wantErr)
+			}
+			if flaky.calls["Stat"] != tt.wantCalls {
+				t.Errorf("Stat() calls = %v, want %v", flaky.calls["Stat"], tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestWithRetry_Deadline(t *testing.T) {
+	flaky, _ := newFlakyProvider(t, map[string]int{"Stat": 1}, gospal.NewProviderConfig())
+	p := gospal.WithRetry(flaky, &gospal.RetryPolicy{InitialBackoff: time.Hour, MaxBackoff: time.Hour})
+
+	// the wait would exceed the deadline of the context, the last error is returned straight away
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	start := time.Now()
+	if _, err := p.StatContext(ctx, "a.txt"); !stderrors.Is(err, errors.ErrTransient) {
+		t.Errorf("StatContext() error = %v, want %v", err, errors.ErrTransient)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("StatContext() took %v, should not have waited", elapsed)
+	}
+	if flaky.calls["Stat"] != 1 {
+		t.Errorf("StatContext() calls = %v, want 1", flaky.calls["Stat"])
+	}
+}
+
+func TestWithRetry_PutStream(t *testing.T) {
+	tests := []struct {
+		name         string
+		reader       io.Reader
+		maxPutBuffer int64
+		wantErr      bool
+		wantCalls    int
+	}{
+		{
+			name:      "Should replay seekable bodies",
+			reader:    strings.NewReader("content"),
+			wantErr:   false,
+			wantCalls: 2,
+		},
+		{
+			name:      "Should not replay other bodies",
+			reader:    io.MultiReader(strings.NewReader("content")),
+			wantErr:   true,
+			wantCalls: 1,
+		},
+		{
+			name:         "Should replay buffered bodies",
+			reader:       io.MultiReader(strings.NewReader("content")),
+			maxPutBuffer: 7,
+			wantErr:      false,
+			wantCalls:    2,
+		},
+		{
+			name:         "Should not replay bodies larger than the buffer",
+			reader:       io.MultiReader(strings.NewReader("content")),
+			maxPutBuffer: 6,
+			wantErr:      true,
+			wantCalls:    1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flaky, store := newFlakyProvider(t, map[string]int{"PutStream": 1}, gospal.NewProviderConfig())
+			p := gospal.WithRetry(flaky, &gospal.RetryPolicy{InitialBackoff: time.Millisecond, MaxPutBuffer: tt.maxPutBuffer})
+			n, err := p.PutStream("a.txt", tt.reader)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("PutStream() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if flaky.calls["PutStream"] != tt.wantCalls {
+				t.Errorf("PutStream() calls = %v, want %v", flaky.calls["PutStream"], tt.wantCalls)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got, _ := store.Get("a.txt"); n != 7 || string(got) != "content" {
+				t.Errorf("PutStream() got = %v, %q, want the whole body", n, got)
+			}
+		})
+	}
+}
+
+// conditionalProvider puts the objects which do not exist yet, the first put failing on the way back
+type conditionalProvider struct {
+	*flakyProvider
+}
+
+func (p *conditionalProvider) PutStream(fileName string, reader io.Reader, opts ...gospal.PutOption) (int64, error) {
+	if _, err := p.Gospal.Stat(fileName); err == nil {
+		p.calls["PutStream"]++
+		return -1, errors.Wrap(errors.ErrPreconditionFailed, fmt.Errorf("412 Precondition Failed"))
+	}
+	n, err := p.Gospal.PutStream(fileName, reader, opts...)
+	if p.fail("PutStream") {
+		return -1, errTransient
+	}
+	return n, err
+}
+
+func TestWithRetry_ConditionalPutStream(t *testing.T) {
+	flaky, store := newFlakyProvider(t, map[string]int{"PutStream": 1}, gospal.NewProviderConfig())
+	p := gospal.WithRetry(&conditionalProvider{flaky}, testPolicy)
+
+	// the condition broken by the committed first attempt is not reported, its outcome is unknown
+	if _, err := p.PutStream("a.txt", strings.NewReader("content")); err != errTransient {
+		t.Errorf("PutStream() error = %v, want %v", err, errTransient)
+	}
+	if flaky.calls["PutStream"] != 2 {
+		t.Errorf("PutStream() calls = %v, want 2", flaky.calls["PutStream"])
+	}
+	if got, _ := store.Get("a.txt"); string(got) != "content" {
+		t.Errorf("PutStream() got = %q, want %q", got, "content")
+	}
+	// while a condition broken at first attempt is
+	if _, err := p.PutStream("a.txt", strings.NewReader("content")); !stderrors.Is(err, errors.ErrPreconditionFailed) {
+		t.Errorf("PutStream() error = %v, want %v", err, errors.ErrPreconditionFailed)
+	}
+}
+
+func TestWithRetry_DeleteKey(t *testing.T) {
+	flaky, store := newFlakyProvider(t, map[string]int{"DeleteKey": 1}, gospal.NewProviderConfig())
+	store.Put("a.txt", []byte("a"))
+	p := gospal.WithRetry(flaky, testPolicy)
+
+	// the first attempt deleted the key before failing, the key missing on retry is not an error
+	if err := p.DeleteKey("a.txt"); err != nil {
+		t.Errorf("DeleteKey() error = %v", err)
+	}
+	if flaky.calls["DeleteKey"] != 2 {
+		t.Errorf("DeleteKey() calls = %v, want 2", flaky.calls["DeleteKey"])
+	}
+	// while a key missing at first attempt is
+	if err := p.DeleteKey("a.txt"); !stderrors.Is(err, errors.ErrNotExist) {
+		t.Errorf("DeleteKey() error = %v, want %v", err, errors.ErrNotExist)
+	}
+}
+
+func TestWithRetry_DeleteKeys(t *testing.T) {
+	flaky, store := newFlakyProvider(t, map[string]int{"DeleteKeys:flaky1.txt": 1, "DeleteKeys:flaky2.txt": 5}, gospal.NewProviderConfig())
+	for _, key := range []string{"a.txt", "flaky1.txt", "flaky2.txt"} {
+		store.Put(key, []byte(key))
+	}
+	p := gospal.WithRetry(flaky, testPolicy)
+
+	// only the keys failing on a transient error are retried
+	err := p.DeleteKeys([]string{"a.txt", "flaky1.txt", "flaky2.txt", "missing.txt"})
+	var deleteErr *errors.DeleteKeysError
+	if !stderrors.As(err, &deleteErr) {
+		t.Errorf("DeleteKeys() error = %v, want a DeleteKeysError", err)
+		return
+	}
+	if want := []string{"flaky2.txt", "missing.txt"}; !reflect.DeepEqual(deleteErr.Keys(), want) {
+		t.Errorf("DeleteKeys() failed keys = %v, want %v", deleteErr.Keys(), want)
+	}
+	if !stderrors.Is(deleteErr.Errors["flaky2.txt"], errors.ErrTransient) || !stderrors.Is(deleteErr.Errors["missing.txt"], errors.ErrNotExist) {
+		t.Errorf("DeleteKeys() errors = %v", deleteErr.Errors)
+	}
+	if flaky.calls["DeleteKeys"] != 3 || flaky.calls["DeleteKeys:flaky2.txt"] != 3 || flaky.calls["DeleteKeys:flaky1.txt"] != 2 {
+		t.Errorf("DeleteKeys() calls = %v", flaky.calls)
+	}
+	if keys := store.Keys(""); !reflect.DeepEqual(keys, []string{"flaky2.txt"}) {
+		t.Errorf("DeleteKeys() left %v, want %v", keys, []string{"flaky2.txt"})
+	}
+}
+
+func TestWithRetry_Objects(t *testing.T) {
+	flaky, store := newFlakyProvider(t, map[string]int{"Objects": 2}, &gospal.ProviderConfig{MaxKeys: 2})
+	var want []string
+	for i := 0; i < 5; i++ {
+		key := fmt.Sprintf("key%v.txt", i)
+		store.Put(key, []byte(key))
+		want = append(want, key)
+	}
+
+	// the listing resumes from the page of the last listed object, without listing it again
+	var got []string
+	it := gospal.WithRetry(flaky, testPolicy).Objects(context.Background(), "")
+	for it.Next() {
+		got = append(got, it.Object().Key)
+	}
+	if err := it.Err(); err != nil {
+		t.Errorf("Objects() error = %v", err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Objects() got = %v, want %v", got, want)
+	}
+	if flaky.calls["ObjectsFrom"] != 3 {
+		t.Errorf("Objects() listings = %v, want 3", flaky.calls["ObjectsFrom"])
+	}
+}
+
+func TestWithRetry_Conformance(t *testing.T) {
+	gospaltest.RunConformance(t, func(t *testing.T) (gospal.Gospal, func()) {
+		store := memprovider.Bucket("retry-" + t.Name())
+		p, _ := memprovider.New(context.Background(), "retry-"+t.Name(), &gospal.ProviderConfig{MaxKeys: 2})
+		return gospal.WithRetry(p, testPolicy), store.Reset
+	})
+}
@@ -0,0 +1,47 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package sftpprovider
+
+import (
+	"os"
+	"sort"
+)
+
+// default number of objects per page when ProviderConfig.MaxKeys is not set
+const defaultMaxKeys = 1024
+
+// fileSystem is the remote file system walked by the iterators and written by the writers
+type fileSystem struct {
+	p *provider
+}
+
+// Stat follows the symbolic links, the server being expected to jail the user
+func (fs fileSystem) Stat(dir string) (os.FileInfo, error) {
+	return fs.p.client.Stat(dir)
+}
+
+func (fs fileSystem) ReadDir(dir string) ([]os.FileInfo, error) {
+	return fs.p.readDir(dir)
+}
+
+// readDir returns the entries of the remote directory sorted by name
+func (p *provider) readDir(dir string) ([]os.FileInfo, error) {
+	infos, err := p.client.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
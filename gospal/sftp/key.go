@@ -0,0 +1,47 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package sftpprovider
+
+import (
+	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/internal/fsutil"
+	"path"
+	"strings"
+)
+
+// rootPath returns the directory holding the keys, the global prefix is a sub directory of the remote directory
+func (p *provider) rootPath() string {
+	return path.Join(p.directory, p.config.GlobalPrefix)
+}
+
+// keyPath returns the remote path of the file of the specified key. Keys are relative to the global prefix, a key
+// resolving outside of it by dot dot elements is rejected by an *errors.InvalidKeyError. Unlike the local provider,
+// the symbolic links of the server are not resolved, the server is expected to jail the user
+func (p *provider) keyPath(key string) (string, error) {
+	if strings.IndexByte(key, 0) >= 0 {
+		return "", errors.ErrorInvalidKey(key, "contains a NUL byte")
+	}
+	root := p.rootPath()
+	filePath := path.Join(root, key)
+	if !fsutil.IsWithin(root, filePath) {
+		return "", errors.ErrorInvalidKey(key, "resolves outside of the directory")
+	}
+	return filePath, nil
+}
+
+// toKey returns the key of the specified remote path, the inverse of keyPath
+func (p *provider) toKey(filePath string) string {
+	return fsutil.RelativePath(p.rootPath(), filePath)
+}
@@ -0,0 +1,577 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package sftpprovider
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/internal/fsutil"
+	"github.com/contentsquare/gospal/gospal/internal/registry"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"math"
+	"mime"
+	"net"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// size of the buffer of the uploads, the sftp client sending the writes larger than a packet concurrently
+const copyBufferSize = 1024 * 1024
+
+// Config is the sftp specific configuration, given as ProviderConfig.SpecConfig. The bucket is the remote directory,
+// either absolute or relative to the login directory of the user
+type Config struct {
+	// Addr of the server, host:port, the port defaulting to 22
+	Addr string
+
+	// User to log in as
+	User string
+
+	// Password of the user, for password authentication
+	Password string
+
+	// PrivateKey of the user, PEM encoded, for public key authentication
+	PrivateKey []byte
+
+	// Passphrase of the private key, when encrypted
+	Passphrase string
+
+	// HostKeyCallback verifies the key of the server, eg.: knownhosts.New or ssh.FixedHostKey. It is required,
+	// ssh.InsecureIgnoreHostKey accepting any server
+	HostKeyCallback ssh.HostKeyCallback
+}
+
+type provider struct {
+	context              context.Context
+	kind                 string
+	directory            string
+	noSuchKeyErrorString string
+	conn                 *ssh.Client
+	client               *sftp.Client
+	config               *gospal.ProviderConfig
+}
+
+// toError classifies a sftp error as one of the gospal errors
+func toError(err error) error {
+	switch {
+	case stderrors.Is(err, context.Canceled) || stderrors.Is(err, context.DeadlineExceeded):
+		return errors.Wrap(errors.ErrCanceled, err)
+	case stderrors.Is(err, os.ErrNotExist):
+		return errors.Wrap(errors.ErrNotExist, err)
+	case stderrors.Is(err, os.ErrPermission):
+		return errors.Wrap(errors.ErrPermissionDenied, err)
+	case stderrors.Is(err, os.ErrExist):
+		return errors.Wrap(errors.ErrAlreadyExists, err)
+	}
+	return err
+}
+
+// Close closes the sftp session and the ssh connection, the provider can not be used afterwards
+func (p *provider) Close() error {
+	p.client.Close()
+	return p.conn.Close()
+}
+
+// openFile opens the file of the key for reading. Directories are not keys, they are reported as not existing
+func (p *provider) openFile(fileName string) (*sftp.File, error) {
+	filePath, err := p.keyPath(fileName)
+	if err != nil {
+		return nil, err
+	}
+	fh, err := p.client.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := fh.Stat(); err != nil || info.IsDir() {
+		fh.Close()
+		if err == nil {
+			err = errors.Wrap(errors.ErrNotExist, fmt.Errorf("%v is a directory", fileName))
+		}
+		return nil, err
+	}
+	return fh, nil
+}
+
+// statFile returns the attributes of the file at the path. Directories are not keys, they are reported as not existing
+func (p *provider) statFile(fileName string, filePath string) (os.FileInfo, error) {
+	info, err := p.client.Stat(filePath)
+	if err == nil && info.IsDir() {
+		err = errors.Wrap(errors.ErrNotExist, fmt.Errorf("%v is a directory", fileName))
+	}
+	return info, err
+}
+
+// pruneDirs removes the directory then its parents as long as they are empty, up to the remote directory which is
+// always kept. Just as object storages, there is no such thing as an empty directory
+func (p *provider) pruneDirs(dir string) {
+	root := path.Clean(p.directory)
+	for ; dir != root && fsutil.IsWithin(root, dir); dir = path.Dir(dir) {
+		// only empty directories can be removed
+		if err := p.client.RemoveDirectory(dir); err != nil {
+			return
+		}
+	}
+}
+
+// removeAll removes the file, or the directory and its content
+func (p *provider) removeAll(filePath string) error {
+	info, err := p.client.Lstat(filePath)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return p.client.Remove(filePath)
+	}
+	infos, err := p.client.ReadDir(filePath)
+	if err != nil {
+		return err
+	}
+	for _, info := range infos {
+		if err := p.removeAll(path.Join(filePath, info.Name())); err != nil {
+			return err
+		}
+	}
+	return p.client.RemoveDirectory(filePath)
+}
+
+func (p *provider) ListKeys(pathName ...string) ([]string, error) {
+	return p.ListKeysContext(p.context, pathName...)
+}
+
+func (p *provider) ListKeysContext(ctx context.Context, pathName ...string) ([]string, error) {
+	if len(pathName) > 1 {
+		return nil, errors.ErrorTooMuchListKeysArgs()
+	}
+	var extraPath string
+	if len(pathName) != 0 {
+		extraPath = pathName[0]
+	}
+	var files []string
+	it := p.Objects(ctx, extraPath)
+	for it.Next() {
+		files = append(files, it.Object().Key)
+	}
+	if err := it.Err(); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func (p *provider) ListDir(prefix string) ([]string, []string, error) {
+	return p.ListDirContext(p.context, prefix)
+}
+
+func (p *provider) ListDirContext(ctx context.Context, prefix string) (keys []string, prefixes []string, err error) {
+	directory, err := p.keyPath(prefix)
+	if err != nil {
+		return nil, nil, errors.ErrorListDir(prefix, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, nil, errors.ErrorListDir(directory, toError(err))
+	}
+	infos, err := p.readDir(directory)
+	if os.IsNotExist(err) {
+		// just as a prefix without any key in object storages
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, errors.ErrorListDir(directory, toError(err))
+	}
+	for _, info := range infos {
+		if fsutil.IsInternalFile(info.Name()) {
+			continue
+		}
+		if info.IsDir() {
+			// directories are returned the same way as object storages common prefixes, with the delimiter
+			prefixes = append(prefixes, p.toKey(path.Join(directory, info.Name()))+"/")
+		} else {
+			keys = append(keys, p.toKey(path.Join(directory, info.Name())))
+		}
+	}
+	return keys, prefixes, nil
+}
+
+func (p *provider) Objects(ctx context.Context, prefix string) gospal.ObjectIterator {
+	return p.ObjectsFrom(ctx, prefix, "")
+}
+
+func (p *provider) ObjectsFrom(ctx context.Context, prefix string, pageToken string) gospal.ObjectIterator {
+	dir, base := path.Split(prefix)
+	root, err := p.keyPath(dir)
+	if err != nil {
+		return fsutil.FailedIterator(errors.ErrorListKeysError(prefix, err))
+	}
+	var resume string
+	if pageToken != "" {
+		if resume, err = p.keyPath(pageToken); err != nil {
+			return fsutil.FailedIterator(errors.ErrorListKeysError(prefix, err))
+		}
+	}
+	walk := fsutil.Walk{
+		Directory:  p.directory,
+		Root:       root,
+		Base:       base,
+		Resume:     resume,
+		PageSize:   defaultMaxKeys,
+		ToKey:      p.toKey,
+		ToError:    toError,
+		IsInternal: fsutil.IsInternalFile,
+	}
+	if p.config.MaxKeys > 0 {
+		walk.PageSize = int(p.config.MaxKeys)
+	}
+	return fsutil.NewIterator(ctx, fileSystem{p}, walk, pageToken)
+}
+
+func (p *provider) PutStream(fileName string, reader io.Reader, opts ...gospal.PutOption) (int64, error) {
+	return p.PutStreamContext(p.context, fileName, reader, opts...)
+}
+
+func (p *provider) PutStreamContext(ctx context.Context, fileName string, reader io.Reader, opts ...gospal.PutOption) (int64, error) {
+	// the stream is written to a temporary file renamed on success, a failed put leaves any previous file untouched
+	writer, err := p.newFileWriter(ctx, fileName, opts...)
+	if err != nil {
+		return -1, err
+	}
+	written, err := io.CopyBuffer(writer, &fsutil.ContextReader{Ctx: ctx, Reader: reader}, make([]byte, copyBufferSize))
+	if err != nil {
+		writer.Abort()
+		return -1, errors.ErrorPutStreamReader(writer.FilePath(), toError(err))
+	}
+	if err := writer.Close(); err != nil {
+		return -1, err
+	}
+	return written, nil
+}
+
+func (p *provider) Stat(fileName string) (*gospal.ObjectInfo, error) {
+	return p.StatContext(p.context, fileName)
+}
+
+func (p *provider) StatContext(ctx context.Context, fileName string) (*gospal.ObjectInfo, error) {
+	filePath, err := p.keyPath(fileName)
+	if err != nil {
+		return nil, errors.ErrorStat(fileName, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, errors.ErrorStat(filePath, toError(err))
+	}
+	info, err := p.statFile(fileName, filePath)
+	if err != nil {
+		return nil, errors.ErrorStat(filePath, toError(err))
+	}
+	options, err := fsutil.ReadMetadata(fileSystem{p}, filePath)
+	if err != nil {
+		return nil, errors.ErrorStat(filePath, toError(err))
+	}
+	// sftp servers do not store any etag. Unless set when putting the file, the content type is guessed from the file
+	// extension
+	if options.ContentType == "" {
+		options.ContentType = mime.TypeByExtension(path.Ext(fileName))
+	}
+	return &gospal.ObjectInfo{
+		Key:             fileName,
+		Size:            info.Size(),
+		LastModified:    info.ModTime(),
+		ContentType:     options.ContentType,
+		ContentEncoding: options.ContentEncoding,
+		CacheControl:    options.CacheControl,
+		Metadata:        options.Metadata,
+	}, nil
+}
+
+func (p *provider) Copy(src string, dst string) error {
+	return p.CopyContext(p.context, src, dst)
+}
+
+func (p *provider) CopyContext(ctx context.Context, src string, dst string) error {
+	// sftp has no server side copy, the file is copied through the process
+	if err := gospal.StreamCopy(ctx, p, src, dst); err != nil {
+		return errors.ErrorCopyKey(src, dst, err)
+	}
+	return nil
+}
+
+func (p *provider) Move(src string, dst string) error {
+	return p.MoveContext(p.context, src, dst)
+}
+
+func (p *provider) MoveContext(ctx context.Context, src string, dst string) error {
+	srcPath, err := p.keyPath(src)
+	if err != nil {
+		return errors.ErrorMoveKey(src, dst, err)
+	}
+	dstPath, err := p.keyPath(dst)
+	if err != nil {
+		return errors.ErrorMoveKey(src, dst, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return errors.ErrorMoveKey(srcPath, dstPath, toError(err))
+	}
+	// only files are keys, directories should not be moved around
+	if _, err := p.statFile(src, srcPath); err != nil {
+		return errors.ErrorMoveKey(srcPath, dstPath, toError(err))
+	}
+	if err := p.client.MkdirAll(path.Dir(dstPath)); err != nil {
+		return errors.ErrorMoveKey(srcPath, dstPath, toError(err))
+	}
+	if err := p.rename(srcPath, dstPath); err != nil {
+		return errors.ErrorMoveKey(srcPath, dstPath, toError(err))
+	}
+	// the attributes of the object follow it
+	err = p.rename(fsutil.MetadataPath(srcPath), fsutil.MetadataPath(dstPath))
+	if os.IsNotExist(err) {
+		err = fsutil.RemoveMetadata(fileSystem{p}, dstPath)
+	}
+	if err != nil {
+		return errors.ErrorMoveKey(srcPath, dstPath, toError(err))
+	}
+	p.pruneDirs(path.Dir(srcPath))
+	return nil
+}
+
+func (p *provider) GetKind() string {
+	return p.kind
+}
+
+func (p *provider) DeleteKey(fileName string) error {
+	return p.DeleteKeyContext(p.context, fileName)
+}
+
+func (p *provider) DeleteKeyContext(ctx context.Context, fileName string) error {
+	filePath, err := p.keyPath(fileName)
+	if err != nil {
+		return errors.ErrorDeleteKey(fileName, err)
+	}
+	if err := ctx.Err(); err != nil {
+		return errors.ErrorDeleteKey(filePath, toError(err))
+	}
+	// check if key exists, directories are not keys
+	if _, err := p.statFile(fileName, filePath); err != nil {
+		return errors.ErrorDeleteKey(filePath, toError(err))
+	}
+	if err := p.client.Remove(filePath); err != nil {
+		return errors.ErrorDeleteKey(filePath, toError(err))
+	}
+	if err := fsutil.RemoveMetadata(fileSystem{p}, filePath); err != nil {
+		return errors.ErrorDeleteKey(filePath, toError(err))
+	}
+	p.pruneDirs(path.Dir(filePath))
+	return nil
+}
+
+func (p *provider) DeleteKeys(fileNames []string) error {
+	return p.DeleteKeysContext(p.context, fileNames)
+}
+
+func (p *provider) DeleteKeysContext(ctx context.Context, fileNames []string) error {
+	failures := map[string]error{}
+	for _, fileName := range fileNames {
+		if err := p.DeleteKeyContext(ctx, fileName); err != nil {
+			failures[fileName] = err
+		}
+	}
+	return errors.ErrorDeleteKeys(failures)
+}
+
+func (p *provider) DeletePrefix(prefix string) error {
+	return p.DeletePrefixContext(p.context, prefix)
+}
+
+func (p *provider) DeletePrefixContext(ctx context.Context, prefix string) error {
+	// a prefix may stop in the middle of a file name, every entry of its directory starting like it is removed
+	dir, base := path.Split(prefix)
+	dirPath, err := p.keyPath(dir)
+	if err != nil {
+		return errors.ErrorDeleteKey(prefix, err)
+	}
+	infos, err := p.readDir(dirPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.ErrorDeleteKey(path.Join(dirPath, base), toError(err))
+	}
+	failures := map[string]error{}
+	for _, info := range infos {
+		// sidecars are removed along with their file, temporary files belong to pending writers
+		if !strings.HasPrefix(info.Name(), base) || fsutil.IsInternalFile(info.Name()) {
+			continue
+		}
+		filePath := path.Join(dirPath, info.Name())
+		if err := ctx.Err(); err != nil {
+			failures[path.Join(dir, info.Name())] = errors.ErrorDeleteKey(filePath, toError(err))
+			continue
+		}
+		if err := p.removeAll(filePath); err != nil {
+			failures[path.Join(dir, info.Name())] = errors.ErrorDeleteKey(filePath, toError(err))
+			continue
+		}
+		if err := fsutil.RemoveMetadata(fileSystem{p}, filePath); err != nil {
+			failures[path.Join(dir, info.Name())] = errors.ErrorDeleteKey(filePath, toError(err))
+		}
+	}
+	p.pruneDirs(dirPath)
+	return errors.ErrorDeleteKeys(failures)
+}
+
+func (p *provider) GetNoSuchKeyErrorString() string {
+	return p.noSuchKeyErrorString
+}
+
+func (p *provider) GetStream(filePath string) (io.Reader, context.CancelFunc, error) {
+	return p.GetStreamContext(p.context, filePath)
+}
+
+func (p *provider) GetStreamContext(ctx context.Context, filePath string) (io.Reader, context.CancelFunc, error) {
+	return gospal.ToStream(p.NewReader(ctx, filePath))
+}
+
+func (p *provider) NewReader(ctx context.Context, filePath string) (io.ReadCloser, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, errors.ErrorGetStreamReader(filePath, toError(err))
+	}
+	fh, err := p.openFile(filePath)
+	if err != nil {
+		return nil, errors.ErrorGetStreamReader(filePath, toError(err))
+	}
+	// reads on the returned stream stop as soon as the context is either done or canceled
+	ctx, cancel := context.WithCancel(ctx)
+	return gospal.NewReadCloser(&fsutil.ContextReader{Ctx: ctx, Reader: fh}, fh, cancel), nil
+}
+
+func (p *provider) GetRange(filePath string, offset int64, length int64) (io.Reader, context.CancelFunc, error) {
+	return p.GetRangeContext(p.context, filePath, offset, length)
+}
+
+func (p *provider) GetRangeContext(ctx context.Context, filePath string, offset int64, length int64) (io.Reader, context.CancelFunc, error) {
+	if err := ctx.Err(); err != nil {
+		return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, filePath, toError(err)))
+	}
+	fh, err := p.openFile(filePath)
+	if err != nil {
+		return gospal.ToStream(nil, errors.ErrorGetRange(length, offset, filePath, toError(err)))
+	}
+	var reader io.Reader = io.NewSectionReader(fh, offset, math.MaxInt64-offset)
+	if length >= 0 {
+		reader = io.NewSectionReader(fh, offset, length)
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	return gospal.ToStream(gospal.NewReadCloser(&fsutil.ContextReader{Ctx: ctx, Reader: reader}, fh, cancel), nil)
+}
+
+// fileReader is the ObjectReader of a remote file, *sftp.File already implements both io.ReadSeeker and io.ReaderAt
+type fileReader struct {
+	*sftp.File
+	size int64
+}
+
+func (f *fileReader) Size() int64 {
+	return f.size
+}
+
+func (p *provider) Open(filePath string) (gospal.ObjectReader, error) {
+	return p.OpenContext(p.context, filePath)
+}
+
+func (p *provider) OpenContext(ctx context.Context, filePath string) (gospal.ObjectReader, error) {
+	info, err := p.StatContext(ctx, filePath)
+	if err != nil {
+		return nil, err
+	}
+	fh, err := p.openFile(filePath)
+	if err != nil {
+		return nil, errors.ErrorGetStreamReader(filePath, toError(err))
+	}
+	return &fileReader{File: fh, size: info.Size}, nil
+}
+
+// the provider is available from the factory as soon as its package is imported
+func init() {
+	registry.MustRegister(gospal.ProviderSFTP, New)
+}
+
+// clientConfig returns the ssh configuration of the sftp configuration, the timeout applying to the connection
+func clientConfig(cfg *Config, timeout int) (*ssh.ClientConfig, error) {
+	if cfg.HostKeyCallback == nil {
+		return nil, stderrors.New("HostKeyCallback is not set")
+	}
+	var auth []ssh.AuthMethod
+	if len(cfg.PrivateKey) > 0 {
+		var signer ssh.Signer
+		var err error
+		if cfg.Passphrase != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(cfg.PrivateKey, []byte(cfg.Passphrase))
+		} else {
+			signer, err = ssh.ParsePrivateKey(cfg.PrivateKey)
+		}
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	if cfg.Password != "" {
+		auth = append(auth, ssh.Password(cfg.Password))
+	}
+	if len(auth) == 0 {
+		return nil, stderrors.New("neither Password nor PrivateKey is set")
+	}
+	return &ssh.ClientConfig{
+		User:            cfg.User,
+		Auth:            auth,
+		HostKeyCallback: cfg.HostKeyCallback,
+		Timeout:         time.Second * time.Duration(timeout),
+	}, nil
+}
+
+//New sftp provider constructor. The provider holds a connection to the server, released by its Close method:
+//  if closer, ok := provider.(io.Closer); ok {
+//      defer closer.Close()
+//  }
+func New(ctx context.Context, bucket string, config *gospal.ProviderConfig) (gospal.Gospal, error) {
+	provider := provider{directory: bucket}
+	provider.kind = string(gospal.ProviderSFTP)
+	provider.noSuchKeyErrorString = os.ErrNotExist.Error()
+	provider.config = config
+	provider.context = ctx
+
+	cfg, ok := config.SpecConfig.(*Config)
+	if !ok || cfg == nil {
+		return nil, errors.ErrorInitProvider("sftp", stderrors.New("SpecConfig is not a *sftpprovider.Config"))
+	}
+	sshConfig, err := clientConfig(cfg, config.TimeOut)
+	if err != nil {
+		return nil, errors.ErrorInitProvider("sftp", err)
+	}
+	addr := cfg.Addr
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = net.JoinHostPort(addr, "22")
+	}
+	if provider.conn, err = ssh.Dial("tcp", addr, sshConfig); err != nil {
+		return nil, errors.ErrorInitProvider("sftp", toError(err))
+	}
+	if provider.client, err = sftp.NewClient(provider.conn); err != nil {
+		provider.conn.Close()
+		return nil, errors.ErrorInitProvider("sftp", toError(err))
+	}
+	return &provider, nil
+}
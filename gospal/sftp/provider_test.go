@@ -0,0 +1,458 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package sftpprovider
+
+import (
+	"context"
+	stderrors "errors"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/gospaltest"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestProvider returns a provider of a new temporary directory served by the server, along with the function
+// releasing both
+func newTestProvider(t *testing.T, server *testServer, config *gospal.ProviderConfig) (gospal.Gospal, string, func()) {
+	tmpDirectory, err := ioutil.TempDir(os.TempDir(), "gospalTest")
+	if err != nil {
+		t.Fatalf("unable to create temporary directory for tests. err=%v", err.Error())
+	}
+	config.SpecConfig = server.config()
+	p, err := New(context.Background(), tmpDirectory, config)
+	if err != nil {
+		os.RemoveAll(tmpDirectory)
+		t.Fatalf("error when instantiating sftp provider. err=%v", err.Error())
+	}
+	return p, tmpDirectory, func() {
+		p.(io.Closer).Close()
+		os.RemoveAll(tmpDirectory)
+	}
+}
+
+// readDirNames returns the sorted names of the entries of the local directory
+func readDirNames(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func TestNew(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+
+	withKey := server.config()
+	withKey.Password = ""
+	withKey.PrivateKey = server.privateKey
+	wrongPassword := server.config()
+	wrongPassword.Password = "wrong"
+	unknownHost := server.config()
+	unknownHost.HostKeyCallback = ssh.FixedHostKey(unknownHostKey(t))
+	noHostKeyCallback := server.config()
+	noHostKeyCallback.HostKeyCallback = nil
+	noAuth := server.config()
+	noAuth.Password = ""
+	invalidKey := server.config()
+	invalidKey.PrivateKey = []byte("not a key")
+
+	tests := []struct {
+		name    string
+		config  *gospal.ProviderConfig
+		wantErr bool
+	}{
+		{
+			name:    "Should instantiate a sftp provider authenticated by password",
+			config:  &gospal.ProviderConfig{TimeOut: 300, SpecConfig: server.config()},
+			wantErr: false,
+		},
+		{
+			name:    "Should instantiate a sftp provider authenticated by private key",
+			config:  &gospal.ProviderConfig{TimeOut: 300, SpecConfig: withKey},
+			wantErr: false,
+		},
+		{
+			name:    "Should raise on missing configuration",
+			config:  &gospal.ProviderConfig{TimeOut: 300},
+			wantErr: true,
+		},
+		{
+			name:    "Should raise on wrong password",
+			config:  &gospal.ProviderConfig{TimeOut: 300, SpecConfig: wrongPassword},
+			wantErr: true,
+		},
+		{
+			name:    "Should raise on unknown host key",
+			config:  &gospal.ProviderConfig{TimeOut: 300, SpecConfig: unknownHost},
+			wantErr: true,
+		},
+		{
+			name:    "Should raise on missing host key callback",
+			config:  &gospal.ProviderConfig{TimeOut: 300, SpecConfig: noHostKeyCallback},
+			wantErr: true,
+		},
+		{
+			name:    "Should raise on missing authentication",
+			config:  &gospal.ProviderConfig{TimeOut: 300, SpecConfig: noAuth},
+			wantErr: true,
+		},
+		{
+			name:    "Should raise on invalid private key",
+			config:  &gospal.ProviderConfig{TimeOut: 300, SpecConfig: invalidKey},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(context.Background(), os.TempDir(), tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("New() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			defer got.(io.Closer).Close()
+			if reflect.TypeOf(got) != reflect.TypeOf(&provider{}) {
+				t.Errorf("New() got = %v, want %v", reflect.TypeOf(got), reflect.TypeOf(provider{}))
+			}
+			if got.GetKind() != "sftp" {
+				t.Errorf("GetKind() got = %v, want %v", got.GetKind(), "sftp")
+			}
+		})
+	}
+}
+
+// unknownHostKey returns the public key of a new key, unknown of the clients
+func unknownHostKey(t *testing.T) ssh.PublicKey {
+	_, signer := newKey(t)
+	return signer.PublicKey()
+}
+
+func Test_toError(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	p, _, cleanup := newTestProvider(t, server, &gospal.ProviderConfig{TimeOut: 300})
+	defer cleanup()
+
+	if _, err := p.Stat("missing.txt"); !stderrors.Is(err, errors.ErrNotExist) {
+		t.Errorf("Stat() error = %v, should be %v", err, errors.ErrNotExist)
+	}
+	if _, err := p.NewReader(context.Background(), "missing.txt"); !stderrors.Is(err, errors.ErrNotExist) {
+		t.Errorf("NewReader() error = %v, should be %v", err, errors.ErrNotExist)
+	}
+	if err := p.DeleteKey("missing.txt"); !stderrors.Is(err, errors.ErrNotExist) {
+		t.Errorf("DeleteKey() error = %v, should be %v", err, errors.ErrNotExist)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := p.StatContext(ctx, "missing.txt"); !stderrors.Is(err, errors.ErrCanceled) {
+		t.Errorf("StatContext() error = %v, should be %v", err, errors.ErrCanceled)
+	}
+}
+
+func Test_provider_PutStreamAtomic(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	p, tmpDirectory, cleanup := newTestProvider(t, server, &gospal.ProviderConfig{TimeOut: 300})
+	defer cleanup()
+
+	if _, err := p.PutStream("a/b.txt", strings.NewReader("first")); err != nil {
+		t.Errorf("PutStream() error = %v", err)
+		return
+	}
+	// a failed put leaves the previous content, and no temporary file behind
+	reader := io.MultiReader(strings.NewReader("second"), &failingReader{})
+	if _, err := p.PutStream("a/b.txt", reader); err == nil {
+		t.Errorf("PutStream() should have failed")
+	}
+	if data, err := ioutil.ReadFile(path.Join(tmpDirectory, "a/b.txt")); err != nil || string(data) != "first" {
+		t.Errorf("a/b.txt got = %v, %v, want %v", string(data), err, "first")
+	}
+	if names, _ := readDirNames(path.Join(tmpDirectory, "a")); !reflect.DeepEqual(names, []string{"b.txt"}) {
+		t.Errorf("PutStream() left %v", names)
+	}
+	// a writer is only visible once closed
+	writer, err := p.NewWriter(context.Background(), "a/c.txt")
+	if err != nil {
+		t.Errorf("NewWriter() error = %v", err)
+		return
+	}
+	io.WriteString(writer, "third")
+	if keys, err := p.ListKeys(); err != nil || !reflect.DeepEqual(keys, []string{"a/b.txt"}) {
+		t.Errorf("ListKeys() got = %v, %v, want %v", keys, err, []string{"a/b.txt"})
+	}
+	if err := writer.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if keys, err := p.ListKeys(); err != nil || !reflect.DeepEqual(keys, []string{"a/b.txt", "a/c.txt"}) {
+		t.Errorf("ListKeys() got = %v, %v, want %v", keys, err, []string{"a/b.txt", "a/c.txt"})
+	}
+}
+
+func Test_provider_PutStreamOptions(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	p, tmpDirectory, cleanup := newTestProvider(t, server, &gospal.ProviderConfig{TimeOut: 300})
+	defer cleanup()
+
+	want := &gospal.ObjectInfo{
+		Key:             "moved.bin",
+		ContentType:     "application/json",
+		ContentEncoding: "gzip",
+		CacheControl:    "no-cache",
+		Metadata:        map[string]string{"owner": "bladibla"},
+	}
+	if _, err := p.PutStream("a/options.bin", strings.NewReader("{}"),
+		gospal.WithContentType(want.ContentType),
+		gospal.WithContentEncoding(want.ContentEncoding),
+		gospal.WithCacheControl(want.CacheControl),
+		gospal.WithMetadata(want.Metadata),
+	); err != nil {
+		t.Errorf("PutStream() error = %v", err)
+		return
+	}
+	// the attributes should follow the object
+	if err := p.Move("a/options.bin", "moved.bin"); err != nil {
+		t.Errorf("Move() error = %v", err)
+		return
+	}
+	got, err := p.Stat("moved.bin")
+	if err != nil {
+		t.Errorf("Stat() error = %v", err)
+		return
+	}
+	got.Size, got.LastModified = 0, time.Time{}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Stat() got = %+v, want %+v", got, want)
+	}
+	// the sidecar should not be listed
+	if keys, err := p.ListKeys(); err != nil || !reflect.DeepEqual(keys, []string{"moved.bin"}) {
+		t.Errorf("ListKeys() got = %v, %v, want %v", keys, err, []string{"moved.bin"})
+	}
+	if keys, _, err := p.ListDir(""); err != nil || !reflect.DeepEqual(keys, []string{"moved.bin"}) {
+		t.Errorf("ListDir() got = %v, %v, want %v", keys, err, []string{"moved.bin"})
+	}
+	// putting the object again without options should reset them
+	writer, err := p.NewWriter(context.Background(), "moved.bin")
+	if err != nil {
+		t.Errorf("NewWriter() error = %v", err)
+		return
+	}
+	io.WriteString(writer, "{}")
+	if err := writer.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+		return
+	}
+	if got, err := p.Stat("moved.bin"); err != nil || got.ContentType == want.ContentType || got.Metadata != nil {
+		t.Errorf("Stat() got = %+v, %v, want no attributes", got, err)
+	}
+	if _, err := p.PutStream("moved.bin", strings.NewReader("{}"), gospal.WithCacheControl("no-cache")); err != nil {
+		t.Errorf("PutStream() error = %v", err)
+		return
+	}
+	if err := p.DeletePrefix("m"); err != nil {
+		t.Errorf("DeletePrefix() error = %v", err)
+	}
+	if names, _ := readDirNames(tmpDirectory); len(names) != 0 {
+		t.Errorf("DeletePrefix() left %v", names)
+	}
+}
+
+func Test_provider_OverwriteWithoutPosixRename(t *testing.T) {
+	// the servers without the extension fail plain renames on existing targets
+	if err := sftp.SetSFTPExtensions("hardlink@openssh.com", "statvfs@openssh.com"); err != nil {
+		t.Fatalf("unable to set the sftp extensions for tests. err=%v", err.Error())
+	}
+	defer sftp.SetSFTPExtensions("hardlink@openssh.com", "posix-rename@openssh.com", "statvfs@openssh.com")
+	server := newTestServer(t)
+	defer server.Close()
+	p, tmpDirectory, cleanup := newTestProvider(t, server, &gospal.ProviderConfig{TimeOut: 300})
+	defer cleanup()
+
+	if _, err := p.PutStream("a/b.txt", strings.NewReader("first")); err != nil {
+		t.Errorf("PutStream() error = %v", err)
+		return
+	}
+	// the previous content is kept rather than removed before the rename
+	if _, err := p.PutStream("a/b.txt", strings.NewReader("second")); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("PutStream() error = %v, want %v", err, errors.ErrNotSupported)
+	}
+	if data, err := ioutil.ReadFile(path.Join(tmpDirectory, "a/b.txt")); err != nil || string(data) != "first" {
+		t.Errorf("a/b.txt got = %v, %v, want %v", string(data), err, "first")
+	}
+	if names, _ := readDirNames(path.Join(tmpDirectory, "a")); !reflect.DeepEqual(names, []string{"b.txt"}) {
+		t.Errorf("PutStream() left %v", names)
+	}
+	if _, err := p.PutStream("a/c.txt", strings.NewReader("third")); err != nil {
+		t.Errorf("PutStream() error = %v", err)
+	}
+	if err := p.Move("a/c.txt", "a/b.txt"); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("Move() error = %v, want %v", err, errors.ErrNotSupported)
+	}
+	// the attributes of a new key are persisted, they can not be replaced any more than the key
+	if _, err := p.PutStream("a/d.txt", strings.NewReader("fourth"), gospal.WithContentType("text/plain")); err != nil {
+		t.Errorf("PutStream() error = %v", err)
+		return
+	}
+	if _, err := p.PutStream("a/d.txt", strings.NewReader("fifth"), gospal.WithContentType("text/csv")); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("PutStream() error = %v, want %v", err, errors.ErrNotSupported)
+	}
+	if got, err := p.Stat("a/d.txt"); err != nil || got.ContentType != "text/plain" || got.Size != int64(len("fourth")) {
+		t.Errorf("Stat() got = %+v, %v, want the first put", got, err)
+	}
+}
+
+type failingReader struct{}
+
+func (r *failingReader) Read(b []byte) (int, error) {
+	return 0, stderrors.New("failing reader")
+}
+
+func Test_provider_GlobalPrefix(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	p, tmpDirectory, cleanup := newTestProvider(t, server, &gospal.ProviderConfig{TimeOut: 300, GlobalPrefix: "tenant"})
+	defer cleanup()
+
+	for _, file := range []string{"tenant/a.txt", "tenant/b/c.txt", "tenant2/d.txt", "e.txt"} {
+		if err := os.MkdirAll(path.Dir(path.Join(tmpDirectory, file)), 0700); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", file, err.Error())
+			return
+		}
+		if err := ioutil.WriteFile(path.Join(tmpDirectory, file), []byte(file), 0600); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", file, err.Error())
+			return
+		}
+	}
+
+	// the keys are relative to the global prefix, the sibling tenant2 is not listed
+	keys, err := p.ListKeys()
+	if err != nil {
+		t.Errorf("ListKeys() error = %v", err)
+		return
+	}
+	if want := []string{"a.txt", "b/c.txt"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("ListKeys() got = %v, want %v", keys, want)
+	}
+	gotKeys, gotPrefixes, err := p.ListDir("")
+	if err != nil || !reflect.DeepEqual(gotKeys, []string{"a.txt"}) || !reflect.DeepEqual(gotPrefixes, []string{"b/"}) {
+		t.Errorf("ListDir() got = %v, %v, %v", gotKeys, gotPrefixes, err)
+	}
+	// and can be fed back to the provider
+	for _, key := range keys {
+		reader, err := p.NewReader(context.Background(), key)
+		if err != nil {
+			t.Errorf("NewReader() error = %v", err)
+			continue
+		}
+		if data, _ := ioutil.ReadAll(reader); string(data) != "tenant/"+key {
+			t.Errorf("NewReader() got = %v, want %v", string(data), "tenant/"+key)
+		}
+		reader.Close()
+		if err := p.DeleteKey(key); err != nil {
+			t.Errorf("DeleteKey() error = %v", err)
+		}
+	}
+	if names, _ := readDirNames(tmpDirectory); !reflect.DeepEqual(names, []string{"e.txt", "tenant2"}) {
+		t.Errorf("DeleteKey() left %v", names)
+	}
+	if keys, err := p.ListKeys(); err != nil || len(keys) != 0 {
+		t.Errorf("ListKeys() got = %v, %v, want no keys", keys, err)
+	}
+}
+
+func Test_provider_InvalidKeys(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	p, tmpDirectory, cleanup := newTestProvider(t, server, &gospal.ProviderConfig{TimeOut: 300, GlobalPrefix: "tenant"})
+	defer cleanup()
+
+	for _, file := range []string{"tenant/a.txt", "tenant2/b.txt"} {
+		if err := os.MkdirAll(path.Dir(path.Join(tmpDirectory, file)), 0700); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", file, err.Error())
+			return
+		}
+		if err := ioutil.WriteFile(path.Join(tmpDirectory, file), []byte(file), 0600); err != nil {
+			t.Errorf("unable to create %v for tests. err=%v", file, err.Error())
+			return
+		}
+	}
+
+	for _, key := range []string{"../tenant2/b.txt", "a/../../tenant2/b.txt", "../../b.txt", "a\x00.txt"} {
+		t.Run(key, func(t *testing.T) {
+			if _, err := p.Stat(key); !stderrors.Is(err, errors.ErrInvalidKey) {
+				t.Errorf("Stat() error = %v, should be %v", err, errors.ErrInvalidKey)
+			}
+			if _, err := p.NewReader(context.Background(), key); !stderrors.Is(err, errors.ErrInvalidKey) {
+				t.Errorf("NewReader() error = %v, should be %v", err, errors.ErrInvalidKey)
+			}
+			if _, err := p.PutStream(key, strings.NewReader("overwritten")); !stderrors.Is(err, errors.ErrInvalidKey) {
+				t.Errorf("PutStream() error = %v, should be %v", err, errors.ErrInvalidKey)
+			}
+			if err := p.Move("a.txt", key); !stderrors.Is(err, errors.ErrInvalidKey) {
+				t.Errorf("Move() error = %v, should be %v", err, errors.ErrInvalidKey)
+			}
+			if err := p.DeleteKey(key); !stderrors.Is(err, errors.ErrInvalidKey) {
+				t.Errorf("DeleteKey() error = %v, should be %v", err, errors.ErrInvalidKey)
+			}
+		})
+	}
+	if _, err := p.ListKeys("../tenant2"); !stderrors.Is(err, errors.ErrInvalidKey) {
+		t.Errorf("ListKeys() error = %v, should be %v", err, errors.ErrInvalidKey)
+	}
+	if err := p.DeletePrefix("../"); !stderrors.Is(err, errors.ErrInvalidKey) {
+		t.Errorf("DeletePrefix() error = %v, should be %v", err, errors.ErrInvalidKey)
+	}
+	// nothing has been touched outside of the global prefix
+	if data, err := ioutil.ReadFile(path.Join(tmpDirectory, "tenant2/b.txt")); err != nil || string(data) != "tenant2/b.txt" {
+		t.Errorf("tenant2/b.txt got = %v, %v", string(data), err)
+	}
+}
+
+func TestConformance(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	gospaltest.RunConformance(t, func(t *testing.T) (gospal.Gospal, func()) {
+		p, _, cleanup := newTestProvider(t, server, &gospal.ProviderConfig{TimeOut: 300, MaxKeys: 2})
+		return p, cleanup
+	})
+}
+
+func TestConfigConformance(t *testing.T) {
+	server := newTestServer(t)
+	defer server.Close()
+	gospaltest.RunConfigConformance(t, func(t *testing.T, config *gospal.ProviderConfig) (gospal.Gospal, func()) {
+		config.TimeOut = 300
+		p, _, cleanup := newTestProvider(t, server, config)
+		return p, cleanup
+	})
+}
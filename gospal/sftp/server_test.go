@@ -0,0 +1,153 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package sftpprovider
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"io"
+	"net"
+	"sync"
+	"testing"
+)
+
+const (
+	testUser     = "gospal"
+	testPassword = "secret"
+)
+
+// testServer is an in-process ssh server serving the sftp subsystem over the file system of the process, the remote
+// paths being the local ones
+type testServer struct {
+	listener   net.Listener
+	hostKey    ssh.PublicKey
+	privateKey []byte
+	wg         sync.WaitGroup
+}
+
+// newKey returns a new PEM encoded private key, along with its signer
+func newKey(t *testing.T) ([]byte, ssh.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unable to generate key for tests. err=%v", err.Error())
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unable to marshal key for tests. err=%v", err.Error())
+	}
+	signer, err := ssh.NewSignerFromKey(key)
+	if err != nil {
+		t.Fatalf("unable to create signer for tests. err=%v", err.Error())
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), signer
+}
+
+// newTestServer starts a server accepting the test user, either by password or by private key
+func newTestServer(t *testing.T) *testServer {
+	_, hostSigner := newKey(t)
+	privateKey, userSigner := newKey(t)
+	userKey := userSigner.PublicKey().Marshal()
+
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if conn.User() == testUser && string(password) == testPassword {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("password rejected for %v", conn.User())
+		},
+		PublicKeyCallback: func(conn ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if conn.User() == testUser && string(key.Marshal()) == string(userKey) {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("public key rejected for %v", conn.User())
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("unable to listen for tests. err=%v", err.Error())
+	}
+	s := &testServer{listener: listener, hostKey: hostSigner.PublicKey(), privateKey: privateKey}
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn, config)
+		}
+	}()
+	return s
+}
+
+func (s *testServer) serve(conn net.Conn, config *ssh.ServerConfig) {
+	defer conn.Close()
+	_, channels, requests, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		return
+	}
+	go ssh.DiscardRequests(requests)
+	for newChannel := range channels {
+		if newChannel.ChannelType() != "session" {
+			newChannel.Reject(ssh.UnknownChannelType, "unknown channel type")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			return
+		}
+		go func(in <-chan *ssh.Request) {
+			for req := range in {
+				// only the sftp subsystem is served
+				ok := req.Type == "subsystem" && string(req.Payload[4:]) == "sftp"
+				req.Reply(ok, nil)
+			}
+		}(requests)
+		go func() {
+			defer channel.Close()
+			server, err := sftp.NewServer(channel)
+			if err != nil {
+				return
+			}
+			if err := server.Serve(); err == io.EOF {
+				server.Close()
+			}
+		}()
+	}
+}
+
+// config returns the configuration of the test user authenticating by password
+func (s *testServer) config() *Config {
+	return &Config{
+		Addr:            s.listener.Addr().String(),
+		User:            testUser,
+		Password:        testPassword,
+		HostKeyCallback: ssh.FixedHostKey(s.hostKey),
+	}
+}
+
+func (s *testServer) Close() {
+	s.listener.Close()
+	s.wg.Wait()
+}
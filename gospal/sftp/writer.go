@@ -0,0 +1,76 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package sftpprovider
+
+import (
+	"context"
+	"github.com/contentsquare/gospal/gospal"
+	"github.com/contentsquare/gospal/gospal/errors"
+	"github.com/contentsquare/gospal/gospal/internal/fsutil"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+func (fs fileSystem) CreateNew(filePath string) (fsutil.File, error) {
+	return fs.p.client.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+}
+
+func (fs fileSystem) MkdirAll(dir string) error {
+	return fs.p.client.MkdirAll(dir)
+}
+
+func (fs fileSystem) Rename(oldPath string, newPath string) error {
+	return fs.p.rename(oldPath, newPath)
+}
+
+func (fs fileSystem) Remove(filePath string) error {
+	return fs.p.client.Remove(filePath)
+}
+
+func (fs fileSystem) ReadFile(filePath string) ([]byte, error) {
+	fh, err := fs.p.client.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+	return ioutil.ReadAll(fh)
+}
+
+// rename moves the file to the target path, replacing it. The replacement is atomic on servers supporting the
+// posix-rename@openssh.com extension, such as OpenSSH. Depending on the server, plain sftp renames either fail on
+// existing targets or replace them, not necessarily atomically: overwrites are not supported without the extension,
+// the ones of the sidecars included
+func (p *provider) rename(oldPath string, newPath string) error {
+	if _, ok := p.client.HasExtension("posix-rename@openssh.com"); ok {
+		return p.client.PosixRename(oldPath, newPath)
+	}
+	if info, err := p.client.Stat(newPath); err == nil && !info.IsDir() {
+		return errors.ErrorNotSupported("Overwrite without posix-rename@openssh.com", p.kind)
+	}
+	return p.client.Rename(oldPath, newPath)
+}
+
+func (p *provider) NewWriter(ctx context.Context, fileName string, opts ...gospal.PutOption) (io.WriteCloser, error) {
+	return p.newFileWriter(ctx, fileName, opts...)
+}
+
+func (p *provider) newFileWriter(ctx context.Context, fileName string, opts ...gospal.PutOption) (*fsutil.Writer, error) {
+	filePath, err := p.keyPath(fileName)
+	if err != nil {
+		return nil, errors.ErrorPutStreamReader(fileName, err)
+	}
+	return fsutil.NewWriter(ctx, fileSystem{p}, filePath, gospal.NewPutOptions(opts...), toError)
+}
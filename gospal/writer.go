@@ -0,0 +1,57 @@
+//  Copyright 2019 Contentsquare
+//
+//  Licensed under the Apache License, Version 2.0 (the "License");
+//  you may not use this file except in compliance with the License.
+//  You may obtain a copy of the License at
+//
+//      https://www.apache.org/licenses/LICENSE-2.0
+//
+//  Unless required by applicable law or agreed to in writing, software
+//  distributed under the License is distributed on an "AS IS" BASIS,
+//  WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//  See the License for the specific language governing permissions and
+//  limitations under the License.
+
+package gospal
+
+import (
+	"context"
+	"io"
+)
+
+// pipeWriter streams what is written to it to the upload through a pipe, the upload being run by a goroutine
+type pipeWriter struct {
+	writer *io.PipeWriter
+	cancel context.CancelFunc
+	done   chan struct{}
+	err    error
+}
+
+// NewPipeWriter returns an io.WriteCloser which content is read by upload, run in its own goroutine. It is meant
+// for the providers uploading readers, to implement NewWriter. When upload fails the pending and following writes
+// return its error, and so does Close, which otherwise waits for upload to complete
+func NewPipeWriter(ctx context.Context, upload func(context.Context, io.Reader) error) io.WriteCloser {
+	ctx, cancel := context.WithCancel(ctx)
+	reader, writer := io.Pipe()
+	w := &pipeWriter{writer: writer, cancel: cancel, done: make(chan struct{})}
+	go func() {
+		defer close(w.done)
+		if err := upload(ctx, reader); err != nil {
+			w.err = err
+			// unblock the pending and following writes
+			reader.CloseWithError(err)
+		}
+	}()
+	return w
+}
+
+func (w *pipeWriter) Write(b []byte) (int, error) {
+	return w.writer.Write(b)
+}
+
+func (w *pipeWriter) Close() error {
+	w.writer.Close()
+	<-w.done
+	w.cancel()
+	return w.err
+}